@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"sava-s3-export/internal/audit"
+	"sava-s3-export/internal/database"
+)
+
+// newAuditCmd groups the subcommands that work with the AUDIT_LOG_PATH log
+func newAuditCmd(flags *globalFlags) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Inspect the audit log",
+	}
+
+	cmd.AddCommand(newAuditVerifyCmd(flags))
+
+	return cmd
+}
+
+func newAuditVerifyCmd(flags *globalFlags) *cobra.Command {
+	var file string
+
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Cross-check the audit log against the sync database",
+		Long: "Compare the last audit entry of every key with its database record and list\n" +
+			"downloads missing from either, and records whose ETag or outcome differs.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := flags.loadConfig()
+			if err != nil {
+				return err
+			}
+			if file == "" {
+				file = cfg.AUDIT_LOG_PATH
+			}
+			if file == "" {
+				return errors.New("no audit log: set AUDIT_LOG_PATH or pass --file")
+			}
+
+			f, err := os.Open(file)
+			if err != nil {
+				return fmt.Errorf("failed to open %s: %w", file, err)
+			}
+			defer f.Close()
+
+			db, err := database.OpenParquetDB(cfg.DB_PATH, cfg.BATCH_SIZE, cfg.PARTITION_BY_DATE)
+			if err != nil {
+				return fmt.Errorf("failed to open database: %w", err)
+			}
+			records, err := db.ReadAllRecords(cmd.Context())
+			if err != nil {
+				return fmt.Errorf("failed to read database: %w", err)
+			}
+
+			found, entries, err := audit.Verify(f, records)
+			if err != nil {
+				return fmt.Errorf("failed to verify %s: %w", file, err)
+			}
+
+			out := cmd.OutOrStdout()
+			if flags.output == outputJSON {
+				if found == nil {
+					found = []audit.Discrepancy{}
+				}
+				err = writeJSON(out, struct {
+					Entries       int                 `json:"entries"`
+					Discrepancies []audit.Discrepancy `json:"discrepancies"`
+				}{entries, found})
+			} else {
+				tw := newTable(out)
+				fmt.Fprintln(tw, "KIND\tS3 KEY\tAUDIT ETAG\tDB ETAG\tAUDIT STATUS\tDB STATUS")
+				for _, d := range found {
+					fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", d.Kind, d.S3Key,
+						orDash(d.AuditETag), orDash(d.DBETag), orDash(d.AuditStatus), orDash(d.DBStatus))
+				}
+				err = tw.Flush()
+				fmt.Fprintf(out, "Checked %d audit entries against %d records\n", entries, len(records))
+			}
+			if err != nil {
+				return err
+			}
+			if len(found) > 0 {
+				return fmt.Errorf("found %d discrepancies between %s and the database", len(found), file)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&file, "file", "", "audit log to verify (default AUDIT_LOG_PATH)")
+
+	return cmd
+}
+
+// orDash returns s, or "-" when it is empty
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
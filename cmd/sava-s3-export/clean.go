@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"sava-s3-export/internal/database"
+)
+
+func newCleanCmd(flags *globalFlags) *cobra.Command {
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "clean",
+		Short: "Remove local files that are not tracked in the sync database",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := flags.loadConfig()
+			if err != nil {
+				return err
+			}
+
+			db, err := database.OpenParquetDB(cfg.DB_PATH, cfg.BATCH_SIZE, cfg.PARTITION_BY_DATE)
+			if err != nil {
+				return fmt.Errorf("failed to open database: %w", err)
+			}
+
+			records, err := db.ReadAllRecords(cmd.Context())
+			if err != nil {
+				return fmt.Errorf("failed to read database: %w", err)
+			}
+
+			tracked := make(map[string]struct{}, len(records))
+			for _, r := range records {
+				tracked[filepath.Clean(r.LocalPath)] = struct{}{}
+			}
+
+			var orphans []string
+			err = filepath.WalkDir(cfg.LOCAL_DIR, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				// Downloads in progress; stale ones are removed by the syncer
+				if d.IsDir() && filepath.Clean(path) == filepath.Clean(cfg.StagingDir()) {
+					return filepath.SkipDir
+				}
+				if !d.Type().IsRegular() {
+					return nil
+				}
+				if _, ok := tracked[filepath.Clean(path)]; !ok {
+					orphans = append(orphans, path)
+				}
+				return nil
+			})
+			if err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to scan %s: %w", cfg.LOCAL_DIR, err)
+			}
+
+			if !dryRun {
+				for _, path := range orphans {
+					if err := os.Remove(path); err != nil {
+						return fmt.Errorf("failed to remove %s: %w", path, err)
+					}
+				}
+			}
+
+			out := cmd.OutOrStdout()
+			if flags.output == outputJSON {
+				if orphans == nil {
+					orphans = []string{}
+				}
+				return writeJSON(out, struct {
+					DryRun  bool     `json:"dry_run"`
+					Removed []string `json:"removed"`
+				}{dryRun, orphans})
+			}
+
+			for _, path := range orphans {
+				fmt.Fprintln(out, path)
+			}
+			if dryRun {
+				fmt.Fprintf(out, "Would remove %d orphan files\n", len(orphans))
+			} else {
+				fmt.Fprintf(out, "Removed %d orphan files\n", len(orphans))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "only print the files that would be removed")
+
+	return cmd
+}
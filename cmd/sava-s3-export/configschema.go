@@ -0,0 +1,23 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"sava-s3-export/internal/config"
+)
+
+func newConfigSchemaCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "config-schema",
+		Short: "Print the JSON Schema of the JSON config file",
+		Long: "Print the JSON Schema of the file read by --config, CONFIG_FILE or\n" +
+			"./sava-config.json, so an editor can validate and complete it, e.g.\n" +
+			"  sava-s3-export config-schema > config.schema.json\n" +
+			"and \"$schema\": \"./config.schema.json\" in the config file.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, err := cmd.OutOrStdout().Write(config.JSONSchema())
+			return err
+		},
+	}
+}
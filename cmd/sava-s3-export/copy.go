@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"sava-s3-export/internal/aws"
+	"sava-s3-export/internal/database"
+)
+
+// statusCopied marks a record moved to the destination key by the copy subcommand
+const statusCopied = "copied"
+
+// copyResult is the JSON output of the copy subcommand
+type copyResult struct {
+	From          string `json:"from"`
+	To            string `json:"to"`
+	RecordUpdated bool   `json:"record_updated"`
+}
+
+func newCopyCmd(flags *globalFlags) *cobra.Command {
+	var from, to string
+
+	cmd := &cobra.Command{
+		Use:   "copy",
+		Short: "Copy an object to another key in S3_BUCKET and move its record there",
+		Long: "Copy the object at --from to --to within S3_BUCKET without downloading it;\n" +
+			"objects over 5 GB are copied in parts. When --from is in the database its\n" +
+			"record is then moved to --to with status \"copied\", so the next sync treats\n" +
+			"--from as a new object unless it is deleted.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if from == to {
+				return errors.New("--from and --to must differ")
+			}
+			cfg, err := flags.loadConfig()
+			if err != nil {
+				return err
+			}
+
+			unlock, err := lockDatabase(cfg)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+
+			db, err := database.OpenParquetDB(cfg.DB_PATH, cfg.BATCH_SIZE, cfg.PARTITION_BY_DATE)
+			if err != nil {
+				return fmt.Errorf("failed to open database: %w", err)
+			}
+			client, err := aws.NewS3Client(cfg)
+			if err != nil {
+				return fmt.Errorf("failed to create S3 client: %w", err)
+			}
+			defer client.Close()
+			if err := client.CopyObject(cmd.Context(), from, to); err != nil {
+				return err
+			}
+
+			result := copyResult{From: from, To: to, RecordUpdated: true}
+			_, err = db.RenameRecord(cmd.Context(), from, to, statusCopied)
+			if errors.Is(err, database.ErrRecordNotFound) {
+				result.RecordUpdated = false
+			} else if err != nil {
+				return fmt.Errorf("copied %s to %s but failed to update its record: %w", from, to, err)
+			}
+
+			out := cmd.OutOrStdout()
+			if flags.output == outputJSON {
+				return writeJSON(out, result)
+			}
+			fmt.Fprintf(out, "Copied s3://%s/%s to s3://%s/%s\n", cfg.S3_BUCKET, from, cfg.S3_BUCKET, to)
+			if !result.RecordUpdated {
+				fmt.Fprintf(out, "%s is not in the sync database, no record was updated\n", from)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&from, "from", "", "S3 key of the object to copy")
+	cmd.Flags().StringVar(&to, "to", "", "S3 key to copy it to")
+	cmd.MarkFlagRequired("from")
+	cmd.MarkFlagRequired("to")
+
+	return cmd
+}
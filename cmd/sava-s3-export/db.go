@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"sava-s3-export/internal/database"
+)
+
+// newDBCmd groups the subcommands that maintain the sync database
+func newDBCmd(flags *globalFlags) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "db",
+		Short: "Maintain the sync database",
+	}
+
+	cmd.AddCommand(
+		newDBImportCmd(flags),
+		newDBStatsCmd(flags),
+		newDBResetCmd(flags),
+	)
+
+	return cmd
+}
+
+func newDBImportCmd(flags *globalFlags) *cobra.Command {
+	var format, file, onConflict string
+
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Import records from a file exported by another sync tool",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "csv" {
+				return fmt.Errorf("invalid --format %q: only csv is supported", format)
+			}
+
+			cfg, err := flags.loadConfig()
+			if err != nil {
+				return err
+			}
+
+			f, err := os.Open(file)
+			if err != nil {
+				return fmt.Errorf("failed to open %s: %w", file, err)
+			}
+			defer f.Close()
+
+			unlock, err := lockDatabase(cfg)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+
+			db, err := database.OpenParquetDB(cfg.DB_PATH, cfg.BATCH_SIZE, cfg.PARTITION_BY_DATE)
+			if err != nil {
+				return fmt.Errorf("failed to open database: %w", err)
+			}
+
+			n, err := db.ImportFromCSVOnConflict(cmd.Context(), f, onConflict)
+			if err != nil {
+				return fmt.Errorf("failed to import %s: %w", file, err)
+			}
+
+			out := cmd.OutOrStdout()
+			if flags.output == outputJSON {
+				return writeJSON(out, map[string]int{"imported": n})
+			}
+			fmt.Fprintf(out, "Imported %d records from %s\n", n, file)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", "csv", "format of the import file: csv")
+	cmd.Flags().StringVar(&file, "file", "", "path of the file to import")
+	cmd.Flags().StringVar(&onConflict, "on-conflict", database.OnConflictOverwrite, "what to do with keys already in the database: overwrite, skip or error")
+	cmd.MarkFlagRequired("file")
+
+	return cmd
+}
+
+func newDBStatsCmd(flags *globalFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "stats",
+		Short: "Print record counts by status and the database's disk usage",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := flags.loadConfig()
+			if err != nil {
+				return err
+			}
+
+			db, err := database.OpenParquetDB(cfg.DB_PATH, cfg.BATCH_SIZE, cfg.PARTITION_BY_DATE)
+			if err != nil {
+				return fmt.Errorf("failed to open database: %w", err)
+			}
+
+			stats, err := db.Stats(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			if flags.output == outputJSON {
+				return writeJSON(out, stats)
+			}
+
+			tw := newTable(out)
+			fmt.Fprintf(tw, "Total records\t%d\n", stats.TotalRecords)
+			fmt.Fprintf(tw, "Database size\t%d bytes\n", stats.FileSizeBytes)
+			fmt.Fprintf(tw, "Tracked bytes\t%d\n", stats.TotalTrackedBytes)
+			fmt.Fprintf(tw, "Oldest record\t%s\n", formatTime(stats.OldestRecord))
+			fmt.Fprintf(tw, "Newest record\t%s\n", formatTime(stats.NewestRecord))
+
+			statuses := make([]string, 0, len(stats.ByStatus))
+			for status := range stats.ByStatus {
+				statuses = append(statuses, status)
+			}
+			sort.Strings(statuses)
+
+			fmt.Fprintln(tw, "\nSTATUS\tCOUNT")
+			for _, status := range statuses {
+				fmt.Fprintf(tw, "%s\t%d\n", status, stats.ByStatus[status])
+			}
+			return tw.Flush()
+		},
+	}
+}
+
+func newDBResetCmd(flags *globalFlags) *cobra.Command {
+	var yes bool
+	var status string
+
+	cmd := &cobra.Command{
+		Use:   "reset",
+		Short: "Back up the database and start a new one, or forget the records with --status",
+		Long: `Without --status, moves DB_PATH to DB_PATH.bak, replacing any earlier
+backup, and creates an empty database, so the next sync downloads every file
+again. It asks for confirmation unless --yes is given.
+
+With --status, only the records with that status are removed, e.g.
+--status=failed, so the next sync retries those files. Other records are
+kept, so no confirmation is needed.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := flags.loadConfig()
+			if err != nil {
+				return err
+			}
+
+			if status == "" && !yes {
+				ok, err := confirm(cmd, fmt.Sprintf("Reset %s? Every file will be downloaded again [y/N] ", cfg.DB_PATH))
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return fmt.Errorf("reset cancelled")
+				}
+			}
+
+			unlock, err := lockDatabase(cfg)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+
+			db, err := database.OpenParquetDB(cfg.DB_PATH, cfg.BATCH_SIZE, cfg.PARTITION_BY_DATE)
+			if err != nil {
+				return fmt.Errorf("failed to open database: %w", err)
+			}
+
+			out := cmd.OutOrStdout()
+			if status != "" {
+				n, err := db.ResetStatus(cmd.Context(), status)
+				if err != nil {
+					return err
+				}
+				if flags.output == outputJSON {
+					return writeJSON(out, map[string]any{"status": status, "removed": n})
+				}
+				fmt.Fprintf(out, "Removed %d %s records from %s\n", n, status, cfg.DB_PATH)
+				return nil
+			}
+
+			backup, err := db.ResetWithBackup()
+			if err != nil {
+				return err
+			}
+			if flags.output == outputJSON {
+				return writeJSON(out, map[string]string{"database": cfg.DB_PATH, "backup": backup})
+			}
+			if backup == "" {
+				fmt.Fprintf(out, "Database %s has been reset\n", cfg.DB_PATH)
+			} else {
+				fmt.Fprintf(out, "Database %s has been reset, the old one is kept as %s\n", cfg.DB_PATH, backup)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&yes, "yes", false, "reset without asking for confirmation")
+	cmd.Flags().StringVar(&status, "status", "", "only remove the records with this status, e.g. failed")
+
+	return cmd
+}
+
+// confirm asks question on stderr and reports whether the answer read from
+// stdin is yes
+func confirm(cmd *cobra.Command, question string) (bool, error) {
+	fmt.Fprint(cmd.ErrOrStderr(), question)
+	answer, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+	if err != nil && answer == "" {
+		return false, fmt.Errorf("failed to read confirmation: %w", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"sava-s3-export/internal/syncer"
+)
+
+func newDeadLetterCmd(flags *globalFlags) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dead-letter",
+		Short: "Manage files that exhausted their download retries",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "requeue",
+		Short: "Reset dead-lettered files to pending so the next sync retries them",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := flags.loadConfig()
+			if err != nil {
+				return err
+			}
+
+			unlock, err := lockDatabase(cfg)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+
+			s, err := syncer.NewSyncer(cfg)
+			if err != nil {
+				return fmt.Errorf("failed to create syncer: %w", err)
+			}
+			defer s.Close()
+
+			n, err := s.RequeueDeadLetters(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			if flags.output == outputJSON {
+				return writeJSON(cmd.OutOrStdout(), struct {
+					Requeued int `json:"requeued"`
+				}{n})
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Requeued %d files\n", n)
+			return nil
+		},
+	})
+
+	return cmd
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"sava-s3-export/internal/aws"
+	"sava-s3-export/internal/database"
+)
+
+// statusDeletedFromS3 marks a record whose object was removed by the delete subcommand
+const statusDeletedFromS3 = "deleted_from_s3"
+
+// deleteResult is the JSON output of the delete subcommand
+type deleteResult struct {
+	Key          string `json:"key"`
+	LocalPath    string `json:"local_path"`
+	DeletedLocal bool   `json:"deleted_local"`
+	DryRun       bool   `json:"dry_run"`
+}
+
+func newDeleteCmd(flags *globalFlags) *cobra.Command {
+	var key string
+	var deleteLocal, dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "delete",
+		Short: "Delete a downloaded file from S3 and mark its record deleted_from_s3",
+		Long: "Delete the object of a downloaded file from S3 and mark its database record\n" +
+			"\"deleted_from_s3\". The key must be in the database with status \"downloaded\".\n" +
+			"The local copy is kept unless --delete-local is given.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := flags.loadConfig()
+			if err != nil {
+				return err
+			}
+
+			unlock, err := lockDatabase(cfg)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+
+			db, err := database.OpenParquetDB(cfg.DB_PATH, cfg.BATCH_SIZE, cfg.PARTITION_BY_DATE)
+			if err != nil {
+				return fmt.Errorf("failed to open database: %w", err)
+			}
+			records, err := db.ReadAllRecords(cmd.Context())
+			if err != nil {
+				return fmt.Errorf("failed to read database: %w", err)
+			}
+			record, ok := records[key]
+			if !ok {
+				return fmt.Errorf("%s is not in the sync database", key)
+			}
+			if record.SyncStatus != "downloaded" {
+				return fmt.Errorf("%s has status %q, not \"downloaded\"", key, record.SyncStatus)
+			}
+
+			result := deleteResult{Key: key, LocalPath: record.LocalPath, DeletedLocal: deleteLocal, DryRun: dryRun}
+			if !dryRun {
+				client, err := aws.NewS3Client(cfg)
+				if err != nil {
+					return fmt.Errorf("failed to create S3 client: %w", err)
+				}
+				defer client.Close()
+				if err := client.DeleteFile(cmd.Context(), key); err != nil {
+					return err
+				}
+				if err := db.UpdateSyncStatus(key, record.ETag, record.LocalPath, statusDeletedFromS3, time.Unix(record.LastModified, 0)); err != nil {
+					return fmt.Errorf("deleted %s from S3 but failed to update its record: %w", key, err)
+				}
+				if deleteLocal {
+					if err := os.Remove(record.LocalPath); err != nil && !os.IsNotExist(err) {
+						return fmt.Errorf("failed to remove %s: %w", record.LocalPath, err)
+					}
+				}
+			}
+
+			out := cmd.OutOrStdout()
+			if flags.output == outputJSON {
+				return writeJSON(out, result)
+			}
+			verb := "Deleted"
+			if dryRun {
+				verb = "Would delete"
+			}
+			fmt.Fprintf(out, "%s s3://%s/%s\n", verb, cfg.S3_BUCKET, key)
+			if deleteLocal {
+				fmt.Fprintf(out, "%s %s\n", verb, record.LocalPath)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&key, "key", "", "S3 key of the downloaded file to delete")
+	cmd.Flags().BoolVar(&deleteLocal, "delete-local", false, "also remove the local copy")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "print what would be deleted without deleting it")
+	cmd.MarkFlagRequired("key")
+
+	return cmd
+}
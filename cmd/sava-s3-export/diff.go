@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"sava-s3-export/internal/syncer"
+)
+
+func newDiffCmd(flags *globalFlags) *cobra.Command {
+	var summary bool
+
+	cmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Compare the objects in S3 with the sync database",
+		Long: "Reconcile S3 with the sync database without downloading anything: objects\n" +
+			"not in the database (new), objects whose ETag changed (modified), records\n" +
+			"whose object is gone (deleted from S3) and downloaded records whose local\n" +
+			"file is gone (missing locally). Unlike list-remote, every record is\n" +
+			"considered, and MODIFIED_AFTER is ignored.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := flags.loadConfig()
+			if err != nil {
+				return err
+			}
+
+			s, err := syncer.NewInspector(cfg)
+			if err != nil {
+				return fmt.Errorf("failed to create syncer: %w", err)
+			}
+			defer s.Close()
+
+			diff, err := s.Diff(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			if flags.output == outputJSON {
+				return writeJSON(out, diff)
+			}
+
+			sets := []struct {
+				state string
+				keys  []string
+			}{
+				{"new", diff.New},
+				{"modified", diff.Modified},
+				{"deleted from S3", diff.DeletedFromS3},
+				{"missing locally", diff.MissingLocally},
+			}
+			tw := newTable(out)
+			fmt.Fprintln(tw, "STATE\tCOUNT")
+			for _, set := range sets {
+				fmt.Fprintf(tw, "%s\t%d\n", set.state, len(set.keys))
+			}
+			if !summary {
+				fmt.Fprintln(tw, "\nS3 KEY\tSTATE")
+				for _, set := range sets {
+					for _, key := range set.keys {
+						fmt.Fprintf(tw, "%s\t%s\n", key, set.state)
+					}
+				}
+			}
+			return tw.Flush()
+		},
+	}
+
+	cmd.Flags().BoolVar(&summary, "summary", false, "only print the count of each state, not the keys")
+
+	return cmd
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"sava-s3-export/internal/aws"
+	"sava-s3-export/internal/database"
+)
+
+// downloadResult is the JSON output of the download subcommand
+type downloadResult struct {
+	Key       string `json:"key"`
+	VersionID string `json:"version_id,omitempty"`
+	LocalPath string `json:"local_path"`
+	Size      int64  `json:"size"`
+	RecordKey string `json:"record_key"`
+}
+
+func newDownloadCmd(flags *globalFlags) *cobra.Command {
+	var key, versionID, dest string
+
+	cmd := &cobra.Command{
+		Use:   "download",
+		Short: "Download one object, or one version of it, and record it",
+		Long: "Download the latest version of --key, or the version --version-id, and\n" +
+			"upsert its record with the version ID. The latest version goes where a sync\n" +
+			"would put it without PATH_TEMPLATE and is recorded under the key; a specific\n" +
+			"version gets \"#<version ID>\" appended to both, so each version downloaded\n" +
+			"keeps its own record. Use list-versions to find the version IDs.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := flags.loadConfig()
+			if err != nil {
+				return err
+			}
+
+			unlock, err := lockDatabase(cfg)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+
+			db, err := database.OpenParquetDB(cfg.DB_PATH, cfg.BATCH_SIZE, cfg.PARTITION_BY_DATE)
+			if err != nil {
+				return fmt.Errorf("failed to open database: %w", err)
+			}
+			client, err := aws.NewS3Client(cfg)
+			if err != nil {
+				return fmt.Errorf("failed to create S3 client: %w", err)
+			}
+			defer client.Close()
+
+			recordKey := key
+			localPath := dest
+			if localPath == "" {
+				localPath = filepath.Join(cfg.LOCAL_DIR, strings.TrimPrefix(key, cfg.S3_PREFIX))
+			}
+			if versionID != "" {
+				recordKey = database.VersionedKey(key, versionID)
+				if dest == "" {
+					localPath += "#" + versionID
+				}
+			}
+
+			info, err := client.DownloadVersion(cmd.Context(), key, versionID, localPath)
+			if err != nil {
+				return err
+			}
+			err = db.PutRecord(cmd.Context(), database.FileRecord{
+				S3Key:         recordKey,
+				ETag:          info.ETag,
+				LastModified:  info.LastModified.Unix(),
+				SyncStatus:    "downloaded",
+				LocalPath:     localPath,
+				LastSyncedAt:  time.Now().Unix(),
+				FileSizeBytes: info.Size,
+				VersionID:     info.VersionID,
+			})
+			if err != nil {
+				return fmt.Errorf("downloaded %s but failed to record it: %w", key, err)
+			}
+
+			out := cmd.OutOrStdout()
+			if flags.output == outputJSON {
+				return writeJSON(out, downloadResult{Key: key, VersionID: info.VersionID, LocalPath: localPath, Size: info.Size, RecordKey: recordKey})
+			}
+			fmt.Fprintf(out, "Downloaded s3://%s/%s to %s (%d bytes)\n", cfg.S3_BUCKET, key, localPath, info.Size)
+			if info.VersionID != "" {
+				fmt.Fprintf(out, "Version %s recorded as %s\n", info.VersionID, recordKey)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&key, "key", "", "S3 key of the object to download")
+	cmd.Flags().StringVar(&versionID, "version-id", "", "version to download instead of the latest")
+	cmd.Flags().StringVar(&dest, "dest", "", "local path to download to instead of under LOCAL_DIR")
+	cmd.MarkFlagRequired("key")
+
+	return cmd
+}
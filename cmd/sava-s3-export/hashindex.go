@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"sava-s3-export/internal/database"
+	"sava-s3-export/internal/index"
+)
+
+func newHashIndexCmd(flags *globalFlags) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "hash-index",
+		Short: "Maintain the HASH_INDEX_PATH index of DEDUPLICATE_DOWNLOADS",
+	}
+
+	cmd.AddCommand(newHashIndexRebuildCmd(flags))
+
+	return cmd
+}
+
+func newHashIndexRebuildCmd(flags *globalFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "rebuild",
+		Short: "Rebuild the hash index from the downloaded records",
+		Long: "Replace the contents of HASH_INDEX_PATH with the content hash and local path\n" +
+			"of every \"downloaded\" record in the database, for an index that was lost or\n" +
+			"has gone stale. The index cannot be rebuilt while a sync has it open.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := flags.loadConfig()
+			if err != nil {
+				return err
+			}
+			if cfg.HASH_INDEX_PATH == "" {
+				return errors.New("HASH_INDEX_PATH is not set")
+			}
+
+			db, err := database.OpenParquetDB(cfg.DB_PATH, cfg.BATCH_SIZE, cfg.PARTITION_BY_DATE)
+			if err != nil {
+				return fmt.Errorf("failed to open database: %w", err)
+			}
+			paths := make(map[string]string)
+			err = db.ScanRecords(cmd.Context(), func(r database.FileRecord) error {
+				if r.SyncStatus == "downloaded" && r.ContentHash != "" {
+					paths[r.ContentHash] = r.LocalPath
+				}
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("failed to read database: %w", err)
+			}
+
+			idx, err := index.OpenContentHashIndex(cfg.HASH_INDEX_PATH)
+			if err != nil {
+				return err
+			}
+			defer idx.Close()
+			if err := idx.Rebuild(paths); err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			if flags.output == outputJSON {
+				return writeJSON(out, map[string]int{"indexed": len(paths)})
+			}
+			fmt.Fprintf(out, "Indexed %d content hashes in %s\n", len(paths), cfg.HASH_INDEX_PATH)
+			return nil
+		},
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"sava-s3-export/internal/syncer"
+)
+
+// healthResult is the JSON output of the health subcommand
+type healthResult struct {
+	Healthy bool     `json:"healthy"`
+	Errors  []string `json:"errors"`
+}
+
+func newHealthCmd(flags *globalFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "health",
+		Short: "Check S3 access, local directories and free disk space",
+		Long: "Run the checks made before every sync: that S3_BUCKET can be reached with the\n" +
+			"configured credentials, that LOCAL_DIR and the directory of DB_PATH are\n" +
+			"writable, and that LOCAL_DIR has at least MIN_FREE_BYTES free. Exits with an\n" +
+			"error if any check fails.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := flags.loadConfig()
+			if err != nil {
+				return err
+			}
+
+			s, err := syncer.NewInspector(cfg)
+			if err != nil {
+				return fmt.Errorf("failed to create syncer: %w", err)
+			}
+			defer s.Close()
+
+			result := healthResult{Healthy: true, Errors: []string{}}
+			checkErr := s.HealthCheck(cmd.Context())
+			if checkErr != nil {
+				result.Healthy = false
+				if joined, ok := checkErr.(interface{ Unwrap() []error }); ok {
+					for _, e := range joined.Unwrap() {
+						result.Errors = append(result.Errors, e.Error())
+					}
+				} else {
+					result.Errors = append(result.Errors, checkErr.Error())
+				}
+			}
+
+			out := cmd.OutOrStdout()
+			if flags.output == outputJSON {
+				if err := writeJSON(out, result); err != nil {
+					return err
+				}
+			} else if result.Healthy {
+				fmt.Fprintln(out, "All health checks passed")
+			} else {
+				for _, e := range result.Errors {
+					fmt.Fprintf(out, "FAIL  %s\n", e)
+				}
+			}
+
+			if !result.Healthy {
+				return errors.New("health check failed")
+			}
+			return nil
+		},
+	}
+}
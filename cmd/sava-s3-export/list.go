@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"sava-s3-export/internal/database"
+)
+
+func newListCmd(flags *globalFlags) *cobra.Command {
+	var status, since string
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List records in the sync database",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var sinceTime time.Time
+			if since != "" {
+				t, err := parseSince(since, time.Now())
+				if err != nil {
+					return err
+				}
+				sinceTime = t
+			}
+
+			cfg, err := flags.loadConfig()
+			if err != nil {
+				return err
+			}
+
+			db, err := database.OpenParquetDB(cfg.DB_PATH, cfg.BATCH_SIZE, cfg.PARTITION_BY_DATE)
+			if err != nil {
+				return fmt.Errorf("failed to open database: %w", err)
+			}
+
+			records, err := db.ReadAllRecords(cmd.Context())
+			if err != nil {
+				return fmt.Errorf("failed to read database: %w", err)
+			}
+
+			var matched []database.FileRecord
+			for _, r := range records {
+				if status != "" && r.SyncStatus != status {
+					continue
+				}
+				if !sinceTime.IsZero() && time.Unix(r.LastSyncedAt, 0).Before(sinceTime) {
+					continue
+				}
+				matched = append(matched, r)
+			}
+			sort.Slice(matched, func(i, j int) bool { return matched[i].S3Key < matched[j].S3Key })
+
+			out := cmd.OutOrStdout()
+			if flags.output == outputJSON {
+				if matched == nil {
+					matched = []database.FileRecord{}
+				}
+				return writeJSON(out, matched)
+			}
+
+			tw := newTable(out)
+			fmt.Fprintln(tw, "S3 KEY\tSTATUS\tETAG\tLAST SYNCED\tLOCAL PATH\tERRORS\tLAST ERROR")
+			for _, r := range matched {
+				lastError := r.LastError
+				if lastError == "" {
+					lastError = "-"
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n", r.S3Key, r.SyncStatus, r.ETag,
+					time.Unix(r.LastSyncedAt, 0).UTC().Format(time.RFC3339), r.LocalPath, r.ErrorCount, lastError)
+			}
+			return tw.Flush()
+		},
+	}
+
+	cmd.Flags().StringVar(&status, "status", "", "only list records with this sync status")
+	cmd.Flags().StringVar(&since, "since", "", "only list records synced after a duration ago (e.g. 24h) or an RFC3339 timestamp")
+
+	return cmd
+}
+
+// parseSince interprets value as either a duration before now or an RFC3339 timestamp
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q: expected a duration like 24h or an RFC3339 timestamp", value)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"sava-s3-export/internal/syncer"
+)
+
+func newListRemoteCmd(flags *globalFlags) *cobra.Command {
+	var sortBy string
+	var limit int
+
+	cmd := &cobra.Command{
+		Use:   "list-remote",
+		Short: "List the files in S3 and whether they are in the sync database",
+		Long: "List the objects under S3_PREFIX without downloading anything. Each file is\n" +
+			"shown as in-db, not-in-db or etag-changed, compared with the sync database.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var less func(a, b syncer.RemoteFile) bool
+			switch sortBy {
+			case "key":
+				less = func(a, b syncer.RemoteFile) bool { return a.S3Key < b.S3Key }
+			case "size":
+				less = func(a, b syncer.RemoteFile) bool { return a.SizeBytes > b.SizeBytes }
+			case "modified":
+				less = func(a, b syncer.RemoteFile) bool { return a.LastModified.After(b.LastModified) }
+			default:
+				return fmt.Errorf("invalid --sort-by %q: must be key, size or modified", sortBy)
+			}
+			if limit < 0 {
+				return fmt.Errorf("invalid --limit %d: must not be negative", limit)
+			}
+
+			cfg, err := flags.loadConfig()
+			if err != nil {
+				return err
+			}
+
+			s, err := syncer.NewInspector(cfg)
+			if err != nil {
+				return fmt.Errorf("failed to create syncer: %w", err)
+			}
+			defer s.Close()
+
+			files, err := s.ListRemote(cmd.Context())
+			if err != nil {
+				return err
+			}
+			sort.SliceStable(files, func(i, j int) bool { return less(files[i], files[j]) })
+			if limit > 0 && len(files) > limit {
+				files = files[:limit]
+			}
+
+			out := cmd.OutOrStdout()
+			if flags.output == outputJSON {
+				return writeJSON(out, files)
+			}
+
+			tw := newTable(out)
+			fmt.Fprintln(tw, "S3 KEY\tSIZE\tETAG\tLAST MODIFIED\tSTATE")
+			for _, f := range files {
+				fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n", f.S3Key, f.SizeBytes, f.ETag,
+					f.LastModified.UTC().Format(time.RFC3339), f.State)
+			}
+			return tw.Flush()
+		},
+	}
+
+	cmd.Flags().StringVar(&sortBy, "sort-by", "key", "sort order: key, size (largest first) or modified (newest first)")
+	cmd.Flags().IntVar(&limit, "limit", 0, "only list the first N files; 0 lists all")
+
+	return cmd
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"sava-s3-export/internal/aws"
+)
+
+func newListVersionsCmd(flags *globalFlags) *cobra.Command {
+	var key string
+
+	cmd := &cobra.Command{
+		Use:   "list-versions",
+		Short: "List the versions of an object in S3_BUCKET",
+		Long: "List every version of --key, newest first, with its version ID, size and\n" +
+			"modification time, for download --version-id. Delete markers are listed\n" +
+			"too. Listing versions needs s3:ListBucketVersions.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := flags.loadConfig()
+			if err != nil {
+				return err
+			}
+			client, err := aws.NewS3Client(cfg)
+			if err != nil {
+				return fmt.Errorf("failed to create S3 client: %w", err)
+			}
+			defer client.Close()
+
+			versions, err := client.ListVersions(cmd.Context(), key)
+			if err != nil {
+				return err
+			}
+			if len(versions) == 0 {
+				return fmt.Errorf("%w: %s", aws.ErrObjectNotFound, key)
+			}
+
+			out := cmd.OutOrStdout()
+			if flags.output == outputJSON {
+				return writeJSON(out, versions)
+			}
+
+			tw := newTable(out)
+			fmt.Fprintln(tw, "VERSION ID\tSIZE\tLAST MODIFIED\tLATEST\tDELETE MARKER")
+			for _, v := range versions {
+				fmt.Fprintf(tw, "%s\t%d\t%s\t%t\t%t\n", v.VersionID, v.Size,
+					v.LastModified.UTC().Format(time.RFC3339), v.IsLatest, v.DeleteMarker)
+			}
+			return tw.Flush()
+		},
+	}
+
+	cmd.Flags().StringVar(&key, "key", "", "S3 key of the object")
+	cmd.MarkFlagRequired("key")
+
+	return cmd
+}
@@ -0,0 +1,34 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"sava-s3-export/internal/syncer"
+)
+
+// handlePauseSignals pauses s on SIGUSR1 and resumes it on SIGUSR2 until
+// ctx is done
+func handlePauseSignals(ctx context.Context, s *syncer.Syncer) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		defer signal.Stop(sigChan)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-sigChan:
+				if sig == syscall.SIGUSR1 {
+					s.Pause()
+				} else {
+					s.Resume()
+				}
+			}
+		}
+	}()
+}
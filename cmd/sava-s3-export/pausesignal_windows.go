@@ -0,0 +1,12 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+
+	"sava-s3-export/internal/syncer"
+)
+
+// handlePauseSignals does nothing, since Windows has no SIGUSR1 or SIGUSR2
+func handlePauseSignals(ctx context.Context, s *syncer.Syncer) {}
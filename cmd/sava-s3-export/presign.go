@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"sava-s3-export/internal/aws"
+	"sava-s3-export/internal/database"
+)
+
+// presignResult is the JSON output of the presign subcommand
+type presignResult struct {
+	Key       string    `json:"key"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func newPresignCmd(flags *globalFlags) *cobra.Command {
+	var key string
+	var expiry time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "presign",
+		Short: "Print a presigned URL for a downloaded file",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := flags.loadConfig()
+			if err != nil {
+				return err
+			}
+			if cmd.Flags().Changed("expiry") {
+				cfg.PRESIGN_EXPIRY_SECONDS = expiry
+			}
+			if err := cfg.Validate(); err != nil {
+				return err
+			}
+
+			db, err := database.OpenParquetDB(cfg.DB_PATH, cfg.BATCH_SIZE, cfg.PARTITION_BY_DATE)
+			if err != nil {
+				return fmt.Errorf("failed to open database: %w", err)
+			}
+			records, err := db.ReadAllRecords(cmd.Context())
+			if err != nil {
+				return fmt.Errorf("failed to read database: %w", err)
+			}
+			record, ok := records[key]
+			if !ok {
+				return fmt.Errorf("%s is not in the sync database", key)
+			}
+			if record.SyncStatus != "downloaded" {
+				return fmt.Errorf("%s has status %q, not \"downloaded\"", key, record.SyncStatus)
+			}
+
+			client, err := aws.NewS3Client(cfg)
+			if err != nil {
+				return fmt.Errorf("failed to create S3 client: %w", err)
+			}
+			defer client.Close()
+			validFor := cfg.PRESIGN_EXPIRY_SECONDS
+			url, err := client.GeneratePresignedURL(cmd.Context(), key, validFor)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			if flags.output == outputJSON {
+				return writeJSON(out, presignResult{Key: key, URL: url, ExpiresAt: time.Now().Add(validFor).UTC()})
+			}
+			fmt.Fprintln(out, url)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&key, "key", "", "S3 key of the file to share")
+	cmd.Flags().DurationVar(&expiry, "expiry", 0, "how long the URL stays valid, at most 168h (defaults to PRESIGN_EXPIRY_SECONDS)")
+	cmd.MarkFlagRequired("key")
+
+	return cmd
+}
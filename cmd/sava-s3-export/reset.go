@@ -0,0 +1,13 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// newResetCmd is the top-level reset, an alias of db reset that backs up the
+// database and asks for confirmation the same way
+func newResetCmd(flags *globalFlags) *cobra.Command {
+	cmd := newDBResetCmd(flags)
+	cmd.Short = "Same as db reset: back up the database and start a new one"
+	return cmd
+}
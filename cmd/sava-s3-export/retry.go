@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"sava-s3-export/internal/syncer"
+)
+
+func newRetryFailedCmd(flags *globalFlags) *cobra.Command {
+	var pattern string
+
+	cmd := &cobra.Command{
+		Use:   "retry-failed",
+		Short: "Reset failed files so the next sync downloads them again",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := flags.loadConfig()
+			if err != nil {
+				return err
+			}
+
+			unlock, err := lockDatabase(cfg)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+
+			s, err := syncer.NewInspector(cfg)
+			if err != nil {
+				return fmt.Errorf("failed to create syncer: %w", err)
+			}
+			defer s.Close()
+
+			var n int
+			if pattern != "" {
+				n, err = s.RetryByPattern(cmd.Context(), pattern)
+			} else {
+				n, err = s.RetryAllFailed(cmd.Context())
+			}
+			if err != nil {
+				return err
+			}
+
+			if flags.output == outputJSON {
+				return writeJSON(cmd.OutOrStdout(), struct {
+					Reset int `json:"reset"`
+				}{n})
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Reset %d failed files\n", n)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&pattern, "pattern", "", "only reset files whose S3 key matches this glob pattern")
+
+	return cmd
+}
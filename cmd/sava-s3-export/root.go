@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"sava-s3-export/internal/config"
+	"sava-s3-export/internal/lock"
+	"sava-s3-export/internal/logging"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// globalFlags holds the flags shared by every subcommand
+type globalFlags struct {
+	configPath string
+	output     string
+	profile    string
+	logFile    string
+}
+
+// newRootCmd builds the command tree. Running the binary without a subcommand
+// performs a sync, matching the behaviour of earlier releases.
+func newRootCmd() *cobra.Command {
+	flags := &globalFlags{}
+
+	root := &cobra.Command{
+		Use:          "sava-s3-export",
+		Short:        "Sync files from an S3 prefix to a local directory",
+		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if flags.output != outputTable && flags.output != outputJSON {
+				return fmt.Errorf("invalid --output %q: must be %q or %q", flags.output, outputTable, outputJSON)
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSync(cmd, flags, &syncFlags{})
+		},
+	}
+
+	root.PersistentFlags().StringVar(&flags.configPath, "config", "", "path to a .env or JSON config file, overriding CONFIG_FILE")
+	root.PersistentFlags().StringVarP(&flags.output, "output", "o", outputTable, "output format: table or json")
+	root.PersistentFlags().StringVar(&flags.profile, "profile", "", "named AWS credentials profile, overriding AWS_PROFILE")
+	root.PersistentFlags().StringVar(&flags.logFile, "log-file", "", "write the log to this rotated file instead of stderr, overriding LOG_OUTPUT_FILE")
+
+	root.AddCommand(
+		newSyncCmd(flags),
+		newStatusCmd(flags),
+		newListCmd(flags),
+		newListRemoteCmd(flags),
+		newDiffCmd(flags),
+		newHealthCmd(flags),
+		newTestConnectionCmd(flags),
+		newResetCmd(flags),
+		newVerifyCmd(flags),
+		newCleanCmd(flags),
+		newDeadLetterCmd(flags),
+		newRetryFailedCmd(flags),
+		newPresignCmd(flags),
+		newDeleteCmd(flags),
+		newCopyCmd(flags),
+		newDownloadCmd(flags),
+		newListVersionsCmd(flags),
+		newDBCmd(flags),
+		newHashIndexCmd(flags),
+		newAuditCmd(flags),
+		newConfigSchemaCmd(),
+	)
+
+	return root
+}
+
+// loadConfig loads the configuration from the first of --config, CONFIG_FILE
+// and ./sava-config.json that is set or exists, or the default .env
+// otherwise. Files ending in .json are read with config.LoadFromJSON, others
+// as .env files. It then applies --profile and --log-file, and sends the log
+// to LOG_OUTPUT_FILE when set. Environment variables that look like misspelt
+// settings are logged as warnings.
+func (f *globalFlags) loadConfig() (*config.Config, error) {
+	path := f.configPath
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path == "" {
+		if _, err := os.Stat(config.DefaultJSONFile); err == nil {
+			path = config.DefaultJSONFile
+		}
+	}
+
+	var cfg *config.Config
+	var err error
+	switch {
+	case path == "":
+		cfg = config.Load()
+	case strings.EqualFold(filepath.Ext(path), ".json"):
+		cfg, err = config.LoadFromJSON(path)
+	default:
+		cfg, err = config.LoadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if f.profile != "" {
+		cfg.AWS_PROFILE = f.profile
+	}
+	if f.logFile != "" {
+		cfg.LOG_OUTPUT_FILE = f.logFile
+	}
+	log.SetOutput(logging.NewWriter(cfg))
+	for _, warning := range config.ValidateEnvKeys() {
+		log.Printf("Warning: %s", warning)
+	}
+	return cfg, nil
+}
+
+// lockDatabase takes the PID_LOCK_FILE lock for a subcommand that writes the
+// database, so it cannot run while a sync does, and returns the function
+// that releases it
+func lockDatabase(cfg *config.Config) (func(), error) {
+	if cfg.PID_LOCK_FILE == "" {
+		return func() {}, nil
+	}
+	l := lock.NewPIDLock(cfg.PID_LOCK_FILE)
+	if err := l.Acquire(); err != nil {
+		return nil, err
+	}
+	return func() {
+		if err := l.Release(); err != nil {
+			log.Printf("%v", err)
+		}
+	}, nil
+}
+
+// writeJSON writes v to w as indented JSON
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(v)
+}
+
+// newTable returns a tabwriter suitable for aligned table output
+func newTable(w io.Writer) *tabwriter.Writer {
+	return tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"sava-s3-export/internal/syncer"
+)
+
+func newStatusCmd(flags *globalFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Print a summary of the sync database",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := flags.loadConfig()
+			if err != nil {
+				return err
+			}
+
+			s, err := syncer.NewInspector(cfg)
+			if err != nil {
+				return fmt.Errorf("failed to create syncer: %w", err)
+			}
+			defer s.Close()
+
+			report, err := s.Status(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			if flags.output == outputJSON {
+				return writeJSON(out, report)
+			}
+
+			tw := newTable(out)
+			fmt.Fprintf(tw, "Total records\t%d\n", report.TotalRecords)
+			fmt.Fprintf(tw, "Last sync\t%s\n", formatTime(report.LastSyncTime))
+			fmt.Fprintf(tw, "Oldest synced\t%s\n", formatTime(report.OldestSyncedAt))
+			fmt.Fprintf(tw, "Newest synced\t%s\n", formatTime(report.NewestSyncedAt))
+			fmt.Fprintf(tw, "Missing local files\t%d\n", report.MissingLocal)
+			fmt.Fprintf(tw, "Total bytes\t%d\n", report.TotalBytes)
+			fmt.Fprintf(tw, "Database size\t%d bytes\n", report.Database.FileSizeBytes)
+
+			statuses := make([]string, 0, len(report.ByStatus))
+			for status := range report.ByStatus {
+				statuses = append(statuses, status)
+			}
+			sort.Strings(statuses)
+
+			fmt.Fprintln(tw, "\nSTATUS\tCOUNT")
+			for _, status := range statuses {
+				fmt.Fprintf(tw, "%s\t%d\n", status, report.ByStatus[status])
+			}
+			return tw.Flush()
+		},
+	}
+}
+
+// formatTime renders t as RFC3339, or a dash when it is unset
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
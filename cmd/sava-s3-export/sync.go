@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"sava-s3-export/internal/api"
+	"sava-s3-export/internal/health"
+	"sava-s3-export/internal/metrics"
+	"sava-s3-export/internal/syncer"
+)
+
+// syncFlags holds the flags of the sync subcommand
+type syncFlags struct {
+	force       bool
+	forceKeys   string
+	confirmCost bool
+	since       string
+	limit       int
+	apiStats    bool
+	resume      bool
+}
+
+func newSyncCmd(flags *globalFlags) *cobra.Command {
+	sf := &syncFlags{}
+
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Download new and modified files from S3",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSync(cmd, flags, sf)
+		},
+	}
+
+	cmd.Flags().BoolVar(&sf.force, "force", false, "re-download all files regardless of ETag match")
+	cmd.Flags().StringVar(&sf.forceKeys, "force-keys", "", "re-download only keys matching this glob pattern")
+	cmd.Flags().StringVar(&sf.since, "since", "", "only sync files modified within this duration (e.g. 24h) or after this RFC3339 timestamp")
+	cmd.Flags().IntVar(&sf.limit, "limit", 0, "download at most this many files, the least recently modified first (overrides MAX_FILES_PER_RUN)")
+	cmd.Flags().BoolVar(&sf.apiStats, "print-api-stats", false, "print the number of S3 requests made by operation after a single run")
+	cmd.Flags().BoolVar(&sf.resume, "resume", false, "resume from the checkpoint at CHECKPOINT_PATH instead of listing the bucket, failing when there is none")
+	cmd.Flags().BoolVar(&sf.confirmCost, "confirm-cost", false, "sync even when the estimated cost exceeds MAX_RUN_COST_USD")
+
+	return cmd
+}
+
+// runSync performs a full sync. On SIGINT or SIGTERM no new downloads are
+// started and in-flight ones are given SHUTDOWN_DRAIN_TIMEOUT_SECONDS to
+// finish; a second signal cancels them immediately. On Unix SIGUSR1 pauses
+// new downloads and SIGUSR2 resumes them.
+func runSync(cmd *cobra.Command, flags *globalFlags, sf *syncFlags) error {
+	// Load configuration
+	cfg, err := flags.loadConfig()
+	if err != nil {
+		return err
+	}
+	if sf.force {
+		cfg.FORCE_REDOWNLOAD = true
+	}
+	if sf.forceKeys != "" {
+		cfg.FORCE_KEYS = sf.forceKeys
+	}
+	if sf.since != "" {
+		since, err := parseSince(sf.since, time.Now())
+		if err != nil {
+			return err
+		}
+		cfg.MODIFIED_AFTER = since
+	}
+	if cmd.Flags().Changed("limit") {
+		cfg.MAX_FILES_PER_RUN = sf.limit
+	}
+
+	// Create a new syncer
+	var opts []syncer.Option
+	if sf.confirmCost {
+		opts = append(opts, syncer.WithCostConfirmed())
+	}
+	if sf.resume {
+		if cfg.CHECKPOINT_PATH == "" {
+			return errors.New("--resume requires CHECKPOINT_PATH")
+		}
+		opts = append(opts, syncer.WithResume())
+	}
+	s, err := syncer.NewSyncer(cfg, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to create syncer: %w", err)
+	}
+	// Closed last, after the servers using it have shut down
+	defer func() {
+		if err := s.Close(); err != nil {
+			log.Printf("%v", err)
+		}
+	}()
+
+	// Start the health server for orchestration probes when configured
+	var healthServer *health.Server
+	if cfg.HEALTH_PORT != 0 {
+		var metricsHandler http.Handler
+		if cfg.METRICS_ENABLED {
+			metricsHandler = metrics.Handler()
+		}
+		healthServer = health.NewServer(cfg.HEALTH_PORT, s, metricsHandler)
+		if err := healthServer.Start(); err != nil {
+			return err
+		}
+	}
+
+	// Start the REST API for triggering syncs and querying records when configured
+	var apiServer *api.Server
+	if cfg.API_PORT != 0 {
+		apiServer = api.NewServer(cfg.API_PORT, cfg.API_TOKEN, s, s.Store())
+		if err := apiServer.Start(); err != nil {
+			return err
+		}
+	}
+
+	// Create a context that is canceled on interruption
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+
+	// Set up a channel to listen for OS signals
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+	handlePauseSignals(ctx, s)
+
+	// Run the syncer in a separate goroutine: once, or on the schedule of
+	// WATCH_MODE or CRON_EXPRESSION
+	continuous := cfg.WATCH_MODE || cfg.CRON_EXPRESSION != ""
+	var result *syncer.SyncResult
+	errChan := make(chan error, 1)
+	go func() {
+		if continuous {
+			errChan <- s.RunContinuously(ctx)
+		} else {
+			var err error
+			result, err = s.RunOnce(ctx)
+			errChan <- err
+		}
+		cancel() // Cancel the context when the syncer is done
+	}()
+
+	// Wait for an interruption signal or for the context to be canceled
+	select {
+	case <-sigChan:
+		log.Println("Received interrupt signal, shutting down...")
+		drained := make(chan bool, 1)
+		go func() { drained <- s.Drain() }()
+		select {
+		case <-drained:
+		case <-sigChan:
+			log.Println("Received second interrupt signal, cancelling in-flight downloads...")
+		}
+		cancel()
+	case <-ctx.Done():
+		log.Println("Syncer has completed its work.")
+	}
+
+	err = <-errChan
+
+	if apiServer != nil {
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := apiServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Failed to shut down API server: %v", err)
+		}
+		shutdownCancel()
+	}
+
+	if healthServer != nil {
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := healthServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Failed to shut down health server: %v", err)
+		}
+		shutdownCancel()
+	}
+
+	log.Println("Application has shut down.")
+	if result != nil && flags.output == outputJSON {
+		if err := writeJSON(cmd.OutOrStdout(), result); err != nil {
+			return err
+		}
+	} else if result != nil && sf.apiStats {
+		if err := printAPIStats(cmd.OutOrStdout(), result.APICalls); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("syncer finished with an error: %w", err)
+	}
+	return nil
+}
+
+// printAPIStats writes a table of the S3 requests of a run by operation
+func printAPIStats(out io.Writer, calls map[string]int64) error {
+	ops := make([]string, 0, len(calls))
+	var total int64
+	for op, n := range calls {
+		ops = append(ops, op)
+		total += n
+	}
+	sort.Strings(ops)
+
+	tw := newTable(out)
+	fmt.Fprintln(tw, "OPERATION\tCALLS")
+	for _, op := range ops {
+		fmt.Fprintf(tw, "%s\t%d\n", op, calls[op])
+	}
+	fmt.Fprintf(tw, "Total\t%d\n", total)
+	return tw.Flush()
+}
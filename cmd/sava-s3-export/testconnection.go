@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"sava-s3-export/internal/aws"
+	"sava-s3-export/internal/config"
+	"sava-s3-export/internal/database"
+)
+
+// testConnectionSampleSize is the number of objects listed under S3_PREFIX
+const testConnectionSampleSize = 10
+
+// connectionCheck is the outcome of one test-connection check
+type connectionCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+// testConnectionResult is the JSON output of the test-connection subcommand
+type testConnectionResult struct {
+	OK     bool              `json:"ok"`
+	Checks []connectionCheck `json:"checks"`
+}
+
+func newTestConnectionCmd(flags *globalFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "test-connection",
+		Short: "Check the credentials, bucket, prefix, LOCAL_DIR and DB_PATH before a first sync",
+		Long: "Check a configuration step by step before running a sync: that the credentials\n" +
+			"are valid (ListBuckets), that S3_BUCKET exists and is accessible (HeadBucket),\n" +
+			"that up to 10 objects can be listed under S3_PREFIX, that a file can be\n" +
+			"created in LOCAL_DIR, and that the database at DB_PATH can be opened, or\n" +
+			"created, and written. Every check runs even when an earlier one fails. Exits\n" +
+			"with an error if any check fails.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := flags.loadConfig()
+			if err != nil {
+				return err
+			}
+
+			client, err := aws.NewS3Client(cfg)
+			if err != nil {
+				return fmt.Errorf("failed to create S3 client: %w", err)
+			}
+			defer client.Close()
+
+			result := testConnectionResult{OK: true, Checks: runConnectionChecks(cmd.Context(), cfg, client)}
+			for _, c := range result.Checks {
+				result.OK = result.OK && c.OK
+			}
+
+			out := cmd.OutOrStdout()
+			if flags.output == outputJSON {
+				if err := writeJSON(out, result); err != nil {
+					return err
+				}
+			} else {
+				tw := newTable(out)
+				fmt.Fprintln(tw, "CHECK\tRESULT\tDETAIL")
+				for _, c := range result.Checks {
+					status := "OK"
+					if !c.OK {
+						status = "FAIL"
+					}
+					fmt.Fprintf(tw, "%s\t%s\t%s\n", c.Name, status, c.Detail)
+				}
+				if err := tw.Flush(); err != nil {
+					return err
+				}
+			}
+
+			if !result.OK {
+				return errors.New("connection test failed")
+			}
+			return nil
+		},
+	}
+}
+
+// runConnectionChecks runs every check of test-connection in order
+func runConnectionChecks(ctx context.Context, cfg *config.Config, client *aws.S3Client) []connectionCheck {
+	check := func(name string, run func() (string, error)) connectionCheck {
+		detail, err := run()
+		if err != nil {
+			return connectionCheck{Name: name, Detail: err.Error()}
+		}
+		return connectionCheck{Name: name, OK: true, Detail: detail}
+	}
+
+	return []connectionCheck{
+		check("credentials", func() (string, error) {
+			buckets, err := client.ListBuckets(ctx)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("valid, %d buckets visible", len(buckets)), nil
+		}),
+		check("bucket", func() (string, error) {
+			if err := client.HeadBucket(ctx); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%s is accessible", cfg.S3_BUCKET), nil
+		}),
+		check("prefix", func() (string, error) {
+			objects, err := client.ListSample(ctx, testConnectionSampleSize)
+			if err != nil {
+				return "", err
+			}
+			if len(objects) == 0 {
+				return fmt.Sprintf("no objects under %q", cfg.S3_PREFIX), nil
+			}
+			return fmt.Sprintf("listed %d objects under %q", len(objects), cfg.S3_PREFIX), nil
+		}),
+		check("local_dir", func() (string, error) {
+			if err := createTempFile(cfg.LOCAL_DIR); err != nil {
+				return "", fmt.Errorf("%s is not writable: %w", cfg.LOCAL_DIR, err)
+			}
+			return fmt.Sprintf("%s is writable", cfg.LOCAL_DIR), nil
+		}),
+		check("database", func() (string, error) {
+			if err := openDatabaseForWriting(ctx, cfg); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%s is writable", cfg.DB_PATH), nil
+		}),
+	}
+}
+
+// createTempFile proves dir writable by creating it if needed, then creating
+// and removing a temporary file in it
+func createTempFile(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".test-connection-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
+
+// openDatabaseForWriting opens the database at DB_PATH, creating it when it
+// does not exist, and checks that it may be written without changing it
+func openDatabaseForWriting(ctx context.Context, cfg *config.Config) error {
+	if !cfg.PARTITION_BY_DATE {
+		if err := os.MkdirAll(filepath.Dir(cfg.DB_PATH), 0755); err != nil {
+			return fmt.Errorf("failed to create the directory of %s: %w", cfg.DB_PATH, err)
+		}
+	}
+	db, err := database.OpenParquetDB(cfg.DB_PATH, cfg.BATCH_SIZE, cfg.PARTITION_BY_DATE)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	if _, err := db.ReadAllRecords(ctx); err != nil {
+		return fmt.Errorf("failed to read database: %w", err)
+	}
+
+	// A partitioned database is a directory of daily files
+	if cfg.PARTITION_BY_DATE {
+		if err := createTempFile(cfg.DB_PATH); err != nil {
+			return fmt.Errorf("%s is not writable: %w", cfg.DB_PATH, err)
+		}
+		return nil
+	}
+	f, err := os.OpenFile(cfg.DB_PATH, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", cfg.DB_PATH, err)
+	}
+	return f.Close()
+}
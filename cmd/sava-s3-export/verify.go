@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"sava-s3-export/internal/syncer"
+)
+
+func newVerifyCmd(flags *globalFlags) *cobra.Command {
+	var repair bool
+	var keys []string
+
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Re-check the checksums of all downloaded files",
+		Long: "Re-hash every downloaded file and compare it with the ETag in S3.\n" +
+			"Corrupt and missing files are printed as JSON lines and marked in the database.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := flags.loadConfig()
+			if err != nil {
+				return err
+			}
+
+			unlock, err := lockDatabase(cfg)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+
+			s, err := syncer.NewInspector(cfg)
+			if err != nil {
+				return fmt.Errorf("failed to create syncer: %w", err)
+			}
+			defer s.Close()
+
+			if len(keys) > 0 {
+				return s.VerifyKeys(cmd.Context(), cmd.OutOrStdout(), keys, repair)
+			}
+			if repair {
+				return s.VerifyAndRepair(cmd.Context(), cmd.OutOrStdout())
+			}
+			return s.Verify(cmd.Context(), cmd.OutOrStdout())
+		},
+	}
+
+	cmd.Flags().BoolVar(&repair, "repair", false, "re-download files that are corrupt or missing")
+	cmd.Flags().StringArrayVar(&keys, "key", nil, "only verify this S3 key, fetching its ETag, size and checksum without listing the prefix; may be repeated")
+
+	return cmd
+}
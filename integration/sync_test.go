@@ -0,0 +1,247 @@
+//go:build integration
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/localstack"
+
+	"sava-s3-export/internal/config"
+	"sava-s3-export/internal/database"
+	"sava-s3-export/internal/syncer"
+)
+
+const (
+	localstackImage = "localstack/localstack:3.8"
+	testBucket      = "sava-integration"
+	testPrefix      = "exports/"
+)
+
+// startLocalStack starts a LocalStack container, removed when the test
+// ends, and returns its S3 endpoint
+func startLocalStack(t *testing.T) string {
+	t.Helper()
+	ctx := context.Background()
+
+	container, err := localstack.Run(ctx, localstackImage)
+	t.Cleanup(func() {
+		if err := testcontainers.TerminateContainer(container); err != nil {
+			t.Logf("failed to terminate LocalStack: %v", err)
+		}
+	})
+	if err != nil {
+		t.Fatalf("failed to start LocalStack: %v", err)
+	}
+
+	endpoint, err := container.PortEndpoint(ctx, "4566/tcp", "http")
+	if err != nil {
+		t.Fatalf("failed to get the LocalStack endpoint: %v", err)
+	}
+	// An IP address makes the SDK address buckets by path rather than by
+	// a virtual host name that does not resolve
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Hostname() == "localhost" {
+		u.Host = "127.0.0.1:" + u.Port()
+	}
+	return u.String()
+}
+
+// localstackEnv points the syncer at endpoint, with LOCAL_DIR and DB_PATH in
+// a temporary directory, and returns the configuration
+func localstackEnv(t *testing.T, endpoint string) *config.Config {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("AWS_ENDPOINT_URL_S3", endpoint)
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("S3_BUCKET", testBucket)
+	t.Setenv("S3_PREFIX", testPrefix)
+	t.Setenv("LOCAL_DIR", filepath.Join(dir, "data"))
+	t.Setenv("DB_PATH", filepath.Join(dir, "s3_sync_status.parquet"))
+	return config.Load()
+}
+
+// newBucket creates the test bucket on endpoint and returns a client for
+// seeding it
+func newBucket(t *testing.T, endpoint string) *s3.Client {
+	t.Helper()
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(endpoint),
+		UsePathStyle: true,
+		Credentials:  credentials.NewStaticCredentialsProvider("test", "test", ""),
+	})
+	_, err := client.CreateBucket(context.Background(), &s3.CreateBucketInput{Bucket: aws.String(testBucket)})
+	if err != nil {
+		t.Fatalf("failed to create bucket: %v", err)
+	}
+	return client
+}
+
+func putObject(t *testing.T, client *s3.Client, key, body string) {
+	t.Helper()
+	_, err := client.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String(testPrefix + key),
+		Body:   bytes.NewReader([]byte(body)),
+	})
+	if err != nil {
+		t.Fatalf("failed to put %s: %v", key, err)
+	}
+}
+
+func deleteObject(t *testing.T, client *s3.Client, key string) {
+	t.Helper()
+	_, err := client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String(testPrefix + key),
+	})
+	if err != nil {
+		t.Fatalf("failed to delete %s: %v", key, err)
+	}
+}
+
+// runSync runs one full sync cycle of cfg and returns the records in the
+// database afterwards
+func runSync(t *testing.T, cfg *config.Config) (*syncer.SyncResult, map[string]database.FileRecord) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	s, err := syncer.NewSyncer(cfg)
+	if err != nil {
+		t.Fatalf("failed to create syncer: %v", err)
+	}
+	defer s.Close()
+	result, err := s.RunOnce(ctx)
+	if err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+
+	db, err := database.OpenParquetDB(cfg.DB_PATH, cfg.BATCH_SIZE, cfg.PARTITION_BY_DATE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := db.ReadAllRecords(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result, records
+}
+
+// checkDownloaded checks that key has a "downloaded" record whose local
+// file holds body
+func checkDownloaded(t *testing.T, records map[string]database.FileRecord, key, body string) {
+	t.Helper()
+	record, ok := records[testPrefix+key]
+	if !ok {
+		t.Errorf("%s has no record", key)
+		return
+	}
+	if record.SyncStatus != "downloaded" {
+		t.Errorf("%s has status %q, want downloaded", key, record.SyncStatus)
+	}
+	data, err := os.ReadFile(record.LocalPath)
+	if err != nil {
+		t.Errorf("failed to read the local file of %s: %v", key, err)
+		return
+	}
+	if string(data) != body {
+		t.Errorf("local file of %s holds %q, want %q", key, data, body)
+	}
+}
+
+func TestSync(t *testing.T) {
+	endpoint := startLocalStack(t)
+	client := newBucket(t, endpoint)
+	cfg := localstackEnv(t, endpoint)
+
+	putObject(t, client, "a.csv", "a,1")
+	putObject(t, client, "b.csv", "b,1")
+	putObject(t, client, "nested/c.csv", "c,1")
+
+	t.Run("initial sync", func(t *testing.T) {
+		result, records := runSync(t, cfg)
+		if result.FilesDownloaded != 3 {
+			t.Errorf("downloaded %d files, want 3", result.FilesDownloaded)
+		}
+		if len(records) != 3 {
+			t.Errorf("database holds %d records, want 3", len(records))
+		}
+		checkDownloaded(t, records, "a.csv", "a,1")
+		checkDownloaded(t, records, "b.csv", "b,1")
+		checkDownloaded(t, records, "nested/c.csv", "c,1")
+	})
+
+	t.Run("incremental sync", func(t *testing.T) {
+		putObject(t, client, "b.csv", "b,2")
+		putObject(t, client, "d.csv", "d,1")
+
+		result, records := runSync(t, cfg)
+		if result.FilesDownloaded != 2 {
+			t.Errorf("downloaded %d files, want the changed and the new one", result.FilesDownloaded)
+		}
+		checkDownloaded(t, records, "a.csv", "a,1")
+		checkDownloaded(t, records, "b.csv", "b,2")
+		checkDownloaded(t, records, "d.csv", "d,1")
+	})
+
+	t.Run("file deleted from S3", func(t *testing.T) {
+		deleteObject(t, client, "a.csv")
+
+		result, records := runSync(t, cfg)
+		if result.FilesDownloaded != 0 {
+			t.Errorf("downloaded %d files, want none", result.FilesDownloaded)
+		}
+		// Deletions are not mirrored: the record and local copy are kept
+		checkDownloaded(t, records, "a.csv", "a,1")
+
+		s, err := syncer.NewSyncer(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		diff, err := s.Diff(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{testPrefix + "a.csv"}; !slices.Equal(diff.DeletedFromS3, want) {
+			t.Errorf("diff reports %v deleted from S3, want %v", diff.DeletedFromS3, want)
+		}
+	})
+
+	t.Run("file larger than MAX_FILE_SIZE_BYTES", func(t *testing.T) {
+		putObject(t, client, "large.csv", "large,1,2,3,4,5")
+		putObject(t, client, "e.csv", "e,1")
+		limited := *cfg
+		limited.MAX_FILE_SIZE_BYTES = 8
+
+		result, records := runSync(t, &limited)
+		if result.FilesDownloaded != 1 {
+			t.Errorf("downloaded %d files, want only the small new one", result.FilesDownloaded)
+		}
+		checkDownloaded(t, records, "e.csv", "e,1")
+		if record, ok := records[testPrefix+"large.csv"]; ok {
+			t.Errorf("large.csv has a record with status %q, want none", record.SyncStatus)
+		}
+		if _, err := os.Stat(filepath.Join(cfg.LOCAL_DIR, "large.csv")); !os.IsNotExist(err) {
+			t.Errorf("large.csv was downloaded (stat: %v)", err)
+		}
+	})
+}
@@ -0,0 +1,306 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"sava-s3-export/internal/database"
+	"sava-s3-export/internal/notification"
+)
+
+const (
+	// defaultRecordLimit and maxRecordLimit bound GET /api/v1/records
+	defaultRecordLimit = 100
+	maxRecordLimit     = 10000
+	// maxRetainedRuns is how many finished runs are kept for status polling
+	maxRetainedRuns = 100
+)
+
+// Run states reported by GET /api/v1/sync/{runID}/status
+const (
+	RunRunning   = "running"
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+)
+
+// errLimitReached stops a record scan once enough records were collected
+var errLimitReached = errors.New("limit reached")
+
+// Runner performs a sync cycle on demand. The Syncer implements it.
+type Runner interface {
+	SyncNow(ctx context.Context, runID string) (*notification.SyncResult, error)
+}
+
+// Server exposes an HTTP API for triggering syncs and querying the sync
+// state. Every endpoint requires an "Authorization: Bearer <API_TOKEN>" header.
+//
+// Errors are returned with a 4xx or 5xx status and the body
+//
+//	{"error": string}
+type Server struct {
+	httpServer *http.Server
+	runner     Runner
+	store      database.StateStore
+	token      string
+
+	// ctx is cancelled by Shutdown to stop triggered runs
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// mu guards runs and runOrder, the finished runs oldest first
+	mu       sync.Mutex
+	runs     map[string]*RunStatus
+	runOrder []string
+}
+
+// RunStatus is the response of POST /api/v1/sync and GET /api/v1/sync/{runID}/status:
+//
+//	{
+//	  "run_id": string,
+//	  "status": "running" | "succeeded" | "failed",
+//	  "started_at": RFC 3339 time,
+//	  "finished_at": RFC 3339 time, omitted while running,
+//	  "files_downloaded": int,
+//	  "files_failed": int,
+//	  "bytes_downloaded": int,
+//	  "error": string, omitted unless failed,
+//	  "result": SyncResult, omitted while running
+//	}
+//
+// where the SyncResult adds the skipped files and the errors of failed
+// files to the counts above.
+type RunStatus struct {
+	RunID           string                   `json:"run_id"`
+	Status          string                   `json:"status"`
+	StartedAt       time.Time                `json:"started_at"`
+	FinishedAt      *time.Time               `json:"finished_at,omitempty"`
+	FilesDownloaded int                      `json:"files_downloaded"`
+	FilesFailed     int                      `json:"files_failed"`
+	BytesDownloaded int64                    `json:"bytes_downloaded"`
+	Error           string                   `json:"error,omitempty"`
+	Result          *notification.SyncResult `json:"result,omitempty"`
+}
+
+// recordsResponse is the response of GET /api/v1/records:
+//
+//	{
+//	  "records": [FileRecord, ...],
+//	  "count": int
+//	}
+//
+// where each FileRecord is encoded as in the database's JSON export.
+type recordsResponse struct {
+	Records []database.FileRecord `json:"records"`
+	Count   int                   `json:"count"`
+}
+
+// errorResponse is the body of every error response
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// NewServer creates an API server listening on port that triggers syncs
+// through runner and reads records from store
+func NewServer(port int, token string, runner Runner, store database.StateStore) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		runner: runner,
+		store:  store,
+		token:  token,
+		ctx:    ctx,
+		cancel: cancel,
+		runs:   make(map[string]*RunStatus),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/sync", s.handleTriggerSync)
+	mux.HandleFunc("GET /api/v1/sync/{runID}/status", s.handleSyncStatus)
+	mux.HandleFunc("GET /api/v1/records", s.handleListRecords)
+	mux.HandleFunc("DELETE /api/v1/records/{key...}", s.handleDeleteRecord)
+
+	s.httpServer = &http.Server{
+		Addr:              net.JoinHostPort("", strconv.Itoa(port)),
+		Handler:           s.authenticate(mux),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return s
+}
+
+// Start begins serving in the background. It returns an error if the port
+// cannot be bound.
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.httpServer.Addr, err)
+	}
+
+	go func() {
+		if err := s.httpServer.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("API server stopped with an error: %v", err)
+		}
+	}()
+
+	log.Printf("API server listening on %s", s.httpServer.Addr)
+	return nil
+}
+
+// Shutdown cancels triggered runs and gracefully stops the server, waiting
+// for in-flight requests until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.cancel()
+	return s.httpServer.Shutdown(ctx)
+}
+
+// authenticate rejects requests without the bearer token
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleTriggerSync serves POST /api/v1/sync. It starts a sync cycle in the
+// background and responds 202 Accepted with its RunStatus; the cycle waits
+// for any cycle already in progress.
+func (s *Server) handleTriggerSync(w http.ResponseWriter, r *http.Request) {
+	status := &RunStatus{RunID: uuid.NewString(), Status: RunRunning, StartedAt: time.Now()}
+
+	s.mu.Lock()
+	s.runs[status.RunID] = status
+	resp := *status
+	s.mu.Unlock()
+
+	go s.runSync(status)
+
+	log.Printf("Sync run %s triggered over the API", status.RunID)
+	writeJSON(w, http.StatusAccepted, resp)
+}
+
+// runSync performs the sync of a triggered run and records its outcome
+func (s *Server) runSync(status *RunStatus) {
+	result, err := s.runner.SyncNow(s.ctx, status.RunID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	finished := time.Now()
+	status.FinishedAt = &finished
+	status.FilesDownloaded = result.FilesDownloaded
+	status.FilesFailed = result.FilesFailed
+	status.BytesDownloaded = result.BytesDownloaded
+	status.Result = result
+	status.Status = RunSucceeded
+	if err != nil {
+		status.Status = RunFailed
+		status.Error = err.Error()
+	}
+
+	s.runOrder = append(s.runOrder, status.RunID)
+	if len(s.runOrder) > maxRetainedRuns {
+		delete(s.runs, s.runOrder[0])
+		s.runOrder = s.runOrder[1:]
+	}
+}
+
+// handleSyncStatus serves GET /api/v1/sync/{runID}/status with the RunStatus
+// of a triggered run, or 404 if the run is unknown or no longer retained
+func (s *Server) handleSyncStatus(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	status, ok := s.runs[r.PathValue("runID")]
+	var resp RunStatus
+	if ok {
+		resp = *status
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown run ID")
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleListRecords serves GET /api/v1/records?status=<status>&limit=<n>. Both
+// parameters are optional; limit defaults to 100 and may not exceed 10000.
+func (s *Server) handleListRecords(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	status := query.Get("status")
+
+	limit := defaultRecordLimit
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > maxRecordLimit {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxRecordLimit))
+			return
+		}
+		limit = n
+	}
+
+	records := []database.FileRecord{}
+	err := s.store.ScanRecords(r.Context(), func(record database.FileRecord) error {
+		if status != "" && record.SyncStatus != status {
+			return nil
+		}
+		records = append(records, record)
+		if len(records) >= limit {
+			return errLimitReached
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errLimitReached) {
+		log.Printf("Failed to query records over the API: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to read records")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, recordsResponse{Records: records, Count: len(records)})
+}
+
+// handleDeleteRecord serves DELETE /api/v1/records/{key}, where key is the
+// full S3 key and may contain slashes. It responds 204 No Content, or 404 if
+// there is no such record.
+func (s *Server) handleDeleteRecord(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	err := s.store.DeleteRecord(r.Context(), key)
+	if errors.Is(err, database.ErrRecordNotFound) {
+		writeError(w, http.StatusNotFound, "record not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to delete record %s over the API: %v", key, err)
+		writeError(w, http.StatusInternalServerError, "failed to delete record")
+		return
+	}
+
+	log.Printf("Deleted record %s over the API", key)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeJSON writes v as JSON with the given status code
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an errorResponse with the given status code
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, errorResponse{Error: msg})
+}
@@ -0,0 +1,177 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"sava-s3-export/internal/database"
+)
+
+// Entry is one line of the audit log
+type Entry struct {
+	Timestamp time.Time `json:"timestamp"`
+	S3Key     string    `json:"s3_key"`
+	ETag      string    `json:"etag"`
+	SizeBytes int64     `json:"size_bytes"`
+	LocalPath string    `json:"local_path"`
+	Status    string    `json:"status"`
+	RunID     string    `json:"run_id"`
+	Hostname  string    `json:"hostname"`
+	User      string    `json:"user"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Logger appends entries to AUDIT_LOG_PATH as JSON lines. The file is only
+// ever opened for appending. It is safe for concurrent use.
+type Logger struct {
+	mu       sync.Mutex
+	file     *os.File
+	runID    string
+	hostname string
+	user     string
+}
+
+// Open opens the audit log at path, creating it if needed
+func Open(path string) (*Logger, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log %s: %w", path, err)
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return &Logger{file: file, hostname: hostname, user: os.Getenv("USER")}, nil
+}
+
+// SetRunID sets the run ID written with the following entries. It is safe on
+// a nil Logger.
+func (l *Logger) SetRunID(runID string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.runID = runID
+}
+
+// Record appends entry, filling in the timestamp, run ID, hostname and user.
+// Each entry is written with a single write so lines never interleave.
+func (l *Logger) Record(entry Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry.Timestamp = time.Now().UTC()
+	entry.RunID = l.runID
+	entry.Hostname = l.hostname
+	entry.User = l.user
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry for %s: %w", entry.S3Key, err)
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// Close closes the audit log
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// Kinds of Discrepancy
+const (
+	// MissingRecord is an audited download with no database record
+	MissingRecord = "missing_record"
+	// ETagMismatch is a record whose ETag differs from its last audit entry
+	ETagMismatch = "etag_mismatch"
+	// StatusMismatch is a record whose download outcome differs from its last audit entry
+	StatusMismatch = "status_mismatch"
+	// Unaudited is a downloaded record with no audit entry
+	Unaudited = "unaudited"
+)
+
+// outcomes are the statuses the syncer writes to the audit log. Other
+// database statuses, such as local_modified or force_redownload, are set
+// after a download by other commands and are not discrepancies.
+var outcomes = map[string]bool{
+	"downloaded":    true,
+	"streamed":      true,
+	"failed":        true,
+	"timeout":       true,
+	"hook_rejected": true,
+}
+
+// Discrepancy is a difference between the audit log and the database
+type Discrepancy struct {
+	Kind        string `json:"kind"`
+	S3Key       string `json:"s3_key"`
+	AuditETag   string `json:"audit_etag,omitempty"`
+	DBETag      string `json:"db_etag,omitempty"`
+	AuditStatus string `json:"audit_status,omitempty"`
+	DBStatus    string `json:"db_status,omitempty"`
+}
+
+// Verify reads an audit log and compares the last entry of every key with
+// its database record. It returns the discrepancies, ordered by the key's
+// first appearance in the log followed by unaudited records, and the number
+// of log entries read.
+func Verify(r io.Reader, records map[string]database.FileRecord) ([]Discrepancy, int, error) {
+	last := make(map[string]Entry)
+	var order []string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lines := 0
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		lines++
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, lines, fmt.Errorf("line %d: invalid audit entry: %w", lines, err)
+		}
+		if _, seen := last[entry.S3Key]; !seen {
+			order = append(order, entry.S3Key)
+		}
+		last[entry.S3Key] = entry
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, lines, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	var found []Discrepancy
+	for _, key := range order {
+		entry := last[key]
+		record, ok := records[key]
+		switch {
+		case !ok:
+			if entry.Status == "downloaded" || entry.Status == "streamed" {
+				found = append(found, Discrepancy{Kind: MissingRecord, S3Key: key, AuditETag: entry.ETag, AuditStatus: entry.Status})
+			}
+		case record.ETag != entry.ETag:
+			found = append(found, Discrepancy{Kind: ETagMismatch, S3Key: key, AuditETag: entry.ETag, DBETag: record.ETag, AuditStatus: entry.Status, DBStatus: record.SyncStatus})
+		case outcomes[record.SyncStatus] && record.SyncStatus != entry.Status:
+			found = append(found, Discrepancy{Kind: StatusMismatch, S3Key: key, AuditETag: entry.ETag, DBETag: record.ETag, AuditStatus: entry.Status, DBStatus: record.SyncStatus})
+		}
+	}
+
+	var unaudited []Discrepancy
+	for key, record := range records {
+		if _, ok := last[key]; !ok && (record.SyncStatus == "downloaded" || record.SyncStatus == "streamed") {
+			unaudited = append(unaudited, Discrepancy{Kind: Unaudited, S3Key: key, DBETag: record.ETag, DBStatus: record.SyncStatus})
+		}
+	}
+	sort.Slice(unaudited, func(i, j int) bool { return unaudited[i].S3Key < unaudited[j].S3Key })
+	return append(found, unaudited...), lines, nil
+}
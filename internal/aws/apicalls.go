@@ -0,0 +1,63 @@
+package aws
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// APICallCounter counts the S3 requests made by a client by operation, such
+// as ListObjectsV2, GetObject and HeadObject. Every attempt is counted, as
+// S3 bills retries too.
+type APICallCounter struct {
+	counts sync.Map // operation name -> *atomic.Int64
+}
+
+// NewAPICallCounter creates a counter with no calls
+func NewAPICallCounter() *APICallCounter {
+	return &APICallCounter{}
+}
+
+// Add counts n calls of operation
+func (c *APICallCounter) Add(operation string, n int64) {
+	v, ok := c.counts.Load(operation)
+	if !ok {
+		v, _ = c.counts.LoadOrStore(operation, new(atomic.Int64))
+	}
+	v.(*atomic.Int64).Add(n)
+}
+
+// Snapshot returns the number of calls of each operation made so far
+func (c *APICallCounter) Snapshot() map[string]int64 {
+	calls := make(map[string]int64)
+	c.counts.Range(func(k, v any) bool {
+		if n := v.(*atomic.Int64).Load(); n > 0 {
+			calls[k.(string)] = n
+		}
+		return true
+	})
+	return calls
+}
+
+// Reset sets every count back to zero
+func (c *APICallCounter) Reset() {
+	c.counts.Range(func(k, v any) bool {
+		v.(*atomic.Int64).Store(0)
+		return true
+	})
+}
+
+// withAPICallCounter counts every request sent by a client in counter. It
+// runs after the retry middleware, so each attempt is counted.
+func withAPICallCounter(counter *APICallCounter) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		return stack.Finalize.Add(middleware.FinalizeMiddlewareFunc("APICallCounter",
+			func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+				counter.Add(awsmiddleware.GetOperationName(ctx), 1)
+				return next.HandleFinalize(ctx, in)
+			}), middleware.After)
+	}
+}
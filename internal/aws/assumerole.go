@@ -0,0 +1,65 @@
+package aws
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+
+	appConfig "sava-s3-export/internal/config"
+)
+
+const (
+	// roleSessionName identifies the sessions of AWS_ROLE_ARN in CloudTrail
+	roleSessionName = "sava-s3-export"
+	// roleRefreshRetryInterval is how long the refresher waits after a failed refresh
+	roleRefreshRetryInterval = time.Minute
+)
+
+// assumeRole replaces the credentials of awsCfg with sessions of AWS_ROLE_ARN,
+// assumed with those credentials. The cache refreshes a session on the first
+// request made within ROLE_REFRESH_BEFORE_EXPIRY_MINUTES of its expiry.
+func assumeRole(awsCfg *aws.Config, cfg *appConfig.Config) {
+	provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(*awsCfg), cfg.AWS_ROLE_ARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = roleSessionName
+		o.Duration = cfg.AWS_ROLE_DURATION_SECONDS
+	})
+	awsCfg.Credentials = aws.NewCredentialsCache(provider, func(o *aws.CredentialsCacheOptions) {
+		o.ExpiryWindow = time.Duration(cfg.ROLE_REFRESH_BEFORE_EXPIRY_MINUTES) * time.Minute
+	})
+}
+
+// refreshRoleCredentials renews the role session held by cache
+// ROLE_REFRESH_BEFORE_EXPIRY_MINUTES before it expires, until ctx is done,
+// so a long sync never waits on STS or sends a request with an expired
+// session. A failed refresh is logged and tried again a minute later; in the
+// meantime requests still refresh through the cache themselves.
+func refreshRoleCredentials(ctx context.Context, cache *aws.CredentialsCache, roleARN string) {
+	creds, err := cache.Retrieve(ctx)
+	for {
+		wait := roleRefreshRetryInterval
+		switch {
+		case err != nil:
+			log.Printf("Failed to refresh the credentials of role %s, requests will try again: %v", roleARN, err)
+		case !creds.CanExpire:
+			return
+		default:
+			// The cache moved Expires earlier by the expiry window
+			wait = max(time.Until(creds.Expires), 0)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		cache.Invalidate()
+		if creds, err = cache.Retrieve(ctx); err == nil {
+			log.Printf("Refreshed the credentials of role %s, next refresh at %s", roleARN, creds.Expires.Format(time.RFC3339))
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package aws
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// assumeRoleResponse is an STS AssumeRole response with credentials that
+// expire at %s
+const assumeRoleResponse = `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>ASIATEST</AccessKeyId>
+      <SecretAccessKey>secret</SecretAccessKey>
+      <SessionToken>token</SessionToken>
+      <Expiration>%s</Expiration>
+    </Credentials>
+    <AssumedRoleUser>
+      <Arn>arn:aws:sts::123456789012:assumed-role/sync/sava-s3-export</Arn>
+      <AssumedRoleId>AROATEST:sava-s3-export</AssumedRoleId>
+    </AssumedRoleUser>
+  </AssumeRoleResult>
+  <ResponseMetadata><RequestId>1</RequestId></ResponseMetadata>
+</AssumeRoleResponse>`
+
+func TestCloseStopsRoleRefresh(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for role sessions to expire")
+	}
+
+	// Every session expires within a second, so the refresher renews it constantly
+	var assumed atomic.Int32
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assumed.Add(1)
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprintf(w, assumeRoleResponse, time.Now().Add(time.Second).UTC().Format(time.RFC3339))
+	}))
+	defer sts.Close()
+
+	client := newEndpointClient(t, "http://127.0.0.1:1", map[string]string{
+		"AWS_ENDPOINT_URL_STS":               sts.URL,
+		"AWS_ROLE_ARN":                       "arn:aws:iam::123456789012:role/sync",
+		"ROLE_REFRESH_BEFORE_EXPIRY_MINUTES": "0",
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for assumed.Load() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("role assumed %d times in 5s, want the session refreshed", assumed.Load())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := client.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	// A refresh already under way may still finish
+	time.Sleep(100 * time.Millisecond)
+	after := assumed.Load()
+	time.Sleep(2 * time.Second)
+	if n := assumed.Load(); n != after {
+		t.Errorf("role assumed %d more times after Close, want the refresher stopped", n-after)
+	}
+}
@@ -0,0 +1,244 @@
+// Package awstest provides an in-memory S3 client for tests
+package awstest
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	appAws "sava-s3-export/internal/aws"
+)
+
+var _ appAws.S3ClientInterface = (*FakeS3Client)(nil)
+
+// FakeS3Client is an in-memory S3ClientInterface for tests. Objects are kept
+// in a map keyed by S3 key; use AddObject and RemoveObject to set up a scenario.
+type FakeS3Client struct {
+	mu          sync.Mutex
+	prefix      string
+	objects     map[string][]byte
+	modified    map[string]time.Time
+	replication map[string]string
+	apiCalls    *appAws.APICallCounter
+}
+
+// NewFakeS3Client creates an empty fake that lists keys under prefix
+func NewFakeS3Client(prefix string) *FakeS3Client {
+	return &FakeS3Client{
+		prefix:      prefix,
+		objects:     make(map[string][]byte),
+		modified:    make(map[string]time.Time),
+		replication: make(map[string]string),
+		apiCalls:    appAws.NewAPICallCounter(),
+	}
+}
+
+// AddObject stores data under key, replacing any existing object
+func (c *FakeS3Client) AddObject(key string, data []byte, lastModified time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.objects[key] = data
+	c.modified[key] = lastModified
+}
+
+// RemoveObject deletes key from the fake
+func (c *FakeS3Client) RemoveObject(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.objects, key)
+	delete(c.modified, key)
+}
+
+// SetReplicationStatus sets the replication status GetReplicationStatus
+// returns for key, "" by default
+func (c *FakeS3Client) SetReplicationStatus(key, status string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.replication[key] = status
+}
+
+// APICalls returns the counter of the calls made to the fake, named after
+// the S3 operations they stand for
+func (c *FakeS3Client) APICalls() *appAws.APICallCounter {
+	return c.apiCalls
+}
+
+// Close does nothing; the fake holds no resources
+func (c *FakeS3Client) Close() error {
+	return nil
+}
+
+// HeadBucket always succeeds, since the fake's bucket always exists
+func (c *FakeS3Client) HeadBucket(ctx context.Context) error {
+	c.apiCalls.Add("HeadBucket", 1)
+	return nil
+}
+
+// StatFile returns the metadata of the stored object, or ErrObjectNotFound
+func (c *FakeS3Client) StatFile(ctx context.Context, key string) (appAws.FileInfo, error) {
+	c.apiCalls.Add("HeadObject", 1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, ok := c.objects[key]
+	if !ok {
+		return appAws.FileInfo{}, fmt.Errorf("%w: %s", appAws.ErrObjectNotFound, key)
+	}
+	obj := fakeObject(key, data, c.modified[key])
+	return appAws.FileInfo{
+		Key:          key,
+		Size:         *obj.Size,
+		ETag:         *obj.ETag,
+		LastModified: *obj.LastModified,
+		StorageClass: string(obj.StorageClass),
+		ContentType:  "application/octet-stream",
+	}, nil
+}
+
+// GetAttributes returns the ETag, size and SHA256 checksum of the stored
+// object, whichever attributes are asked for, or ErrObjectNotFound
+func (c *FakeS3Client) GetAttributes(ctx context.Context, key string, attributes []types.ObjectAttributes) (*s3.GetObjectAttributesOutput, error) {
+	c.apiCalls.Add("GetObjectAttributes", 1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, ok := c.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", appAws.ErrObjectNotFound, key)
+	}
+	obj := fakeObject(key, data, c.modified[key])
+	out := &s3.GetObjectAttributesOutput{LastModified: obj.LastModified}
+	for _, attr := range attributes {
+		switch attr {
+		case types.ObjectAttributesEtag:
+			// GetObjectAttributes returns the ETag without its quotes
+			out.ETag = aws.String(strings.Trim(*obj.ETag, `"`))
+		case types.ObjectAttributesObjectSize:
+			out.ObjectSize = obj.Size
+		case types.ObjectAttributesChecksum:
+			sum := sha256.Sum256(data)
+			out.Checksum = &types.Checksum{
+				ChecksumSHA256: aws.String(base64.StdEncoding.EncodeToString(sum[:])),
+				ChecksumType:   types.ChecksumTypeFullObject,
+			}
+		}
+	}
+	return out, nil
+}
+
+// GetReplicationStatus returns the status set by SetReplicationStatus, or
+// ErrObjectNotFound
+func (c *FakeS3Client) GetReplicationStatus(ctx context.Context, key string) (string, error) {
+	c.apiCalls.Add("HeadObject", 1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.objects[key]; !ok {
+		return "", fmt.Errorf("%w: %s", appAws.ErrObjectNotFound, key)
+	}
+	return c.replication[key], nil
+}
+
+// ListFiles returns every stored object under the prefix, sorted by key
+func (c *FakeS3Client) ListFiles(ctx context.Context) ([]types.Object, error) {
+	c.apiCalls.Add("ListObjectsV2", 1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var files []types.Object
+	for key, data := range c.objects {
+		if !strings.HasPrefix(key, c.prefix) {
+			continue
+		}
+		files = append(files, fakeObject(key, data, c.modified[key]))
+	}
+	sort.Slice(files, func(i, j int) bool { return *files[i].Key < *files[j].Key })
+	return files, nil
+}
+
+// ListFromInventory has no inventory report to read, so it returns the same
+// objects as ListFiles
+func (c *FakeS3Client) ListFromInventory(ctx context.Context, manifestKey string) ([]types.Object, error) {
+	return c.ListFiles(ctx)
+}
+
+// DownloadFile writes the stored object to localPath
+func (c *FakeS3Client) DownloadFile(ctx context.Context, obj types.Object, localPath string) error {
+	key := aws.ToString(obj.Key)
+	c.apiCalls.Add("GetObject", 1)
+	c.mu.Lock()
+	data, ok := c.objects[key]
+	c.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("failed to download file %s: no such key", key)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", localPath, err)
+	}
+	return os.WriteFile(localPath, data, 0644)
+}
+
+// StreamFile copies the stored object to dst
+func (c *FakeS3Client) StreamFile(ctx context.Context, key string, dst io.Writer) (int64, error) {
+	c.apiCalls.Add("GetObject", 1)
+	c.mu.Lock()
+	data, ok := c.objects[key]
+	c.mu.Unlock()
+	if !ok {
+		return 0, fmt.Errorf("failed to get file %s: no such key", key)
+	}
+	n, err := dst.Write(data)
+	return int64(n), err
+}
+
+// UploadFile stores the contents of localPath under key
+func (c *FakeS3Client) UploadFile(ctx context.Context, localPath, key string) error {
+	c.apiCalls.Add("PutObject", 1)
+	data, err := os.ReadFile(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", localPath, err)
+	}
+	c.AddObject(key, data, time.Now())
+	return nil
+}
+
+// DeleteFile removes key from the fake
+func (c *FakeS3Client) DeleteFile(ctx context.Context, key string) error {
+	c.apiCalls.Add("DeleteObject", 1)
+	c.RemoveObject(key)
+	return nil
+}
+
+// ErrSelectNotSupported is returned by FakeS3Client.SelectQuery, which cannot evaluate SQL
+var ErrSelectNotSupported = errors.New("fake S3 client does not support S3 Select")
+
+// SelectQuery always fails with ErrSelectNotSupported
+func (c *FakeS3Client) SelectQuery(ctx context.Context, key, expression, inputFormat, outputFormat string) (io.ReadCloser, error) {
+	return nil, ErrSelectNotSupported
+}
+
+// fakeObject builds the listing entry for a stored object, using the MD5 of
+// its contents as the ETag just like a single-part S3 upload
+func fakeObject(key string, data []byte, lastModified time.Time) types.Object {
+	sum := md5.Sum(data)
+	return types.Object{
+		Key:          aws.String(key),
+		ETag:         aws.String(`"` + hex.EncodeToString(sum[:]) + `"`),
+		Size:         aws.Int64(int64(len(data))),
+		LastModified: aws.Time(lastModified),
+		StorageClass: types.ObjectStorageClassStandard,
+	}
+}
@@ -0,0 +1,61 @@
+package aws
+
+import (
+	"bufio"
+	"io"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+
+	"sava-s3-export/internal/metrics"
+)
+
+// bufferPool hands out reusable write buffers of a fixed size. It implements
+// manager.WriterReadFromProvider so the Downloader writes every part through
+// a pooled buffer instead of allocating its own.
+type bufferPool struct {
+	pool sync.Pool
+}
+
+var _ manager.WriterReadFromProvider = (*bufferPool)(nil)
+
+// newBufferPool creates a pool of buffers of size bytes
+func newBufferPool(size int) *bufferPool {
+	p := &bufferPool{}
+	p.pool.New = func() any {
+		metrics.BufferPoolMisses.Inc()
+		return &pooledWriter{Writer: bufio.NewWriterSize(nil, size), fresh: true}
+	}
+	return p
+}
+
+// GetReadFrom wraps w in a pooled buffer; cleanup must be called once the
+// returned writer is no longer used to return the buffer to the pool
+func (p *bufferPool) GetReadFrom(w io.Writer) (manager.WriterReadFrom, func()) {
+	buf := p.pool.Get().(*pooledWriter)
+	if !buf.fresh {
+		metrics.BufferPoolHits.Inc()
+	}
+	buf.fresh = false
+	buf.Reset(w)
+	return buf, func() {
+		buf.Reset(nil) // drop the reference to the destination
+		p.pool.Put(buf)
+	}
+}
+
+// pooledWriter is a bufio.Writer that flushes at the end of every ReadFrom,
+// since the Downloader never calls Flush itself
+type pooledWriter struct {
+	*bufio.Writer
+	fresh bool // newly allocated, not yet handed out
+}
+
+// ReadFrom copies r into the buffered writer and flushes it
+func (w *pooledWriter) ReadFrom(r io.Reader) (int64, error) {
+	n, err := w.Writer.ReadFrom(r)
+	if flushErr := w.Flush(); flushErr != nil && err == nil {
+		err = flushErr
+	}
+	return n, err
+}
@@ -0,0 +1,80 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestBufferPoolReusesBuffers(t *testing.T) {
+	p := newBufferPool(1024)
+	var dst bytes.Buffer
+	w, release := p.GetReadFrom(&dst)
+	if _, err := w.ReadFrom(bytes.NewReader([]byte("hello"))); err != nil {
+		t.Fatal(err)
+	}
+	// ReadFrom flushes, since the Downloader never does
+	if got := dst.String(); got != "hello" {
+		t.Errorf("destination holds %q after ReadFrom, want hello", got)
+	}
+	first := w.(*pooledWriter)
+	release()
+
+	w, release = p.GetReadFrom(&dst)
+	defer release()
+	if second := w.(*pooledWriter); second != first {
+		// sync.Pool may drop buffers at any time, so this is not an error
+		t.Logf("released buffer was not reused")
+	}
+	if _, err := w.ReadFrom(bytes.NewReader([]byte(" world"))); err != nil {
+		t.Fatal(err)
+	}
+	if got := dst.String(); got != "hello world" {
+		t.Errorf("destination holds %q, want the writes of both buffers", got)
+	}
+}
+
+// BenchmarkDownloadBuffers measures the allocations of 50 concurrent
+// downloads through the SDK downloader, with part buffers drawn from the
+// DOWNLOAD_BUFFER_SIZE pool and with the downloader's own
+func BenchmarkDownloadBuffers(b *testing.B) {
+	const concurrency = 50
+	const size = 1 << 20
+	content := bytes.Repeat([]byte{'x'}, size)
+	obj := types.Object{Key: aws.String("data.bin")}
+
+	for _, pooled := range []bool{true, false} {
+		name := "pooled"
+		if !pooled {
+			name = "unpooled"
+		}
+		b.Run(name, func(b *testing.B) {
+			client := newTestClient(b, objectHandler(bytes.NewReader(content), size, `"bench-1"`),
+				map[string]string{"MULTIPART_THRESHOLD_MB": "0"})
+			if !pooled {
+				client.downloader = manager.NewDownloader(client.client)
+			}
+
+			b.ReportAllocs()
+			b.SetBytes(concurrency * size)
+			for range b.N {
+				var wg sync.WaitGroup
+				for range concurrency {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						if _, err := client.downloadToWriter(context.Background(), obj, discardWriterAt{}); err != nil {
+							b.Error(err)
+						}
+					}()
+				}
+				wg.Wait()
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"sava-s3-export/internal/metrics"
+)
+
+// ErrCircuitOpen is returned without calling S3 while the circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is the state of a CircuitBreaker
+type CircuitState int
+
+const (
+	// CircuitClosed lets every call through
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects every call until the reset timeout elapses
+	CircuitOpen
+	// CircuitHalfOpen lets a single probe call through to test recovery
+	CircuitHalfOpen
+)
+
+// String returns the lower-case name of the state
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half_open"
+	}
+	return "unknown"
+}
+
+// CircuitBreaker stops calls to S3 after a run of consecutive failures so
+// that workers do not pile onto a struggling endpoint
+type CircuitBreaker struct {
+	threshold    int
+	resetTimeout time.Duration
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewCircuitBreaker creates a breaker that opens after threshold consecutive
+// failures and allows a probe after resetTimeout
+func NewCircuitBreaker(threshold int, resetTimeout time.Duration) *CircuitBreaker {
+	metrics.CircuitBreakerState.Set(float64(CircuitClosed))
+	return &CircuitBreaker{threshold: threshold, resetTimeout: resetTimeout}
+}
+
+// State returns the current state of the breaker
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
+
+// Allow returns ErrCircuitOpen if a call may not be made right now. Every
+// allowed call must be followed by Record.
+func (cb *CircuitBreaker) Allow() error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case CircuitOpen:
+		if time.Since(cb.openedAt) < cb.resetTimeout {
+			return ErrCircuitOpen
+		}
+		cb.setState(CircuitHalfOpen)
+		cb.probing = true
+		return nil
+	case CircuitHalfOpen:
+		if cb.probing {
+			return ErrCircuitOpen
+		}
+		cb.probing = true
+		return nil
+	}
+	return nil
+}
+
+// Record reports the outcome of a call permitted by Allow
+func (cb *CircuitBreaker) Record(err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.probing = false
+	if err == nil {
+		cb.failures = 0
+		if cb.state != CircuitClosed {
+			cb.setState(CircuitClosed)
+		}
+		return
+	}
+
+	cb.failures++
+	if cb.state == CircuitHalfOpen || cb.failures >= cb.threshold {
+		cb.openedAt = time.Now()
+		if cb.state != CircuitOpen {
+			cb.setState(CircuitOpen)
+		}
+	}
+}
+
+// abandon releases a probe slot without recording an outcome
+func (cb *CircuitBreaker) abandon() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.probing = false
+}
+
+// setState transitions the breaker; cb.mu must be held
+func (cb *CircuitBreaker) setState(state CircuitState) {
+	log.Printf("S3 circuit breaker %s -> %s", cb.state, state)
+	cb.state = state
+	metrics.CircuitBreakerState.Set(float64(state))
+}
+
+// CircuitBreakerClient guards the listing, DownloadFile and SelectQuery of an S3ClientInterface with a CircuitBreaker
+type CircuitBreakerClient struct {
+	S3ClientInterface
+	breaker *CircuitBreaker
+}
+
+// NewCircuitBreakerClient wraps client with breaker
+func NewCircuitBreakerClient(client S3ClientInterface, breaker *CircuitBreaker) *CircuitBreakerClient {
+	return &CircuitBreakerClient{S3ClientInterface: client, breaker: breaker}
+}
+
+// Breaker returns the circuit breaker guarding the client
+func (c *CircuitBreakerClient) Breaker() *CircuitBreaker {
+	return c.breaker
+}
+
+// ListFiles lists files unless the circuit is open
+func (c *CircuitBreakerClient) ListFiles(ctx context.Context) ([]types.Object, error) {
+	if err := c.breaker.Allow(); err != nil {
+		return nil, err
+	}
+	files, err := c.S3ClientInterface.ListFiles(ctx)
+	c.record(ctx, err)
+	return files, err
+}
+
+// ListFromInventory lists files from an inventory report unless the circuit is open
+func (c *CircuitBreakerClient) ListFromInventory(ctx context.Context, manifestKey string) ([]types.Object, error) {
+	if err := c.breaker.Allow(); err != nil {
+		return nil, err
+	}
+	files, err := c.S3ClientInterface.ListFromInventory(ctx, manifestKey)
+	c.record(ctx, err)
+	return files, err
+}
+
+// DownloadFile downloads a file unless the circuit is open
+func (c *CircuitBreakerClient) DownloadFile(ctx context.Context, obj types.Object, localPath string) error {
+	if err := c.breaker.Allow(); err != nil {
+		return err
+	}
+	err := c.S3ClientInterface.DownloadFile(ctx, obj, localPath)
+	c.record(ctx, err)
+	return err
+}
+
+// SelectQuery starts an S3 Select query unless the circuit is open
+func (c *CircuitBreakerClient) SelectQuery(ctx context.Context, key, expression, inputFormat, outputFormat string) (io.ReadCloser, error) {
+	if err := c.breaker.Allow(); err != nil {
+		return nil, err
+	}
+	r, err := c.S3ClientInterface.SelectQuery(ctx, key, expression, inputFormat, outputFormat)
+	c.record(ctx, err)
+	return r, err
+}
+
+// record reports err to the breaker, ignoring failures caused by the caller cancelling ctx
+func (c *CircuitBreakerClient) record(ctx context.Context, err error) {
+	if err != nil && ctx.Err() != nil {
+		c.breaker.abandon()
+		return
+	}
+	c.breaker.Record(err)
+}
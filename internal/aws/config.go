@@ -0,0 +1,45 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+
+	appConfig "sava-s3-export/internal/config"
+)
+
+// LoadAWSConfig builds the AWS SDK configuration shared by every AWS service client
+func LoadAWSConfig(ctx context.Context, cfg *appConfig.Config) (aws.Config, error) {
+	opts := []func(*config.LoadOptions) error{
+		config.WithRegion(cfg.Region()),
+	}
+
+	// A named profile wins over static keys; with neither, the SDK's default
+	// credential chain (environment, shared files, instance or task role) is used
+	switch {
+	case cfg.AWS_PROFILE != "":
+		opts = append(opts, config.WithSharedConfigProfile(cfg.AWS_PROFILE))
+	case cfg.AWS_ACCESS_KEY_ID != "":
+		opts = append(opts, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(cfg.AWS_ACCESS_KEY_ID, cfg.AWS_SECRET_ACCESS_KEY, "")))
+	}
+
+	httpClient, err := newHTTPClient(cfg)
+	if err != nil {
+		return aws.Config{}, err
+	}
+	if httpClient != nil {
+		opts = append(opts, config.WithHTTPClient(httpClient))
+	}
+
+	awsCfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	if cfg.AWS_ROLE_ARN != "" {
+		assumeRole(&awsCfg, cfg)
+	}
+	return awsCfg, nil
+}
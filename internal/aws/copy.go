@@ -0,0 +1,156 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	// maxCopyObjectSize is the largest object a single CopyObject call accepts
+	maxCopyObjectSize = 5 * 1024 * 1024 * 1024
+	// copyPartSize is the size of each UploadPartCopy of a multipart copy,
+	// raised for objects that would otherwise need more than maxCopyParts
+	copyPartSize = 512 * 1024 * 1024
+	// maxCopyParts is the most parts a multipart upload may have
+	maxCopyParts = 10000
+)
+
+// CopyObject copies sourceKey to destKey within the bucket, keeping its
+// content type and metadata. Objects larger than 5 GB, which CopyObject
+// rejects, are copied in parts with UploadPartCopy.
+func (c *S3Client) CopyObject(ctx context.Context, sourceKey, destKey string) error {
+	head, err := c.HeadObject(ctx, sourceKey)
+	if err != nil {
+		return fmt.Errorf("failed to get metadata of %s: %w", sourceKey, err)
+	}
+	size := aws.ToInt64(head.ContentLength)
+
+	if size > maxCopyObjectSize {
+		if err := c.copyMultipart(ctx, sourceKey, destKey, size, head); err != nil {
+			return fmt.Errorf("failed to copy %s to %s: %w", sourceKey, destKey, err)
+		}
+	} else {
+		_, err := c.client.CopyObject(ctx, &s3.CopyObjectInput{
+			Bucket:       aws.String(c.bucket),
+			Key:          aws.String(destKey),
+			CopySource:   aws.String(c.copySource(sourceKey)),
+			RequestPayer: c.requestPayer,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to copy %s to %s: %w", sourceKey, destKey, err)
+		}
+	}
+
+	log.Printf("Successfully copied %s to %s", sourceKey, destKey)
+	return nil
+}
+
+// copySource returns the URL-encoded bucket/key form of key expected by
+// CopySource
+func (c *S3Client) copySource(key string) string {
+	return url.PathEscape(c.bucket + "/" + key)
+}
+
+// copyMultipart copies the size bytes of sourceKey to destKey as parallel
+// UploadPartCopy requests. Unlike CopyObject a multipart upload does not carry
+// over the content type and metadata, so those of head are set on it. The
+// upload is aborted when any part fails.
+func (c *S3Client) copyMultipart(ctx context.Context, sourceKey, destKey string, size int64, head *s3.HeadObjectOutput) error {
+	partSize := max(int64(copyPartSize), (size+maxCopyParts-1)/maxCopyParts)
+	numParts := int((size + partSize - 1) / partSize)
+
+	upload, err := c.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:       aws.String(c.bucket),
+		Key:          aws.String(destKey),
+		ContentType:  head.ContentType,
+		Metadata:     head.Metadata,
+		RequestPayer: c.requestPayer,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start multipart upload: %w", err)
+	}
+
+	partCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	parts := make([]types.CompletedPart, numParts)
+	errs := make([]error, numParts)
+	sem := make(chan struct{}, multipartConcurrency)
+	for i := 0; i < numParts; i++ {
+		first := int64(i) * partSize
+		last := min(first+partSize, size) - 1
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-partCtx.Done():
+				errs[i] = partCtx.Err()
+				return
+			}
+			defer func() { <-sem }()
+
+			partNumber := aws.Int32(int32(i + 1))
+			out, err := c.client.UploadPartCopy(partCtx, &s3.UploadPartCopyInput{
+				Bucket:          aws.String(c.bucket),
+				Key:             aws.String(destKey),
+				UploadId:        upload.UploadId,
+				PartNumber:      partNumber,
+				CopySource:      aws.String(c.copySource(sourceKey)),
+				CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", first, last)),
+				RequestPayer:    c.requestPayer,
+			})
+			if err != nil {
+				errs[i] = fmt.Errorf("part %d of %d: %w", i+1, numParts, err)
+				cancel() // the upload will be aborted, stop the remaining parts
+				return
+			}
+			parts[i] = types.CompletedPart{ETag: out.CopyPartResult.ETag, PartNumber: partNumber}
+			log.Printf("Copied part %d/%d of %s", i+1, numParts, sourceKey)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			c.abortUpload(destKey, upload.UploadId)
+			return err
+		}
+	}
+
+	_, err = c.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(c.bucket),
+		Key:             aws.String(destKey),
+		UploadId:        upload.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+		RequestPayer:    c.requestPayer,
+	})
+	if err != nil {
+		c.abortUpload(destKey, upload.UploadId)
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+	return nil
+}
+
+// abortUpload aborts the multipart upload uploadID of key so its parts are
+// not billed. It uses its own context since the copy may have been cancelled.
+func (c *S3Client) abortUpload(key string, uploadID *string) {
+	_, err := c.client.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+		Bucket:       aws.String(c.bucket),
+		Key:          aws.String(key),
+		UploadId:     uploadID,
+		RequestPayer: c.requestPayer,
+	})
+	if err != nil {
+		log.Printf("Failed to abort multipart upload of %s: %v", key, err)
+	}
+}
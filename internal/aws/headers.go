@@ -0,0 +1,29 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// withCustomHeaders returns an API option that sets CUSTOM_HEADERS on every
+// request, e.g. the token an S3 authentication proxy expects. The headers are
+// added at the end of the finalize step, after the request has been signed,
+// so they are not part of the signature the proxy forwards upstream.
+func withCustomHeaders(headers map[string]string) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		return stack.Finalize.Add(middleware.FinalizeMiddlewareFunc("CustomHeaders",
+			func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+				req, ok := in.Request.(*smithyhttp.Request)
+				if !ok {
+					return middleware.FinalizeOutput{}, middleware.Metadata{}, fmt.Errorf("unexpected request type %T", in.Request)
+				}
+				for name, value := range headers {
+					req.Header.Set(name, value)
+				}
+				return next.HandleFinalize(ctx, in)
+			}), middleware.After)
+	}
+}
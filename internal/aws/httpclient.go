@@ -0,0 +1,92 @@
+package aws
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"golang.org/x/net/http/httpproxy"
+
+	appConfig "sava-s3-export/internal/config"
+)
+
+// newHTTPClient returns the HTTP client for AWS requests when HTTP_PROXY_URL
+// or the TLS_* settings need one, or nil to keep the SDK default. It starts
+// from the SDK's own client so its timeouts and connection limits still apply.
+func newHTTPClient(cfg *appConfig.Config) (*awshttp.BuildableClient, error) {
+	if cfg.HTTP_PROXY_URL == "" && !cfg.TLS_SKIP_VERIFY && cfg.TLS_CERT_FILE == "" && cfg.TLS_CA_FILE == "" {
+		return nil, nil
+	}
+
+	tlsConfig, err := loadTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var proxy func(*url.URL) (*url.URL, error)
+	if cfg.HTTP_PROXY_URL != "" {
+		if _, err := url.Parse(cfg.HTTP_PROXY_URL); err != nil {
+			return nil, fmt.Errorf("invalid HTTP_PROXY_URL: %w", err)
+		}
+		proxy = (&httpproxy.Config{
+			HTTPProxy:  cfg.HTTP_PROXY_URL,
+			HTTPSProxy: cfg.HTTP_PROXY_URL,
+			NoProxy:    cfg.NO_PROXY,
+		}).ProxyFunc()
+	}
+	if cfg.TLS_SKIP_VERIFY {
+		log.Println("TLS_SKIP_VERIFY is enabled, AWS server certificates will not be verified")
+	}
+
+	return awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+		if proxy != nil {
+			tr.Proxy = func(req *http.Request) (*url.URL, error) {
+				return proxy(req.URL)
+			}
+		}
+		if tlsConfig != nil {
+			tr.TLSClientConfig = tlsConfig
+		}
+	}), nil
+}
+
+// loadTLSConfig builds the client TLS configuration from TLS_CERT_FILE and
+// TLS_KEY_FILE, presented for mutual TLS, TLS_CA_FILE, trusted in addition to
+// the system roots, and TLS_SKIP_VERIFY. It returns nil when none are set.
+func loadTLSConfig(cfg *appConfig.Config) (*tls.Config, error) {
+	if !cfg.TLS_SKIP_VERIFY && cfg.TLS_CERT_FILE == "" && cfg.TLS_CA_FILE == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.TLS_SKIP_VERIFY,
+	}
+	if cfg.TLS_CERT_FILE != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLS_CERT_FILE, cfg.TLS_KEY_FILE)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS client certificate %s with key %s: %w", cfg.TLS_CERT_FILE, cfg.TLS_KEY_FILE, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if cfg.TLS_CA_FILE != "" {
+		pem, err := os.ReadFile(cfg.TLS_CA_FILE)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("TLS CA file %s contains no PEM certificates", cfg.TLS_CA_FILE)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
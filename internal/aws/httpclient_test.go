@@ -0,0 +1,177 @@
+package aws
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	appConfig "sava-s3-export/internal/config"
+)
+
+// testCert is a certificate and its key, written as PEM files
+type testCert struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+// newTestCert creates a certificate for template signed by parent, or
+// self-signed when parent is nil, and writes it to dir as name.pem and
+// name-key.pem
+func newTestCert(t *testing.T, dir, name string, template *x509.Certificate, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.Subject = pkix.Name{CommonName: name}
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tc := &testCert{
+		cert:     cert,
+		key:      key,
+		certFile: filepath.Join(dir, name+".pem"),
+		keyFile:  filepath.Join(dir, name+"-key.pem"),
+	}
+	writePEM(t, tc.certFile, "CERTIFICATE", der)
+	writePEM(t, tc.keyFile, "EC PRIVATE KEY", keyDER)
+	return tc
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newMTLSServer starts an HTTPS server with a certificate of ca that
+// requires clients to present a certificate of ca, and reports the common
+// name of each client certificate it accepts on clients
+func newMTLSServer(t *testing.T, dir string, ca *testCert) (*httptest.Server, chan string) {
+	t.Helper()
+	server := newTestCert(t, dir, "server", &x509.Certificate{
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+	}, ca)
+
+	clients := make(chan string, 16)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clients <- r.TLS.PeerCertificates[0].Subject.CommonName
+	}))
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	ts.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{server.cert.Raw}, PrivateKey: server.key}},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	return ts, clients
+}
+
+// newTestCA creates a certificate authority in dir
+func newTestCA(t *testing.T, dir string) *testCert {
+	t.Helper()
+	return newTestCert(t, dir, "ca", &x509.Certificate{
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+}
+
+// newClientCert creates a client certificate signed by ca in dir
+func newClientCert(t *testing.T, dir, name string, ca *testCert) *testCert {
+	t.Helper()
+	return newTestCert(t, dir, name, &x509.Certificate{
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+	}, ca)
+}
+
+func TestMutualTLSPresentsClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir)
+	server, clients := newMTLSServer(t, dir, ca)
+	client := newClientCert(t, dir, "sava-client", ca)
+
+	s3Client := newEndpointClient(t, server.URL, map[string]string{
+		"TLS_CERT_FILE": client.certFile,
+		"TLS_KEY_FILE":  client.keyFile,
+		"TLS_CA_FILE":   ca.certFile,
+	})
+	if err := s3Client.HeadBucket(context.Background()); err != nil {
+		t.Fatalf("HeadBucket: %v", err)
+	}
+	if got := <-clients; got != "sava-client" {
+		t.Errorf("server saw client certificate %q, want sava-client", got)
+	}
+}
+
+func TestMutualTLSWithoutClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir)
+	server, clients := newMTLSServer(t, dir, ca)
+
+	s3Client := newEndpointClient(t, server.URL, map[string]string{"TLS_CA_FILE": ca.certFile})
+	if err := s3Client.HeadBucket(context.Background()); err == nil {
+		t.Error("HeadBucket succeeded without a client certificate")
+	}
+	if len(clients) != 0 {
+		t.Errorf("server accepted %d requests without a client certificate", len(clients))
+	}
+}
+
+func TestMutualTLSMismatchedKeyPair(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir)
+	first := newClientCert(t, dir, "first", ca)
+	second := newClientCert(t, dir, "second", ca)
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("S3_BUCKET", "bucket")
+	t.Setenv("TLS_CERT_FILE", first.certFile)
+	t.Setenv("TLS_KEY_FILE", second.keyFile)
+	_, err := NewS3Client(appConfig.Load())
+	if err == nil || !strings.Contains(err.Error(), first.certFile) {
+		t.Errorf("NewS3Client = %v, want an error naming %s", err, first.certFile)
+	}
+}
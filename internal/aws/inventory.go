@@ -0,0 +1,257 @@
+package aws
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+// ErrUnsupportedInventoryFormat is returned by ListFromInventory for reports
+// whose fileFormat it cannot read, such as ORC
+var ErrUnsupportedInventoryFormat = errors.New("unsupported inventory format")
+
+// inventoryManifest is the manifest.json written by S3 Inventory for each report
+type inventoryManifest struct {
+	SourceBucket      string `json:"sourceBucket"`
+	DestinationBucket string `json:"destinationBucket"`
+	FileFormat        string `json:"fileFormat"`
+	FileSchema        string `json:"fileSchema"`
+	Files             []struct {
+		Key  string `json:"key"`
+		Size int64  `json:"size"`
+	} `json:"files"`
+}
+
+// inventoryRow is the subset of an inventory entry needed to build a types.Object
+type inventoryRow struct {
+	key          string
+	size         int64
+	lastModified time.Time
+	etag         string
+	storageClass string
+	// skip marks noncurrent versions and delete markers of versioned inventories
+	skip bool
+}
+
+// ListFromInventory lists the objects under the prefix from an S3 Inventory
+// report instead of ListObjectsV2, which can take hours on very large
+// buckets. manifestKey is the key of the report's manifest.json in the
+// bucket, or an s3://bucket/key URL when the report is delivered to another
+// bucket. CSV and Parquet reports are supported; ORC is not.
+func (c *S3Client) ListFromInventory(ctx context.Context, manifestKey string) ([]types.Object, error) {
+	manifestBucket, manifestKey := c.bucket, manifestKey
+	if rest, ok := strings.CutPrefix(manifestKey, "s3://"); ok {
+		manifestBucket, manifestKey, _ = strings.Cut(rest, "/")
+	}
+
+	var manifest inventoryManifest
+	if err := c.getObjectWith(ctx, manifestBucket, manifestKey, func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(&manifest)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to read inventory manifest %s: %w", manifestKey, err)
+	}
+
+	// The destination bucket is given as an ARN, arn:aws:s3:::name
+	dataBucket := manifestBucket
+	if i := strings.LastIndex(manifest.DestinationBucket, ":"); i >= 0 && i < len(manifest.DestinationBucket)-1 {
+		dataBucket = manifest.DestinationBucket[i+1:]
+	}
+
+	var read func(r io.Reader, fn func(inventoryRow)) error
+	switch strings.ToUpper(manifest.FileFormat) {
+	case "CSV":
+		columns := strings.Split(manifest.FileSchema, ",")
+		for i := range columns {
+			columns[i] = strings.TrimSpace(columns[i])
+		}
+		read = func(r io.Reader, fn func(inventoryRow)) error {
+			return readInventoryCSV(r, columns, fn)
+		}
+	case "PARQUET":
+		read = readInventoryParquet
+	case "ORC":
+		return nil, fmt.Errorf("%w %q of manifest %s: configure the report as CSV or Parquet", ErrUnsupportedInventoryFormat, manifest.FileFormat, manifestKey)
+	default:
+		return nil, fmt.Errorf("%w %q of manifest %s", ErrUnsupportedInventoryFormat, manifest.FileFormat, manifestKey)
+	}
+
+	var files []types.Object
+	for _, file := range manifest.Files {
+		err := c.getObjectWith(ctx, dataBucket, file.Key, func(r io.Reader) error {
+			return read(r, func(row inventoryRow) {
+				if row.skip || !strings.HasPrefix(row.key, c.prefix) {
+					return
+				}
+				files = append(files, types.Object{
+					Key:          aws.String(row.key),
+					Size:         aws.Int64(row.size),
+					LastModified: aws.Time(row.lastModified),
+					ETag:         aws.String(`"` + row.etag + `"`),
+					StorageClass: types.ObjectStorageClass(row.storageClass),
+				})
+			})
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read inventory file %s: %w", file.Key, err)
+		}
+	}
+
+	log.Printf("Listed %d objects from inventory manifest %s (%d files)", len(files), manifestKey, len(manifest.Files))
+	return files, nil
+}
+
+// getObjectWith fetches bucket/key and passes its body to fn
+func (c *S3Client) getObjectWith(ctx context.Context, bucket, key string, fn func(io.Reader) error) error {
+	out, err := c.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return err
+	}
+	defer out.Body.Close()
+	return fn(out.Body)
+}
+
+// readInventoryCSV reads a gzip-compressed CSV inventory file whose columns
+// are named by the manifest's fileSchema
+func readInventoryCSV(r io.Reader, columns []string, fn func(inventoryRow)) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("failed to open gzip stream: %w", err)
+	}
+	defer gz.Close()
+
+	index := make(map[string]int, len(columns))
+	for i, name := range columns {
+		index[name] = i
+	}
+	if _, ok := index["Key"]; !ok {
+		return errors.New("inventory schema has no Key column")
+	}
+	field := func(record []string, name string) string {
+		if i, ok := index[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	cr := csv.NewReader(gz)
+	cr.FieldsPerRecord = -1
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse CSV: %w", err)
+		}
+
+		// Keys are URL-encoded in CSV inventories
+		key, err := url.QueryUnescape(field(record, "Key"))
+		if err != nil {
+			return fmt.Errorf("failed to decode key %q: %w", field(record, "Key"), err)
+		}
+		size, _ := strconv.ParseInt(field(record, "Size"), 10, 64)
+		lastModified, _ := time.Parse(time.RFC3339Nano, field(record, "LastModifiedDate"))
+
+		fn(inventoryRow{
+			key:          key,
+			size:         size,
+			lastModified: lastModified,
+			etag:         field(record, "ETag"),
+			storageClass: field(record, "StorageClass"),
+			skip:         field(record, "IsLatest") == "false" || field(record, "IsDeleteMarker") == "true",
+		})
+	}
+}
+
+// readInventoryParquet reads a Parquet inventory file column by column, as
+// its schema depends on the fields selected for the report
+func readInventoryParquet(r io.Reader, fn func(inventoryRow)) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	pr, err := reader.NewParquetColumnReader(buffer.NewBufferFileFromBytes(data), 4)
+	if err != nil {
+		return fmt.Errorf("failed to create parquet column reader: %w", err)
+	}
+	defer pr.ReadStop()
+
+	numRows := pr.GetNumRows()
+	if numRows == 0 {
+		return nil
+	}
+	present := make(map[string]bool)
+	for i, info := range pr.SchemaHandler.Infos {
+		if i > 0 && pr.SchemaHandler.SchemaElements[i].GetNumChildren() == 0 {
+			present[info.ExName] = true
+		}
+	}
+	root := pr.SchemaHandler.GetRootExName()
+	column := func(name string) ([]interface{}, error) {
+		if !present[name] {
+			return nil, nil
+		}
+		values, _, _, err := pr.ReadColumnByPath(common.PathToStr([]string{root, name}), numRows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read column %s: %w", name, err)
+		}
+		return values, nil
+	}
+
+	cols := make(map[string][]interface{})
+	for _, name := range []string{"key", "size", "last_modified_date", "e_tag", "storage_class", "is_latest", "is_delete_marker"} {
+		values, err := column(name)
+		if err != nil {
+			return err
+		}
+		cols[name] = values
+	}
+	if cols["key"] == nil {
+		return errors.New("inventory schema has no key column")
+	}
+	value := func(name string, i int) interface{} {
+		if values := cols[name]; i < len(values) {
+			return values[i]
+		}
+		return nil
+	}
+
+	for i := range cols["key"] {
+		row := inventoryRow{}
+		row.key, _ = value("key", i).(string)
+		row.size, _ = value("size", i).(int64)
+		if millis, ok := value("last_modified_date", i).(int64); ok {
+			row.lastModified = time.UnixMilli(millis).UTC()
+		}
+		row.etag, _ = value("e_tag", i).(string)
+		row.storageClass, _ = value("storage_class", i).(string)
+		if latest, ok := value("is_latest", i).(bool); ok && !latest {
+			row.skip = true
+		}
+		if marker, ok := value("is_delete_marker", i).(bool); ok && marker {
+			row.skip = true
+		}
+		fn(row)
+	}
+	return nil
+}
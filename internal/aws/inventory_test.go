@@ -0,0 +1,121 @@
+package aws
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// parquetInventoryRow is a row of a Parquet inventory report with the
+// column names S3 Inventory writes
+type parquetInventoryRow struct {
+	Bucket           string `parquet:"name=bucket, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Key              string `parquet:"name=key, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Size             int64  `parquet:"name=size, type=INT64"`
+	LastModifiedDate int64  `parquet:"name=last_modified_date, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	ETag             string `parquet:"name=e_tag, type=BYTE_ARRAY, convertedtype=UTF8"`
+	IsLatest         bool   `parquet:"name=is_latest, type=BOOLEAN"`
+}
+
+// inventoryServer serves manifest.json with format and the data file
+// data.bin, counting the requests for the data file
+func inventoryServer(t *testing.T, format, schema string, data []byte) (*S3Client, *atomic.Int32) {
+	t.Helper()
+	manifest := fmt.Sprintf(`{"sourceBucket": "bucket", "destinationBucket": "arn:aws:s3:::bucket",
+		"fileFormat": %q, "fileSchema": %q, "files": [{"key": "inventory/data.bin", "size": %d}]}`,
+		format, schema, len(data))
+	var dataRequests atomic.Int32
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/manifest.json"):
+			w.Write([]byte(manifest))
+		case strings.HasSuffix(r.URL.Path, "/data.bin"):
+			dataRequests.Add(1)
+			w.Write(data)
+		default:
+			http.NotFound(w, r)
+		}
+	}), map[string]string{"S3_PREFIX": "p/"})
+	return client, &dataRequests
+}
+
+func TestListFromInventory(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	var csvData bytes.Buffer
+	gz := gzip.NewWriter(&csvData)
+	fmt.Fprintf(gz, "bucket,p/a%%20b.csv,3,%s,abc,true\n", modified.Format(time.RFC3339))
+	fmt.Fprintf(gz, "bucket,p/old.csv,4,%s,def,false\n", modified.Format(time.RFC3339))
+	fmt.Fprintf(gz, "bucket,other/c.csv,5,%s,ghi,true\n", modified.Format(time.RFC3339))
+	gz.Close()
+
+	pf := buffer.NewBufferFile()
+	pw, err := writer.NewParquetWriter(pf, new(parquetInventoryRow), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range []parquetInventoryRow{
+		{Bucket: "bucket", Key: "p/a b.csv", Size: 3, LastModifiedDate: modified.UnixMilli(), ETag: "abc", IsLatest: true},
+		{Bucket: "bucket", Key: "p/old.csv", Size: 4, LastModifiedDate: modified.UnixMilli(), ETag: "def"},
+		{Bucket: "bucket", Key: "other/c.csv", Size: 5, LastModifiedDate: modified.UnixMilli(), ETag: "ghi", IsLatest: true},
+	} {
+		if err := pw.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pw.WriteStop(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		format, schema string
+		data           []byte
+	}{
+		{"CSV", "Bucket, Key, Size, LastModifiedDate, ETag, IsLatest", csvData.Bytes()},
+		{"Parquet", "message s3.inventory { ... }", pf.Bytes()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			client, _ := inventoryServer(t, tt.format, tt.schema, tt.data)
+			files, err := client.ListFromInventory(context.Background(), "inventory/manifest.json")
+			if err != nil {
+				t.Fatalf("ListFromInventory: %v", err)
+			}
+			// Only the current version under the prefix is listed
+			if len(files) != 1 {
+				t.Fatalf("listed %d objects, want 1", len(files))
+			}
+			f := files[0]
+			if aws.ToString(f.Key) != "p/a b.csv" || aws.ToInt64(f.Size) != 3 ||
+				aws.ToString(f.ETag) != `"abc"` || !aws.ToTime(f.LastModified).Equal(modified) {
+				t.Errorf("listed %s, %d bytes, ETag %s, modified %v", aws.ToString(f.Key), aws.ToInt64(f.Size), aws.ToString(f.ETag), aws.ToTime(f.LastModified))
+			}
+		})
+	}
+}
+
+func TestListFromInventoryUnsupportedFormat(t *testing.T) {
+	for _, format := range []string{"ORC", ""} {
+		t.Run(format, func(t *testing.T) {
+			client, dataRequests := inventoryServer(t, format, "", []byte("not read"))
+			_, err := client.ListFromInventory(context.Background(), "inventory/manifest.json")
+			if !errors.Is(err, ErrUnsupportedInventoryFormat) {
+				t.Fatalf("ListFromInventory: %v, want ErrUnsupportedInventoryFormat", err)
+			}
+			if n := dataRequests.Load(); n != 0 {
+				t.Errorf("fetched the data file %d times, want none", n)
+			}
+		})
+	}
+}
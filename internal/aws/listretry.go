@@ -0,0 +1,101 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// listRetryMaxDelay caps the backoff between two listing attempts
+const listRetryMaxDelay = 30 * time.Second
+
+// ListFilesWithRetry pages through every object under the prefix. A page
+// that fails is fetched again, from the continuation token of the last page
+// that succeeded, after a full-jitter exponential backoff: a random delay
+// between 0 and min(30s, LIST_RETRY_BASE_DELAY_MS * 2^attempt). Up to
+// LIST_RETRY_MAX_ATTEMPTS consecutive attempts are made. When S3 rejects
+// the continuation token, e.g. because it expired, the listing starts over
+// from the beginning.
+func (c *S3Client) ListFilesWithRetry(ctx context.Context) ([]types.Object, error) {
+	var files []types.Object
+	var token *string
+	failures := 0
+	for {
+		page, err := c.client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:            aws.String(c.bucket),
+			Prefix:            aws.String(c.prefix),
+			ContinuationToken: token,
+			RequestPayer:      c.requestPayer,
+		})
+		if err == nil {
+			failures = 0
+			files = append(files, page.Contents...)
+			if !aws.ToBool(page.IsTruncated) || aws.ToString(page.NextContinuationToken) == "" {
+				return files, nil
+			}
+			token = page.NextContinuationToken
+			continue
+		}
+
+		failures++
+		restart := token != nil && isInvalidTokenError(err)
+		if ctx.Err() != nil || failures >= c.listRetryMaxAttempts || !(restart || isRetryableListError(err)) {
+			return nil, fmt.Errorf("failed to get page from S3: %w", err)
+		}
+		if restart {
+			log.Printf("S3 rejected the listing's continuation token, listing %s/%s again from the start: %v", c.bucket, c.prefix, err)
+			files, token = nil, nil
+		}
+
+		delay := fullJitter(c.listRetryBaseDelay, failures-1)
+		log.Printf("Listing page of %s/%s failed (attempt %d of %d), retrying in %v: %v",
+			c.bucket, c.prefix, failures, c.listRetryMaxAttempts, delay.Round(time.Millisecond), err)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to get page from S3: %w", err)
+		case <-time.After(delay):
+		}
+	}
+}
+
+// fullJitter returns a random delay between 0 and min(listRetryMaxDelay,
+// base * 2^attempt), so that clients failing together do not retry together
+func fullJitter(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	ceiling := base
+	for i := 0; i < attempt && ceiling < listRetryMaxDelay; i++ {
+		ceiling *= 2
+	}
+	return rand.N(min(ceiling, listRetryMaxDelay) + 1)
+}
+
+// isRetryableListError reports whether a failed ListObjectsV2 call may
+// succeed when made again. Client errors such as AccessDenied or
+// NoSuchBucket will not, except for throttling and timeouts.
+func isRetryableListError(err error) bool {
+	var respErr interface{ HTTPStatusCode() int }
+	if !errors.As(err, &respErr) {
+		// No response at all, e.g. a broken connection
+		return true
+	}
+	code := respErr.HTTPStatusCode()
+	return code < 400 || code >= 500 || code == http.StatusRequestTimeout || code == http.StatusTooManyRequests
+}
+
+// isInvalidTokenError reports whether S3 rejected the continuation token of
+// a ListObjectsV2 call
+func isInvalidTokenError(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidArgument"
+}
@@ -0,0 +1,174 @@
+package aws
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+const (
+	// multipartPartSize is the size of each range request of a multipart download
+	multipartPartSize = 16 * 1024 * 1024
+	// multipartConcurrency is the number of parts of one file downloaded at once
+	multipartConcurrency = 8
+	// partRetryBaseDelay is the delay before retrying a failed part; it doubles on each further attempt
+	partRetryBaseDelay = 500 * time.Millisecond
+)
+
+// downloadMultipart downloads key into w as parallel range requests, each
+// written at its own offset; a file is pre-sized to size bytes first. A failed
+// part is retried on its own up to maxRetries times. Every part is read with
+// If-Match etag, so parts of a replaced object are not mixed. When etag is a plain MD5
+// and w can be read back, the assembled content is checked against it.
+func (c *S3Client) downloadMultipart(ctx context.Context, key string, w io.WriterAt, size int64, etag string) error {
+	if file, ok := w.(*os.File); ok {
+		if err := file.Truncate(size); err != nil {
+			return fmt.Errorf("failed to allocate %d bytes for %s: %w", size, file.Name(), err)
+		}
+	}
+
+	numParts := int((size + multipartPartSize - 1) / multipartPartSize)
+	start := time.Now()
+
+	partCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg        sync.WaitGroup
+		doneBytes atomic.Int64
+		doneParts atomic.Int32
+	)
+	errs := make([]error, numParts)
+	sem := make(chan struct{}, multipartConcurrency)
+	for i := 0; i < numParts; i++ {
+		first := int64(i) * multipartPartSize
+		last := min(first+multipartPartSize, size) - 1
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-partCtx.Done():
+				errs[i] = partCtx.Err()
+				return
+			}
+			defer func() { <-sem }()
+
+			if err := c.downloadPartWithRetry(partCtx, w, key, etag, first, last); err != nil {
+				errs[i] = fmt.Errorf("part %d of %d: %w", i+1, numParts, err)
+				cancel() // the file is unusable, stop the remaining parts
+				return
+			}
+			total := doneBytes.Add(last - first + 1)
+			log.Printf("Downloaded part %d/%d of %s (%d of %d bytes)", doneParts.Add(1), numParts, key, total, size)
+		}(i)
+	}
+	wg.Wait()
+
+	// Report the failed part rather than those cancelled because of it
+	var failed error
+	for _, err := range errs {
+		if err != nil && (failed == nil || errors.Is(failed, context.Canceled)) {
+			failed = err
+		}
+	}
+	if failed != nil {
+		return fmt.Errorf("failed to download file %s: %w", key, failed)
+	}
+
+	elapsed := time.Since(start)
+	log.Printf("Downloaded %s in %d parts: %d bytes in %v (%.1f MB/s)",
+		key, numParts, size, elapsed, float64(size)/(1024*1024)/elapsed.Seconds())
+
+	if r, ok := w.(io.ReaderAt); ok {
+		return verifyMD5(io.NewSectionReader(r, 0, size), key, etag)
+	}
+	return nil
+}
+
+// downloadPartWithRetry fetches bytes first..last of key into w, retrying
+// up to maxRetries times with exponential backoff. A part of an object
+// replaced since it was listed is not retried.
+func (c *S3Client) downloadPartWithRetry(ctx context.Context, w io.WriterAt, key, etag string, first, last int64) error {
+	for attempt := 1; ; attempt++ {
+		err := c.downloadPart(ctx, w, key, etag, first, last)
+		if err == nil || ctx.Err() != nil || isPreconditionFailed(err) || attempt > c.maxRetries {
+			return err
+		}
+
+		delay := partRetryBaseDelay << (attempt - 1)
+		log.Printf("Range %d-%d of %s failed (attempt %d of %d), retrying in %v: %v",
+			first, last, key, attempt, c.maxRetries+1, delay, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// downloadPart fetches bytes first..last of the version etag of key and
+// writes them at offset first of w
+func (c *S3Client) downloadPart(ctx context.Context, w io.WriterAt, key, etag string, first, last int64) error {
+	out, err := c.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket:       aws.String(c.bucket),
+		Key:          aws.String(key),
+		Range:        aws.String(fmt.Sprintf("bytes=%d-%d", first, last)),
+		IfMatch:      ifMatch(etag),
+		RequestPayer: c.requestPayer,
+	})
+	if err != nil {
+		return err
+	}
+	defer out.Body.Close()
+
+	rf, release := c.bufferPool.GetReadFrom(io.NewOffsetWriter(w, first))
+	defer release()
+	n, err := rf.ReadFrom(out.Body)
+	if err != nil {
+		return err
+	}
+	if want := last - first + 1; n != want {
+		return fmt.Errorf("short read: got %d of %d bytes", n, want)
+	}
+	return nil
+}
+
+// isPreconditionFailed reports whether err is S3 refusing an If-Match read
+// because the object's ETag changed
+func isPreconditionFailed(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "PreconditionFailed"
+}
+
+// verifyMD5 compares the content read from r with etag. Multipart ETags are
+// not a content hash, so those are accepted without checking.
+func verifyMD5(r io.Reader, key, etag string) error {
+	expected := strings.Trim(etag, `"`)
+	if expected == "" || strings.Contains(expected, "-") {
+		return nil
+	}
+
+	h := md5.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return fmt.Errorf("failed to hash %s: %w", key, err)
+	}
+	if actual := hex.EncodeToString(h.Sum(nil)); actual != expected {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", key, expected, actual)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	appConfig "sava-s3-export/internal/config"
+)
+
+// newTestClient returns an S3Client of bucket "bucket" whose requests go to
+// handler, with env set on top of its configuration
+func newTestClient(t testing.TB, handler http.Handler, env map[string]string) *S3Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return newEndpointClient(t, server.URL, env)
+}
+
+// newEndpointClient returns an S3Client of bucket "bucket" whose requests go
+// to endpoint, with env set on top of its configuration
+func newEndpointClient(t testing.TB, endpoint string, env map[string]string) *S3Client {
+	t.Helper()
+	t.Setenv("AWS_ENDPOINT_URL_S3", endpoint)
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("S3_BUCKET", "bucket")
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+	client, err := NewS3Client(appConfig.Load())
+	if err != nil {
+		t.Fatalf("NewS3Client: %v", err)
+	}
+	return client
+}
+
+// objectHandler serves the size bytes of content as every object with etag,
+// honouring Range and If-Match
+func objectHandler(content io.ReaderAt, size int64, etag string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "", time.Time{}, io.NewSectionReader(content, 0, size))
+	}
+}
+
+func TestDownloadMultipartUsesListedObject(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), (multipartPartSize+multipartPartSize/4)/16)
+	sum := md5.Sum(content)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+
+	var (
+		mu        sync.Mutex
+		methods   []string
+		ifMatches []string
+	)
+	serve := objectHandler(bytes.NewReader(content), int64(len(content)), etag)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		methods = append(methods, r.Method)
+		ifMatches = append(ifMatches, r.Header.Get("If-Match"))
+		mu.Unlock()
+		serve(w, r)
+	})
+	client := newTestClient(t, handler, map[string]string{"MULTIPART_THRESHOLD_MB": "1"})
+
+	localPath := filepath.Join(t.TempDir(), "data.bin")
+	obj := types.Object{Key: aws.String("data.bin"), Size: aws.Int64(int64(len(content))), ETag: aws.String(etag)}
+	if err := client.DownloadFile(context.Background(), obj, localPath); err != nil {
+		t.Fatalf("DownloadFile: %v", err)
+	}
+	got, err := os.ReadFile(localPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("downloaded %d bytes that differ from the %d of the object", len(got), len(content))
+	}
+
+	if len(methods) != 2 {
+		t.Errorf("sent %d requests, want one per part: %v", len(methods), methods)
+	}
+	for i, method := range methods {
+		if method != http.MethodGet {
+			t.Errorf("request %d is a %s, want only GETs", i, method)
+		}
+		if ifMatches[i] != etag {
+			t.Errorf("request %d has If-Match %q, want %q", i, ifMatches[i], etag)
+		}
+	}
+}
+
+func TestDownloadMultipartReplacedObject(t *testing.T) {
+	content := bytes.Repeat([]byte{'x'}, multipartPartSize*2)
+	client := newTestClient(t, objectHandler(bytes.NewReader(content), int64(len(content)), `"new-2"`), map[string]string{
+		"MULTIPART_THRESHOLD_MB": "1",
+		"MAX_RETRIES":            "3",
+	})
+
+	obj := types.Object{Key: aws.String("data.bin"), Size: aws.Int64(int64(len(content))), ETag: aws.String(`"old-2"`)}
+	start := time.Now()
+	err := client.DownloadFile(context.Background(), obj, filepath.Join(t.TempDir(), "data.bin"))
+	if !isPreconditionFailed(err) {
+		t.Fatalf("DownloadFile = %v, want PreconditionFailed", err)
+	}
+	if elapsed := time.Since(start); elapsed >= partRetryBaseDelay {
+		t.Errorf("DownloadFile took %v, want no retries", elapsed)
+	}
+}
+
+// patternReaderAt reads an endless repeating byte pattern, so that large
+// objects can be served without holding them in memory
+type patternReaderAt struct{}
+
+func (patternReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	for i := range p {
+		p[i] = byte(off + int64(i))
+	}
+	return len(p), nil
+}
+
+// discardWriterAt accepts every write without storing it
+type discardWriterAt struct{}
+
+func (discardWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	return len(p), nil
+}
+
+// BenchmarkDownload compares fetching a 1 GB object with a single GetObject
+// stream, with the SDK downloader and with parallel range requests
+func BenchmarkDownload(b *testing.B) {
+	const size = 1 << 30
+	// A multipart ETag is not an MD5, so nothing is read back to check it
+	handler := objectHandler(patternReaderAt{}, size, `"bench-64"`)
+	obj := types.Object{Key: aws.String("large.bin"), Size: aws.Int64(size), ETag: aws.String(`"bench-64"`)}
+
+	b.Run("single stream", func(b *testing.B) {
+		client := newTestClient(b, handler, nil)
+		b.SetBytes(size)
+		for range b.N {
+			if _, err := client.StreamFile(context.Background(), *obj.Key, io.Discard); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("downloader", func(b *testing.B) {
+		client := newTestClient(b, handler, map[string]string{"MULTIPART_THRESHOLD_MB": "0"})
+		b.SetBytes(size)
+		for range b.N {
+			if _, err := client.downloadToWriter(context.Background(), obj, discardWriterAt{}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("multipart", func(b *testing.B) {
+		client := newTestClient(b, handler, map[string]string{"MULTIPART_THRESHOLD_MB": strconv.Itoa(size/(1<<20) - 1)})
+		b.SetBytes(size)
+		for range b.N {
+			if _, err := client.downloadToWriter(context.Background(), obj, discardWriterAt{}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
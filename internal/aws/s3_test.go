@@ -0,0 +1,247 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const listResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Name>bucket</Name>
+  <Prefix>p/</Prefix>
+  <KeyCount>1</KeyCount>
+  <MaxKeys>1000</MaxKeys>
+  <IsTruncated>false</IsTruncated>
+  <Contents>
+    <Key>p/a.csv</Key>
+    <LastModified>2024-05-01T00:00:00.000Z</LastModified>
+    <ETag>&quot;0cc175b9c0f1b6a831c399e269772661&quot;</ETag>
+    <Size>1</Size>
+  </Contents>
+</ListBucketResult>`
+
+// blockedListing is an S3 endpoint whose listings wait until release is
+// closed, counting the requests it gets
+type blockedListing struct {
+	server   *httptest.Server
+	requests atomic.Int32
+	entered  chan struct{}
+	release  chan struct{}
+}
+
+func newBlockedListing(t *testing.T) *blockedListing {
+	t.Helper()
+	l := &blockedListing{entered: make(chan struct{}, 8), release: make(chan struct{})}
+	l.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.requests.Add(1)
+		l.entered <- struct{}{}
+		select {
+		case <-l.release:
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(listResponse))
+	}))
+	t.Cleanup(l.server.Close)
+	return l
+}
+
+// waitForListing waits for the first listing to reach the server
+func (l *blockedListing) waitForListing(t *testing.T) {
+	t.Helper()
+	select {
+	case <-l.entered:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no listing reached S3")
+	}
+}
+
+// joinTime is how long a caller is given to join a listing in flight
+const joinTime = 100 * time.Millisecond
+
+func TestListFilesSharesListing(t *testing.T) {
+	listing := newBlockedListing(t)
+	env := map[string]string{"S3_PREFIX": "p/"}
+	// Like the targets of SYNC_TARGETS, each caller has its own client
+	clients := []*S3Client{
+		newEndpointClient(t, listing.server.URL, env),
+		newEndpointClient(t, listing.server.URL, env),
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(clients))
+	counts := make([]int, len(clients))
+	list := func(i int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			files, err := clients[i].ListFiles(context.Background())
+			errs[i], counts[i] = err, len(files)
+		}()
+	}
+	list(0)
+	listing.waitForListing(t)
+	list(1)
+	time.Sleep(joinTime)
+	close(listing.release)
+	wg.Wait()
+
+	for i := range clients {
+		if errs[i] != nil {
+			t.Errorf("ListFiles of client %d: %v", i, errs[i])
+		}
+		if counts[i] != 1 {
+			t.Errorf("client %d listed %d files, want 1", i, counts[i])
+		}
+	}
+	calls := clients[0].APICalls().Snapshot()["ListObjectsV2"] + clients[1].APICalls().Snapshot()["ListObjectsV2"]
+	if calls != 1 || listing.requests.Load() != 1 {
+		t.Errorf("ListObjectsV2 called %d times (%d requests), want once", calls, listing.requests.Load())
+	}
+}
+
+func TestListFilesCallerCancelled(t *testing.T) {
+	listing := newBlockedListing(t)
+	client := newEndpointClient(t, listing.server.URL, map[string]string{"S3_PREFIX": "p/"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := client.ListFiles(ctx)
+		first <- err
+	}()
+	listing.waitForListing(t)
+
+	second := make(chan error, 1)
+	go func() {
+		files, err := client.ListFiles(context.Background())
+		if err == nil && len(files) != 1 {
+			t.Errorf("second caller listed %d files, want 1", len(files))
+		}
+		second <- err
+	}()
+	time.Sleep(joinTime)
+
+	// The first caller gives up at once, without failing the listing
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled ListFiles = %v, want context.Canceled", err)
+	}
+	close(listing.release)
+	if err := <-second; err != nil {
+		t.Errorf("ListFiles sharing the cancelled listing: %v", err)
+	}
+	if n := listing.requests.Load(); n != 1 {
+		t.Errorf("sent %d listings, want 1", n)
+	}
+}
+
+func TestRequesterPays(t *testing.T) {
+	content := bytes.Repeat([]byte{'x'}, multipartPartSize+1)
+	serveObject := objectHandler(bytes.NewReader(content), int64(len(content)), `"data-2"`)
+	// Large enough to be copied in parts, and only ever asked for its size
+	serveLarge := objectHandler(patternReaderAt{}, maxCopyObjectSize+1, `"large-1"`)
+
+	for _, requesterPays := range []bool{true, false} {
+		t.Run("REQUESTER_PAYS="+strconv.FormatBool(requesterPays), func(t *testing.T) {
+			var (
+				mu     sync.Mutex
+				payers = map[string][]string{}
+			)
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				query := r.URL.Query()
+				op := r.Method
+				switch {
+				case query.Get("list-type") == "2":
+					op = "ListObjectsV2"
+				case r.Header.Get("Range") != "":
+					op = "GET range"
+				case query.Has("uploads"):
+					op = "CreateMultipartUpload"
+				case query.Has("uploadId") && r.Method == http.MethodPut:
+					op = "UploadPartCopy"
+				case query.Has("uploadId"):
+					op = "CompleteMultipartUpload"
+				case r.Header.Get("x-amz-copy-source") != "":
+					op = "CopyObject"
+				}
+				mu.Lock()
+				payers[op] = append(payers[op], r.Header.Get("x-amz-request-payer"))
+				mu.Unlock()
+
+				w.Header().Set("Content-Type", "application/xml")
+				switch op {
+				case "ListObjectsV2":
+					w.Write([]byte(listResponse))
+				case "CreateMultipartUpload":
+					w.Write([]byte(`<InitiateMultipartUploadResult><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`))
+				case "UploadPartCopy":
+					w.Write([]byte(`<CopyPartResult><ETag>"part"</ETag></CopyPartResult>`))
+				case "CompleteMultipartUpload":
+					w.Write([]byte(`<CompleteMultipartUploadResult><ETag>"large-2"</ETag></CompleteMultipartUploadResult>`))
+				case "CopyObject":
+					w.Write([]byte(`<CopyObjectResult><ETag>"data-2"</ETag></CopyObjectResult>`))
+				default:
+					if strings.HasSuffix(r.URL.Path, "/large.bin") {
+						serveLarge(w, r)
+					} else {
+						serveObject(w, r)
+					}
+				}
+			})
+			client := newTestClient(t, handler, map[string]string{
+				"S3_PREFIX":              "p/",
+				"REQUESTER_PAYS":         strconv.FormatBool(requesterPays),
+				"MULTIPART_THRESHOLD_MB": "1",
+			})
+
+			ctx := context.Background()
+			if _, err := client.ListFiles(ctx); err != nil {
+				t.Fatalf("ListFiles: %v", err)
+			}
+			if _, err := client.StatFile(ctx, "p/data.bin"); err != nil {
+				t.Fatalf("StatFile: %v", err)
+			}
+			if _, err := client.StreamFile(ctx, "p/data.bin", io.Discard); err != nil {
+				t.Fatalf("StreamFile: %v", err)
+			}
+			if _, err := client.DownloadToWriter(ctx, "p/data.bin", discardWriterAt{}); err != nil {
+				t.Fatalf("DownloadToWriter: %v", err)
+			}
+			if err := client.CopyObject(ctx, "p/data.bin", "p/copy.bin"); err != nil {
+				t.Fatalf("CopyObject: %v", err)
+			}
+			if err := client.CopyObject(ctx, "p/large.bin", "p/large-copy.bin"); err != nil {
+				t.Fatalf("CopyObject of a large object: %v", err)
+			}
+
+			want := ""
+			if requesterPays {
+				want = "requester"
+			}
+			ops := []string{"ListObjectsV2", http.MethodHead, http.MethodGet, "GET range",
+				"CopyObject", "CreateMultipartUpload", "UploadPartCopy", "CompleteMultipartUpload"}
+			for _, op := range ops {
+				if len(payers[op]) == 0 {
+					t.Errorf("no %s request was sent", op)
+				}
+				for _, got := range payers[op] {
+					if got != want {
+						t.Errorf("%s sent x-amz-request-payer %q, want %q", op, got, want)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Input and output formats accepted by SelectQuery
+const (
+	SelectFormatCSV     = "CSV"
+	SelectFormatJSON    = "JSON"
+	SelectFormatParquet = "Parquet"
+)
+
+// SelectQuery runs an S3 Select SQL expression against key and returns a
+// reader over the matching records serialised as outputFormat (CSV or JSON).
+// The input is read as inputFormat: CSV with a header row, JSON lines, or
+// Parquet. Errors that occur while streaming are returned from Read.
+func (c *S3Client) SelectQuery(ctx context.Context, key, expression, inputFormat, outputFormat string) (io.ReadCloser, error) {
+	input, err := selectInput(inputFormat)
+	if err != nil {
+		return nil, err
+	}
+	output, err := selectOutput(outputFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.SelectObjectContent(ctx, &s3.SelectObjectContentInput{
+		Bucket:              aws.String(c.bucket),
+		Key:                 aws.String(key),
+		Expression:          aws.String(expression),
+		ExpressionType:      types.ExpressionTypeSql,
+		InputSerialization:  input,
+		OutputSerialization: output,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to select from %s: %w", key, err)
+	}
+
+	stream := resp.GetStream()
+	pr, pw := io.Pipe()
+	go func() {
+		defer stream.Close()
+		for event := range stream.Events() {
+			switch e := event.(type) {
+			case *types.SelectObjectContentEventStreamMemberRecords:
+				if _, err := pw.Write(e.Value.Payload); err != nil {
+					return // reader closed
+				}
+			case *types.SelectObjectContentEventStreamMemberEnd:
+				pw.Close()
+				return
+			}
+		}
+		// The stream ended without an End event, so the result is incomplete
+		err := stream.Err()
+		if err == nil {
+			err = errors.New("stream ended before the end of the result")
+		}
+		pw.CloseWithError(fmt.Errorf("failed to select from %s: %w", key, err))
+	}()
+
+	return pr, nil
+}
+
+// selectInput returns the input serialisation of an S3 Select input format
+func selectInput(format string) (*types.InputSerialization, error) {
+	switch {
+	case strings.EqualFold(format, SelectFormatCSV):
+		return &types.InputSerialization{CSV: &types.CSVInput{FileHeaderInfo: types.FileHeaderInfoUse}}, nil
+	case strings.EqualFold(format, SelectFormatJSON):
+		return &types.InputSerialization{JSON: &types.JSONInput{Type: types.JSONTypeLines}}, nil
+	case strings.EqualFold(format, SelectFormatParquet):
+		return &types.InputSerialization{Parquet: &types.ParquetInput{}}, nil
+	}
+	return nil, fmt.Errorf("unsupported S3 Select input format %q, expected CSV, JSON or Parquet", format)
+}
+
+// selectOutput returns the output serialisation of an S3 Select output format
+func selectOutput(format string) (*types.OutputSerialization, error) {
+	switch {
+	case strings.EqualFold(format, SelectFormatCSV):
+		return &types.OutputSerialization{CSV: &types.CSVOutput{}}, nil
+	case strings.EqualFold(format, SelectFormatJSON):
+		return &types.OutputSerialization{JSON: &types.JSONOutput{}}, nil
+	}
+	return nil, fmt.Errorf("unsupported S3 Select output format %q, expected CSV or JSON", format)
+}
+
+// SelectOutputFormat is the output format used for an input format: CSV
+// stays CSV, JSON and Parquet become JSON lines
+func SelectOutputFormat(inputFormat string) string {
+	if strings.EqualFold(inputFormat, SelectFormatCSV) {
+		return SelectFormatCSV
+	}
+	return SelectFormatJSON
+}
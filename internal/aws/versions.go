@@ -0,0 +1,146 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ObjectVersion is one version of an object, or a delete marker, as listed
+// by ListVersions
+type ObjectVersion struct {
+	Key          string    `json:"key"`
+	VersionID    string    `json:"version_id"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+	IsLatest     bool      `json:"is_latest"`
+	DeleteMarker bool      `json:"delete_marker,omitempty"`
+}
+
+// ListVersions returns every version and delete marker of key, newest
+// first. An object in a bucket that was never versioned has a single
+// version with ID "null".
+func (c *S3Client) ListVersions(ctx context.Context, key string) ([]ObjectVersion, error) {
+	var versions []ObjectVersion
+	paginator := s3.NewListObjectVersionsPaginator(c.client, &s3.ListObjectVersionsInput{
+		Bucket:       aws.String(c.bucket),
+		Prefix:       aws.String(key),
+		RequestPayer: c.requestPayer,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list versions of %s: %w", key, err)
+		}
+		// The prefix also matches longer keys
+		for _, v := range page.Versions {
+			if aws.ToString(v.Key) != key {
+				continue
+			}
+			versions = append(versions, ObjectVersion{
+				Key:          key,
+				VersionID:    aws.ToString(v.VersionId),
+				Size:         aws.ToInt64(v.Size),
+				ETag:         aws.ToString(v.ETag),
+				LastModified: aws.ToTime(v.LastModified),
+				IsLatest:     aws.ToBool(v.IsLatest),
+			})
+		}
+		for _, m := range page.DeleteMarkers {
+			if aws.ToString(m.Key) != key {
+				continue
+			}
+			versions = append(versions, ObjectVersion{
+				Key:          key,
+				VersionID:    aws.ToString(m.VersionId),
+				LastModified: aws.ToTime(m.LastModified),
+				IsLatest:     aws.ToBool(m.IsLatest),
+				DeleteMarker: true,
+			})
+		}
+	}
+
+	// Versions and delete markers come in separate lists
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].LastModified.After(versions[j].LastModified)
+	})
+	return versions, nil
+}
+
+// DownloadVersion downloads the version versionID of key to localPath, or
+// its latest version when versionID is empty, and returns the metadata of
+// the version downloaded. It fails with ErrObjectNotFound when the key or
+// version does not exist.
+func (c *S3Client) DownloadVersion(ctx context.Context, key, versionID, localPath string) (FileInfo, error) {
+	var version *string
+	if versionID != "" {
+		version = aws.String(versionID)
+	}
+	head, err := c.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(c.bucket),
+		Key:          aws.String(key),
+		VersionId:    version,
+		RequestPayer: c.requestPayer,
+	})
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return FileInfo{}, fmt.Errorf("%w: %s", ErrObjectNotFound, versionName(key, versionID))
+		}
+		return FileInfo{}, fmt.Errorf("failed to get metadata of %s: %w", versionName(key, versionID), err)
+	}
+	info := FileInfo{
+		Key:          key,
+		Size:         aws.ToInt64(head.ContentLength),
+		ETag:         aws.ToString(head.ETag),
+		LastModified: aws.ToTime(head.LastModified),
+		StorageClass: string(head.StorageClass),
+		ContentType:  aws.ToString(head.ContentType),
+		VersionID:    aws.ToString(head.VersionId),
+	}
+	if info.StorageClass == "" {
+		info.StorageClass = string(types.StorageClassStandard)
+	}
+
+	dir := filepath.Dir(localPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return FileInfo{}, fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+	file, err := os.Create(localPath)
+	if err != nil {
+		return FileInfo{}, fmt.Errorf("failed to create file %s: %w", localPath, err)
+	}
+	defer file.Close()
+
+	// Pin the version found so a newer upload cannot slip in between
+	_, err = c.downloader.Download(ctx, file, &s3.GetObjectInput{
+		Bucket:       aws.String(c.bucket),
+		Key:          aws.String(key),
+		VersionId:    head.VersionId,
+		RequestPayer: c.requestPayer,
+	})
+	if err != nil {
+		return FileInfo{}, fmt.Errorf("failed to download file %s: %w", versionName(key, info.VersionID), err)
+	}
+
+	log.Printf("Successfully downloaded %s to %s", versionName(key, info.VersionID), localPath)
+	return info, nil
+}
+
+// versionName names version versionID of key in messages
+func versionName(key, versionID string) string {
+	if versionID == "" {
+		return key
+	}
+	return key + " version " + versionID
+}
@@ -1,9 +1,13 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -13,13 +17,131 @@ type Config struct {
 	AWS_ACCESS_KEY_ID     string
 	AWS_SECRET_ACCESS_KEY string
 	AWS_REGION            string
+	AUTO_DETECT_REGION    bool
+	AWS_PROFILE           string
+	AWS_ROLE_ARN          string
+	HTTP_PROXY_URL        string
+	NO_PROXY              string
+	TLS_SKIP_VERIFY       bool
+	TLS_CERT_FILE         string
+	TLS_KEY_FILE          string
+	TLS_CA_FILE           string
+	CUSTOM_HEADERS        map[string]string
 	S3_BUCKET             string
+	S3_OBJECT_LAMBDA_ARN  string
+	REQUESTER_PAYS        bool
 	S3_PREFIX             string
 	LOCAL_DIR             string
+	STAGING_DIR           string
+	STAGING_TTL           time.Duration
 	DB_PATH               string
+	PID_LOCK_FILE         string
+	PARTITION_BY_DATE     bool
+	PARQUET_READ_WORKERS  int
 	MAX_WORKERS           int
 	BATCH_SIZE            int
 	RATE_LIMIT_PER_SEC    int
+	RATE_LIMIT_BURST      int
+	RATE_LIMIT_ALGORITHM  string
+	PREFIX_RATE_LIMITS    map[string]int
+	FORCE_REDOWNLOAD      bool
+	FORCE_KEYS            string
+	SKIP_EXISTING         bool
+	DELTA_SYNC_ALGORITHM  string
+	MODIFIED_AFTER        time.Time
+	PATH_TEMPLATE         string
+	PRESERVE_TIMESTAMPS   bool
+	POST_PROCESSOR_CMD    string
+	CONTENT_TYPE_ROUTING  map[string]string
+	STORAGE_CLASS_DIRS    map[string]string
+	HEALTH_PORT           int
+	HEALTH_CHECK_KEY      string
+	METRICS_ENABLED       bool
+	API_PORT              int
+	API_TOKEN             string
+	WATCH_MODE            bool
+	FILE_WATCHER_ENABLED  bool
+	POLL_INTERVAL_SECONDS time.Duration
+	POLL_JITTER_SECONDS   time.Duration
+	SQS_QUEUE_URL         string
+	SNS_TOPIC_ARN         string
+	SNS_NOTIFY_ON         string
+	SLACK_WEBHOOK_URL     string
+	SLACK_NOTIFY_ON       string
+	ADAPTIVE_CONCURRENCY  bool
+	ERROR_RATE_THRESHOLD  float64
+	DOWNLOAD_PRIORITY     string
+	MAX_QUEUE_DEPTH       int
+	HASH_INDEX_PATH       string
+	MAX_FILES_PER_RUN     int
+	CHECKPOINT_PATH       string
+	CHECKPOINT_INTERVAL   int
+	MIN_FREE_BYTES        int64
+	MAX_FILE_SIZE_BYTES   int64
+	MAX_RUN_COST_USD      float64
+	COST_REPORT_PATH      string
+	MANIFEST_PATH         string
+	MANIFEST_FORMAT       string
+	AUDIT_LOG_PATH        string
+	RESULT_FILE_PATH      string
+	MAX_RETRIES           int
+	DEAD_LETTER_PATH      string
+	MAX_DLQ_SIZE_MB       int
+
+	DOWNLOAD_TIMEOUT_SECONDS time.Duration
+	LIST_TIMEOUT_SECONDS     time.Duration
+	LIST_RETRY_MAX_ATTEMPTS  int
+	LIST_RETRY_BASE_DELAY_MS int
+	GLOBAL_TIMEOUT_SECONDS   time.Duration
+	MULTIPART_THRESHOLD_MB   int
+	DOWNLOAD_BUFFER_SIZE     int
+	DECOMPRESS_ON_DOWNLOAD   bool
+	S3_SELECT_EXPRESSION     string
+	S3_SELECT_INPUT_FORMAT   string
+	USE_INVENTORY            bool
+	INVENTORY_MANIFEST_KEY   string
+	DEDUPLICATE_DOWNLOADS    bool
+
+	SHUTDOWN_DRAIN_TIMEOUT_SECONDS time.Duration
+	REQUIRE_REPLICATION_COMPLETE   bool
+
+	AWS_ROLE_DURATION_SECONDS          time.Duration
+	ROLE_REFRESH_BEFORE_EXPIRY_MINUTES int
+
+	BLOOM_FALSE_POSITIVE_RATE float64
+	PRESIGN_EXPIRY_SECONDS    time.Duration
+
+	CRON_EXPRESSION string
+
+	KAFKA_BROKERS     string
+	KAFKA_TOPIC       string
+	KAFKA_ASYNC       bool
+	KAFKA_BUFFER_SIZE int
+
+	DISTRIBUTED_LOCK_ENABLED  bool
+	LOCK_TABLE_NAME           string
+	LOCK_WAIT_TIMEOUT_SECONDS time.Duration
+
+	SYNC_TARGETS          string
+	PARALLEL_TARGET_COUNT int
+	WORKERS_PER_PREFIX    int
+
+	CIRCUIT_BREAKER_THRESHOLD     int
+	CIRCUIT_BREAKER_RESET_TIMEOUT time.Duration
+
+	THROTTLE_DETECTION_THRESHOLD int
+	THROTTLE_BACKOFF_DURATION    time.Duration
+
+	LOG_OUTPUT_FILE  string
+	LOG_MAX_SIZE_MB  int
+	LOG_MAX_BACKUPS  int
+	LOG_MAX_AGE_DAYS int
+
+	CLOUDWATCH_NAMESPACE       string
+	CLOUDWATCH_DIMENSION_NAME  string
+	CLOUDWATCH_DIMENSION_VALUE string
+
+	LAZY_LOAD_THRESHOLD_RECORDS int
 }
 
 // Load loads the configuration from a .env file or uses hardcoded defaults
@@ -29,18 +151,192 @@ func Load() *Config {
 		log.Println("No .env file found, using hardcoded defaults")
 	}
 
+	return fromEnv()
+}
+
+// LoadFile loads the configuration from the given .env file. Unlike Load, a
+// missing or unreadable file is an error since the caller asked for it explicitly.
+func LoadFile(path string) (*Config, error) {
+	if err := godotenv.Load(path); err != nil {
+		return nil, fmt.Errorf("failed to load config file %s: %w", path, err)
+	}
+
+	return fromEnv(), nil
+}
+
+// fromEnv builds a Config from the environment, falling back to hardcoded defaults
+func fromEnv() *Config {
+	// A cron schedule replaces the poll interval, so only default one without it
+	cronExpression := getEnv("CRON_EXPRESSION", "")
+	pollInterval := 5 * time.Minute
+	if cronExpression != "" {
+		pollInterval = 0
+	}
+
+	// The burst defaults to one second's worth of downloads
+	rateLimit := getEnvInt("RATE_LIMIT_PER_SEC", 100)
+
+	// The PID lock sits next to the database it protects
+	dbPath := getEnv("DB_PATH", "./s3_sync_status.parquet")
+
+	// On ECS the task knows its region, so AWS_REGION may be left out
+	region := getEnv("AWS_REGION", "")
+	if region == "" {
+		region = ecsRegion()
+	}
+
 	return &Config{
-		AWS_ACCESS_KEY_ID:     getEnv("AWS_ACCESS_KEY_ID", "YOUR_AWS_ACCESS_KEY_ID"),
-		AWS_SECRET_ACCESS_KEY: getEnv("AWS_SECRET_ACCESS_KEY", "YOUR_AWS_SECRET_ACCESS_KEY"),
-		AWS_REGION:            getEnv("AWS_REGION", "us-east-1"),
+		AWS_ACCESS_KEY_ID:     getEnv("AWS_ACCESS_KEY_ID", ""),
+		AWS_SECRET_ACCESS_KEY: getEnv("AWS_SECRET_ACCESS_KEY", ""),
+		AWS_REGION:            region,
+		AUTO_DETECT_REGION:    getEnvBool("AUTO_DETECT_REGION", false),
+		AWS_PROFILE:           getEnv("AWS_PROFILE", ""),
+		AWS_ROLE_ARN:          getEnv("AWS_ROLE_ARN", ""),
+		HTTP_PROXY_URL:        getEnv("HTTP_PROXY_URL", ""),
+		NO_PROXY:              getEnv("NO_PROXY", ""),
+		TLS_SKIP_VERIFY:       getEnvBool("TLS_SKIP_VERIFY", false),
+		TLS_CERT_FILE:         getEnv("TLS_CERT_FILE", ""),
+		TLS_KEY_FILE:          getEnv("TLS_KEY_FILE", ""),
+		TLS_CA_FILE:           getEnv("TLS_CA_FILE", ""),
+		CUSTOM_HEADERS:        getEnvMapSep("CUSTOM_HEADERS", ";"),
 		S3_BUCKET:             getEnv("S3_BUCKET", "your-s3-bucket-name"),
+		S3_OBJECT_LAMBDA_ARN:  getEnv("S3_OBJECT_LAMBDA_ARN", ""),
+		REQUESTER_PAYS:        getEnvBool("REQUESTER_PAYS", false),
 		S3_PREFIX:             getEnv("S3_PREFIX", "your-s3-prefix/"),
 		LOCAL_DIR:             getEnv("LOCAL_DIR", "./data"),
-		DB_PATH:               getEnv("DB_PATH", "./s3_sync_status.parquet"),
+		STAGING_DIR:           getEnv("STAGING_DIR", ""),
+		STAGING_TTL:           getEnvDuration("STAGING_TTL", time.Hour),
+		DB_PATH:               dbPath,
+		PID_LOCK_FILE:         getEnv("PID_LOCK_FILE", dbPath+".lock"),
+		PARTITION_BY_DATE:     getEnvBool("PARTITION_BY_DATE", false),
+		PARQUET_READ_WORKERS:  getEnvInt("PARQUET_READ_WORKERS", 4),
 		MAX_WORKERS:           getEnvInt("MAX_WORKERS", 50),
 		BATCH_SIZE:            getEnvInt("BATCH_SIZE", 100),
-		RATE_LIMIT_PER_SEC:    getEnvInt("RATE_LIMIT_PER_SEC", 100),
+		RATE_LIMIT_PER_SEC:    rateLimit,
+		RATE_LIMIT_BURST:      getEnvInt("RATE_LIMIT_BURST", rateLimit),
+		RATE_LIMIT_ALGORITHM:  getEnv("RATE_LIMIT_ALGORITHM", "token_bucket"),
+		PREFIX_RATE_LIMITS:    getEnvIntMap("PREFIX_RATE_LIMITS"),
+		FORCE_REDOWNLOAD:      getEnvBool("FORCE_REDOWNLOAD", false),
+		FORCE_KEYS:            getEnv("FORCE_KEYS", ""),
+		SKIP_EXISTING:         getEnvBool("SKIP_EXISTING", false),
+		DELTA_SYNC_ALGORITHM:  getEnv("DELTA_SYNC_ALGORITHM", "etag"),
+		MODIFIED_AFTER:        getEnvTime("MODIFIED_AFTER"),
+		PATH_TEMPLATE:         getEnv("PATH_TEMPLATE", ""),
+		PRESERVE_TIMESTAMPS:   getEnvBool("PRESERVE_TIMESTAMPS", false),
+		POST_PROCESSOR_CMD:    getEnv("POST_PROCESSOR_CMD", ""),
+		CONTENT_TYPE_ROUTING:  getEnvMap("CONTENT_TYPE_ROUTING"),
+		STORAGE_CLASS_DIRS:    getEnvMap("STORAGE_CLASS_DIRS"),
+		HEALTH_PORT:           getEnvInt("HEALTH_PORT", 0),
+		HEALTH_CHECK_KEY:      getEnv("HEALTH_CHECK_KEY", ""),
+		METRICS_ENABLED:       getEnvBool("METRICS_ENABLED", false),
+		API_PORT:              getEnvInt("API_PORT", 0),
+		API_TOKEN:             getEnv("API_TOKEN", ""),
+		WATCH_MODE:            getEnvBool("WATCH_MODE", false),
+		FILE_WATCHER_ENABLED:  getEnvBool("FILE_WATCHER_ENABLED", false),
+		POLL_INTERVAL_SECONDS: getEnvDuration("POLL_INTERVAL_SECONDS", pollInterval),
+		POLL_JITTER_SECONDS:   getEnvDuration("POLL_JITTER_SECONDS", 0),
+		SQS_QUEUE_URL:         getEnv("SQS_QUEUE_URL", ""),
+		SNS_TOPIC_ARN:         getEnv("SNS_TOPIC_ARN", ""),
+		SNS_NOTIFY_ON:         getEnv("SNS_NOTIFY_ON", "always"),
+		SLACK_WEBHOOK_URL:     getEnv("SLACK_WEBHOOK_URL", ""),
+		SLACK_NOTIFY_ON:       getEnv("SLACK_NOTIFY_ON", "always"),
+		ADAPTIVE_CONCURRENCY:  getEnvBool("ADAPTIVE_CONCURRENCY", false),
+		ERROR_RATE_THRESHOLD:  getEnvFloat("ERROR_RATE_THRESHOLD", 0.05),
+		DOWNLOAD_PRIORITY:     getEnv("DOWNLOAD_PRIORITY", "smallest_first"),
+		MAX_QUEUE_DEPTH:       getEnvInt("MAX_QUEUE_DEPTH", 10000),
+		HASH_INDEX_PATH:       getEnv("HASH_INDEX_PATH", ""),
+		MAX_FILES_PER_RUN:     getEnvInt("MAX_FILES_PER_RUN", 0),
+		CHECKPOINT_PATH:       getEnv("CHECKPOINT_PATH", ""),
+		CHECKPOINT_INTERVAL:   getEnvInt("CHECKPOINT_INTERVAL", 1000),
+		MIN_FREE_BYTES:        getEnvInt64("MIN_FREE_BYTES", 0),
+		MAX_FILE_SIZE_BYTES:   getEnvInt64("MAX_FILE_SIZE_BYTES", 0),
+		MAX_RUN_COST_USD:      getEnvFloat("MAX_RUN_COST_USD", 0),
+		COST_REPORT_PATH:      getEnv("COST_REPORT_PATH", ""),
+		MANIFEST_PATH:         getEnv("MANIFEST_PATH", ""),
+		MANIFEST_FORMAT:       getEnv("MANIFEST_FORMAT", "json"),
+		AUDIT_LOG_PATH:        getEnv("AUDIT_LOG_PATH", ""),
+		RESULT_FILE_PATH:      getEnv("RESULT_FILE_PATH", ""),
+		MAX_RETRIES:           getEnvInt("MAX_RETRIES", 3),
+		DEAD_LETTER_PATH:      getEnv("DEAD_LETTER_PATH", ""),
+		MAX_DLQ_SIZE_MB:       getEnvInt("MAX_DLQ_SIZE_MB", 100),
+
+		DOWNLOAD_TIMEOUT_SECONDS: getEnvDuration("DOWNLOAD_TIMEOUT_SECONDS", 5*time.Minute),
+		LIST_TIMEOUT_SECONDS:     getEnvDuration("LIST_TIMEOUT_SECONDS", 0),
+		LIST_RETRY_MAX_ATTEMPTS:  getEnvInt("LIST_RETRY_MAX_ATTEMPTS", 5),
+		LIST_RETRY_BASE_DELAY_MS: getEnvInt("LIST_RETRY_BASE_DELAY_MS", 200),
+		GLOBAL_TIMEOUT_SECONDS:   getEnvDuration("GLOBAL_TIMEOUT_SECONDS", 0),
+		MULTIPART_THRESHOLD_MB:   getEnvInt("MULTIPART_THRESHOLD_MB", 100),
+		DOWNLOAD_BUFFER_SIZE:     getEnvInt("DOWNLOAD_BUFFER_SIZE", 5*1024*1024),
+		DECOMPRESS_ON_DOWNLOAD:   getEnvBool("DECOMPRESS_ON_DOWNLOAD", false),
+		S3_SELECT_EXPRESSION:     getEnv("S3_SELECT_EXPRESSION", ""),
+		S3_SELECT_INPUT_FORMAT:   getEnv("S3_SELECT_INPUT_FORMAT", "CSV"),
+		USE_INVENTORY:            getEnvBool("USE_INVENTORY", false),
+		INVENTORY_MANIFEST_KEY:   getEnv("INVENTORY_MANIFEST_KEY", ""),
+		DEDUPLICATE_DOWNLOADS:    getEnvBool("DEDUPLICATE_DOWNLOADS", false),
+
+		SHUTDOWN_DRAIN_TIMEOUT_SECONDS: getEnvDuration("SHUTDOWN_DRAIN_TIMEOUT_SECONDS", time.Minute),
+		REQUIRE_REPLICATION_COMPLETE:   getEnvBool("REQUIRE_REPLICATION_COMPLETE", false),
+
+		AWS_ROLE_DURATION_SECONDS:          getEnvDuration("AWS_ROLE_DURATION_SECONDS", time.Hour),
+		ROLE_REFRESH_BEFORE_EXPIRY_MINUTES: getEnvInt("ROLE_REFRESH_BEFORE_EXPIRY_MINUTES", 10),
+
+		BLOOM_FALSE_POSITIVE_RATE: getEnvFloat("BLOOM_FALSE_POSITIVE_RATE", 0.01),
+		PRESIGN_EXPIRY_SECONDS:    getEnvDuration("PRESIGN_EXPIRY_SECONDS", time.Hour),
+
+		CRON_EXPRESSION: cronExpression,
+
+		KAFKA_BROKERS:     getEnv("KAFKA_BROKERS", ""),
+		KAFKA_TOPIC:       getEnv("KAFKA_TOPIC", ""),
+		KAFKA_ASYNC:       getEnvBool("KAFKA_ASYNC", false),
+		KAFKA_BUFFER_SIZE: getEnvInt("KAFKA_BUFFER_SIZE", 1000),
+
+		DISTRIBUTED_LOCK_ENABLED:  getEnvBool("DISTRIBUTED_LOCK_ENABLED", false),
+		LOCK_TABLE_NAME:           getEnv("LOCK_TABLE_NAME", ""),
+		LOCK_WAIT_TIMEOUT_SECONDS: getEnvDuration("LOCK_WAIT_TIMEOUT_SECONDS", time.Minute),
+
+		SYNC_TARGETS:          getEnv("SYNC_TARGETS", ""),
+		PARALLEL_TARGET_COUNT: getEnvInt("PARALLEL_TARGET_COUNT", 1),
+		WORKERS_PER_PREFIX:    getEnvInt("WORKERS_PER_PREFIX", 0),
+
+		CIRCUIT_BREAKER_THRESHOLD:     getEnvInt("CIRCUIT_BREAKER_THRESHOLD", 10),
+		CIRCUIT_BREAKER_RESET_TIMEOUT: getEnvDuration("CIRCUIT_BREAKER_RESET_TIMEOUT", 30*time.Second),
+
+		THROTTLE_DETECTION_THRESHOLD: getEnvInt("THROTTLE_DETECTION_THRESHOLD", 5),
+		THROTTLE_BACKOFF_DURATION:    getEnvDuration("THROTTLE_BACKOFF_DURATION", 5*time.Second),
+
+		LOG_OUTPUT_FILE:  getEnv("LOG_OUTPUT_FILE", ""),
+		LOG_MAX_SIZE_MB:  getEnvInt("LOG_MAX_SIZE_MB", 100),
+		LOG_MAX_BACKUPS:  getEnvInt("LOG_MAX_BACKUPS", 5),
+		LOG_MAX_AGE_DAYS: getEnvInt("LOG_MAX_AGE_DAYS", 30),
+
+		CLOUDWATCH_NAMESPACE:       getEnv("CLOUDWATCH_NAMESPACE", ""),
+		CLOUDWATCH_DIMENSION_NAME:  getEnv("CLOUDWATCH_DIMENSION_NAME", ""),
+		CLOUDWATCH_DIMENSION_VALUE: getEnv("CLOUDWATCH_DIMENSION_VALUE", ""),
+
+		LAZY_LOAD_THRESHOLD_RECORDS: getEnvInt("LAZY_LOAD_THRESHOLD_RECORDS", 100000),
+	}
+}
+
+// DefaultRegion is the region used when AWS_REGION is unset and the region
+// of the bucket cannot be detected
+const DefaultRegion = "us-east-1"
+
+// Region returns AWS_REGION, or DefaultRegion when it is unset. The S3
+// client fills in AWS_REGION with the region of the bucket when it can.
+func (c *Config) Region() string {
+	if c.AWS_REGION != "" {
+		return c.AWS_REGION
+	}
+	return DefaultRegion
+}
+
+// StagingDir returns the directory downloads are written to before they are
+// moved into LOCAL_DIR: STAGING_DIR, or LOCAL_DIR/.staging when it is unset
+func (c *Config) StagingDir() string {
+	if c.STAGING_DIR != "" {
+		return c.STAGING_DIR
 	}
+	return filepath.Join(c.LOCAL_DIR, ".staging")
 }
 
 // getEnv retrieves an environment variable or returns a default value
@@ -51,6 +347,47 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvMap retrieves an environment variable of comma-separated key=value
+// pairs, e.g. "text/csv=csv/,*=other/". Malformed pairs are ignored.
+func getEnvMap(key string) map[string]string {
+	return getEnvMapSep(key, ",")
+}
+
+// getEnvMapSep is getEnvMap with pairs separated by sep, for values that may
+// themselves contain commas
+func getEnvMapSep(key, sep string) map[string]string {
+	value, exists := os.LookupEnv(key)
+	if !exists || strings.TrimSpace(value) == "" {
+		return nil
+	}
+	result := make(map[string]string)
+	for _, pair := range strings.Split(value, sep) {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			continue
+		}
+		result[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return result
+}
+
+// getEnvIntMap retrieves an environment variable of comma-separated key=value
+// pairs with integer values, e.g. "archive/=5,realtime/=100". Malformed pairs
+// are ignored.
+func getEnvIntMap(key string) map[string]int {
+	pairs := getEnvMap(key)
+	if pairs == nil {
+		return nil
+	}
+	result := make(map[string]int, len(pairs))
+	for k, v := range pairs {
+		if intValue, err := strconv.Atoi(v); err == nil {
+			result[k] = intValue
+		}
+	}
+	return result
+}
+
 // getEnvInt retrieves an environment variable as integer or returns a default value
 func getEnvInt(key string, defaultValue int) int {
 	if value, exists := os.LookupEnv(key); exists {
@@ -59,4 +396,60 @@ func getEnvInt(key string, defaultValue int) int {
 		}
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
+
+// getEnvInt64 retrieves an environment variable as a 64-bit integer or returns a default value
+func getEnvInt64(key string, defaultValue int64) int64 {
+	if value, exists := os.LookupEnv(key); exists {
+		if intValue, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return intValue
+		}
+	}
+	return defaultValue
+}
+
+// getEnvDuration retrieves an environment variable as a duration such as
+// "30s" or "1h30m", or returns a default value. A plain integer is a number
+// of seconds, as these settings were before they took durations.
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, exists := os.LookupEnv(key); exists {
+		if seconds, err := strconv.Atoi(value); err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+	}
+	return defaultValue
+}
+
+// getEnvTime retrieves an environment variable as an RFC 3339 timestamp, or
+// returns the zero time when it is unset or malformed
+func getEnvTime(key string) time.Time {
+	if value, exists := os.LookupEnv(key); exists {
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// getEnvBool retrieves an environment variable as boolean or returns a default value
+func getEnvBool(key string, defaultValue bool) bool {
+	if value, exists := os.LookupEnv(key); exists {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+// getEnvFloat retrieves an environment variable as float or returns a default value
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value, exists := os.LookupEnv(key); exists {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
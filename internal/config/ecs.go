@@ -0,0 +1,72 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+)
+
+// ecsMetadataEnv names the task metadata endpoint v4, which the ECS agent
+// sets in every container of a task on ECS or Fargate
+const ecsMetadataEnv = "ECS_CONTAINER_METADATA_URI_V4"
+
+// ecsMetadataTimeout bounds the metadata request, so that a missing
+// endpoint delays startup by no more than this
+const ecsMetadataTimeout = 200 * time.Millisecond
+
+// ecsRegion returns the region of the ECS task the process runs in, taken
+// from the task ARN, or "" when not running on ECS or the endpoint cannot
+// be read in time
+func ecsRegion() string {
+	endpoint := os.Getenv(ecsMetadataEnv)
+	if endpoint == "" {
+		return ""
+	}
+	region, err := fetchECSRegion(endpoint)
+	if err != nil {
+		log.Printf("Could not read the region from the ECS task metadata: %v", err)
+		return ""
+	}
+	log.Printf("AWS_REGION is not set, using %s from the ECS task metadata", region)
+	return region
+}
+
+// fetchECSRegion reads the task ARN from the task metadata endpoint and
+// returns its region
+func fetchECSRegion(endpoint string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ecsMetadataTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(endpoint, "/")+"/task", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("task metadata endpoint returned %s", resp.Status)
+	}
+
+	var task struct {
+		TaskARN string `json:"TaskARN"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&task); err != nil {
+		return "", fmt.Errorf("failed to decode task metadata: %w", err)
+	}
+	// arn:aws:ecs:<region>:<account>:task/<cluster>/<id>
+	parsed, err := arn.Parse(task.TaskARN)
+	if err != nil || parsed.Region == "" {
+		return "", fmt.Errorf("task ARN %q has no region", task.TaskARN)
+	}
+	return parsed.Region, nil
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// maxSuggestionDistance is the largest edit distance at which a known key is
+// suggested for an unrecognised one
+const maxSuggestionDistance = 2
+
+// envKeyPrefixes are the prefixes of the environment variables read by the
+// application. Unknown variables with one of them are likely typos.
+var envKeyPrefixes = []string{
+	"AWS_", "S3_", "LOCAL_", "DB_", "MAX_", "BATCH_", "RATE_", "PARQUET_",
+	"SYNC_", "DOWNLOAD_", "STAGING_", "KAFKA_", "SNS_", "SLACK_",
+	"LOCK_", "LIST_", "CIRCUIT_BREAKER_", "THROTTLE_", "LOG_", "CLOUDWATCH_",
+}
+
+// sdkEnvPrefix starts the variables the AWS SDK reads itself, such as
+// AWS_SESSION_TOKEN, so unknown ones are only reported as likely typos
+const sdkEnvPrefix = "AWS_"
+
+// KnownEnvKeys returns the name of every environment variable read into
+// Config, which are the names of its fields
+func KnownEnvKeys() []string {
+	t := reflect.TypeOf(Config{})
+	keys := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		keys = append(keys, t.Field(i).Name)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ValidateEnvKeys returns a warning for every environment variable that
+// looks like a setting but is not one, e.g. AWS_ACESS_KEY_ID, with the
+// closest known key as a suggestion when one is within two edits. Since the
+// AWS SDK reads many AWS_ variables of its own, those are only reported when
+// a suggestion is found.
+func ValidateEnvKeys() []string {
+	known := KnownEnvKeys()
+	isKnown := make(map[string]bool, len(known))
+	for _, k := range known {
+		isKnown[k] = true
+	}
+
+	var warnings []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if isKnown[name] || !hasEnvKeyPrefix(name) {
+			continue
+		}
+		suggestion := closestKey(name, known)
+		switch {
+		case suggestion != "":
+			warnings = append(warnings, fmt.Sprintf("unknown setting %s, did you mean %s?", name, suggestion))
+		case !strings.HasPrefix(name, sdkEnvPrefix):
+			warnings = append(warnings, fmt.Sprintf("unknown setting %s", name))
+		}
+	}
+	sort.Strings(warnings)
+	return warnings
+}
+
+// hasEnvKeyPrefix reports whether name starts with one of envKeyPrefixes
+func hasEnvKeyPrefix(name string) bool {
+	for _, prefix := range envKeyPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// closestKey returns the known key nearest to name, or "" if none is within
+// maxSuggestionDistance edits
+func closestKey(name string, known []string) string {
+	best, bestDistance := "", maxSuggestionDistance+1
+	for _, k := range known {
+		if d := levenshtein(name, k); d < bestDistance {
+			best, bestDistance = k, d
+		}
+	}
+	return best
+}
+
+// levenshtein returns the number of single-character insertions, deletions
+// and substitutions that turn a into b
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
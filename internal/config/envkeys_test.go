@@ -0,0 +1,104 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// envWarning returns the warning of ValidateEnvKeys about name, or ""
+func envWarning(name string) string {
+	for _, w := range ValidateEnvKeys() {
+		if strings.HasPrefix(w, "unknown setting "+name+",") || w == "unknown setting "+name {
+			return w
+		}
+	}
+	return ""
+}
+
+func TestValidateEnvKeysTypos(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"AWS_ACESS_KEY_ID", "AWS_ACCESS_KEY_ID"},
+		{"AWS_SECRET_ACCES_KEY", "AWS_SECRET_ACCESS_KEY"},
+		{"AWS_REGOIN", "AWS_REGION"},
+		{"S3_BUCKT", "S3_BUCKET"},
+		{"S3_PREFX", "S3_PREFIX"},
+		{"LOCAL_DIRR", "LOCAL_DIR"},
+		{"DB_PAHT", "DB_PATH"},
+		{"MAX_WORKER", "MAX_WORKERS"},
+		{"BATCH_SIZ", "BATCH_SIZE"},
+		{"RATE_LIMIT_PER_SECS", "RATE_LIMIT_PER_SEC"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.name, "x")
+			want := "unknown setting " + tt.name + ", did you mean " + tt.want + "?"
+			if got := envWarning(tt.name); got != want {
+				t.Errorf("warning = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestValidateEnvKeysUnknown(t *testing.T) {
+	tests := []struct {
+		name string
+		// warned is whether the variable is reported at all
+		warned bool
+	}{
+		// Nothing close to suggest, but the prefix is the application's
+		{"S3_SOMETHING_UNRELATED", true},
+		// Read by the AWS SDK itself, not a typo of a setting
+		{"AWS_SESSION_TOKEN", false},
+		{"AWS_CA_BUNDLE", false},
+		// Not a prefix of the application
+		{"HOME_DIRECTORY", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.name, "x")
+			got := envWarning(tt.name)
+			if (got != "") != tt.warned {
+				t.Errorf("warning = %q, want warned = %v", got, tt.warned)
+			}
+			if strings.Contains(got, "did you mean") {
+				t.Errorf("warning %q suggests a key, want none", got)
+			}
+		})
+	}
+}
+
+func TestValidateEnvKeysKnown(t *testing.T) {
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "S3_BUCKET", "MAX_WORKERS", "RATE_LIMIT_BURST"} {
+		if !slices.Contains(KnownEnvKeys(), name) {
+			t.Errorf("KnownEnvKeys does not list %s", name)
+		}
+		t.Setenv(name, "1")
+		if got := envWarning(name); got != "" {
+			t.Errorf("known setting %s reported: %q", name, got)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"", "abc", 3},
+		{"S3_BUCKET", "S3_BUCKET", 0},
+		{"S3_BUCKT", "S3_BUCKET", 1},
+		{"AWS_REGOIN", "AWS_REGION", 2},
+		{"kitten", "sitting", 3},
+	}
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// DefaultJSONFile is the JSON config file picked up from the working
+// directory when neither --config nor CONFIG_FILE names one
+const DefaultJSONFile = "sava-config.json"
+
+//go:embed config.schema.json
+var schemaFS embed.FS
+
+// JSONSchema returns the JSON Schema of the config file read by LoadFromJSON,
+// for editors to validate and complete it
+func JSONSchema() []byte {
+	schema, err := schemaFS.ReadFile("config.schema.json")
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}
+
+// jsonDuration accepts a duration as a string such as "30s", or as a number
+// of seconds, and keeps it in the form getEnvDuration reads
+type jsonDuration string
+
+func (d *jsonDuration) UnmarshalJSON(data []byte) error {
+	var seconds int64
+	if err := json.Unmarshal(data, &seconds); err == nil {
+		*d = jsonDuration(strconv.FormatInt(seconds, 10))
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("expected a duration such as \"30s\" or a number of seconds")
+	}
+	if _, err := time.ParseDuration(s); err != nil {
+		return fmt.Errorf("invalid duration %q", s)
+	}
+	*d = jsonDuration(s)
+	return nil
+}
+
+// jsonTime accepts an RFC 3339 timestamp
+type jsonTime string
+
+func (t *jsonTime) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("expected an RFC 3339 timestamp")
+	}
+	if _, err := time.Parse(time.RFC3339, s); err != nil {
+		return fmt.Errorf("invalid RFC 3339 timestamp %q", s)
+	}
+	*t = jsonTime(s)
+	return nil
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// jsonFileType is a struct with a pointer field per Config field, tagged
+// with its camelCase JSON name, so that the decoder rejects unknown keys and
+// values of the wrong type and leaves absent keys nil
+var jsonFileType = buildJSONFileType()
+
+func buildJSONFileType() reflect.Type {
+	t := reflect.TypeOf(Config{})
+	fields := []reflect.StructField{{
+		// Lets a file name its schema for editors
+		Name: "Schema_",
+		Type: reflect.TypeOf((*string)(nil)),
+		Tag:  `json:"$schema"`,
+	}}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		var typ reflect.Type
+		switch {
+		case f.Type == durationType:
+			typ = reflect.TypeOf((*jsonDuration)(nil))
+		case f.Type == timeType:
+			typ = reflect.TypeOf((*jsonTime)(nil))
+		case f.Type.Kind() == reflect.Map:
+			typ = f.Type
+		default:
+			typ = reflect.PointerTo(f.Type)
+		}
+		fields = append(fields, reflect.StructField{
+			Name: f.Name,
+			Type: typ,
+			Tag:  reflect.StructTag(fmt.Sprintf(`json:"%s"`, JSONKey(f.Name))),
+		})
+	}
+	return reflect.StructOf(fields)
+}
+
+// JSONKey returns the camelCase JSON name of a Config field, e.g. awsRegion
+// for AWS_REGION and s3Bucket for S3_BUCKET
+func JSONKey(field string) string {
+	var b strings.Builder
+	for i, part := range strings.Split(strings.ToLower(field), "_") {
+		if i > 0 && part != "" {
+			r := []rune(part)
+			r[0] = unicode.ToUpper(r[0])
+			part = string(r)
+		}
+		b.WriteString(part)
+	}
+	return b.String()
+}
+
+// LoadFromJSON loads the configuration from a JSON file whose keys are the
+// Config fields in camelCase, e.g. {"awsRegion": "eu-west-1", "s3Bucket":
+// "exports"}. Unknown keys and values of the wrong type are errors.
+// Durations may be strings such as "5m" or numbers of seconds. Environment
+// variables still override the file, and settings in neither get their
+// hardcoded defaults.
+func LoadFromJSON(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	values := reflect.New(jsonFileType)
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(values.Interface()); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	// Hand the values to fromEnv as environment variables, the way a .env
+	// file is loaded, leaving variables that are already set alone
+	v := values.Elem()
+	for i := 1; i < v.NumField(); i++ {
+		name := jsonFileType.Field(i).Name
+		value, ok := envValue(name, v.Field(i))
+		if !ok {
+			continue
+		}
+		if _, set := os.LookupEnv(name); set {
+			continue
+		}
+		if err := os.Setenv(name, value); err != nil {
+			return nil, fmt.Errorf("failed to apply %s from %s: %w", JSONKey(name), path, err)
+		}
+	}
+	return fromEnv(), nil
+}
+
+// envValue formats a decoded field as its environment variable would be
+// written. It returns false for keys absent from the file.
+func envValue(name string, field reflect.Value) (string, bool) {
+	if field.IsNil() {
+		return "", false
+	}
+	if field.Kind() == reflect.Map {
+		sep := ","
+		if name == "CUSTOM_HEADERS" {
+			sep = ";"
+		}
+		pairs := make([]string, 0, field.Len())
+		iter := field.MapRange()
+		for iter.Next() {
+			pairs = append(pairs, fmt.Sprintf("%s=%v", iter.Key().Interface(), iter.Value().Interface()))
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, sep), true
+	}
+	return fmt.Sprint(field.Elem().Interface()), true
+}
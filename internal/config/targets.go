@@ -0,0 +1,60 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SyncTarget maps one S3 prefix to its own local directory and database file
+type SyncTarget struct {
+	Prefix       string `yaml:"prefix"`
+	LocalDir     string `yaml:"local_dir"`
+	DBPathSuffix string `yaml:"db_path_suffix"`
+}
+
+// ParseSyncTargets decodes SYNC_TARGETS, which is either an inline YAML list
+// of targets or the path of a .yaml/.yml file containing one. An empty value
+// yields no targets.
+func ParseSyncTargets(value string) ([]SyncTarget, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+
+	data := []byte(value)
+	if ext := strings.ToLower(filepath.Ext(value)); ext == ".yaml" || ext == ".yml" {
+		b, err := os.ReadFile(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SYNC_TARGETS file %s: %w", value, err)
+		}
+		data = b
+	}
+
+	var targets []SyncTarget
+	if err := yaml.Unmarshal(data, &targets); err != nil {
+		return nil, fmt.Errorf("failed to parse SYNC_TARGETS: %w", err)
+	}
+
+	suffixes := make(map[string]bool, len(targets))
+	for i, t := range targets {
+		if t.Prefix == "" || t.LocalDir == "" || t.DBPathSuffix == "" {
+			return nil, fmt.Errorf("SYNC_TARGETS entry %d: prefix, local_dir and db_path_suffix are required", i)
+		}
+		if suffixes[t.DBPathSuffix] {
+			return nil, fmt.Errorf("SYNC_TARGETS entry %d: duplicate db_path_suffix %q", i, t.DBPathSuffix)
+		}
+		suffixes[t.DBPathSuffix] = true
+	}
+	return targets, nil
+}
+
+// DBPath derives the database file of target from the base DB_PATH, e.g.
+// ./s3_sync_status.parquet with suffix "logs" becomes ./s3_sync_status_logs.parquet
+func (t SyncTarget) DBPath(base string) string {
+	ext := filepath.Ext(base)
+	return strings.TrimSuffix(base, ext) + "_" + t.DBPathSuffix + ext
+}
@@ -0,0 +1,322 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/robfig/cron/v3"
+)
+
+// maxPresignExpiry is the longest validity S3 allows for a presigned URL
+const maxPresignExpiry = 7 * 24 * time.Hour
+
+// minRoleDuration and maxRoleDuration bound the sessions STS AssumeRole issues
+const (
+	minRoleDuration = 15 * time.Minute
+	maxRoleDuration = 12 * time.Hour
+)
+
+// cronParser accepts the standard five-field format, an optional leading
+// seconds field, and descriptors such as @hourly
+var cronParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// ParseCronExpression parses a CRON_EXPRESSION schedule
+func ParseCronExpression(expr string) (cron.Schedule, error) {
+	schedule, err := cronParser.Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CRON_EXPRESSION %q: %w", expr, err)
+	}
+	return schedule, nil
+}
+
+// Validate reports settings that are invalid or contradict each other
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.CRON_EXPRESSION != "" {
+		if c.POLL_INTERVAL_SECONDS > 0 {
+			errs = append(errs, errors.New("CRON_EXPRESSION and POLL_INTERVAL_SECONDS cannot both be set"))
+		}
+		if _, err := ParseCronExpression(c.CRON_EXPRESSION); err != nil {
+			errs = append(errs, err)
+		}
+	} else if c.WATCH_MODE && c.POLL_INTERVAL_SECONDS <= 0 {
+		errs = append(errs, fmt.Errorf("POLL_INTERVAL_SECONDS must be positive in watch mode, got %v", c.POLL_INTERVAL_SECONDS))
+	}
+
+	if c.FORCE_KEYS != "" {
+		if _, err := path.Match(c.FORCE_KEYS, ""); err != nil {
+			errs = append(errs, fmt.Errorf("invalid FORCE_KEYS pattern %q: %w", c.FORCE_KEYS, err))
+		}
+	}
+
+	switch c.SNS_NOTIFY_ON {
+	case "always", "failure", "never":
+	default:
+		errs = append(errs, fmt.Errorf("SNS_NOTIFY_ON must be always, failure or never, got %q", c.SNS_NOTIFY_ON))
+	}
+
+	if c.USE_INVENTORY && c.INVENTORY_MANIFEST_KEY == "" {
+		errs = append(errs, errors.New("INVENTORY_MANIFEST_KEY must be set when USE_INVENTORY is enabled"))
+	}
+
+	// A decompressed file no longer matches its key's name, so it cannot be
+	// linked under another key and decompressed again
+	if c.DEDUPLICATE_DOWNLOADS && c.DECOMPRESS_ON_DOWNLOAD {
+		errs = append(errs, errors.New("DEDUPLICATE_DOWNLOADS cannot be combined with DECOMPRESS_ON_DOWNLOAD"))
+	}
+	if c.HASH_INDEX_PATH != "" && !c.DEDUPLICATE_DOWNLOADS {
+		errs = append(errs, errors.New("HASH_INDEX_PATH requires DEDUPLICATE_DOWNLOADS"))
+	}
+
+	// The SHA256 of a downloaded file is compared with the checksum of the
+	// object, so the file must hold the object's content unchanged
+	switch c.DELTA_SYNC_ALGORITHM {
+	case "etag":
+	case "sha256":
+		for _, conflict := range []struct {
+			name string
+			set  bool
+		}{
+			{"DEDUPLICATE_DOWNLOADS", c.DEDUPLICATE_DOWNLOADS},
+			{"POST_PROCESSOR_CMD", c.POST_PROCESSOR_CMD != ""},
+			{"S3_SELECT_EXPRESSION", c.S3_SELECT_EXPRESSION != ""},
+			{"S3_OBJECT_LAMBDA_ARN", c.S3_OBJECT_LAMBDA_ARN != ""},
+		} {
+			if conflict.set {
+				errs = append(errs, fmt.Errorf("DELTA_SYNC_ALGORITHM=sha256 cannot be combined with %s", conflict.name))
+			}
+		}
+	default:
+		errs = append(errs, fmt.Errorf("DELTA_SYNC_ALGORITHM must be etag or sha256, got %q", c.DELTA_SYNC_ALGORITHM))
+	}
+
+	// STS issues role sessions of 15 minutes to 12 hours, further limited by
+	// the maximum session duration of the role
+	if c.AWS_ROLE_ARN != "" {
+		if a, err := arn.Parse(c.AWS_ROLE_ARN); err != nil || a.Service != "iam" || !strings.HasPrefix(a.Resource, "role/") {
+			errs = append(errs, fmt.Errorf("AWS_ROLE_ARN must be an IAM role ARN, got %q", c.AWS_ROLE_ARN))
+		}
+		if c.AWS_ROLE_DURATION_SECONDS < minRoleDuration || c.AWS_ROLE_DURATION_SECONDS > maxRoleDuration {
+			errs = append(errs, fmt.Errorf("AWS_ROLE_DURATION_SECONDS must be between %v and %v, got %v", minRoleDuration, maxRoleDuration, c.AWS_ROLE_DURATION_SECONDS))
+		}
+		refreshBefore := time.Duration(c.ROLE_REFRESH_BEFORE_EXPIRY_MINUTES) * time.Minute
+		if refreshBefore < 0 || refreshBefore >= c.AWS_ROLE_DURATION_SECONDS {
+			errs = append(errs, fmt.Errorf("ROLE_REFRESH_BEFORE_EXPIRY_MINUTES must be at least 0 and less than AWS_ROLE_DURATION_SECONDS, got %d", c.ROLE_REFRESH_BEFORE_EXPIRY_MINUTES))
+		}
+	}
+
+	if c.DISTRIBUTED_LOCK_ENABLED && c.LOCK_TABLE_NAME == "" {
+		errs = append(errs, errors.New("LOCK_TABLE_NAME must be set when DISTRIBUTED_LOCK_ENABLED is enabled"))
+	}
+
+	if c.BLOOM_FALSE_POSITIVE_RATE < 0 || c.BLOOM_FALSE_POSITIVE_RATE >= 1 {
+		errs = append(errs, fmt.Errorf("BLOOM_FALSE_POSITIVE_RATE must be at least 0 and less than 1, got %v", c.BLOOM_FALSE_POSITIVE_RATE))
+	}
+
+	// S3 rejects presigned URLs valid for longer than seven days
+	if c.PRESIGN_EXPIRY_SECONDS < time.Second || c.PRESIGN_EXPIRY_SECONDS > maxPresignExpiry {
+		errs = append(errs, fmt.Errorf("PRESIGN_EXPIRY_SECONDS must be between 1s and %v (7 days), got %v", maxPresignExpiry, c.PRESIGN_EXPIRY_SECONDS))
+	}
+
+	// Zero disables the timeouts and intervals that are optional
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"POLL_INTERVAL_SECONDS", c.POLL_INTERVAL_SECONDS},
+		{"POLL_JITTER_SECONDS", c.POLL_JITTER_SECONDS},
+		{"DOWNLOAD_TIMEOUT_SECONDS", c.DOWNLOAD_TIMEOUT_SECONDS},
+		{"LIST_TIMEOUT_SECONDS", c.LIST_TIMEOUT_SECONDS},
+		{"GLOBAL_TIMEOUT_SECONDS", c.GLOBAL_TIMEOUT_SECONDS},
+		{"STAGING_TTL", c.STAGING_TTL},
+		{"SHUTDOWN_DRAIN_TIMEOUT_SECONDS", c.SHUTDOWN_DRAIN_TIMEOUT_SECONDS},
+		{"LOCK_WAIT_TIMEOUT_SECONDS", c.LOCK_WAIT_TIMEOUT_SECONDS},
+		{"CIRCUIT_BREAKER_RESET_TIMEOUT", c.CIRCUIT_BREAKER_RESET_TIMEOUT},
+		{"THROTTLE_BACKOFF_DURATION", c.THROTTLE_BACKOFF_DURATION},
+	} {
+		if d.value < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative, got %v", d.name, d.value))
+		}
+	}
+
+	if c.ADAPTIVE_CONCURRENCY && (c.ERROR_RATE_THRESHOLD <= 0 || c.ERROR_RATE_THRESHOLD >= 1) {
+		errs = append(errs, fmt.Errorf("ERROR_RATE_THRESHOLD must be between 0 and 1, got %v", c.ERROR_RATE_THRESHOLD))
+	}
+
+	if c.API_PORT != 0 && c.API_TOKEN == "" {
+		errs = append(errs, errors.New("API_TOKEN must be set when API_PORT is set"))
+	}
+
+	switch c.SLACK_NOTIFY_ON {
+	case "always", "failure", "success":
+	default:
+		errs = append(errs, fmt.Errorf("SLACK_NOTIFY_ON must be always, failure or success, got %q", c.SLACK_NOTIFY_ON))
+	}
+
+	if c.S3_SELECT_EXPRESSION != "" {
+		switch strings.ToUpper(c.S3_SELECT_INPUT_FORMAT) {
+		case "CSV", "JSON", "PARQUET":
+		default:
+			errs = append(errs, fmt.Errorf("S3_SELECT_INPUT_FORMAT must be CSV, JSON or Parquet, got %q", c.S3_SELECT_INPUT_FORMAT))
+		}
+	}
+
+	// Streamed objects never reach LOCAL_DIR, so there is no file to query or link
+	if c.POST_PROCESSOR_CMD != "" {
+		if strings.TrimSpace(c.POST_PROCESSOR_CMD) == "" {
+			errs = append(errs, errors.New("POST_PROCESSOR_CMD must name a command"))
+		}
+		if c.S3_SELECT_EXPRESSION != "" {
+			errs = append(errs, errors.New("POST_PROCESSOR_CMD cannot be combined with S3_SELECT_EXPRESSION"))
+		}
+		if c.DEDUPLICATE_DOWNLOADS {
+			errs = append(errs, errors.New("POST_PROCESSOR_CMD cannot be combined with DEDUPLICATE_DOWNLOADS"))
+		}
+	}
+
+	// Object Lambda access point ARNs look like
+	// arn:aws:s3-object-lambda:region:account:accesspoint/name
+	if c.S3_OBJECT_LAMBDA_ARN != "" {
+		if a, err := arn.Parse(c.S3_OBJECT_LAMBDA_ARN); err != nil || a.Service != "s3-object-lambda" || !strings.HasPrefix(a.Resource, "accesspoint/") {
+			errs = append(errs, fmt.Errorf("S3_OBJECT_LAMBDA_ARN must be an S3 Object Lambda access point ARN, got %q", c.S3_OBJECT_LAMBDA_ARN))
+		}
+		if c.S3_SELECT_EXPRESSION != "" {
+			errs = append(errs, errors.New("S3_OBJECT_LAMBDA_ARN cannot be combined with S3_SELECT_EXPRESSION"))
+		}
+	}
+
+	// REQUESTER_PAYS bills the requests and transfer to the account of the
+	// credentials, which must be allowed to incur charges; that can only be
+	// told from the AccessDenied of the first request
+	if c.REQUESTER_PAYS && c.S3_SELECT_EXPRESSION != "" {
+		// SelectObjectContent cannot be sent as a Requester Pays request
+		errs = append(errs, errors.New("REQUESTER_PAYS cannot be combined with S3_SELECT_EXPRESSION"))
+	}
+
+	if c.HTTP_PROXY_URL != "" {
+		if u, err := url.Parse(c.HTTP_PROXY_URL); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("HTTP_PROXY_URL must be a URL such as http://proxy:3128, got %q", c.HTTP_PROXY_URL))
+		}
+	}
+
+	if (c.TLS_CERT_FILE == "") != (c.TLS_KEY_FILE == "") {
+		errs = append(errs, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together"))
+	}
+
+	switch c.MANIFEST_FORMAT {
+	case "json", "csv":
+	default:
+		errs = append(errs, fmt.Errorf("MANIFEST_FORMAT must be json or csv, got %q", c.MANIFEST_FORMAT))
+	}
+
+	switch c.DOWNLOAD_PRIORITY {
+	case "smallest_first", "largest_first", "oldest_first", "newest_first", "fifo":
+	default:
+		errs = append(errs, fmt.Errorf("DOWNLOAD_PRIORITY must be smallest_first, largest_first, oldest_first, newest_first or fifo, got %q", c.DOWNLOAD_PRIORITY))
+	}
+
+	switch c.RATE_LIMIT_ALGORITHM {
+	case "token_bucket", "sliding_window":
+	default:
+		errs = append(errs, fmt.Errorf("RATE_LIMIT_ALGORITHM must be token_bucket or sliding_window, got %q", c.RATE_LIMIT_ALGORITHM))
+	}
+	if c.WORKERS_PER_PREFIX < 0 {
+		errs = append(errs, fmt.Errorf("WORKERS_PER_PREFIX must not be negative, got %d", c.WORKERS_PER_PREFIX))
+	}
+	if c.MAX_FILES_PER_RUN < 0 {
+		errs = append(errs, fmt.Errorf("MAX_FILES_PER_RUN must not be negative, got %d", c.MAX_FILES_PER_RUN))
+	}
+	if c.MAX_FILE_SIZE_BYTES < 0 {
+		errs = append(errs, fmt.Errorf("MAX_FILE_SIZE_BYTES must not be negative, got %d", c.MAX_FILE_SIZE_BYTES))
+	}
+	if targets, err := ParseSyncTargets(c.SYNC_TARGETS); err != nil {
+		errs = append(errs, err)
+	} else if len(targets) > 0 && c.PARALLEL_TARGET_COUNT <= 0 {
+		errs = append(errs, fmt.Errorf("PARALLEL_TARGET_COUNT must be positive, got %d", c.PARALLEL_TARGET_COUNT))
+	}
+	if c.CHECKPOINT_PATH != "" {
+		if c.CHECKPOINT_INTERVAL < 1 {
+			errs = append(errs, fmt.Errorf("CHECKPOINT_INTERVAL must be at least 1, got %d", c.CHECKPOINT_INTERVAL))
+		}
+		if c.SYNC_TARGETS != "" {
+			errs = append(errs, errors.New("CHECKPOINT_PATH cannot be combined with SYNC_TARGETS"))
+		}
+	}
+	if c.LAZY_LOAD_THRESHOLD_RECORDS < 0 {
+		errs = append(errs, fmt.Errorf("LAZY_LOAD_THRESHOLD_RECORDS must not be negative, got %d", c.LAZY_LOAD_THRESHOLD_RECORDS))
+	}
+	if c.MAX_QUEUE_DEPTH < 1 {
+		errs = append(errs, fmt.Errorf("MAX_QUEUE_DEPTH must be at least 1, got %d", c.MAX_QUEUE_DEPTH))
+	}
+	if c.PARQUET_READ_WORKERS < 1 {
+		errs = append(errs, fmt.Errorf("PARQUET_READ_WORKERS must be at least 1, got %d", c.PARQUET_READ_WORKERS))
+	}
+	if c.LIST_RETRY_MAX_ATTEMPTS < 1 {
+		errs = append(errs, fmt.Errorf("LIST_RETRY_MAX_ATTEMPTS must be at least 1, got %d", c.LIST_RETRY_MAX_ATTEMPTS))
+	}
+	if c.LIST_RETRY_BASE_DELAY_MS < 0 {
+		errs = append(errs, fmt.Errorf("LIST_RETRY_BASE_DELAY_MS must not be negative, got %d", c.LIST_RETRY_BASE_DELAY_MS))
+	}
+	if c.THROTTLE_DETECTION_THRESHOLD < 0 {
+		errs = append(errs, fmt.Errorf("THROTTLE_DETECTION_THRESHOLD must not be negative, got %d", c.THROTTLE_DETECTION_THRESHOLD))
+	}
+	if c.LOG_OUTPUT_FILE != "" {
+		if c.LOG_MAX_SIZE_MB <= 0 {
+			errs = append(errs, fmt.Errorf("LOG_MAX_SIZE_MB must be positive, got %d", c.LOG_MAX_SIZE_MB))
+		}
+		if c.LOG_MAX_BACKUPS < 0 {
+			errs = append(errs, fmt.Errorf("LOG_MAX_BACKUPS must not be negative, got %d", c.LOG_MAX_BACKUPS))
+		}
+		if c.LOG_MAX_AGE_DAYS < 0 {
+			errs = append(errs, fmt.Errorf("LOG_MAX_AGE_DAYS must not be negative, got %d", c.LOG_MAX_AGE_DAYS))
+		}
+	}
+	if (c.CLOUDWATCH_DIMENSION_NAME == "") != (c.CLOUDWATCH_DIMENSION_VALUE == "") {
+		errs = append(errs, fmt.Errorf("CLOUDWATCH_DIMENSION_NAME and CLOUDWATCH_DIMENSION_VALUE must be set together"))
+	}
+	if c.MAX_RUN_COST_USD < 0 {
+		errs = append(errs, fmt.Errorf("MAX_RUN_COST_USD must not be negative, got %g", c.MAX_RUN_COST_USD))
+	}
+	if c.RATE_LIMIT_BURST <= 0 {
+		errs = append(errs, fmt.Errorf("RATE_LIMIT_BURST must be positive, got %d", c.RATE_LIMIT_BURST))
+	}
+
+	for prefix, perSec := range c.PREFIX_RATE_LIMITS {
+		if perSec <= 0 {
+			errs = append(errs, fmt.Errorf("PREFIX_RATE_LIMITS entry %s: rate must be positive, got %d", prefix, perSec))
+		}
+	}
+
+	for contentType, dir := range c.CONTENT_TYPE_ROUTING {
+		clean := filepath.Clean(dir)
+		if dir == "" || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+			errs = append(errs, fmt.Errorf("CONTENT_TYPE_ROUTING entry %s: directory %q must be relative to LOCAL_DIR", contentType, dir))
+		}
+	}
+
+	if len(c.STORAGE_CLASS_DIRS) > 0 {
+		classes := make(map[string]bool)
+		for _, class := range types.ObjectStorageClass("").Values() {
+			classes[string(class)] = true
+		}
+		for class := range c.STORAGE_CLASS_DIRS {
+			if !classes[class] {
+				errs = append(errs, fmt.Errorf("STORAGE_CLASS_DIRS entry %s: not an S3 storage class", class))
+			}
+		}
+		// Content type routing moves files within LOCAL_DIR only
+		if len(c.CONTENT_TYPE_ROUTING) > 0 {
+			errs = append(errs, errors.New("STORAGE_CLASS_DIRS cannot be combined with CONTENT_TYPE_ROUTING"))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		// want is part of the error, "" when the settings are valid
+		want string
+	}{
+		{
+			name: "defaults",
+		},
+		{
+			name: "FORCE_KEYS pattern",
+			env:  map[string]string{"FORCE_KEYS": "p/*.csv"},
+		},
+		{
+			name: "invalid FORCE_KEYS pattern",
+			env:  map[string]string{"FORCE_KEYS": "p/[a"},
+			want: "invalid FORCE_KEYS pattern",
+		},
+		{
+			name: "watch mode without a poll interval",
+			env:  map[string]string{"WATCH_MODE": "true", "POLL_INTERVAL_SECONDS": "0"},
+			want: "POLL_INTERVAL_SECONDS must be positive in watch mode",
+		},
+		{
+			name: "watch mode on a cron schedule",
+			env:  map[string]string{"WATCH_MODE": "true", "POLL_INTERVAL_SECONDS": "0", "CRON_EXPRESSION": "@hourly"},
+		},
+		{
+			name: "adaptive concurrency",
+			env:  map[string]string{"ADAPTIVE_CONCURRENCY": "true", "ERROR_RATE_THRESHOLD": "0.1"},
+		},
+		{
+			name: "ERROR_RATE_THRESHOLD of 1",
+			env:  map[string]string{"ADAPTIVE_CONCURRENCY": "true", "ERROR_RATE_THRESHOLD": "1"},
+			want: "ERROR_RATE_THRESHOLD must be between 0 and 1",
+		},
+		{
+			name: "DOWNLOAD_PRIORITY",
+			env:  map[string]string{"DOWNLOAD_PRIORITY": "newest_first"},
+		},
+		{
+			name: "unknown DOWNLOAD_PRIORITY",
+			env:  map[string]string{"DOWNLOAD_PRIORITY": "random"},
+			want: "DOWNLOAD_PRIORITY must be",
+		},
+		{
+			name: "SYNC_TARGETS",
+			env:  map[string]string{"SYNC_TARGETS": "[{prefix: a/, local_dir: /data/a, db_path_suffix: a}]"},
+		},
+		{
+			name: "SYNC_TARGETS without parallel targets",
+			env:  map[string]string{"SYNC_TARGETS": "[{prefix: a/, local_dir: /data/a, db_path_suffix: a}]", "PARALLEL_TARGET_COUNT": "0"},
+			want: "PARALLEL_TARGET_COUNT must be positive",
+		},
+		{
+			name: "invalid SYNC_TARGETS",
+			env:  map[string]string{"SYNC_TARGETS": "[{prefix: a/}]"},
+			want: "prefix, local_dir and db_path_suffix are required",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("S3_BUCKET", "bucket")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			err := Load().Validate()
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("Validate: %v, want no error", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("Validate: %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package cost
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrBudgetExceeded is returned when a run's estimated cost is over MAX_RUN_COST_USD
+var ErrBudgetExceeded = errors.New("estimated run cost exceeds MAX_RUN_COST_USD")
+
+const (
+	// listPricePer1000 is the price of 1000 LIST requests in USD
+	listPricePer1000 = 0.0004
+	// objectsPerListRequest is the most keys one ListObjectsV2 page returns
+	objectsPerListRequest = 1000
+	// defaultTransferPricePerGB applies to regions missing from transferPricePerGB
+	defaultTransferPricePerGB = 0.09
+)
+
+// transferPricePerGB is the price in USD of transferring 1 GiB out of a region
+// to the internet, at the first pricing tier
+var transferPricePerGB = map[string]float64{
+	"us-east-1":      0.09,
+	"us-east-2":      0.09,
+	"us-west-1":      0.09,
+	"us-west-2":      0.09,
+	"ca-central-1":   0.09,
+	"eu-west-1":      0.09,
+	"eu-west-2":      0.09,
+	"eu-west-3":      0.09,
+	"eu-central-1":   0.09,
+	"eu-north-1":     0.09,
+	"ap-south-1":     0.1093,
+	"ap-northeast-1": 0.114,
+	"ap-northeast-2": 0.126,
+	"ap-southeast-1": 0.12,
+	"ap-southeast-2": 0.114,
+	"sa-east-1":      0.15,
+}
+
+// ListRequests returns the number of ListObjectsV2 requests needed to list objectCount objects
+func ListRequests(objectCount int64) int64 {
+	if objectCount <= 0 {
+		return 1
+	}
+	return (objectCount + objectsPerListRequest - 1) / objectsPerListRequest
+}
+
+// EstimateListCost returns the cost in USD of listing objectCount objects
+func EstimateListCost(objectCount int64) float64 {
+	return ListRequestCost(ListRequests(objectCount))
+}
+
+// ListRequestCost returns the cost in USD of making requests LIST requests
+func ListRequestCost(requests int64) float64 {
+	return float64(requests) * listPricePer1000 / 1000
+}
+
+// EstimateDownloadCost returns the cost in USD of transferring bytes out of region
+func EstimateDownloadCost(bytes int64, region string) float64 {
+	price, ok := transferPricePerGB[region]
+	if !ok {
+		price = defaultTransferPricePerGB
+	}
+	return float64(bytes) / (1 << 30) * price
+}
+
+// Report records the requests a run made, as counted by the S3 clients, and
+// what they are estimated to cost. It is written to COST_REPORT_PATH after each run.
+//
+//	{
+//	  "run_id": "4b1f...",
+//	  "region": "us-east-1",
+//	  "objects_listed": 120000,
+//	  "list_requests": 120,
+//	  "get_requests": 5012,
+//	  "api_calls": {"GetObject": 5000, "HeadObject": 12, "ListObjectsV2": 120},
+//	  "bytes_downloaded": 73400320,
+//	  "list_cost_usd": 0.000048,
+//	  "download_cost_usd": 0.00615,
+//	  "total_cost_usd": 0.006198,
+//	  "generated_at": "2026-01-02T15:04:05Z"
+//	}
+type Report struct {
+	RunID         string `json:"run_id"`
+	Region        string `json:"region"`
+	ObjectsListed int64  `json:"objects_listed"`
+	ListRequests  int64  `json:"list_requests"`
+	GetRequests   int64  `json:"get_requests"`
+	// APICalls is the number of requests made by operation
+	APICalls        map[string]int64 `json:"api_calls,omitempty"`
+	BytesDownloaded int64            `json:"bytes_downloaded"`
+	ListCostUSD     float64          `json:"list_cost_usd"`
+	DownloadCostUSD float64          `json:"download_cost_usd"`
+	TotalCostUSD    float64          `json:"total_cost_usd"`
+	GeneratedAt     time.Time        `json:"generated_at"`
+}
+
+// WriteReport writes report to path as indented JSON, replacing any previous report
+func WriteReport(path string, report Report) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cost report: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write cost report %s: %w", path, err)
+	}
+	return nil
+}
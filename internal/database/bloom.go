@@ -0,0 +1,48 @@
+package database
+
+import (
+	"log"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// EnableBloomFilter keeps a bloom filter of every key in the database with
+// the given false positive rate, rebuilt whenever the records are loaded or
+// flushed. A rate of 0 disables it.
+func (db *ParquetDB) EnableBloomFilter(falsePositiveRate float64) {
+	db.index.mu.Lock()
+	defer db.index.mu.Unlock()
+	db.index.bloomRate = falsePositiveRate
+	db.index.bloom = nil
+	if falsePositiveRate > 0 && db.index.records != nil {
+		db.index.buildBloom()
+	}
+}
+
+// MayContain reports whether key may have a record. False means it
+// definitely has none; true may be a false positive. Without a bloom filter
+// it always returns true.
+func (db *ParquetDB) MayContain(key string) bool {
+	db.index.mu.RLock()
+	defer db.index.mu.RUnlock()
+	if db.index.bloom == nil {
+		return true
+	}
+	return db.index.bloom.TestString(key)
+}
+
+// buildBloom rebuilds the bloom filter from the indexed records; mu must be held
+func (idx *recordIndex) buildBloom() {
+	if idx.bloomRate <= 0 || idx.records == nil {
+		idx.bloom = nil
+		return
+	}
+
+	// The filter needs room for at least one key to be well-formed
+	filter := bloom.NewWithEstimates(uint(max(len(idx.records), 1)), idx.bloomRate)
+	for key := range idx.records {
+		filter.AddString(key)
+	}
+	idx.bloom = filter
+	log.Printf("Built bloom filter of %d keys (%d bits)", len(idx.records), filter.Cap())
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBloomFilterNoFalseNegatives(t *testing.T) {
+	const n = 100_000
+	const rate = 0.01
+
+	db, err := NewParquetDB(filepath.Join(t.TempDir(), "db.parquet"), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.EnableBloomFilter(rate)
+	records := randomRecords(n)
+	if err := db.WriteRecords(records); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(t *testing.T, records []FileRecord) {
+		t.Helper()
+		missed := 0
+		for _, r := range records {
+			if !db.MayContain(r.S3Key) {
+				missed++
+			}
+		}
+		if missed > 0 {
+			t.Errorf("%d of %d stored keys reported absent", missed, len(records))
+		}
+	}
+
+	t.Run("written", func(t *testing.T) {
+		check(t, records)
+	})
+
+	t.Run("loaded from disk", func(t *testing.T) {
+		db.InvalidateCache()
+		if _, err := db.ReadAllRecords(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		check(t, records)
+	})
+
+	t.Run("flushed", func(t *testing.T) {
+		added := make([]FileRecord, 250)
+		for i := range added {
+			added[i] = FileRecord{S3Key: fmt.Sprintf("exports/new/part-%08d.csv.gz", i), ETag: `"new"`}
+			if err := db.BatchUpdate(added[i].S3Key, added[i].ETag, "", "downloaded", time.Now()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := db.FlushBatch(); err != nil {
+			t.Fatal(err)
+		}
+		check(t, records)
+		check(t, added)
+	})
+
+	t.Run("false positive rate", func(t *testing.T) {
+		positives := 0
+		for i := range n {
+			if db.MayContain(fmt.Sprintf("missing/%08d", i)) {
+				positives++
+			}
+		}
+		// Allow for variance around the configured rate
+		if got := float64(positives) / n; got > 2*rate {
+			t.Errorf("false positive rate = %.4f, want about %.2f", got, rate)
+		}
+	})
+}
+
+func TestMayContainWithoutBloomFilter(t *testing.T) {
+	db, err := NewParquetDB(filepath.Join(t.TempDir(), "db.parquet"), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !db.MayContain("any/key") {
+		t.Error("MayContain = false without a bloom filter, want true")
+	}
+}
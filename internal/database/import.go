@@ -0,0 +1,233 @@
+package database
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policies for an imported record whose key is already in the database
+const (
+	OnConflictOverwrite = "overwrite"
+	OnConflictSkip      = "skip"
+	OnConflictError     = "error"
+)
+
+// ErrImportConflict is returned by an import with OnConflictError when a key already has a record
+var ErrImportConflict = errors.New("record already exists")
+
+// requiredImportColumns must be present in every imported CSV
+var requiredImportColumns = []string{"s3_key", "etag", "sync_status"}
+
+// importStatuses are the sync statuses an imported record may have
+var importStatuses = map[string]bool{
+	"downloaded":       true,
+	"failed":           true,
+	"force_redownload": true,
+	"pending":          true,
+	"timeout":          true,
+	"hook_rejected":    true,
+	"checksum_failed":  true,
+	"missing":          true,
+	"local_modified":   true,
+	"local_deleted":    true,
+	"streamed":         true,
+	"staging":          true,
+	"metadata_only":    true,
+}
+
+// ImportFromCSV imports records from a CSV file with a header of FileRecord
+// column names, overwriting records with the same key. See
+// ImportFromCSVOnConflict.
+func (db *ParquetDB) ImportFromCSV(ctx context.Context, r io.Reader) (int, error) {
+	return db.ImportFromCSVOnConflict(ctx, r, OnConflictOverwrite)
+}
+
+// ImportFromCSVOnConflict imports records from a CSV file whose header names
+// FileRecord columns, e.g. s3_key,etag,sync_status,last_modified. The
+// s3_key, etag and sync_status columns are required and unknown columns are
+// rejected. Timestamps may be Unix seconds or RFC 3339.
+//
+// Every row is validated before anything is written, and the records are
+// stored as given, so importing the same file again is a no-op. onConflict
+// decides what happens to keys already in the database. It returns the
+// number of records written.
+func (db *ParquetDB) ImportFromCSVOnConflict(ctx context.Context, r io.Reader, onConflict string) (int, error) {
+	switch onConflict {
+	case OnConflictOverwrite, OnConflictSkip, OnConflictError:
+	default:
+		return 0, fmt.Errorf("invalid conflict policy %q: must be %s, %s or %s", onConflict, OnConflictOverwrite, OnConflictSkip, OnConflictError)
+	}
+
+	imported, err := parseImportCSV(r)
+	if err != nil {
+		return 0, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	// Apply buffered updates first so the import sees the current state
+	if err := db.flushBatchLocked(); err != nil {
+		return 0, err
+	}
+	records, err := db.ReadAllRecords(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read records for import: %w", err)
+	}
+
+	written := 0
+	for _, record := range imported {
+		if _, exists := records[record.S3Key]; exists {
+			switch onConflict {
+			case OnConflictSkip:
+				continue
+			case OnConflictError:
+				return 0, fmt.Errorf("%w: %s", ErrImportConflict, record.S3Key)
+			}
+		}
+		records[record.S3Key] = record
+		written++
+	}
+	if written == 0 {
+		return 0, nil
+	}
+
+	recordSlice := make([]FileRecord, 0, len(records))
+	for _, rec := range records {
+		recordSlice = append(recordSlice, rec)
+	}
+	if err := db.WriteRecords(recordSlice); err != nil {
+		return 0, fmt.Errorf("failed to write imported records: %w", err)
+	}
+
+	log.Printf("Imported %d records into %s", written, db.path)
+	return written, nil
+}
+
+// parseImportCSV reads and validates every row of an import file
+func parseImportCSV(r io.Reader) ([]FileRecord, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("CSV file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if _, ok := recordColumns[name]; !ok {
+			return nil, fmt.Errorf("unknown CSV column %q", name)
+		}
+		if _, dup := columns[name]; dup {
+			return nil, fmt.Errorf("duplicate CSV column %q", name)
+		}
+		columns[name] = i
+	}
+	var missing []string
+	for _, name := range requiredImportColumns {
+		if _, ok := columns[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("CSV is missing required columns: %s", strings.Join(missing, ", "))
+	}
+
+	var records []FileRecord
+	seen := make(map[string]int)
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+
+		record, err := parseImportRow(row, columns)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if prev, dup := seen[record.S3Key]; dup {
+			return nil, fmt.Errorf("line %d: s3_key %s already appears on line %d", line, record.S3Key, prev)
+		}
+		seen[record.S3Key] = line
+		records = append(records, record)
+	}
+}
+
+// parseImportRow converts one CSV row into a FileRecord
+func parseImportRow(row []string, columns map[string]int) (FileRecord, error) {
+	field := func(name string) (string, bool) {
+		i, ok := columns[name]
+		if !ok {
+			return "", false
+		}
+		return strings.TrimSpace(row[i]), true
+	}
+
+	var record FileRecord
+	record.S3Key, _ = field("s3_key")
+	record.ETag, _ = field("etag")
+	record.SyncStatus, _ = field("sync_status")
+	record.LocalPath, _ = field("local_path")
+	record.LastError, _ = field("last_error")
+	record.ContentHash, _ = field("content_hash")
+	record.VersionID, _ = field("version_id")
+
+	if record.S3Key == "" {
+		return record, errors.New("s3_key is empty")
+	}
+	if !importStatuses[record.SyncStatus] {
+		return record, fmt.Errorf("invalid sync_status %q", record.SyncStatus)
+	}
+
+	for name, dst := range map[string]*int64{"last_modified": &record.LastModified, "last_synced_at": &record.LastSyncedAt} {
+		value, ok := field(name)
+		if !ok || value == "" {
+			continue
+		}
+		ts, err := parseImportTime(value)
+		if err != nil {
+			return record, fmt.Errorf("invalid %s %q: %w", name, value, err)
+		}
+		*dst = ts
+	}
+	if value, ok := field("error_count"); ok && value != "" {
+		n, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || n < 0 {
+			return record, fmt.Errorf("invalid error_count %q", value)
+		}
+		record.ErrorCount = int32(n)
+	}
+	if value, ok := field("file_size_bytes"); ok && value != "" {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			return record, fmt.Errorf("invalid file_size_bytes %q", value)
+		}
+		record.FileSizeBytes = n
+	}
+	return record, nil
+}
+
+// parseImportTime accepts Unix seconds or an RFC 3339 timestamp
+func parseImportTime(value string) (int64, error) {
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return secs, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, errors.New("expected Unix seconds or an RFC 3339 timestamp")
+	}
+	return t.Unix(), nil
+}
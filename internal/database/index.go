@@ -0,0 +1,123 @@
+package database
+
+import (
+	"maps"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// recordIndex caches every record of the database in memory so that repeat
+// reads, and in particular each FlushBatch, do not re-read the whole file.
+// It is only trusted while the file's mtime matches the one it was loaded
+// at, so an external modification causes a reload.
+type recordIndex struct {
+	mu      sync.RWMutex
+	records map[string]FileRecord
+	modTime time.Time
+
+	// bloom is a filter of the indexed keys, see bloom.go
+	bloom     *bloom.BloomFilter
+	bloomRate float64
+}
+
+// InvalidateCache drops the in-memory index and the records read by
+// LookupRecord; the next read reloads them from disk
+func (db *ParquetDB) InvalidateCache() {
+	db.lazyMu.Lock()
+	db.lazy = nil
+	db.lazyMu.Unlock()
+
+	db.index.mu.Lock()
+	defer db.index.mu.Unlock()
+	db.index.records = nil
+	db.index.bloom = nil
+}
+
+// cachedRecords returns a copy of the index, or false if it is not loaded
+// or the file changed since
+func (db *ParquetDB) cachedRecords() (map[string]FileRecord, bool) {
+	modTime, err := db.modTime()
+	if err != nil {
+		return nil, false
+	}
+
+	db.index.mu.RLock()
+	defer db.index.mu.RUnlock()
+	if db.index.records == nil || !modTime.Equal(db.index.modTime) {
+		return nil, false
+	}
+	return maps.Clone(db.index.records), true
+}
+
+// CachedStatusCounts returns the number of records in each SyncStatus,
+// counted from the in-memory index without reading the file, or false when
+// the index is not loaded or the file changed since
+func (db *ParquetDB) CachedStatusCounts() (map[string]int64, bool) {
+	modTime, err := db.modTime()
+	if err != nil {
+		return nil, false
+	}
+
+	db.index.mu.RLock()
+	defer db.index.mu.RUnlock()
+	if db.index.records == nil || !modTime.Equal(db.index.modTime) {
+		return nil, false
+	}
+	counts := make(map[string]int64)
+	for _, r := range db.index.records {
+		counts[r.SyncStatus]++
+	}
+	return counts, true
+}
+
+// storeIndex replaces the index with records, which the index takes
+// ownership of, as of the file's mtime modTime
+func (db *ParquetDB) storeIndex(records map[string]FileRecord, modTime time.Time) {
+	db.index.mu.Lock()
+	defer db.index.mu.Unlock()
+	db.index.records = records
+	db.index.modTime = modTime
+	db.index.buildBloom()
+}
+
+// indexWritten updates the index after the database was written with
+// records, which the index takes ownership of
+func (db *ParquetDB) indexWritten(records map[string]FileRecord) {
+	modTime, err := db.modTime()
+	if err != nil {
+		db.InvalidateCache()
+		return
+	}
+	db.storeIndex(records, modTime)
+}
+
+// modTime returns the mtime of the database file, or the newest mtime of
+// its partitions
+func (db *ParquetDB) modTime() (time.Time, error) {
+	if !db.partitioned {
+		info, err := os.Stat(db.path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return info.ModTime(), nil
+	}
+
+	partitions, err := db.listPartitions()
+	if err != nil {
+		return time.Time{}, err
+	}
+	var newest time.Time
+	for _, p := range partitions {
+		info, err := os.Stat(p.path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+	}
+	return newest, nil
+}
@@ -0,0 +1,158 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIndexReloadsAfterExternalWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.parquet")
+	db, err := NewParquetDB(path, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.WriteRecords([]FileRecord{{S3Key: "a", ETag: `"1"`}}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := db.ReadAllRecords(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another process rewrites the file
+	other, err := NewParquetDB(path, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.WriteRecords([]FileRecord{{S3Key: "a", ETag: `"2"`}, {S3Key: "b"}}); err != nil {
+		t.Fatal(err)
+	}
+	// Make sure the mtime moves even on filesystems with coarse timestamps
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := db.ReadAllRecords(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records["a"].ETag != `"2"` {
+		t.Errorf("ReadAllRecords = %v, want the records written by the other database", records)
+	}
+}
+
+func TestIndexCopiesRecords(t *testing.T) {
+	db, err := NewParquetDB(filepath.Join(t.TempDir(), "db.parquet"), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.WriteRecords([]FileRecord{{S3Key: "a", ETag: `"1"`}}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	records, err := db.ReadAllRecords(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Changing the returned map must not change the index
+	delete(records, "a")
+	records["b"] = FileRecord{S3Key: "b"}
+
+	again, err := db.ReadAllRecords(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := again["a"]; !ok || len(again) != 1 {
+		t.Errorf("ReadAllRecords = %v after the caller changed an earlier result", again)
+	}
+}
+
+func TestFlushBatchMergesIndex(t *testing.T) {
+	db, err := NewParquetDB(filepath.Join(t.TempDir(), "db.parquet"), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.WriteRecords(randomRecords(1000)); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := db.ReadAllRecords(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.BatchUpdate("new/key", `"n"`, "/data/new", "downloaded", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.FlushBatch(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The flushed file and the index agree
+	indexed, err := db.ReadAllRecords(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.InvalidateCache()
+	onDisk, err := db.ReadAllRecords(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(indexed) != 1001 || len(onDisk) != 1001 {
+		t.Fatalf("have %d indexed and %d stored records, want 1001", len(indexed), len(onDisk))
+	}
+	if indexed["new/key"] != onDisk["new/key"] {
+		t.Errorf("indexed record %+v differs from the stored %+v", indexed["new/key"], onDisk["new/key"])
+	}
+}
+
+// BenchmarkIndex shows what the in-memory index saves on 1M records: each
+// ReadAllRecords and FlushBatch without it reads the whole file first
+func BenchmarkIndex(b *testing.B) {
+	const n = 1_000_000
+	records := randomRecords(n)
+	db := openBenchDB(b, records, benchBatchSize+1)
+	ctx := context.Background()
+
+	for _, indexed := range []bool{false, true} {
+		name := "cold"
+		if indexed {
+			name = "indexed"
+		}
+
+		b.Run(fmt.Sprintf("ReadAllRecords/%s", name), func(b *testing.B) {
+			for range b.N {
+				if !indexed {
+					db.InvalidateCache()
+				}
+				if _, err := db.ReadAllRecords(ctx); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("FlushBatch/%s", name), func(b *testing.B) {
+			for i := range b.N {
+				b.StopTimer()
+				for j := range benchBatchSize {
+					r := records[(i*benchBatchSize+j)%n]
+					if err := db.BatchUpdate(r.S3Key, r.ETag, r.LocalPath, "downloaded", time.Unix(r.LastModified, 0)); err != nil {
+						b.Fatal(err)
+					}
+				}
+				if !indexed {
+					db.InvalidateCache()
+				}
+				b.StartTimer()
+				if err := db.FlushBatch(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
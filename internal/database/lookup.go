@@ -0,0 +1,275 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+// RecordSummary is the part of a record a listed object is compared with
+// before deciding whether its full record is needed
+type RecordSummary struct {
+	ETag       string
+	SyncStatus string
+
+	// row is the position of the record in the database file, unset in a
+	// partitioned database
+	row int64
+}
+
+// lazyRecords holds what LookupRecord has read from the file as of its
+// mtime modTime: the summary of every record and, populated one key at a
+// time, the full records looked up
+type lazyRecords struct {
+	modTime   time.Time
+	summaries map[string]RecordSummary
+	records   sync.Map
+}
+
+// CountRecords returns the number of rows in the database, read from the
+// file footers. In a partitioned database a key is counted once for every
+// partition it appears in.
+func (db *ParquetDB) CountRecords() (int64, error) {
+	paths := []string{db.path}
+	if db.partitioned {
+		partitions, err := db.listPartitions()
+		if err != nil {
+			return 0, err
+		}
+		paths = paths[:0]
+		for _, p := range partitions {
+			paths = append(paths, p.path)
+		}
+	}
+
+	var total int64
+	for _, path := range paths {
+		fr, err := local.NewLocalFileReader(path)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create local file reader: %w", err)
+		}
+		pr, err := reader.NewParquetColumnReader(fr, 1)
+		if err != nil {
+			fr.Close()
+			return 0, fmt.Errorf("failed to create parquet reader: %w", err)
+		}
+		total += pr.GetNumRows()
+		fr.Close()
+	}
+	return total, nil
+}
+
+// ReadSummaries returns the ETag and sync status of every record, reading
+// only the s3_key, etag and sync_status columns of the file. The map is kept
+// for LookupRecord until the file changes and must not be modified. A
+// partitioned database is read in full.
+func (db *ParquetDB) ReadSummaries(ctx context.Context) (map[string]RecordSummary, error) {
+	lazy, err := db.lazyRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return lazy.summaries, nil
+}
+
+// LookupRecord returns the record of s3Key. It is answered from the
+// in-memory index when that is loaded; otherwise the key is found among the
+// summaries and only its row is read in full, once until the file changes.
+// Looking up many keys is cheaper after PrefetchRecords. A partitioned
+// database is read in full.
+func (db *ParquetDB) LookupRecord(ctx context.Context, s3Key string) (FileRecord, bool, error) {
+	if record, exists, ok := db.indexedRecord(s3Key); ok {
+		return record, exists, nil
+	}
+
+	if db.partitioned {
+		records, err := db.ReadAllRecords(ctx)
+		if err != nil {
+			return FileRecord{}, false, err
+		}
+		record, exists := records[s3Key]
+		return record, exists, nil
+	}
+
+	lazy, err := db.lazyRecords(ctx)
+	if err != nil {
+		return FileRecord{}, false, err
+	}
+	summary, exists := lazy.summaries[s3Key]
+	if !exists {
+		return FileRecord{}, false, nil
+	}
+	if record, ok := lazy.records.Load(s3Key); ok {
+		return record.(FileRecord), true, nil
+	}
+
+	record, err := db.readRow(summary.row)
+	if err != nil {
+		return FileRecord{}, false, err
+	}
+	if record.S3Key != s3Key {
+		return FileRecord{}, false, fmt.Errorf("failed to look up %s: row %d holds %s", s3Key, summary.row, record.S3Key)
+	}
+	lazy.records.Store(s3Key, record)
+	return record, true, nil
+}
+
+// PrefetchRecords reads the records of keys in a single pass over the file,
+// for the LookupRecord calls that follow
+func (db *ParquetDB) PrefetchRecords(ctx context.Context, keys []string) error {
+	if db.partitioned || db.indexLoaded() || len(keys) == 0 {
+		return nil
+	}
+	lazy, err := db.lazyRecords(ctx)
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if _, ok := lazy.records.Load(key); !ok {
+			wanted[key] = true
+		}
+	}
+	if len(wanted) == 0 {
+		return nil
+	}
+	return db.ScanRecords(ctx, func(r FileRecord) error {
+		if wanted[r.S3Key] {
+			lazy.records.Store(r.S3Key, r)
+		}
+		return nil
+	})
+}
+
+// indexLoaded reports whether the in-memory index is loaded and current
+func (db *ParquetDB) indexLoaded() bool {
+	_, _, loaded := db.indexedRecord("")
+	return loaded
+}
+
+// indexedRecord looks key up in the in-memory index, or returns false as
+// its last result if the index is not loaded or the file changed since
+func (db *ParquetDB) indexedRecord(key string) (FileRecord, bool, bool) {
+	modTime, err := db.modTime()
+	if err != nil {
+		return FileRecord{}, false, false
+	}
+
+	db.index.mu.RLock()
+	defer db.index.mu.RUnlock()
+	if db.index.records == nil || !modTime.Equal(db.index.modTime) {
+		return FileRecord{}, false, false
+	}
+	record, exists := db.index.records[key]
+	return record, exists, true
+}
+
+// lazyRecords returns the lazily read records, reading the summaries again
+// when the file changed since they were read
+func (db *ParquetDB) lazyRecords(ctx context.Context) (*lazyRecords, error) {
+	db.lazyMu.Lock()
+	defer db.lazyMu.Unlock()
+
+	// Take the mtime first so a write during the read makes them stale
+	modTime, err := db.modTime()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat database: %w", err)
+	}
+	if db.lazy != nil && modTime.Equal(db.lazy.modTime) {
+		return db.lazy, nil
+	}
+
+	summaries, err := db.readSummaries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db.lazy = &lazyRecords{modTime: modTime, summaries: summaries}
+	return db.lazy, nil
+}
+
+// readSummaries reads the s3_key, etag and sync_status columns of the file
+// in chunks of scanChunkSize rows
+func (db *ParquetDB) readSummaries(ctx context.Context) (map[string]RecordSummary, error) {
+	if db.partitioned {
+		// A key may be in several partitions, so they must be merged first
+		records, err := db.ReadAllRecords(ctx)
+		if err != nil {
+			return nil, err
+		}
+		summaries := make(map[string]RecordSummary, len(records))
+		for key, r := range records {
+			summaries[key] = RecordSummary{ETag: r.ETag, SyncStatus: r.SyncStatus}
+		}
+		return summaries, nil
+	}
+
+	fr, err := local.NewLocalFileReader(db.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create local file reader: %w", err)
+	}
+	defer fr.Close()
+
+	pr, err := reader.NewParquetColumnReader(fr, 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create parquet reader: %w", err)
+	}
+	defer pr.ReadStop()
+
+	numRows := pr.GetNumRows()
+	summaries := make(map[string]RecordSummary, numRows)
+	for row := int64(0); row < numRows; {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		n := min(numRows-row, scanChunkSize)
+		var columns [3][]interface{}
+		for i, name := range []string{"s3_key", "etag", "sync_status"} {
+			values, _, _, err := pr.ReadColumnByPath(common.ReformPathStr("parquet_go_root."+name), n)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read column %s: %w", name, err)
+			}
+			if int64(len(values)) != n {
+				return nil, fmt.Errorf("failed to read column %s: got %d of %d rows", name, len(values), n)
+			}
+			columns[i] = values
+		}
+		for i := range n {
+			key, _ := columns[0][i].(string)
+			etag, _ := columns[1][i].(string)
+			status, _ := columns[2][i].(string)
+			summaries[key] = RecordSummary{ETag: etag, SyncStatus: status, row: row + i}
+		}
+		row += n
+	}
+	return summaries, nil
+}
+
+// readRow reads the record at row of the file
+func (db *ParquetDB) readRow(row int64) (FileRecord, error) {
+	fr, err := local.NewLocalFileReader(db.path)
+	if err != nil {
+		return FileRecord{}, fmt.Errorf("failed to create local file reader: %w", err)
+	}
+	defer fr.Close()
+
+	pr, err := reader.NewParquetReader(fr, new(FileRecord), 4)
+	if err != nil {
+		return FileRecord{}, fmt.Errorf("failed to create parquet reader: %w", err)
+	}
+	defer pr.ReadStop()
+
+	if err := pr.SkipRows(row); err != nil {
+		return FileRecord{}, fmt.Errorf("failed to seek to row %d: %w", row, err)
+	}
+	records := make([]FileRecord, 1)
+	if err := pr.Read(&records); err != nil {
+		return FileRecord{}, fmt.Errorf("failed to read row %d: %w", row, err)
+	}
+	return records[0], nil
+}
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLookupRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.parquet")
+	writer, err := NewParquetDB(path, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []FileRecord{
+		{S3Key: "a", ETag: `"1"`, SyncStatus: "downloaded", LocalPath: "/data/a", LastSyncedAt: 100, FileSizeBytes: 10},
+		{S3Key: "b", ETag: `"2"`, SyncStatus: "failed", LastError: "timeout", ErrorCount: 2},
+		{S3Key: "c", ETag: `"3"`, SyncStatus: "downloaded", LocalPath: "/data/c", ContentHash: "abc"},
+	}
+	if err := writer.WriteRecords(records); err != nil {
+		t.Fatal(err)
+	}
+
+	// A database that has not read the file, as in another process
+	db, err := NewParquetDB(path, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.InvalidateCache()
+	ctx := context.Background()
+
+	summaries, err := db.ReadSummaries(ctx)
+	if err != nil {
+		t.Fatalf("ReadSummaries: %v", err)
+	}
+	if len(summaries) != len(records) {
+		t.Errorf("ReadSummaries returned %d summaries, want %d", len(summaries), len(records))
+	}
+	for _, want := range records {
+		if got := summaries[want.S3Key]; got.ETag != want.ETag || got.SyncStatus != want.SyncStatus {
+			t.Errorf("summary of %s = %+v, want ETag %s and status %s", want.S3Key, got, want.ETag, want.SyncStatus)
+		}
+	}
+
+	for _, want := range records {
+		got, ok, err := db.LookupRecord(ctx, want.S3Key)
+		if err != nil {
+			t.Fatalf("LookupRecord(%s): %v", want.S3Key, err)
+		}
+		if !ok || got != want {
+			t.Errorf("LookupRecord(%s) = %+v, %v, want %+v", want.S3Key, got, ok, want)
+		}
+	}
+	if _, ok, err := db.LookupRecord(ctx, "missing"); err != nil || ok {
+		t.Errorf("LookupRecord(missing) found a record (err %v)", err)
+	}
+	if db.indexLoaded() {
+		t.Error("LookupRecord loaded the full index, want the file read lazily")
+	}
+
+	// Another process updates a record
+	if err := writer.BatchUpdate("a", `"4"`, "/data/a", "pending", time.Unix(200, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.FlushBatch(); err != nil {
+		t.Fatal(err)
+	}
+	// Make sure the mtime moves even on filesystems with coarse timestamps
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok, err := db.LookupRecord(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || got.ETag != `"4"` || got.SyncStatus != "pending" {
+		t.Errorf("LookupRecord(a) = %+v after the file changed, want the updated record", got)
+	}
+	if summaries, err = db.ReadSummaries(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := summaries["a"]; got.ETag != `"4"` {
+		t.Errorf("summary of a = %+v after the file changed, want ETag \"4\"", got)
+	}
+}
+
+func TestPrefetchRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.parquet")
+	db, err := NewParquetDB(path, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []FileRecord{
+		{S3Key: "a", ETag: `"1"`, LocalPath: "/data/a"},
+		{S3Key: "b", ETag: `"2"`, LocalPath: "/data/b"},
+		{S3Key: "c", ETag: `"3"`, LocalPath: "/data/c"},
+	}
+	if err := db.WriteRecords(records); err != nil {
+		t.Fatal(err)
+	}
+	db.InvalidateCache()
+
+	ctx := context.Background()
+	if err := db.PrefetchRecords(ctx, []string{"a", "c", "missing"}); err != nil {
+		t.Fatalf("PrefetchRecords: %v", err)
+	}
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true, "missing": false} {
+		record, got := db.lazy.records.Load(key)
+		if got != want {
+			t.Errorf("%s prefetched: %v, want %v", key, got, want)
+		}
+		if got && record.(FileRecord).LocalPath != "/data/"+key {
+			t.Errorf("prefetched record of %s = %+v", key, record)
+		}
+	}
+
+	// LookupRecord answers from the prefetched record
+	got, ok, err := db.LookupRecord(ctx, "c")
+	if err != nil || !ok || got.ETag != `"3"` {
+		t.Errorf("LookupRecord(c) = %+v, %v, %v, want the prefetched record", got, ok, err)
+	}
+}
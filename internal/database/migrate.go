@@ -0,0 +1,105 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+// recordColumns maps each parquet column name of FileRecord to its field index
+var recordColumns = func() map[string]int {
+	columns := make(map[string]int)
+	t := reflect.TypeOf(FileRecord{})
+	for i := 0; i < t.NumField(); i++ {
+		for _, part := range strings.Split(t.Field(i).Tag.Get("parquet"), ",") {
+			if name, ok := strings.CutPrefix(strings.TrimSpace(part), "name="); ok {
+				columns[name] = i
+			}
+		}
+	}
+	return columns
+}()
+
+// migrate rewrites a database file, or each partition of a partitioned
+// database, written by an older version whose schema
+// lacks some FileRecord columns. The reader cannot open such files with the
+// current schema, so the old rows are read column by column and written back
+// with the missing fields left at their zero value.
+func (db *ParquetDB) migrate() error {
+	if !db.partitioned {
+		return migrateFile(db.path)
+	}
+
+	partitions, err := db.listPartitions()
+	if err != nil {
+		return err
+	}
+	for _, p := range partitions {
+		if err := migrateFile(p.path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateFile migrates the database file at path
+func migrateFile(path string) error {
+	fr, err := local.NewLocalFileReader(path)
+	if err != nil {
+		return fmt.Errorf("failed to create local file reader: %w", err)
+	}
+	defer fr.Close()
+
+	pr, err := reader.NewParquetColumnReader(fr, 4)
+	if err != nil {
+		return fmt.Errorf("failed to create parquet column reader: %w", err)
+	}
+	defer pr.ReadStop()
+
+	present := make(map[string]bool)
+	for i, info := range pr.SchemaHandler.Infos {
+		if i > 0 && pr.SchemaHandler.SchemaElements[i].GetNumChildren() == 0 {
+			present[info.ExName] = true
+		}
+	}
+
+	var missing []string
+	for name := range recordColumns {
+		if !present[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+
+	numRows := pr.GetNumRows()
+	records := make([]FileRecord, numRows)
+	root := pr.SchemaHandler.GetRootExName()
+	for name, field := range recordColumns {
+		if !present[name] || numRows == 0 {
+			continue
+		}
+		values, _, _, err := pr.ReadColumnByPath(common.PathToStr([]string{root, name}), numRows)
+		if err != nil {
+			return fmt.Errorf("failed to read column %s: %w", name, err)
+		}
+		for i, v := range values {
+			if v == nil || i >= len(records) {
+				continue
+			}
+			f := reflect.ValueOf(&records[i]).Elem().Field(field)
+			f.Set(reflect.ValueOf(v).Convert(f.Type()))
+		}
+	}
+
+	log.Printf("Migrating database %s to the current schema, adding columns %s", path, strings.Join(missing, ", "))
+	return writeFile(path, records)
+}
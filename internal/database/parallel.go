@@ -0,0 +1,180 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// DefaultReadWorkers is the number of goroutines a database reads its row
+// groups with unless SetReadWorkers is called
+const DefaultReadWorkers = 4
+
+// ParallelReader reads every record of a Parquet file, spreading its row
+// groups over a pool of goroutines. The reader of the parquet library is not
+// safe for concurrent use, so each goroutine has a reader of its own, limited
+// to its share of the row groups.
+type ParallelReader struct {
+	path    string
+	workers int
+}
+
+// NewParallelReader creates a reader of the file at path using at most
+// workers goroutines
+func NewParallelReader(path string, workers int) *ParallelReader {
+	return &ParallelReader{path: path, workers: max(workers, 1)}
+}
+
+// rowRange is a run of consecutive rows of a Parquet file, made of the row
+// groups from firstGroup on
+type rowRange struct {
+	first, count int64
+	firstGroup   int
+	groups       int
+}
+
+// ReadAll returns the records of the file in file order
+func (r *ParallelReader) ReadAll(ctx context.Context) ([]FileRecord, error) {
+	groups, err := r.rowGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	// Give each worker a contiguous share of the row groups
+	shares := splitRowGroups(groups, r.workers)
+	if len(shares) <= 1 {
+		var total int64
+		for _, g := range groups {
+			total += g.count
+		}
+		return r.readRange(rowRange{count: total, groups: len(groups)})
+	}
+
+	results := make([][]FileRecord, len(shares))
+	errs := make([]error, len(shares))
+	var wg sync.WaitGroup
+	for i, share := range shares {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := ctx.Err(); err != nil {
+				errs[i] = err
+				return
+			}
+			results[i], errs[i] = r.readRange(share)
+		}()
+	}
+	wg.Wait()
+
+	var total int
+	for i := range shares {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		total += len(results[i])
+	}
+	records := make([]FileRecord, 0, total)
+	for _, part := range results {
+		records = append(records, part...)
+	}
+	return records, nil
+}
+
+// rowGroups returns the rows of each row group of the file, from its footer
+func (r *ParallelReader) rowGroups() ([]rowRange, error) {
+	fr, err := local.NewLocalFileReader(r.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create local file reader: %w", err)
+	}
+	defer fr.Close()
+
+	pr, err := reader.NewParquetReader(fr, new(FileRecord), 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create parquet reader: %w", err)
+	}
+	defer pr.ReadStop()
+
+	groups := make([]rowRange, 0, len(pr.Footer.RowGroups))
+	var first int64
+	for i, rg := range pr.Footer.RowGroups {
+		groups = append(groups, rowRange{first: first, count: rg.NumRows, firstGroup: i, groups: 1})
+		first += rg.NumRows
+	}
+	return groups, nil
+}
+
+// readRange reads the rows of rr through a reader of its own
+func (r *ParallelReader) readRange(rr rowRange) ([]FileRecord, error) {
+	fr, err := local.NewLocalFileReader(r.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create local file reader: %w", err)
+	}
+	defer fr.Close()
+
+	pr, err := reader.NewParquetReader(fr, new(FileRecord), 4)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create parquet reader: %w", err)
+	}
+	defer pr.ReadStop()
+
+	if rr.firstGroup > 0 || rr.groups < len(pr.Footer.RowGroups) {
+		if err := restrictRowGroups(pr, fr, rr); err != nil {
+			return nil, err
+		}
+	}
+	records := make([]FileRecord, rr.count)
+	if err := pr.Read(&records); err != nil {
+		return nil, fmt.Errorf("failed to read records: %w", err)
+	}
+	return records, nil
+}
+
+// restrictRowGroups limits pr to the row groups of rr. SkipRows would
+// decode every skipped page, so the column buffers are instead recreated
+// over a footer that lists only those row groups, which makes them start
+// at the first one.
+func restrictRowGroups(pr *reader.ParquetReader, fr source.ParquetFile, rr rowRange) error {
+	footer := *pr.Footer
+	footer.RowGroups = pr.Footer.RowGroups[rr.firstGroup : rr.firstGroup+rr.groups]
+	footer.NumRows = rr.count
+	for path, cb := range pr.ColumnBuffers {
+		cb.PFile.Close()
+		restricted, err := reader.NewColumnBuffer(fr, &footer, pr.SchemaHandler, path)
+		if err != nil {
+			return fmt.Errorf("failed to seek to row %d: %w", rr.first, err)
+		}
+		pr.ColumnBuffers[path] = restricted
+	}
+	pr.Footer = &footer
+	return nil
+}
+
+// splitRowGroups merges groups into at most n contiguous ranges of roughly
+// equal row counts
+func splitRowGroups(groups []rowRange, n int) []rowRange {
+	var total int64
+	for _, g := range groups {
+		total += g.count
+	}
+	n = min(n, len(groups))
+	if n <= 1 {
+		return nil
+	}
+
+	target := (total + int64(n) - 1) / int64(n)
+	var shares []rowRange
+	var current rowRange
+	for _, g := range groups {
+		if current.count > 0 && current.count+g.count > target && len(shares) < n-1 {
+			shares = append(shares, current)
+			current = rowRange{first: g.first, firstGroup: g.firstGroup}
+		}
+		current.count += g.count
+		current.groups++
+	}
+	return append(shares, current)
+}
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// writeRowGroups writes records to a Parquet file at path in row groups of
+// about rowGroupSize bytes, so that ParallelReader has groups to split
+func writeRowGroups(tb testing.TB, path string, records []FileRecord, rowGroupSize int64) {
+	tb.Helper()
+	fw, err := local.NewLocalFileWriter(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer fw.Close()
+	pw, err := writer.NewParquetWriter(fw, new(FileRecord), 4)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	pw.RowGroupSize = rowGroupSize
+	for _, r := range records {
+		if err := pw.Write(r); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	if err := pw.WriteStop(); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func TestParallelReaderMatchesSerialRead(t *testing.T) {
+	records := randomRecords(20_000)
+	path := filepath.Join(t.TempDir(), "db.parquet")
+	writeRowGroups(t, path, records, 256*1024)
+
+	groups, err := NewParallelReader(path, 1).rowGroups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) < 8 {
+		t.Fatalf("file has %d row groups, want enough to split over 8 workers", len(groups))
+	}
+
+	for _, workers := range []int{1, 2, 3, 8, 64} {
+		t.Run(fmt.Sprintf("workers=%d", workers), func(t *testing.T) {
+			got, err := NewParallelReader(path, workers).ReadAll(context.Background())
+			if err != nil {
+				t.Fatalf("ReadAll: %v", err)
+			}
+			if !reflect.DeepEqual(got, records) {
+				t.Errorf("read %d records that differ from the %d written, or are out of order", len(got), len(records))
+			}
+		})
+	}
+}
+
+func TestSplitRowGroups(t *testing.T) {
+	groups := []rowRange{
+		{first: 0, count: 10, firstGroup: 0, groups: 1},
+		{first: 10, count: 10, firstGroup: 1, groups: 1},
+		{first: 20, count: 10, firstGroup: 2, groups: 1},
+		{first: 30, count: 5, firstGroup: 3, groups: 1},
+	}
+
+	tests := []struct {
+		n    int
+		want []rowRange
+	}{
+		{1, nil},
+		{2, []rowRange{
+			{first: 0, count: 10, firstGroup: 0, groups: 1},
+			{first: 10, count: 25, firstGroup: 1, groups: 3},
+		}},
+		{4, groups},
+		{10, groups},
+	}
+	for _, tt := range tests {
+		got := splitRowGroups(groups, tt.n)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitRowGroups(n=%d) = %+v, want %+v", tt.n, got, tt.want)
+		}
+	}
+}
+
+// BenchmarkParallelReader reads files of 100k and 1M records in 4 MB row
+// groups with PARQUET_READ_WORKERS of 1 to 8
+func BenchmarkParallelReader(b *testing.B) {
+	for _, n := range []int{100_000, 1_000_000} {
+		path := filepath.Join(b.TempDir(), "db.parquet")
+		writeRowGroups(b, path, randomRecords(n), 4*1024*1024)
+
+		for _, workers := range []int{1, 2, 4, 8} {
+			b.Run(fmt.Sprintf("records=%d/workers=%d", n, workers), func(b *testing.B) {
+				r := NewParallelReader(path, workers)
+				for range b.N {
+					records, err := r.ReadAll(context.Background())
+					if err != nil {
+						b.Fatal(err)
+					}
+					if len(records) != n {
+						b.Fatalf("read %d records, want %d", len(records), n)
+					}
+				}
+			})
+		}
+	}
+}
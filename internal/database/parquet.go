@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"maps"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/xitongsys/parquet-go-source/local"
@@ -15,27 +17,66 @@ import (
 
 // FileRecord represents a single record in the Parquet database
 type FileRecord struct {
-	S3Key        string `parquet:"name=s3_key, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
-	ETag         string `parquet:"name=etag, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
-	LastModified int64  `parquet:"name=last_modified, type=INT64"`
-	SyncStatus   string `parquet:"name=sync_status, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
-	LocalPath    string `parquet:"name=local_path, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
-	LastSyncedAt int64  `parquet:"name=last_synced_at, type=INT64"`
+	S3Key        string `parquet:"name=s3_key, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY" json:"s3_key"`
+	ETag         string `parquet:"name=etag, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY" json:"etag"`
+	LastModified int64  `parquet:"name=last_modified, type=INT64" json:"last_modified"`
+	SyncStatus   string `parquet:"name=sync_status, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY" json:"sync_status"`
+	LocalPath    string `parquet:"name=local_path, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY" json:"local_path"`
+	LastSyncedAt int64  `parquet:"name=last_synced_at, type=INT64" json:"last_synced_at"`
+	LastError    string `parquet:"name=last_error, type=BYTE_ARRAY, convertedtype=UTF8" json:"last_error,omitempty"`
+	ErrorCount   int32  `parquet:"name=error_count, type=INT32" json:"error_count,omitempty"`
+	ContentHash  string `parquet:"name=content_hash, type=BYTE_ARRAY, convertedtype=UTF8" json:"content_hash,omitempty"`
+	// FileSizeBytes is the size of the object when it was downloaded, 0 if unknown
+	FileSizeBytes int64 `parquet:"name=file_size_bytes, type=INT64" json:"file_size_bytes,omitempty"`
+	// VersionID is the S3 version downloaded by the download subcommand;
+	// records of a specific version are keyed by VersionedKey
+	VersionID string `parquet:"name=version_id, type=BYTE_ARRAY, convertedtype=UTF8" json:"version_id,omitempty"`
 }
 
+// scanChunkSize is the number of rows ScanRecords reads from the file at a time
+const scanChunkSize = 10000
+
 // ParquetDB handles operations on the Parquet database file
 type ParquetDB struct {
 	path        string
 	batchBuffer []FileRecord
 	batchSize   int
+
+	// partitioned makes path a directory of daily partitions, see partition.go
+	partitioned bool
+
+	// readWorkers bounds the goroutines a file is read with, see SetReadWorkers
+	readWorkers int
+
+	// index caches the records in memory, see index.go
+	index recordIndex
+
+	// lazy holds the records read by LookupRecord, see lookup.go; lazyMu
+	// serialises reading them
+	lazy   *lazyRecords
+	lazyMu sync.Mutex
+
+	// onFlush are called after each batch is written, see OnFlush
+	onFlush []func()
+
+	// mu serialises read-modify-write cycles on the file and guards batchBuffer
+	mu sync.Mutex
 }
 
 // NewParquetDB creates a new ParquetDB instance
 func NewParquetDB(path string, batchSize int) (*ParquetDB, error) {
+	return OpenParquetDB(path, batchSize, false)
+}
+
+// OpenParquetDB creates a ParquetDB at path, which is a directory of daily
+// partitions when partitioned is set and a single file otherwise
+func OpenParquetDB(path string, batchSize int, partitioned bool) (*ParquetDB, error) {
 	db := &ParquetDB{
 		path:        path,
 		batchBuffer: make([]FileRecord, 0, batchSize),
 		batchSize:   batchSize,
+		partitioned: partitioned,
+		readWorkers: DefaultReadWorkers,
 	}
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		log.Println("No database file found, creating a new one...")
@@ -43,12 +84,23 @@ func NewParquetDB(path string, batchSize int) (*ParquetDB, error) {
 			return nil, fmt.Errorf("failed to create empty database file: %w", err)
 		}
 		log.Println("Successfully created new database file.")
+	} else if err := db.migrate(); err != nil {
+		return nil, fmt.Errorf("failed to migrate database file: %w", err)
 	}
 	return db, nil
 }
 
-// createEmptyFile creates an empty Parquet file with the correct schema
+// createEmptyFile creates an empty Parquet file with the correct schema, or
+// the empty partition directory
 func (db *ParquetDB) createEmptyFile() error {
+	if db.partitioned {
+		if err := os.MkdirAll(db.path, 0755); err != nil {
+			return fmt.Errorf("failed to create partition directory: %w", err)
+		}
+		log.Printf("Successfully created partitioned database at %s", db.path)
+		return nil
+	}
+
 	fw, err := local.NewLocalFileWriter(db.path)
 	if err != nil {
 		return fmt.Errorf("failed to create local file writer: %w", err)
@@ -70,27 +122,42 @@ func (db *ParquetDB) createEmptyFile() error {
 	return nil
 }
 
-// ReadAllRecords reads all records from the Parquet file
+// ReadAllRecords reads all records from the Parquet file. After the first
+// call they are served from an in-memory index until the file changes.
 func (db *ParquetDB) ReadAllRecords(ctx context.Context) (map[string]FileRecord, error) {
-	fr, err := local.NewLocalFileReader(db.path)
+	if records, ok := db.cachedRecords(); ok {
+		return records, nil
+	}
+
+	// Take the mtime first so a write during the read makes the index stale
+	modTime, err := db.modTime()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create local file reader: %w", err)
+		return nil, fmt.Errorf("failed to stat database: %w", err)
 	}
-	defer fr.Close()
 
-	pr, err := reader.NewParquetReader(fr, new(FileRecord), 4)
+	var records map[string]FileRecord
+	if db.partitioned {
+		records, err = db.ReadRecordsBetween(ctx, time.Time{}, time.Time{})
+	} else {
+		records, err = db.readFile(db.path)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to create parquet reader: %w", err)
+		return nil, err
 	}
-	defer pr.ReadStop()
 
-	numRows := pr.GetNumRows()
-	records := make([]FileRecord, numRows)
-	if err := pr.Read(&records); err != nil {
-		return nil, fmt.Errorf("failed to read records: %w", err)
+	db.storeIndex(maps.Clone(records), modTime)
+	return records, nil
+}
+
+// readFile reads all records from the Parquet file at path with up to
+// readWorkers goroutines, see ParallelReader
+func (db *ParquetDB) readFile(path string) (map[string]FileRecord, error) {
+	records, err := NewParallelReader(path, db.readWorkers).ReadAll(context.Background())
+	if err != nil {
+		return nil, err
 	}
 
-	recordMap := make(map[string]FileRecord, numRows)
+	recordMap := make(map[string]FileRecord, len(records))
 	for _, r := range records {
 		recordMap[r.S3Key] = r
 	}
@@ -98,9 +165,81 @@ func (db *ParquetDB) ReadAllRecords(ctx context.Context) (map[string]FileRecord,
 	return recordMap, nil
 }
 
+// ScanRecords calls fn for every record in the Parquet file, reading it in
+// chunks so the whole database never has to be held in memory at once
+func (db *ParquetDB) ScanRecords(ctx context.Context, fn func(FileRecord) error) error {
+	if db.partitioned {
+		// A key may be in several partitions, so they must be merged first
+		records, err := db.ReadAllRecords(ctx)
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			if err := fn(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	fr, err := local.NewLocalFileReader(db.path)
+	if err != nil {
+		return fmt.Errorf("failed to create local file reader: %w", err)
+	}
+	defer fr.Close()
+
+	pr, err := reader.NewParquetReader(fr, new(FileRecord), 4)
+	if err != nil {
+		return fmt.Errorf("failed to create parquet reader: %w", err)
+	}
+	defer pr.ReadStop()
+
+	remaining := int(pr.GetNumRows())
+	for remaining > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n := min(remaining, scanChunkSize)
+		chunk := make([]FileRecord, n)
+		if err := pr.Read(&chunk); err != nil {
+			return fmt.Errorf("failed to read records: %w", err)
+		}
+		for _, r := range chunk {
+			if err := fn(r); err != nil {
+				return err
+			}
+		}
+		remaining -= n
+	}
+
+	return nil
+}
+
 // WriteRecords writes a slice of records to the Parquet file, overwriting existing content
 func (db *ParquetDB) WriteRecords(records []FileRecord) error {
-	fw, err := local.NewLocalFileWriter(db.path)
+	var err error
+	if db.partitioned {
+		err = db.writePartitions(records)
+	} else {
+		err = writeFile(db.path, records)
+	}
+	if err != nil {
+		db.InvalidateCache()
+		return err
+	}
+
+	index := make(map[string]FileRecord, len(records))
+	for _, r := range records {
+		index[r.S3Key] = r
+	}
+	db.indexWritten(index)
+	return nil
+}
+
+// writeFile writes records to the Parquet file at path, overwriting existing content
+func writeFile(path string, records []FileRecord) error {
+	fw, err := local.NewLocalFileWriter(path)
 	if err != nil {
 		return fmt.Errorf("failed to create local file writer: %w", err)
 	}
@@ -122,12 +261,15 @@ func (db *ParquetDB) WriteRecords(records []FileRecord) error {
 		}
 	}
 
-	log.Printf("Successfully wrote %d records to %s", len(records), db.path)
+	log.Printf("Successfully wrote %d records to %s", len(records), path)
 	return nil
 }
 
 // UpdateSyncStatus updates the sync status of a given file
 func (db *ParquetDB) UpdateSyncStatus(s3Key, etag, localPath, status string, lastModified time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	records, err := db.ReadAllRecords(context.Background())
 	if err != nil {
 		return fmt.Errorf("failed to read records for update: %w", err)
@@ -143,6 +285,10 @@ func (db *ParquetDB) UpdateSyncStatus(s3Key, etag, localPath, status string, las
 	record.SyncStatus = status
 	record.LastModified = lastModified.Unix()
 	record.LastSyncedAt = time.Now().Unix()
+	if status == "downloaded" {
+		record.LastError = ""
+		record.ErrorCount = 0
+	}
 	records[s3Key] = record
 
 	var recordSlice []FileRecord
@@ -153,52 +299,205 @@ func (db *ParquetDB) UpdateSyncStatus(s3Key, etag, localPath, status string, las
 	return db.WriteRecords(recordSlice)
 }
 
-// BatchUpdate adds a record to the batch buffer
+// BatchUpdate adds a record to the batch buffer. A "downloaded" status clears
+// the error recorded by BatchUpdateFailure; other statuses keep it.
 func (db *ParquetDB) BatchUpdate(s3Key, etag, localPath, status string, lastModified time.Time) error {
-	record := FileRecord{
+	return db.batchUpdate(FileRecord{
 		S3Key:        s3Key,
 		ETag:         etag,
 		LocalPath:    localPath,
 		SyncStatus:   status,
 		LastModified: lastModified.Unix(),
 		LastSyncedAt: time.Now().Unix(),
-	}
-	
+	})
+}
+
+// BatchUpdateDownloaded adds a "downloaded" record to the batch buffer with
+// the object's size and the content hash used to deduplicate downloads
+func (db *ParquetDB) BatchUpdateDownloaded(s3Key, etag, localPath, contentHash string, sizeBytes int64, lastModified time.Time) error {
+	return db.batchUpdate(FileRecord{
+		S3Key:         s3Key,
+		ETag:          etag,
+		LocalPath:     localPath,
+		SyncStatus:    "downloaded",
+		LastModified:  lastModified.Unix(),
+		LastSyncedAt:  time.Now().Unix(),
+		ContentHash:   contentHash,
+		FileSizeBytes: sizeBytes,
+	})
+}
+
+// BatchUpdateFailure adds a failed record to the batch buffer, storing
+// downloadErr as its LastError and incrementing its ErrorCount
+func (db *ParquetDB) BatchUpdateFailure(s3Key, etag, localPath, status string, lastModified time.Time, downloadErr error) error {
+	return db.batchUpdate(FileRecord{
+		S3Key:        s3Key,
+		ETag:         etag,
+		LocalPath:    localPath,
+		SyncStatus:   status,
+		LastModified: lastModified.Unix(),
+		LastSyncedAt: time.Now().Unix(),
+		LastError:    downloadErr.Error(),
+		ErrorCount:   1,
+	})
+}
+
+// BatchTouch adds record to the batch buffer with only its LastSyncedAt set
+// to now, keeping every other field as it is
+func (db *ParquetDB) BatchTouch(record FileRecord) error {
+	record.LastSyncedAt = time.Now().Unix()
+	// A buffered ErrorCount counts new failures, see mergeErrorState, so
+	// leave it zero for flushBatch to keep the stored error state
+	record.LastError, record.ErrorCount = "", 0
+	return db.batchUpdate(record)
+}
+
+// batchUpdate buffers record, flushing the buffer once it is full
+func (db *ParquetDB) batchUpdate(record FileRecord) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	db.batchBuffer = append(db.batchBuffer, record)
-	
+
 	if len(db.batchBuffer) >= db.batchSize {
-		return db.FlushBatch()
+		return db.flushBatchLocked()
 	}
-	
+
 	return nil
 }
 
+// SetReadWorkers sets the number of goroutines the row groups of a file are
+// read with; 1 reads them in turn
+func (db *ParquetDB) SetReadWorkers(n int) {
+	db.readWorkers = max(n, 1)
+}
+
+// OnFlush registers fn to be called after each batch of buffered records is
+// written, whether by FlushBatch or because the buffer filled up, after any
+// function registered before it. fn is called with the database locked, so
+// it must not block or use db.
+func (db *ParquetDB) OnFlush(fn func()) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.onFlush = append(db.onFlush, fn)
+}
+
 // FlushBatch writes all buffered records to the database
 func (db *ParquetDB) FlushBatch() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.flushBatchLocked()
+}
+
+// flushBatchLocked implements FlushBatch; db.mu must be held
+func (db *ParquetDB) flushBatchLocked() error {
 	if len(db.batchBuffer) == 0 {
 		return nil
 	}
-	
+
 	existingRecords, err := db.ReadAllRecords(context.Background())
 	if err != nil {
 		return fmt.Errorf("failed to read existing records: %w", err)
 	}
-	
-	for _, record := range db.batchBuffer {
-		existingRecords[record.S3Key] = record
-	}
-	
-	var recordSlice []FileRecord
-	for _, r := range existingRecords {
-		recordSlice = append(recordSlice, r)
+
+	for i, record := range db.batchBuffer {
+		db.batchBuffer[i] = mergeFileSize(existingRecords[record.S3Key], mergeErrorState(existingRecords[record.S3Key], record))
+		existingRecords[record.S3Key] = db.batchBuffer[i]
 	}
-	
-	if err := db.WriteRecords(recordSlice); err != nil {
-		return fmt.Errorf("failed to write batch: %w", err)
+
+	if db.partitioned {
+		// Only today's partition changes; older ones keep the superseded versions
+		if err := db.appendToPartition(time.Now(), db.batchBuffer); err != nil {
+			db.InvalidateCache()
+			return fmt.Errorf("failed to write batch: %w", err)
+		}
+		db.indexWritten(existingRecords)
+	} else {
+		var recordSlice []FileRecord
+		for _, r := range existingRecords {
+			recordSlice = append(recordSlice, r)
+		}
+
+		if err := db.WriteRecords(recordSlice); err != nil {
+			return fmt.Errorf("failed to write batch: %w", err)
+		}
 	}
-	
+
 	log.Printf("Flushed batch of %d records to database", len(db.batchBuffer))
 	db.batchBuffer = db.batchBuffer[:0]
-	
+	for _, fn := range db.onFlush {
+		fn()
+	}
+
+	return nil
+}
+
+// mergeErrorState carries the error fields of prev over to a buffered record.
+// In the buffer ErrorCount is the number of new failures, so it is added to
+// the stored count; a successful download starts from zero again.
+func mergeErrorState(prev, record FileRecord) FileRecord {
+	switch {
+	case record.ErrorCount > 0:
+		record.ErrorCount += prev.ErrorCount
+	case record.SyncStatus != "downloaded":
+		record.LastError = prev.LastError
+		record.ErrorCount = prev.ErrorCount
+	}
+	return record
+}
+
+// mergeFileSize keeps the known size of prev for a buffered record of the
+// same object version that was recorded without one
+func mergeFileSize(prev, record FileRecord) FileRecord {
+	if record.FileSizeBytes == 0 && prev.ETag == record.ETag {
+		record.FileSizeBytes = prev.FileSizeBytes
+	}
+	return record
+}
+
+// Reset discards all records and leaves an empty database file in place
+func (db *ParquetDB) Reset() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.batchBuffer = db.batchBuffer[:0]
+	db.InvalidateCache()
+	if db.partitioned {
+		if err := os.RemoveAll(db.path); err != nil {
+			return fmt.Errorf("failed to reset database: %w", err)
+		}
+	}
+	if err := db.createEmptyFile(); err != nil {
+		return fmt.Errorf("failed to reset database: %w", err)
+	}
 	return nil
-}
\ No newline at end of file
+}
+
+// ResetWithBackup moves the database to a .bak file next to it, replacing any
+// previous backup, and leaves an empty database in its place. It returns the
+// path of the backup, or "" when there was no database to keep.
+func (db *ParquetDB) ResetWithBackup() (string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.batchBuffer = db.batchBuffer[:0]
+	db.InvalidateCache()
+	backup := db.path + ".bak"
+	if _, err := os.Stat(db.path); err == nil {
+		// A partitioned backup is a directory, which Rename will not replace
+		if err := os.RemoveAll(backup); err != nil {
+			return "", fmt.Errorf("failed to remove old backup %s: %w", backup, err)
+		}
+		if err := os.Rename(db.path, backup); err != nil {
+			return "", fmt.Errorf("failed to back up database: %w", err)
+		}
+	} else if os.IsNotExist(err) {
+		backup = ""
+	} else {
+		return "", fmt.Errorf("failed to stat database: %w", err)
+	}
+	if err := db.createEmptyFile(); err != nil {
+		return "", fmt.Errorf("failed to reset database: %w", err)
+	}
+	return backup, nil
+}
@@ -0,0 +1,138 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// benchSizes are the record counts the benchmarks run against
+var benchSizes = []int{100, 10_000, 100_000, 1_000_000}
+
+// benchBatchSize is the default BATCH_SIZE
+const benchBatchSize = 100
+
+// randomRecords returns n records with the keys, ETags and sizes of a
+// typical export prefix, generated from a fixed seed
+func randomRecords(n int) []FileRecord {
+	r := rand.New(rand.NewPCG(1, uint64(n)))
+	statuses := []string{"downloaded", "downloaded", "downloaded", "failed", "pending"}
+	now := time.Now()
+	records := make([]FileRecord, n)
+	for i := range records {
+		modified := now.Add(-time.Duration(r.IntN(365*24)) * time.Hour)
+		records[i] = FileRecord{
+			S3Key:         fmt.Sprintf("exports/%04d/%02d/part-%08d-%016x.csv.gz", modified.Year(), modified.Month(), i, r.Uint64()),
+			ETag:          fmt.Sprintf(`"%016x%016x"`, r.Uint64(), r.Uint64()),
+			LastModified:  modified.Unix(),
+			SyncStatus:    statuses[r.IntN(len(statuses))],
+			LocalPath:     fmt.Sprintf("/data/exports/part-%08d.csv.gz", i),
+			LastSyncedAt:  now.Unix(),
+			ContentHash:   fmt.Sprintf("%016x%016x", r.Uint64(), r.Uint64()),
+			FileSizeBytes: r.Int64N(64 << 20),
+		}
+	}
+	return records
+}
+
+// openBenchDB opens a database in a temporary directory holding records
+func openBenchDB(b *testing.B, records []FileRecord, batchSize int) *ParquetDB {
+	b.Helper()
+	db, err := NewParquetDB(filepath.Join(b.TempDir(), "bench.parquet"), batchSize)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := db.WriteRecords(records); err != nil {
+		b.Fatal(err)
+	}
+	return db
+}
+
+// reportBytesPerSec reports the rate at which the database file at db was
+// processed when each of the b.N operations went through perOp bytes of it
+func reportBytesPerSec(b *testing.B, db *ParquetDB, perOp float64) {
+	b.Helper()
+	info, err := os.Stat(db.path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if elapsed := b.Elapsed().Seconds(); elapsed > 0 {
+		b.ReportMetric(float64(info.Size())*perOp*float64(b.N)/elapsed, "bytes/s")
+	}
+}
+
+func BenchmarkReadAllRecords(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("records=%d", n), func(b *testing.B) {
+			db := openBenchDB(b, randomRecords(n), benchBatchSize)
+			ctx := context.Background()
+
+			b.ResetTimer()
+			for range b.N {
+				// Read from disk rather than from the index
+				db.InvalidateCache()
+				records, err := db.ReadAllRecords(ctx)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(records) != n {
+					b.Fatalf("read %d records, want %d", len(records), n)
+				}
+			}
+			b.StopTimer()
+			reportBytesPerSec(b, db, 1)
+		})
+	}
+}
+
+func BenchmarkFlushBatch(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("records=%d", n), func(b *testing.B) {
+			records := randomRecords(n)
+			batch := min(benchBatchSize, n)
+			db := openBenchDB(b, records, batch+1)
+
+			b.ResetTimer()
+			for i := range b.N {
+				b.StopTimer()
+				for j := range batch {
+					r := records[(i*batch+j)%n]
+					if err := db.BatchUpdate(r.S3Key, r.ETag, r.LocalPath, "downloaded", time.Unix(r.LastModified, 0)); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.StartTimer()
+				if err := db.FlushBatch(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			reportBytesPerSec(b, db, 1)
+		})
+	}
+}
+
+func BenchmarkBatchUpdate(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("records=%d", n), func(b *testing.B) {
+			records := randomRecords(n)
+			batch := min(benchBatchSize, n)
+			db := openBenchDB(b, records, batch)
+
+			b.ResetTimer()
+			for i := range b.N {
+				r := records[i%n]
+				if err := db.BatchUpdate(r.S3Key, r.ETag, r.LocalPath, "downloaded", time.Unix(r.LastModified, 0)); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			// Each update costs its share of the flush that rewrites the file
+			reportBytesPerSec(b, db, 1/float64(batch))
+		})
+	}
+}
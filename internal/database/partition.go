@@ -0,0 +1,205 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// partitionFile is the name of the records file in each daily partition
+const partitionFile = "records.parquet"
+
+// partition is one daily file of a partitioned database
+type partition struct {
+	day  time.Time
+	path string
+}
+
+// A partitioned database (PARTITION_BY_DATE) keeps the records synced on
+// each day in <DB_PATH>/year=YYYY/month=MM/day=DD/records.parquet, in UTC.
+// FlushBatch only rewrites today's partition, so a key updated on several
+// days has a version in each of them; the newest partition wins on read.
+
+// partitionPath returns the file of the partition holding records synced on day
+func (db *ParquetDB) partitionPath(day time.Time) string {
+	day = day.UTC()
+	return filepath.Join(db.path,
+		fmt.Sprintf("year=%04d", day.Year()),
+		fmt.Sprintf("month=%02d", int(day.Month())),
+		fmt.Sprintf("day=%02d", day.Day()),
+		partitionFile)
+}
+
+// listPartitions returns the partitions found under the database directory, oldest first
+func (db *ParquetDB) listPartitions() ([]partition, error) {
+	matches, err := filepath.Glob(filepath.Join(db.path, "year=*", "month=*", "day=*", partitionFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list partitions: %w", err)
+	}
+
+	var partitions []partition
+	for _, path := range matches {
+		dayDir := filepath.Dir(path)
+		monthDir := filepath.Dir(dayDir)
+		yearDir := filepath.Dir(monthDir)
+
+		var year, month, day int
+		_, errY := fmt.Sscanf(filepath.Base(yearDir), "year=%d", &year)
+		_, errM := fmt.Sscanf(filepath.Base(monthDir), "month=%d", &month)
+		_, errD := fmt.Sscanf(filepath.Base(dayDir), "day=%d", &day)
+		if errY != nil || errM != nil || errD != nil {
+			log.Printf("Ignoring unrecognised partition %s", path)
+			continue
+		}
+		partitions = append(partitions, partition{
+			day:  time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC),
+			path: path,
+		})
+	}
+
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].day.Before(partitions[j].day) })
+	return partitions, nil
+}
+
+// ReadRecordsBetween reads the records synced between the days of after and
+// before, inclusive; a zero time leaves that end open. In a partitioned
+// database only the partitions in the range are read, and each key has its
+// newest version within the range.
+func (db *ParquetDB) ReadRecordsBetween(ctx context.Context, after, before time.Time) (map[string]FileRecord, error) {
+	first, last := truncateDay(after), truncateDay(before)
+
+	if !db.partitioned {
+		records, err := db.readFile(db.path)
+		if err != nil {
+			return nil, err
+		}
+		for key, r := range records {
+			day := truncateDay(time.Unix(r.LastSyncedAt, 0))
+			if (!first.IsZero() && day.Before(first)) || (!last.IsZero() && day.After(last)) {
+				delete(records, key)
+			}
+		}
+		return records, nil
+	}
+
+	partitions, err := db.listPartitions()
+	if err != nil {
+		return nil, err
+	}
+
+	records := make(map[string]FileRecord)
+	for _, p := range partitions {
+		if (!first.IsZero() && p.day.Before(first)) || (!last.IsZero() && p.day.After(last)) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		partRecords, err := db.readFile(p.path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read partition %s: %w", p.path, err)
+		}
+		for key, r := range partRecords {
+			records[key] = r
+		}
+	}
+	return records, nil
+}
+
+// MergePartitions compacts the records synced between the days of after and
+// before into a single Parquet file at outputPath for analysis, keeping the
+// newest version of each key. The database itself is left unchanged.
+func (db *ParquetDB) MergePartitions(ctx context.Context, after, before time.Time, outputPath string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	records, err := db.ReadRecordsBetween(ctx, after, before)
+	if err != nil {
+		return err
+	}
+
+	recordSlice := make([]FileRecord, 0, len(records))
+	for _, r := range records {
+		recordSlice = append(recordSlice, r)
+	}
+	sort.Slice(recordSlice, func(i, j int) bool { return recordSlice[i].S3Key < recordSlice[j].S3Key })
+
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", outputPath, err)
+	}
+	if err := writeFile(outputPath, recordSlice); err != nil {
+		return fmt.Errorf("failed to merge partitions: %w", err)
+	}
+	return nil
+}
+
+// appendToPartition adds records to the partition of day, replacing the
+// versions of the same keys already in it
+func (db *ParquetDB) appendToPartition(day time.Time, records []FileRecord) error {
+	path := db.partitionPath(day)
+
+	existing := make(map[string]FileRecord)
+	if _, err := os.Stat(path); err == nil {
+		if existing, err = db.readFile(path); err != nil {
+			return fmt.Errorf("failed to read partition %s: %w", path, err)
+		}
+	}
+	for _, r := range records {
+		existing[r.S3Key] = r
+	}
+
+	recordSlice := make([]FileRecord, 0, len(existing))
+	for _, r := range existing {
+		recordSlice = append(recordSlice, r)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create partition directory: %w", err)
+	}
+	return writeFile(path, recordSlice)
+}
+
+// writePartitions replaces the whole partitioned database with records,
+// placing each in the partition of the day it was last synced
+func (db *ParquetDB) writePartitions(records []FileRecord) error {
+	byPath := make(map[string][]FileRecord)
+	for _, r := range records {
+		path := db.partitionPath(time.Unix(r.LastSyncedAt, 0))
+		byPath[path] = append(byPath[path], r)
+	}
+
+	old, err := db.listPartitions()
+	if err != nil {
+		return err
+	}
+
+	for path, partRecords := range byPath {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create partition directory: %w", err)
+		}
+		if err := writeFile(path, partRecords); err != nil {
+			return err
+		}
+	}
+	for _, p := range old {
+		if _, ok := byPath[p.path]; ok {
+			continue
+		}
+		if err := os.Remove(p.path); err != nil {
+			return fmt.Errorf("failed to remove partition %s: %w", p.path, err)
+		}
+	}
+	return nil
+}
+
+// truncateDay returns the start of the UTC day of t, keeping the zero time zero
+func truncateDay(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DBStats summarises the records in the database and the space it takes
+type DBStats struct {
+	TotalRecords int64            `json:"total_records"`
+	ByStatus     map[string]int64 `json:"by_status"`
+	// FileSizeBytes is the size of the database file or partitions, plus any
+	// sidecar files next to it such as backups
+	FileSizeBytes int64     `json:"file_size_bytes"`
+	OldestRecord  time.Time `json:"oldest_record"`
+	NewestRecord  time.Time `json:"newest_record"`
+	// TotalTrackedBytes is the summed FileSizeBytes of the records; records
+	// written before sizes were stored count as 0
+	TotalTrackedBytes int64 `json:"total_tracked_bytes"`
+}
+
+// Stats computes DBStats in a single pass over the records. Oldest and
+// newest are by LastSyncedAt.
+func (db *ParquetDB) Stats(ctx context.Context) (DBStats, error) {
+	stats := DBStats{ByStatus: make(map[string]int64)}
+
+	var oldest, newest int64
+	err := db.ScanRecords(ctx, func(r FileRecord) error {
+		stats.TotalRecords++
+		stats.ByStatus[r.SyncStatus]++
+		stats.TotalTrackedBytes += r.FileSizeBytes
+		if oldest == 0 || r.LastSyncedAt < oldest {
+			oldest = r.LastSyncedAt
+		}
+		if r.LastSyncedAt > newest {
+			newest = r.LastSyncedAt
+		}
+		return nil
+	})
+	if err != nil {
+		return DBStats{}, fmt.Errorf("failed to scan database: %w", err)
+	}
+	if stats.TotalRecords > 0 {
+		stats.OldestRecord = time.Unix(oldest, 0)
+		stats.NewestRecord = time.Unix(newest, 0)
+	}
+
+	if stats.FileSizeBytes, err = db.DiskUsage(); err != nil {
+		return DBStats{}, fmt.Errorf("failed to measure database size: %w", err)
+	}
+	return stats, nil
+}
+
+// lockFileSuffix names the default PID_LOCK_FILE next to the database,
+// which is not part of it
+const lockFileSuffix = ".lock"
+
+// DiskUsage returns the bytes used by the database: the file, or every file
+// under the partition directory, plus sidecars named <path>.* such as
+// write-ahead logs and backups. The <path>.lock PID file is not counted.
+func (db *ParquetDB) DiskUsage() (int64, error) {
+	var total int64
+	if db.partitioned {
+		err := filepath.WalkDir(db.path, func(_ string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			total += info.Size()
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		info, err := os.Stat(db.path)
+		if err != nil {
+			return 0, err
+		}
+		total = info.Size()
+	}
+
+	sidecars, err := filepath.Glob(db.path + ".*")
+	if err != nil {
+		return 0, err
+	}
+	for _, path := range sidecars {
+		if path == db.path+lockFileSuffix {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			total += info.Size()
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,141 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrRecordNotFound is returned by DeleteRecord when no record has the given key
+var ErrRecordNotFound = errors.New("record not found")
+
+// StateStore is the view of the sync state used outside the syncer, such as
+// by the REST API. ParquetDB implements it.
+type StateStore interface {
+	// ScanRecords calls fn for every record until fn returns an error
+	ScanRecords(ctx context.Context, fn func(FileRecord) error) error
+	// DeleteRecord removes the record of s3Key, so the next run downloads it again
+	DeleteRecord(ctx context.Context, s3Key string) error
+}
+
+var _ StateStore = (*ParquetDB)(nil)
+
+// DeleteRecord removes the record of s3Key from the database, flushing any
+// buffered updates first so a pending one cannot bring it back
+func (db *ParquetDB) DeleteRecord(ctx context.Context, s3Key string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if err := db.flushBatchLocked(); err != nil {
+		return err
+	}
+
+	records, err := db.ReadAllRecords(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read records for delete: %w", err)
+	}
+	if _, ok := records[s3Key]; !ok {
+		return fmt.Errorf("%w: %s", ErrRecordNotFound, s3Key)
+	}
+	delete(records, s3Key)
+
+	recordSlice := make([]FileRecord, 0, len(records))
+	for _, r := range records {
+		recordSlice = append(recordSlice, r)
+	}
+	return db.WriteRecords(recordSlice)
+}
+
+// ResetStatus removes every record whose status is status, so the next run
+// downloads those files again while all other records are kept. It returns
+// the number of records removed.
+func (db *ParquetDB) ResetStatus(ctx context.Context, status string) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if err := db.flushBatchLocked(); err != nil {
+		return 0, err
+	}
+
+	records, err := db.ReadAllRecords(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read records for reset: %w", err)
+	}
+
+	kept := make([]FileRecord, 0, len(records))
+	for _, r := range records {
+		if r.SyncStatus != status {
+			kept = append(kept, r)
+		}
+	}
+	removed := len(records) - len(kept)
+	if removed == 0 {
+		return 0, nil
+	}
+	if err := db.WriteRecords(kept); err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// RenameRecord moves the record of oldKey to newKey with status status,
+// replacing any record newKey already had. It returns the moved record.
+func (db *ParquetDB) RenameRecord(ctx context.Context, oldKey, newKey, status string) (FileRecord, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if err := db.flushBatchLocked(); err != nil {
+		return FileRecord{}, err
+	}
+
+	records, err := db.ReadAllRecords(ctx)
+	if err != nil {
+		return FileRecord{}, fmt.Errorf("failed to read records for rename: %w", err)
+	}
+	record, ok := records[oldKey]
+	if !ok {
+		return FileRecord{}, fmt.Errorf("%w: %s", ErrRecordNotFound, oldKey)
+	}
+	delete(records, oldKey)
+	record.S3Key = newKey
+	record.SyncStatus = status
+	records[newKey] = record
+
+	recordSlice := make([]FileRecord, 0, len(records))
+	for _, r := range records {
+		recordSlice = append(recordSlice, r)
+	}
+	if err := db.WriteRecords(recordSlice); err != nil {
+		return FileRecord{}, err
+	}
+	return record, nil
+}
+
+// VersionedKey is the key of the record of version versionID of s3Key, kept
+// apart from the record of its latest version under s3Key itself
+func VersionedKey(s3Key, versionID string) string {
+	return s3Key + "#" + versionID
+}
+
+// PutRecord writes record, replacing any record of the same key, after
+// flushing the batch buffer
+func (db *ParquetDB) PutRecord(ctx context.Context, record FileRecord) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if err := db.flushBatchLocked(); err != nil {
+		return err
+	}
+
+	records, err := db.ReadAllRecords(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read records for update: %w", err)
+	}
+	records[record.S3Key] = record
+
+	recordSlice := make([]FileRecord, 0, len(records))
+	for _, r := range records {
+		recordSlice = append(recordSlice, r)
+	}
+	return db.WriteRecords(recordSlice)
+}
@@ -0,0 +1,111 @@
+package deadletter
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Entry is a single file that exhausted its download retries
+type Entry struct {
+	S3Key        string    `json:"s3_key"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"last_modified,omitzero"`
+	ErrorMessage string    `json:"error_message"`
+	Timestamp    time.Time `json:"timestamp"`
+	AttemptCount int       `json:"attempt_count"`
+}
+
+// Queue is an NDJSON dead letter file of persistently-failing downloads
+type Queue struct {
+	path     string
+	maxBytes int64
+
+	mu sync.Mutex
+}
+
+// NewQueue creates a dead letter queue at path. Appends are dropped once the
+// file reaches maxBytes; zero means unlimited.
+func NewQueue(path string, maxBytes int64) *Queue {
+	return &Queue{path: path, maxBytes: maxBytes}
+}
+
+// Append adds an entry to the end of the file. Each entry is written with a
+// single O_APPEND write so concurrent appends never interleave.
+func (q *Queue) Append(entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode dead letter entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.maxBytes > 0 {
+		if info, err := os.Stat(q.path); err == nil && info.Size()+int64(len(line)) > q.maxBytes {
+			log.Printf("Dead letter queue %s is full, dropping entry for %s", q.path, entry.S3Key)
+			return nil
+		}
+	}
+
+	f, err := os.OpenFile(q.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open dead letter queue %s: %w", q.path, err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(line); err != nil {
+		return fmt.Errorf("failed to append to dead letter queue %s: %w", q.path, err)
+	}
+	return nil
+}
+
+// ReadAll returns every entry in the file. A missing file is an empty queue.
+func (q *Queue) ReadAll() ([]Entry, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	f, err := os.Open(q.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dead letter queue %s: %w", q.path, err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("failed to decode line %d of %s: %w", line, q.path, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read dead letter queue %s: %w", q.path, err)
+	}
+	return entries, nil
+}
+
+// Truncate empties the queue
+func (q *Queue) Truncate() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := os.Truncate(q.path, 0); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to truncate dead letter queue %s: %w", q.path, err)
+	}
+	return nil
+}
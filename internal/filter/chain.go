@@ -0,0 +1,86 @@
+package filter
+
+import (
+	"log"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"sava-s3-export/internal/database"
+)
+
+// FileFilter decides whether a listed object is downloaded. record is its
+// database record when exists is set. An excluded object comes with a short,
+// fixed reason, such as "unchanged", under which it is counted.
+type FileFilter interface {
+	Filter(obj types.Object, record *database.FileRecord, exists bool) (include bool, reason string)
+}
+
+// FilterFunc adapts a function to a FileFilter
+type FilterFunc func(obj types.Object, record *database.FileRecord, exists bool) (bool, string)
+
+// Filter calls f
+func (f FilterFunc) Filter(obj types.Object, record *database.FileRecord, exists bool) (bool, string) {
+	return f(obj, record, exists)
+}
+
+// FilterChain downloads the objects included by every one of its filters,
+// run in the order they were added until one excludes the object
+type FilterChain struct {
+	filters    []FileFilter
+	mayContain func(key string) bool
+}
+
+// NewChain creates an empty chain, which includes every object
+func NewChain() *FilterChain {
+	return &FilterChain{}
+}
+
+// Add appends f to the chain
+func (c *FilterChain) Add(f FileFilter) *FilterChain {
+	c.filters = append(c.filters, f)
+	return c
+}
+
+// WithMembership skips the record lookup of keys for which mayContain, such
+// as a bloom filter of the database, reports false
+func (c *FilterChain) WithMembership(mayContain func(key string) bool) *FilterChain {
+	c.mayContain = mayContain
+	return c
+}
+
+// Apply returns the objects of s3Files included by every filter, in order,
+// and logs how many were excluded for each reason
+func (c *FilterChain) Apply(s3Files []types.Object, localRecords map[string]database.FileRecord) []types.Object {
+	var included []types.Object
+	excluded := make(map[string]int)
+	for _, obj := range s3Files {
+		var record database.FileRecord
+		exists := false
+		if c.mayContain == nil || c.mayContain(*obj.Key) {
+			record, exists = localRecords[*obj.Key]
+		}
+
+		include := true
+		for _, f := range c.filters {
+			var reason string
+			if include, reason = f.Filter(obj, &record, exists); !include {
+				excluded[reason]++
+				break
+			}
+		}
+		if include {
+			included = append(included, obj)
+		}
+	}
+
+	reasons := make([]string, 0, len(excluded))
+	for reason := range excluded {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		log.Printf("Excluded %d files: %s", excluded[reason], reason)
+	}
+	return included
+}
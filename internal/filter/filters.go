@@ -0,0 +1,111 @@
+package filter
+
+import (
+	"path"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"sava-s3-export/internal/database"
+)
+
+// ETagFilter includes objects without a record, those whose ETag differs
+// from the recorded one, and those whose record has one of the Retry statuses
+type ETagFilter struct {
+	Retry map[string]bool
+}
+
+// Filter implements FileFilter
+func (f ETagFilter) Filter(obj types.Object, record *database.FileRecord, exists bool) (bool, string) {
+	if !exists || record.ETag != *obj.ETag || f.Retry[record.SyncStatus] {
+		return true, ""
+	}
+	return false, "unchanged"
+}
+
+// SizeFilter includes objects of at least Min and at most Max bytes; a zero
+// bound is not checked
+type SizeFilter struct {
+	Min, Max int64
+}
+
+// Filter implements FileFilter
+func (f SizeFilter) Filter(obj types.Object, record *database.FileRecord, exists bool) (bool, string) {
+	var size int64
+	if obj.Size != nil {
+		size = *obj.Size
+	}
+	if f.Min > 0 && size < f.Min {
+		return false, "smaller than minimum size"
+	}
+	if f.Max > 0 && size > f.Max {
+		return false, "larger than maximum size"
+	}
+	return true, ""
+}
+
+// DateFilter includes objects last modified after After and before Before; a
+// zero time is not checked
+type DateFilter struct {
+	After, Before time.Time
+}
+
+// Filter implements FileFilter
+func (f DateFilter) Filter(obj types.Object, record *database.FileRecord, exists bool) (bool, string) {
+	if obj.LastModified == nil {
+		return f.After.IsZero() && f.Before.IsZero(), "modification time unknown"
+	}
+	if !f.After.IsZero() && !obj.LastModified.After(f.After) {
+		return false, "modified too early"
+	}
+	if !f.Before.IsZero() && !obj.LastModified.Before(f.Before) {
+		return false, "modified too late"
+	}
+	return true, ""
+}
+
+// PatternFilter includes objects whose key matches one of the Include glob
+// patterns, or any key when there are none, unless it matches one of Exclude.
+// Patterns use the syntax of path.Match.
+type PatternFilter struct {
+	Include, Exclude []string
+}
+
+// Filter implements FileFilter
+func (f PatternFilter) Filter(obj types.Object, record *database.FileRecord, exists bool) (bool, string) {
+	if len(f.Include) > 0 && !matchAny(f.Include, *obj.Key) {
+		return false, "not matched by an include pattern"
+	}
+	if matchAny(f.Exclude, *obj.Key) {
+		return false, "matched by an exclude pattern"
+	}
+	return true, ""
+}
+
+// matchAny reports whether key matches one of patterns; malformed patterns match nothing
+func matchAny(patterns []string, key string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// StorageClassFilter includes only objects of the Allowed storage classes.
+// Objects listed without one are STANDARD.
+type StorageClassFilter struct {
+	Allowed map[types.ObjectStorageClass]bool
+}
+
+// Filter implements FileFilter
+func (f StorageClassFilter) Filter(obj types.Object, record *database.FileRecord, exists bool) (bool, string) {
+	class := obj.StorageClass
+	if class == "" {
+		class = types.ObjectStorageClassStandard
+	}
+	if !f.Allowed[class] {
+		return false, "storage class not allowed"
+	}
+	return true, ""
+}
@@ -0,0 +1,125 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Prober reports the state of the application to the health endpoints. Both
+// methods are called on every probe, so they must not do any I/O.
+type Prober interface {
+	// Healthy returns the error of the last sync cycle, or nil if it succeeded
+	Healthy() error
+	// Ready reports whether the first sync cycle has completed
+	Ready() bool
+}
+
+// DetailProber is optionally implemented by a Prober to add component state,
+// such as the circuit breaker, to the /healthz response
+type DetailProber interface {
+	ProbeDetails() map[string]string
+}
+
+// Checker is optionally implemented by a Prober to verify connectivity and
+// local prerequisites on demand. Unlike the Prober methods it does I/O, so
+// /healthz only calls it when asked with ?check=full.
+type Checker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// checkTimeout bounds a full health check made through /healthz
+const checkTimeout = 10 * time.Second
+
+// Server exposes /healthz and /readyz for container orchestration probes, and
+// /metrics when a metrics handler is configured
+type Server struct {
+	httpServer *http.Server
+}
+
+// probeResponse is the JSON body returned by the probe endpoints
+type probeResponse struct {
+	Status  string            `json:"status"`
+	Error   string            `json:"error,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// NewServer creates a health server listening on port. metricsHandler may be
+// nil, in which case /metrics is not served.
+func NewServer(port int, prober Prober, metricsHandler http.Handler) *Server {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		var details map[string]string
+		if dp, ok := prober.(DetailProber); ok {
+			details = dp.ProbeDetails()
+		}
+		err := prober.Healthy()
+		if checker, ok := prober.(Checker); ok && err == nil && r.URL.Query().Get("check") == "full" {
+			ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+			err = checker.HealthCheck(ctx)
+			cancel()
+		}
+		if err != nil {
+			writeProbe(w, http.StatusServiceUnavailable, probeResponse{Status: "error", Error: err.Error(), Details: details})
+			return
+		}
+		writeProbe(w, http.StatusOK, probeResponse{Status: "ok", Details: details})
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !prober.Ready() {
+			writeProbe(w, http.StatusServiceUnavailable, probeResponse{Status: "not ready"})
+			return
+		}
+		writeProbe(w, http.StatusOK, probeResponse{Status: "ok"})
+	})
+
+	if metricsHandler != nil {
+		mux.Handle("/metrics", metricsHandler)
+	}
+
+	return &Server{
+		httpServer: &http.Server{
+			Addr:              net.JoinHostPort("", strconv.Itoa(port)),
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		},
+	}
+}
+
+// Start begins serving in the background. It returns an error if the port
+// cannot be bound.
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.httpServer.Addr, err)
+	}
+
+	go func() {
+		if err := s.httpServer.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Health server stopped with an error: %v", err)
+		}
+	}()
+
+	log.Printf("Health server listening on %s", s.httpServer.Addr)
+	return nil
+}
+
+// Shutdown gracefully stops the server, waiting for in-flight probes until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.httpServer.Shutdown(ctx)
+}
+
+// writeProbe writes resp as JSON with the given status code
+func writeProbe(w http.ResponseWriter, code int, resp probeResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
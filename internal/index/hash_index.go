@@ -0,0 +1,94 @@
+package index
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// hashBucket holds the local path of each content hash
+var hashBucket = []byte("content_hashes")
+
+// openTimeout bounds the wait for another process holding the index open
+const openTimeout = 5 * time.Second
+
+// ContentHashIndex maps the content hash of downloaded files to the local path
+// holding that content, in a bbolt database kept across runs
+type ContentHashIndex struct {
+	db *bolt.DB
+}
+
+// OpenContentHashIndex opens the index at path, creating it and its directory
+// when missing. Only one process may have it open at a time.
+func OpenContentHashIndex(path string) (*ContentHashIndex, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory for hash index %s: %w", path, err)
+	}
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open hash index %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(hashBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialise hash index %s: %w", path, err)
+	}
+	return &ContentHashIndex{db: db}, nil
+}
+
+// Lookup returns the local path stored for hash
+func (i *ContentHashIndex) Lookup(hash string) (localPath string, ok bool) {
+	i.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(hashBucket).Get([]byte(hash)); v != nil {
+			localPath, ok = string(v), true
+		}
+		return nil
+	})
+	return localPath, ok
+}
+
+// Store records localPath as holding the content with hash
+func (i *ContentHashIndex) Store(hash, localPath string) error {
+	err := i.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(hashBucket).Put([]byte(hash), []byte(localPath))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store hash %s: %w", hash, err)
+	}
+	return nil
+}
+
+// Rebuild replaces the whole index with paths, keyed by content hash, in a
+// single transaction
+func (i *ContentHashIndex) Rebuild(paths map[string]string) error {
+	err := i.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(hashBucket); err != nil {
+			return err
+		}
+		b, err := tx.CreateBucket(hashBucket)
+		if err != nil {
+			return err
+		}
+		for hash, localPath := range paths {
+			if err := b.Put([]byte(hash), []byte(localPath)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to rebuild hash index: %w", err)
+	}
+	return nil
+}
+
+// Close closes the index, releasing its file lock
+func (i *ContentHashIndex) Close() error {
+	return i.db.Close()
+}
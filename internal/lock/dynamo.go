@@ -0,0 +1,222 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+
+	appAws "sava-s3-export/internal/aws"
+	"sava-s3-export/internal/config"
+)
+
+const (
+	// leaseDuration is how long a lock stays valid without being renewed; it
+	// is stored in the expires_at TTL attribute so DynamoDB removes stale locks
+	leaseDuration = 5 * time.Minute
+	// renewInterval is how often a held lock extends its lease
+	renewInterval = time.Minute
+	// acquireRetryInterval is the delay between attempts to take a held lock
+	acquireRetryInterval = 5 * time.Second
+)
+
+// ErrLockHeld is returned by Acquire when another instance holds the lock;
+// DynamoLock first waits up to LOCK_WAIT_TIMEOUT_SECONDS for it
+var ErrLockHeld = errors.New("lock is held by another instance")
+
+// ErrLockLost is the cause of the cancellation of the context returned by
+// Acquire when the lease could not be renewed before it expired, or another
+// instance has taken the lock over
+var ErrLockLost = errors.New("lock was lost")
+
+// DynamoLock is a lease on an item in the LOCK_TABLE_NAME DynamoDB table,
+// keyed by S3_BUCKET and S3_PREFIX, that keeps instances on different hosts
+// from syncing the same prefix at once. The table's partition key must be
+// the string attribute lock_key; enable TTL on expires_at to clean up locks
+// of crashed instances.
+type DynamoLock struct {
+	client      *dynamodb.Client
+	table       string
+	key         string
+	owner       string
+	hostname    string
+	waitTimeout time.Duration
+
+	// stopRenew ends the renewal goroutine of a held lock, and cancelRun
+	// the context of the run holding it
+	mu        sync.Mutex
+	stopRenew context.CancelFunc
+	cancelRun context.CancelCauseFunc
+	renewDone chan struct{}
+}
+
+// NewDynamoLock creates the lock for the configured bucket and prefix
+func NewDynamoLock(ctx context.Context, cfg *config.Config) (*DynamoLock, error) {
+	awsCfg, err := appAws.LoadAWSConfig(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return &DynamoLock{
+		client:      dynamodb.NewFromConfig(awsCfg),
+		table:       cfg.LOCK_TABLE_NAME,
+		key:         cfg.S3_BUCKET + "/" + cfg.S3_PREFIX,
+		owner:       uuid.NewString(),
+		hostname:    hostname,
+		waitTimeout: cfg.LOCK_WAIT_TIMEOUT_SECONDS,
+	}, nil
+}
+
+// Acquire takes the lock, retrying for LOCK_WAIT_TIMEOUT_SECONDS while
+// another instance holds it, and keeps renewing its lease until Release. The
+// returned context is derived from ctx and is cancelled with ErrLockLost
+// when the lock is lost, so the run holding it must use it.
+func (l *DynamoLock) Acquire(ctx context.Context) (context.Context, error) {
+	deadline := time.Now().Add(l.waitTimeout)
+	for {
+		err := l.put(ctx, true)
+		if err == nil {
+			break
+		}
+		var conflict *types.ConditionalCheckFailedException
+		if !errors.As(err, &conflict) {
+			return nil, fmt.Errorf("failed to acquire lock %s: %w", l.key, err)
+		}
+		if !time.Now().Add(acquireRetryInterval).Before(deadline) {
+			return nil, fmt.Errorf("%w: %s", ErrLockHeld, l.key)
+		}
+
+		log.Printf("Lock %s is held by another instance, retrying in %v", l.key, acquireRetryInterval)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(acquireRetryInterval):
+		}
+	}
+
+	log.Printf("Acquired lock %s in table %s", l.key, l.table)
+
+	runCtx, cancelRun := context.WithCancelCause(ctx)
+	renewCtx, cancel := context.WithCancel(context.Background())
+	l.mu.Lock()
+	l.stopRenew = cancel
+	l.cancelRun = cancelRun
+	l.renewDone = make(chan struct{})
+	l.mu.Unlock()
+	go l.renew(renewCtx, cancelRun, l.renewDone)
+	return runCtx, nil
+}
+
+// Release stops renewing the lease and deletes the lock if it is still ours
+func (l *DynamoLock) Release(ctx context.Context) error {
+	l.mu.Lock()
+	cancel, cancelRun, done := l.stopRenew, l.cancelRun, l.renewDone
+	l.stopRenew, l.cancelRun, l.renewDone = nil, nil, nil
+	l.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	<-done
+	cancelRun(context.Canceled)
+
+	_, err := l.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           aws.String(l.table),
+		Key:                 map[string]types.AttributeValue{"lock_key": &types.AttributeValueMemberS{Value: l.key}},
+		ConditionExpression: aws.String("#owner = :owner"),
+		ExpressionAttributeNames: map[string]string{
+			"#owner": "owner",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":owner": &types.AttributeValueMemberS{Value: l.owner},
+		},
+	})
+	var conflict *types.ConditionalCheckFailedException
+	if errors.As(err, &conflict) {
+		log.Printf("Lock %s was taken over by another instance before release", l.key)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to release lock %s: %w", l.key, err)
+	}
+
+	log.Printf("Released lock %s", l.key)
+	return nil
+}
+
+// renew extends the lease every renewInterval until ctx is cancelled. When
+// another instance has taken the lock, or the lease has expired without a
+// successful renewal, it cancels the run with ErrLockLost and stops.
+func (l *DynamoLock) renew(ctx context.Context, cancelRun context.CancelCauseFunc, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(renewInterval)
+	defer ticker.Stop()
+	expires := time.Now().Add(leaseDuration)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := l.put(ctx, false)
+			if err == nil {
+				expires = time.Now().Add(leaseDuration)
+				continue
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			var conflict *types.ConditionalCheckFailedException
+			if errors.As(err, &conflict) || !time.Now().Before(expires) {
+				log.Printf("Lost lock %s, stopping the run: %v", l.key, err)
+				cancelRun(fmt.Errorf("%w: %s", ErrLockLost, l.key))
+				return
+			}
+			log.Printf("Failed to renew lock %s: %v", l.key, err)
+		}
+	}
+}
+
+// put writes the lock item with a fresh lease. When acquiring, it only
+// succeeds if the lock is free or its lease has expired; when renewing, only
+// if we still own it.
+func (l *DynamoLock) put(ctx context.Context, acquire bool) error {
+	now := time.Now()
+	condition := "#owner = :owner"
+	values := map[string]types.AttributeValue{
+		":owner": &types.AttributeValueMemberS{Value: l.owner},
+	}
+	if acquire {
+		condition = "attribute_not_exists(lock_key) OR expires_at < :now OR #owner = :owner"
+		values[":now"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)}
+	}
+
+	_, err := l.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(l.table),
+		Item: map[string]types.AttributeValue{
+			"lock_key":   &types.AttributeValueMemberS{Value: l.key},
+			"owner":      &types.AttributeValueMemberS{Value: l.owner},
+			"hostname":   &types.AttributeValueMemberS{Value: l.hostname},
+			"pid":        &types.AttributeValueMemberN{Value: strconv.Itoa(os.Getpid())},
+			"updated_at": &types.AttributeValueMemberS{Value: now.UTC().Format(time.RFC3339)},
+			"expires_at": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(leaseDuration).Unix(), 10)},
+		},
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeNames:  map[string]string{"#owner": "owner"},
+		ExpressionAttributeValues: values,
+	})
+	return err
+}
@@ -0,0 +1,104 @@
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// errLocked is returned by tryLock when another process holds the lock
+var errLocked = errors.New("file is locked")
+
+// PIDLock is an exclusive lock on a lock file holding the PID of the
+// process that owns it. It keeps two instances on the same host from
+// writing one database at once; DynamoLock covers instances on different
+// hosts. The operating system drops the lock when its process exits, so a
+// lock file left by a crashed process is simply locked again.
+type PIDLock struct {
+	path string
+	file *os.File
+}
+
+// NewPIDLock creates the lock for the lock file at path
+func NewPIDLock(path string) *PIDLock {
+	return &PIDLock{path: path}
+}
+
+// Acquire locks the lock file, creating it if needed, and writes our PID to
+// it. It fails with ErrLockHeld while another process holds the lock.
+func (l *PIDLock) Acquire() error {
+	for {
+		f, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open lock file %s: %w", l.path, err)
+		}
+		if err := tryLock(f); err != nil {
+			f.Close()
+			if !errors.Is(err, errLocked) {
+				return fmt.Errorf("failed to lock %s: %w", l.path, err)
+			}
+			if owner, err := readPID(l.path); err == nil {
+				return fmt.Errorf("%w: %s is owned by process %d", ErrLockHeld, l.path, owner)
+			}
+			return fmt.Errorf("%w: %s", ErrLockHeld, l.path)
+		}
+
+		// The owner may have removed the file on release after we opened
+		// it, leaving us a lock on a file no one else will open
+		current, err := os.Stat(l.path)
+		opened, ferr := f.Stat()
+		if err != nil || ferr != nil || !os.SameFile(current, opened) {
+			f.Close()
+			continue
+		}
+
+		if err := writePID(f); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write lock file %s: %w", l.path, err)
+		}
+		l.file = f
+		log.Printf("Acquired lock file %s", l.path)
+		return nil
+	}
+}
+
+// Release removes the lock file and drops the lock
+func (l *PIDLock) Release() error {
+	if l.file == nil {
+		return nil
+	}
+	f := l.file
+	l.file = nil
+	if err := removeLocked(f, l.path); err != nil {
+		return fmt.Errorf("failed to remove lock file %s: %w", l.path, err)
+	}
+	log.Printf("Released lock file %s", l.path)
+	return nil
+}
+
+// writePID replaces the contents of f with our PID
+func writePID(f *os.File) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// readPID reads the PID stored in the lock file at path
+func readPID(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("lock file %s does not hold a PID", path)
+	}
+	return pid, nil
+}
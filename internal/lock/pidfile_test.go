@@ -0,0 +1,71 @@
+package lock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestPIDLockExclusive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.parquet.lock")
+	// Left behind by a process that has exited
+	if err := os.WriteFile(path, []byte("999999\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	const contenders = 20
+	locks := make([]*PIDLock, contenders)
+	errs := make([]error, contenders)
+	var wg sync.WaitGroup
+	for i := range locks {
+		locks[i] = NewPIDLock(path)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = locks[i].Acquire()
+		}()
+	}
+	wg.Wait()
+
+	var holder *PIDLock
+	for i, err := range errs {
+		switch {
+		case err == nil && holder != nil:
+			t.Fatalf("two locks on %s acquired at once", path)
+		case err == nil:
+			holder = locks[i]
+		case !errors.Is(err, ErrLockHeld):
+			t.Errorf("Acquire: %v, want ErrLockHeld", err)
+		}
+	}
+	if holder == nil {
+		t.Fatalf("no lock on %s acquired, want the stale lock file taken over", path)
+	}
+	if pid, err := readPID(path); err != nil || pid != os.Getpid() {
+		t.Errorf("lock file holds %d (%v), want our PID %d", pid, err, os.Getpid())
+	}
+
+	if err := holder.Release(); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("lock file still exists after Release: %v", err)
+	}
+	next := NewPIDLock(path)
+	if err := next.Acquire(); err != nil {
+		t.Fatalf("Acquire after Release: %v", err)
+	}
+	defer next.Release()
+
+	err := NewPIDLock(path).Acquire()
+	if !errors.Is(err, ErrLockHeld) {
+		t.Fatalf("Acquire of a held lock: %v, want ErrLockHeld", err)
+	}
+	if want := "owned by process " + strconv.Itoa(os.Getpid()); !strings.Contains(err.Error(), want) {
+		t.Errorf("error %q does not name the owner: want %q", err, want)
+	}
+}
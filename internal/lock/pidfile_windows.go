@@ -0,0 +1,36 @@
+//go:build windows
+
+package lock
+
+import (
+	"errors"
+	"math"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// tryLock locks a byte of f far past its end without waiting, failing with
+// errLocked while another process holds it. Windows locks keep others from
+// reading the locked range, so the PID itself is left readable.
+func tryLock(f *os.File) error {
+	ol := &windows.Overlapped{Offset: math.MaxUint32, OffsetHigh: math.MaxInt32}
+	err := windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, ol)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return errLocked
+	}
+	return err
+}
+
+// removeLocked closes f, which drops the lock, and then removes the lock
+// file at path. Windows cannot remove a file another process has open, so
+// one that opened it meanwhile keeps it.
+func removeLocked(f *os.File, path string) error {
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) && !errors.Is(err, windows.ERROR_SHARING_VIOLATION) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package logging
+
+import (
+	"io"
+	"os"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	"sava-s3-export/internal/config"
+)
+
+// NewWriter returns the destination of the application log: stderr, or
+// LOG_OUTPUT_FILE rotated once it reaches LOG_MAX_SIZE_MB. Rotated files are
+// kept until there are more than LOG_MAX_BACKUPS of them or they are older
+// than LOG_MAX_AGE_DAYS; 0 disables either limit.
+//
+// The rotating writer serialises writes and rotations with its own mutex, so
+// a line is never split across two files.
+func NewWriter(cfg *config.Config) io.Writer {
+	if cfg.LOG_OUTPUT_FILE == "" {
+		return os.Stderr
+	}
+	return &lumberjack.Logger{
+		Filename:   cfg.LOG_OUTPUT_FILE,
+		MaxSize:    cfg.LOG_MAX_SIZE_MB,
+		MaxBackups: cfg.LOG_MAX_BACKUPS,
+		MaxAge:     cfg.LOG_MAX_AGE_DAYS,
+	}
+}
@@ -0,0 +1,135 @@
+package manifest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MANIFEST_FORMAT values
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+// Entry is a file downloaded during a run
+type Entry struct {
+	S3Key        string    `json:"s3_key"`
+	LocalPath    string    `json:"local_path"`
+	ETag         string    `json:"etag"`
+	SizeBytes    int64     `json:"size_bytes"`
+	LastModified time.Time `json:"last_modified"`
+	DownloadedAt time.Time `json:"downloaded_at"`
+}
+
+// Summary totals the outcome of a run
+type Summary struct {
+	FilesDownloaded int   `json:"files_downloaded"`
+	FilesFailed     int   `json:"files_failed"`
+	BytesDownloaded int64 `json:"bytes_downloaded"`
+}
+
+// Manifest lists the files downloaded by one sync run. As JSON it is
+//
+//	{
+//	  "run_id": "4b1f...",
+//	  "start_time": "2026-01-02T15:04:05Z",
+//	  "end_time": "2026-01-02T15:09:30Z",
+//	  "summary": {"files_downloaded": 2, "files_failed": 0, "bytes_downloaded": 2048},
+//	  "files": [
+//	    {"s3_key": "...", "local_path": "...", "etag": "...", "size_bytes": 1024,
+//	     "last_modified": "...", "downloaded_at": "..."}
+//	  ]
+//	}
+//
+// As CSV only the files are written, one row each, with the run ID in the first column.
+type Manifest struct {
+	RunID     string    `json:"run_id"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	Summary   Summary   `json:"summary"`
+	Files     []Entry   `json:"files"`
+}
+
+// Recorder collects the entries of the current run; it is safe for concurrent use
+type Recorder struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// Add records a downloaded file
+func (r *Recorder) Add(entry Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, entry)
+}
+
+// Take returns the recorded entries and starts over for the next run
+func (r *Recorder) Take() []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entries := r.entries
+	r.entries = nil
+	return entries
+}
+
+// Write writes m to path in format, replacing any previous manifest. It is
+// written to a temporary file first, so readers never see a partial manifest.
+func Write(path, format string, m Manifest) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".manifest-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary manifest for %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if format == FormatCSV {
+		err = writeCSV(tmp, m)
+	} else {
+		err = writeJSON(tmp, m)
+	}
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write manifest %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write manifest %s: %w", path, err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to move manifest to %s: %w", path, err)
+	}
+	return nil
+}
+
+func writeJSON(w io.Writer, m Manifest) error {
+	if m.Files == nil {
+		m.Files = []Entry{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+func writeCSV(w io.Writer, m Manifest) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"run_id", "s3_key", "local_path", "etag", "size_bytes", "last_modified", "downloaded_at"})
+	for _, e := range m.Files {
+		cw.Write([]string{
+			m.RunID,
+			e.S3Key,
+			e.LocalPath,
+			e.ETag,
+			strconv.FormatInt(e.SizeBytes, 10),
+			e.LastModified.UTC().Format(time.RFC3339),
+			e.DownloadedAt.UTC().Format(time.RFC3339),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,183 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+const (
+	// maxDatumsPerCall is the number of metric data points CloudWatch
+	// accepts in one PutMetricData call
+	maxDatumsPerCall = 20
+	// maxValuesPerDatum is the number of distinct values CloudWatch accepts
+	// in the Values of one data point
+	maxValuesPerDatum = 150
+	// emitTimeout bounds an emission started in the background
+	emitTimeout = 10 * time.Second
+)
+
+// CloudWatchEmitter sends download statistics to CloudWatch as the custom
+// metrics FilesDownloaded, FilesFailed, BytesDownloaded and
+// DownloadDurationMs. Downloads are counted as they happen and sent, then
+// cleared, by Emit. A nil emitter records and sends nothing.
+type CloudWatchEmitter struct {
+	client     *cloudwatch.Client
+	namespace  string
+	dimensions []types.Dimension
+
+	mu         sync.Mutex
+	downloaded int
+	failed     int
+	bytes      int64
+	// durations counts downloads by their duration in whole milliseconds
+	durations map[int64]int
+
+	// pending tracks emissions started by EmitInBackground
+	pending sync.WaitGroup
+}
+
+// NewCloudWatchEmitter creates an emitter publishing under namespace. When
+// dimensionName is set, every metric carries it with dimensionValue, e.g.
+// Environment=production.
+func NewCloudWatchEmitter(awsCfg aws.Config, namespace, dimensionName, dimensionValue string) *CloudWatchEmitter {
+	var dimensions []types.Dimension
+	if dimensionName != "" {
+		dimensions = []types.Dimension{{Name: aws.String(dimensionName), Value: aws.String(dimensionValue)}}
+	}
+	return &CloudWatchEmitter{
+		client:     cloudwatch.NewFromConfig(awsCfg),
+		namespace:  namespace,
+		dimensions: dimensions,
+		durations:  make(map[int64]int),
+	}
+}
+
+// RecordDownload counts a successful download of size bytes that took d
+func (e *CloudWatchEmitter) RecordDownload(size int64, d time.Duration) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.downloaded++
+	e.bytes += size
+	e.durations[d.Milliseconds()]++
+}
+
+// RecordFailure counts a failed download
+func (e *CloudWatchEmitter) RecordFailure() {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.failed++
+}
+
+// Emit sends the statistics recorded since the last emission, in batches of
+// at most 20 data points. Nothing is sent when nothing was recorded. The
+// statistics are cleared even if sending fails, so a failure is not counted
+// twice by the next emission.
+func (e *CloudWatchEmitter) Emit(ctx context.Context) error {
+	if e == nil {
+		return nil
+	}
+	datums := e.take()
+	for start := 0; start < len(datums); start += maxDatumsPerCall {
+		end := min(start+maxDatumsPerCall, len(datums))
+		_, err := e.client.PutMetricData(ctx, &cloudwatch.PutMetricDataInput{
+			Namespace:  aws.String(e.namespace),
+			MetricData: datums[start:end],
+		})
+		if err != nil {
+			return fmt.Errorf("failed to put metric data to CloudWatch namespace %s: %w", e.namespace, err)
+		}
+	}
+	return nil
+}
+
+// EmitInBackground starts an Emit without waiting for it, logging a
+// failure. Wait waits for it to finish.
+func (e *CloudWatchEmitter) EmitInBackground() {
+	if e == nil {
+		return
+	}
+	e.pending.Add(1)
+	go func() {
+		defer e.pending.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), emitTimeout)
+		defer cancel()
+		if err := e.Emit(ctx); err != nil {
+			log.Printf("Failed to emit CloudWatch metrics: %v", err)
+		}
+	}()
+}
+
+// Wait waits for the emissions started by EmitInBackground
+func (e *CloudWatchEmitter) Wait() {
+	if e == nil {
+		return
+	}
+	e.pending.Wait()
+}
+
+// take returns the recorded statistics as metric data points and clears them
+func (e *CloudWatchEmitter) take() []types.MetricDatum {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.downloaded == 0 && e.failed == 0 {
+		return nil
+	}
+	now := aws.Time(time.Now())
+	datum := func(name string, unit types.StandardUnit, value float64) types.MetricDatum {
+		return types.MetricDatum{
+			MetricName: aws.String(name),
+			Dimensions: e.dimensions,
+			Timestamp:  now,
+			Unit:       unit,
+			Value:      aws.Float64(value),
+		}
+	}
+	datums := []types.MetricDatum{
+		datum("FilesDownloaded", types.StandardUnitCount, float64(e.downloaded)),
+		datum("FilesFailed", types.StandardUnitCount, float64(e.failed)),
+		datum("BytesDownloaded", types.StandardUnitBytes, float64(e.bytes)),
+	}
+
+	// Each duration is sent as a value with the number of downloads that
+	// took it, so CloudWatch can compute percentiles
+	var values, counts []float64
+	flush := func() {
+		datums = append(datums, types.MetricDatum{
+			MetricName: aws.String("DownloadDurationMs"),
+			Dimensions: e.dimensions,
+			Timestamp:  now,
+			Unit:       types.StandardUnitMilliseconds,
+			Values:     values,
+			Counts:     counts,
+		})
+		values, counts = nil, nil
+	}
+	for ms, n := range e.durations {
+		values = append(values, float64(ms))
+		counts = append(counts, float64(n))
+		if len(values) == maxValuesPerDatum {
+			flush()
+		}
+	}
+	if len(values) > 0 {
+		flush()
+	}
+
+	e.downloaded, e.failed, e.bytes = 0, 0, 0
+	e.durations = make(map[int64]int)
+	return datums
+}
@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every metric exported by the application
+var Registry = prometheus.NewRegistry()
+
+var (
+	// FilesDownloaded counts files successfully downloaded from S3
+	FilesDownloaded = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "s3exporter",
+		Name:      "files_downloaded_total",
+		Help:      "Number of files successfully downloaded from S3.",
+	})
+
+	// FilesFailed counts files whose download failed, labelled by how many
+	// times in a row the file has now failed (see ErrorCountLabel)
+	FilesFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "s3exporter",
+		Name:      "files_failed_total",
+		Help:      "Number of files that failed to download from S3, by consecutive failure count.",
+	}, []string{"error_count"})
+
+	// QueueDepth is the number of files waiting in the download queue
+	QueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "s3exporter",
+		Name:      "download_queue_depth",
+		Help:      "Number of files waiting in the download queue.",
+	})
+
+	// BufferPoolHits counts download buffers reused from the pool
+	BufferPoolHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "s3exporter",
+		Name:      "buffer_pool_hits_total",
+		Help:      "Number of download buffers reused from the pool.",
+	})
+
+	// BufferPoolMisses counts download buffers allocated because the pool was empty
+	BufferPoolMisses = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "s3exporter",
+		Name:      "buffer_pool_misses_total",
+		Help:      "Number of download buffers allocated because the pool was empty.",
+	})
+
+	// RecordsByStatus is the number of database records in each sync status
+	RecordsByStatus = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "s3exporter",
+		Name:      "database_records",
+		Help:      "Number of records in the sync database, by sync status.",
+	}, []string{"status"})
+
+	// CircuitBreakerState is the state of the S3 circuit breaker: 0 closed, 1 open, 2 half-open
+	CircuitBreakerState = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "s3exporter",
+		Name:      "circuit_breaker_state",
+		Help:      "State of the S3 circuit breaker: 0 closed, 1 open, 2 half-open.",
+	})
+
+	// ThrottleActivations counts how often the workers were paused because S3 kept answering 503 Slow Down
+	ThrottleActivations = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "s3exporter",
+		Name:      "throttle_activations_total",
+		Help:      "Number of times all downloads were paused after repeated 503 Slow Down responses from S3.",
+	})
+
+	// SyncerPaused is 1 while new downloads are paused with SIGUSR1, 0 otherwise
+	SyncerPaused = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "s3exporter",
+		Name:      "syncer_paused",
+		Help:      "Whether new downloads are paused: 1 paused, 0 running.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		FilesDownloaded,
+		FilesFailed,
+		QueueDepth,
+		BufferPoolHits,
+		BufferPoolMisses,
+		RecordsByStatus,
+		CircuitBreakerState,
+		ThrottleActivations,
+		SyncerPaused,
+	)
+}
+
+// SetRecordsByStatus replaces the RecordsByStatus gauges with counts, so
+// statuses no longer present drop to nothing
+func SetRecordsByStatus(counts map[string]int64) {
+	RecordsByStatus.Reset()
+	for status, n := range counts {
+		RecordsByStatus.WithLabelValues(status).Set(float64(n))
+	}
+}
+
+// maxErrorCountLabel bounds the cardinality of the error_count label
+const maxErrorCountLabel = 5
+
+// ErrorCountLabel returns the error_count label value for a file that has
+// failed count times, folding everything from maxErrorCountLabel up into "5+"
+func ErrorCountLabel(count int32) string {
+	if count >= maxErrorCountLabel {
+		return strconv.Itoa(maxErrorCountLabel) + "+"
+	}
+	return strconv.Itoa(int(count))
+}
+
+// Handler serves the metrics in Registry in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,137 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"sava-s3-export/internal/config"
+	"sava-s3-export/internal/database"
+)
+
+// errKafkaBufferFull is returned by an async KafkaPublisher whose buffer has no room
+var errKafkaBufferFull = errors.New("kafka publish buffer is full")
+
+// Messages are sent in batches of up to kafkaBatchSize, waiting at most
+// kafkaBatchTimeout for a batch to fill
+const (
+	kafkaBatchSize    = 100
+	kafkaBatchTimeout = 5 * time.Millisecond
+)
+
+// KafkaPublisher publishes a message to KAFKA_TOPIC for every downloaded
+// file, keyed by S3 key with the JSON-encoded FileRecord as the value.
+// With KAFKA_ASYNC, Publish only queues the message in a buffer of
+// KAFKA_BUFFER_SIZE messages drained in the background; otherwise it waits
+// for the brokers to acknowledge it.
+type KafkaPublisher struct {
+	writer *kafka.Writer
+	buffer chan kafka.Message
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewKafkaPublisher creates a publisher for KAFKA_TOPIC on the comma-separated KAFKA_BROKERS
+func NewKafkaPublisher(cfg *config.Config) (*KafkaPublisher, error) {
+	var brokers []string
+	for _, broker := range strings.Split(cfg.KAFKA_BROKERS, ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			brokers = append(brokers, broker)
+		}
+	}
+	if len(brokers) == 0 || cfg.KAFKA_TOPIC == "" {
+		return nil, fmt.Errorf("KAFKA_BROKERS and KAFKA_TOPIC must both be set")
+	}
+
+	p := &KafkaPublisher{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        cfg.KAFKA_TOPIC,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			// A partial batch is otherwise held for a second, which every
+			// synchronous Publish would wait out
+			BatchTimeout: kafkaBatchTimeout,
+			BatchSize:    kafkaBatchSize,
+		},
+	}
+	if cfg.KAFKA_ASYNC {
+		size := cfg.KAFKA_BUFFER_SIZE
+		if size <= 0 {
+			size = 1
+		}
+		p.buffer = make(chan kafka.Message, size)
+		p.done = make(chan struct{})
+		go p.drain()
+	}
+	return p, nil
+}
+
+// Publish sends record to Kafka. In async mode a full buffer drops the
+// message with an error rather than stalling the download.
+func (p *KafkaPublisher) Publish(ctx context.Context, record database.FileRecord) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode record for %s: %w", record.S3Key, err)
+	}
+	msg := kafka.Message{Key: []byte(record.S3Key), Value: value}
+
+	if p.buffer == nil {
+		if err := p.writer.WriteMessages(ctx, msg); err != nil {
+			return fmt.Errorf("failed to publish %s to Kafka: %w", record.S3Key, err)
+		}
+		return nil
+	}
+
+	select {
+	case p.buffer <- msg:
+		return nil
+	default:
+		return fmt.Errorf("failed to publish %s to Kafka: %w", record.S3Key, errKafkaBufferFull)
+	}
+}
+
+// drain writes buffered messages until the buffer is closed, together with
+// whatever else is buffered by then, up to kafkaBatchSize per write
+func (p *KafkaPublisher) drain() {
+	defer close(p.done)
+	batch := make([]kafka.Message, 0, kafkaBatchSize)
+	for msg := range p.buffer {
+		batch = append(batch[:0], msg)
+	fill:
+		for len(batch) < kafkaBatchSize {
+			select {
+			case msg, ok := <-p.buffer:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, msg)
+			default:
+				break fill
+			}
+		}
+		if err := p.writer.WriteMessages(context.Background(), batch...); err != nil {
+			log.Printf("Failed to publish %d messages to Kafka: %v", len(batch), err)
+		}
+	}
+}
+
+// Close flushes any buffered messages and closes the connection to the brokers
+func (p *KafkaPublisher) Close() error {
+	var err error
+	p.once.Do(func() {
+		if p.buffer != nil {
+			close(p.buffer)
+			<-p.done
+		}
+		err = p.writer.Close()
+	})
+	return err
+}
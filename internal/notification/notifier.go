@@ -0,0 +1,57 @@
+package notification
+
+import (
+	"context"
+	"time"
+)
+
+// Values of the *_NOTIFY_ON settings
+const (
+	NotifyAlways  = "always"
+	NotifyFailure = "failure"
+	NotifySuccess = "success"
+	NotifyNever   = "never"
+)
+
+// SyncResult is the outcome of one sync run. Errors holds the error that
+// ended the run, if any, followed by the errors of failed files, up to
+// MaxResultErrors in all.
+type SyncResult struct {
+	RunID           string        `json:"run_id"`
+	StartTime       time.Time     `json:"start_time"`
+	Duration        time.Duration `json:"duration_ns"`
+	FilesDownloaded int           `json:"files_downloaded"`
+	FilesFailed     int           `json:"files_failed"`
+	FilesSkipped    int           `json:"files_skipped"`
+	BytesDownloaded int64         `json:"bytes_downloaded"`
+	Errors          []string      `json:"errors"`
+	ErrorReport     string        `json:"error_report,omitempty"`
+	// APICalls is the number of S3 requests made by operation, e.g. ListObjectsV2
+	APICalls map[string]int64 `json:"api_calls,omitempty"`
+}
+
+// MaxResultErrors caps SyncResult.Errors so a run failing many files stays small
+const MaxResultErrors = 100
+
+// Failed reports whether the run ended with an error or failed downloads
+func (r SyncResult) Failed() bool {
+	return len(r.Errors) > 0 || r.FilesFailed > 0
+}
+
+// Notifier is told about every completed sync run
+type Notifier interface {
+	Notify(ctx context.Context, result SyncResult) error
+}
+
+// shouldNotify reports whether a result passes the notifyOn policy
+func shouldNotify(notifyOn string, result SyncResult) bool {
+	switch notifyOn {
+	case NotifyAlways:
+		return true
+	case NotifyFailure:
+		return result.Failed()
+	case NotifySuccess:
+		return !result.Failed()
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// slackMaxAttempts bounds how often a rate-limited message is retried
+	slackMaxAttempts = 5
+	// slackRetryBaseDelay is the first backoff after a 429 without Retry-After; it doubles on each retry
+	slackRetryBaseDelay = time.Second
+	// slackMaxErrors is how many of a result's errors are shown in the message
+	slackMaxErrors = 5
+)
+
+var _ Notifier = (*SlackNotifier)(nil)
+
+// SlackNotifier posts a summary of each SyncResult to a Slack incoming webhook
+type SlackNotifier struct {
+	webhookURL string
+	notifyOn   string
+	client     *http.Client
+}
+
+// NewSlackNotifier creates a notifier for webhookURL honouring notifyOn
+func NewSlackNotifier(webhookURL, notifyOn string) *SlackNotifier {
+	return &SlackNotifier{
+		webhookURL: webhookURL,
+		notifyOn:   notifyOn,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// slackMessage is the webhook payload: one colour-coded attachment
+type slackMessage struct {
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+type slackAttachment struct {
+	Color  string       `json:"color"`
+	Fields []slackField `json:"fields"`
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+// Notify posts result unless SLACK_NOTIFY_ON filters it out, backing off and
+// retrying while Slack answers 429 Too Many Requests
+func (n *SlackNotifier) Notify(ctx context.Context, result SyncResult) error {
+	if !shouldNotify(n.notifyOn, result) {
+		return nil
+	}
+
+	body, err := json.Marshal(slackPayload(result))
+	if err != nil {
+		return fmt.Errorf("failed to encode Slack message: %w", err)
+	}
+
+	delay := slackRetryBaseDelay
+	for attempt := 1; ; attempt++ {
+		retryAfter, err := n.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if retryAfter < 0 || attempt == slackMaxAttempts {
+			return err
+		}
+
+		wait := delay
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		delay *= 2
+	}
+}
+
+// post sends body to the webhook once. When Slack rate-limits the request it
+// returns the Retry-After delay (0 if absent) with the error; any other
+// failure returns -1.
+func (n *SlackNotifier) post(ctx context.Context, body []byte) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return -1, fmt.Errorf("failed to create Slack request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return -1, fmt.Errorf("failed to post to Slack: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		retryAfter := time.Duration(0)
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			retryAfter = time.Duration(secs) * time.Second
+		}
+		return retryAfter, fmt.Errorf("slack webhook rate limited")
+	case resp.StatusCode >= 300:
+		return -1, fmt.Errorf("slack webhook returned %s", resp.Status)
+	}
+	return 0, nil
+}
+
+// slackPayload renders result as a Slack message, green on success and red on failure
+func slackPayload(result SyncResult) slackMessage {
+	text, color := "S3 sync completed", "good"
+	if result.Failed() {
+		text, color = "S3 sync failed", "danger"
+	}
+
+	fields := []slackField{
+		{Title: "Downloaded", Value: strconv.Itoa(result.FilesDownloaded), Short: true},
+		{Title: "Failed", Value: strconv.Itoa(result.FilesFailed), Short: true},
+		{Title: "Skipped", Value: strconv.Itoa(result.FilesSkipped), Short: true},
+		{Title: "Duration", Value: result.Duration.Round(time.Second).String(), Short: true},
+		{Title: "Run ID", Value: result.RunID, Short: true},
+	}
+	if len(result.Errors) > 0 {
+		shown := result.Errors
+		if len(shown) > slackMaxErrors {
+			shown = shown[:slackMaxErrors]
+		}
+		value := strings.Join(shown, "\n")
+		if more := len(result.Errors) - len(shown); more > 0 {
+			value += fmt.Sprintf("\n... and %d more", more)
+		}
+		fields = append(fields, slackField{Title: "Errors", Value: value})
+	}
+	if result.ErrorReport != "" {
+		fields = append(fields, slackField{Title: "Error report", Value: result.ErrorReport})
+	}
+
+	return slackMessage{
+		Text:        text,
+		Attachments: []slackAttachment{{Color: color, Fields: fields}},
+	}
+}
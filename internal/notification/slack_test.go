@@ -0,0 +1,155 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slackServer records the messages posted to it, answering each request
+// with the next of statuses and then 200 OK
+func slackServer(t *testing.T, statuses ...int) (*httptest.Server, *[]slackMessage) {
+	t.Helper()
+	var (
+		messages []slackMessage
+		requests atomic.Int32
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Content-Type"); got != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", got)
+		}
+		var msg slackMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Errorf("failed to decode Slack message: %v", err)
+		}
+		messages = append(messages, msg)
+
+		if i := int(requests.Add(1)) - 1; i < len(statuses) {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(statuses[i])
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &messages
+}
+
+func TestSlackNotifierPayload(t *testing.T) {
+	tests := []struct {
+		name   string
+		result SyncResult
+		want   slackMessage
+	}{
+		{
+			name: "success",
+			result: SyncResult{
+				RunID:           "run-1",
+				Duration:        90 * time.Second,
+				FilesDownloaded: 12,
+				FilesSkipped:    3,
+			},
+			want: slackMessage{
+				Text: "S3 sync completed",
+				Attachments: []slackAttachment{{Color: "good", Fields: []slackField{
+					{Title: "Downloaded", Value: "12", Short: true},
+					{Title: "Failed", Value: "0", Short: true},
+					{Title: "Skipped", Value: "3", Short: true},
+					{Title: "Duration", Value: "1m30s", Short: true},
+					{Title: "Run ID", Value: "run-1", Short: true},
+				}}},
+			},
+		},
+		{
+			name: "failure",
+			result: SyncResult{
+				RunID:           "run-2",
+				Duration:        2 * time.Second,
+				FilesDownloaded: 1,
+				FilesFailed:     7,
+				Errors:          []string{"e1", "e2", "e3", "e4", "e5", "e6", "e7"},
+				ErrorReport:     "/var/log/sync/errors-run-2.json",
+			},
+			want: slackMessage{
+				Text: "S3 sync failed",
+				Attachments: []slackAttachment{{Color: "danger", Fields: []slackField{
+					{Title: "Downloaded", Value: "1", Short: true},
+					{Title: "Failed", Value: "7", Short: true},
+					{Title: "Skipped", Value: "0", Short: true},
+					{Title: "Duration", Value: "2s", Short: true},
+					{Title: "Run ID", Value: "run-2", Short: true},
+					{Title: "Errors", Value: "e1\ne2\ne3\ne4\ne5\n... and 2 more"},
+					{Title: "Error report", Value: "/var/log/sync/errors-run-2.json"},
+				}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, messages := slackServer(t)
+			n := NewSlackNotifier(server.URL, NotifyAlways)
+			if err := n.Notify(context.Background(), tt.result); err != nil {
+				t.Fatalf("Notify: %v", err)
+			}
+			if len(*messages) != 1 {
+				t.Fatalf("posted %d messages, want 1", len(*messages))
+			}
+			if got := (*messages)[0]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("posted %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSlackNotifierNotifyOn(t *testing.T) {
+	success := SyncResult{FilesDownloaded: 1}
+	failure := SyncResult{FilesFailed: 1}
+
+	tests := []struct {
+		notifyOn string
+		result   SyncResult
+		want     int
+	}{
+		{NotifyAlways, success, 1},
+		{NotifyAlways, failure, 1},
+		{NotifyFailure, success, 0},
+		{NotifyFailure, failure, 1},
+		{NotifySuccess, success, 1},
+		{NotifySuccess, failure, 0},
+	}
+
+	for _, tt := range tests {
+		server, messages := slackServer(t)
+		n := NewSlackNotifier(server.URL, tt.notifyOn)
+		if err := n.Notify(context.Background(), tt.result); err != nil {
+			t.Fatalf("Notify: %v", err)
+		}
+		if len(*messages) != tt.want {
+			t.Errorf("SLACK_NOTIFY_ON=%s posted %d messages for failed=%v, want %d",
+				tt.notifyOn, len(*messages), tt.result.Failed(), tt.want)
+		}
+	}
+}
+
+func TestSlackNotifierRetriesRateLimit(t *testing.T) {
+	server, messages := slackServer(t, http.StatusTooManyRequests)
+	n := NewSlackNotifier(server.URL, NotifyAlways)
+	if err := n.Notify(context.Background(), SyncResult{}); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if len(*messages) != 2 {
+		t.Errorf("posted %d messages, want the rate-limited one and its retry", len(*messages))
+	}
+}
+
+func TestSlackNotifierError(t *testing.T) {
+	server, _ := slackServer(t, http.StatusInternalServerError)
+	n := NewSlackNotifier(server.URL, NotifyAlways)
+	if err := n.Notify(context.Background(), SyncResult{}); err == nil {
+		t.Error("Notify succeeded on 500 Internal Server Error")
+	}
+}
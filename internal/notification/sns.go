@@ -0,0 +1,62 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+
+	appAws "sava-s3-export/internal/aws"
+	"sava-s3-export/internal/config"
+)
+
+var _ Notifier = (*SNSNotifier)(nil)
+
+// SNSNotifier publishes each SyncResult as a JSON message to an SNS topic
+type SNSNotifier struct {
+	client   *sns.Client
+	topicARN string
+	notifyOn string
+}
+
+// NewSNSNotifier creates a notifier for SNS_TOPIC_ARN honouring SNS_NOTIFY_ON
+func NewSNSNotifier(ctx context.Context, cfg *config.Config) (*SNSNotifier, error) {
+	awsCfg, err := appAws.LoadAWSConfig(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SNSNotifier{
+		client:   sns.NewFromConfig(awsCfg),
+		topicARN: cfg.SNS_TOPIC_ARN,
+		notifyOn: cfg.SNS_NOTIFY_ON,
+	}, nil
+}
+
+// Notify publishes result unless SNS_NOTIFY_ON filters it out
+func (n *SNSNotifier) Notify(ctx context.Context, result SyncResult) error {
+	if !shouldNotify(n.notifyOn, result) {
+		return nil
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to encode sync result: %w", err)
+	}
+
+	subject := "S3 sync completed"
+	if result.Failed() {
+		subject = "S3 sync failed"
+	}
+	_, err = n.client.Publish(ctx, &sns.PublishInput{
+		TopicArn: aws.String(n.topicARN),
+		Subject:  aws.String(subject),
+		Message:  aws.String(string(body)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", n.topicARN, err)
+	}
+	return nil
+}
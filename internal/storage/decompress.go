@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compression formats recognised by Decompress
+const (
+	formatGzip  = "gzip"
+	formatZstd  = "zstd"
+	formatBzip2 = "bzip2"
+)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	bzip2Magic = []byte("BZh")
+)
+
+// compressionExtensions maps file suffixes to the format they imply
+var compressionExtensions = map[string]string{
+	".gz":  formatGzip,
+	".zst": formatZstd,
+	".bz2": formatBzip2,
+}
+
+// Decompress detects a gzip, zstd or bzip2 file by its magic bytes or its
+// extension and decompresses it next to the original without the compression
+// extension, then removes the compressed file. It returns the path of the
+// decompressed file, or path unchanged if the file is not compressed. On
+// error the compressed file is left in place.
+func Decompress(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return path, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	header, _ := br.Peek(4)
+	ext := strings.ToLower(filepath.Ext(path))
+
+	format := compressionExtensions[ext]
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		format = formatGzip
+	case bytes.HasPrefix(header, zstdMagic):
+		format = formatZstd
+	case bytes.HasPrefix(header, bzip2Magic) && ext == ".bz2":
+		// "BZh" alone is too weak a signature to trust without the extension
+		format = formatBzip2
+	}
+	if format == "" {
+		return path, nil
+	}
+
+	var r io.Reader
+	switch format {
+	case formatGzip:
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return path, fmt.Errorf("failed to read gzip header of %s: %w", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	case formatZstd:
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return path, fmt.Errorf("failed to create zstd reader for %s: %w", path, err)
+		}
+		defer zr.Close()
+		r = zr
+	case formatBzip2:
+		r = bzip2.NewReader(br)
+	}
+
+	target := path
+	if compressionExtensions[ext] != "" {
+		target = strings.TrimSuffix(path, filepath.Ext(path))
+	}
+
+	// Write to a temporary file first so a failure never leaves a truncated target
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".decompress-*")
+	if err != nil {
+		return path, fmt.Errorf("failed to create temporary file for %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return path, fmt.Errorf("failed to decompress %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return path, fmt.Errorf("failed to write decompressed %s: %w", path, err)
+	}
+	f.Close()
+
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return path, fmt.Errorf("failed to move decompressed file to %s: %w", target, err)
+	}
+	if target != path {
+		if err := os.Remove(path); err != nil {
+			return target, fmt.Errorf("failed to remove compressed file %s: %w", path, err)
+		}
+	}
+	return target, nil
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ErrInsufficientSpace is returned by CheckDiskSpace when the filesystem is too full
+var ErrInsufficientSpace = errors.New("insufficient disk space")
+
+// CheckDiskSpace returns ErrInsufficientSpace if the filesystem holding dir
+// has fewer than requiredBytes available. dir does not need to exist yet; the
+// nearest existing ancestor is checked instead.
+func CheckDiskSpace(dir string, requiredBytes int64) error {
+	free, err := FreeBytes(dir)
+	if err != nil {
+		return err
+	}
+	if free < requiredBytes {
+		return fmt.Errorf("%w in %s: %d bytes required, %d bytes available", ErrInsufficientSpace, dir, requiredBytes, free)
+	}
+	return nil
+}
+
+// FreeBytes returns the number of bytes available to unprivileged users on
+// the filesystem holding dir, or its nearest existing ancestor
+func FreeBytes(dir string) (int64, error) {
+	existing, err := nearestExisting(dir)
+	if err != nil {
+		return 0, err
+	}
+	free, err := freeBytes(existing)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get free space for %s: %w", existing, err)
+	}
+	return free, nil
+}
+
+// nearestExisting walks up from dir until it finds a path that exists
+func nearestExisting(dir string) (string, error) {
+	path, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", dir, err)
+	}
+	for {
+		_, err := os.Stat(path)
+		if err == nil {
+			return path, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", fmt.Errorf("no existing ancestor for %s", dir)
+		}
+		path = parent
+	}
+}
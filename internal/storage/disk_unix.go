@@ -0,0 +1,14 @@
+//go:build unix
+
+package storage
+
+import "golang.org/x/sys/unix"
+
+// freeBytes returns the space available to unprivileged users on the filesystem holding path
+func freeBytes(path string) (int64, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package storage
+
+import "golang.org/x/sys/windows"
+
+// freeBytes returns the space available to the calling user on the volume holding path
+func freeBytes(path string) (int64, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var available uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &available, nil, nil); err != nil {
+		return 0, err
+	}
+	return int64(available), nil
+}
@@ -0,0 +1,151 @@
+package syncer
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+const (
+	// adaptiveWindowSize is the number of recent operations the error rate is computed over
+	adaptiveWindowSize = 100
+	// adaptiveRecoveryRate is the error rate below which concurrency may grow again
+	adaptiveRecoveryRate = 0.01
+	// adaptiveRecoveryOps is how many consecutive healthy operations trigger an increase
+	adaptiveRecoveryOps = 200
+)
+
+// AdaptiveConcurrencyController limits how many workers may download at once
+// and tunes that limit from the observed S3 error rate. When the error rate
+// over the last 100 operations exceeds the threshold the limit shrinks by 20%;
+// after 200 consecutive operations below 1% it grows by 10%, up to the maximum.
+// Workers are never restarted; the limit acts as a semaphore of variable width.
+//
+// A nil controller imposes no limit.
+type AdaptiveConcurrencyController struct {
+	mu        sync.Mutex
+	limit     int
+	max       int
+	active    int
+	threshold float64
+
+	// window is a ring buffer of recent outcomes, true meaning an error
+	window  [adaptiveWindowSize]bool
+	next    int
+	samples int
+	errors  int
+	healthy int
+
+	// changed is closed and replaced whenever a slot may have become available
+	changed chan struct{}
+}
+
+// NewAdaptiveConcurrencyController creates a controller that starts at
+// maxWorkers and reduces concurrency when the error rate exceeds threshold
+func NewAdaptiveConcurrencyController(maxWorkers int, threshold float64) *AdaptiveConcurrencyController {
+	return &AdaptiveConcurrencyController{
+		limit:     maxWorkers,
+		max:       maxWorkers,
+		threshold: threshold,
+		changed:   make(chan struct{}),
+	}
+}
+
+// Acquire blocks until the worker may start an operation or ctx is cancelled
+func (c *AdaptiveConcurrencyController) Acquire(ctx context.Context) error {
+	if c == nil {
+		return nil
+	}
+	for {
+		c.mu.Lock()
+		if c.active < c.limit {
+			c.active++
+			c.mu.Unlock()
+			return nil
+		}
+		changed := c.changed
+		c.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Release ends an operation started with Acquire and records whether it failed
+func (c *AdaptiveConcurrencyController) Release(failed bool) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.active--
+	c.record(failed)
+	c.adjust()
+
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// Limit returns the current number of operations allowed to run at once
+func (c *AdaptiveConcurrencyController) Limit() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.limit
+}
+
+// record adds an outcome to the rolling window; c.mu must be held
+func (c *AdaptiveConcurrencyController) record(failed bool) {
+	if c.samples == adaptiveWindowSize {
+		if c.window[c.next] {
+			c.errors--
+		}
+	} else {
+		c.samples++
+	}
+	c.window[c.next] = failed
+	if failed {
+		c.errors++
+	}
+	c.next = (c.next + 1) % adaptiveWindowSize
+}
+
+// adjust changes the limit based on the current error rate; c.mu must be held
+func (c *AdaptiveConcurrencyController) adjust() {
+	rate := float64(c.errors) / float64(c.samples)
+
+	if c.samples == adaptiveWindowSize && rate > c.threshold {
+		if newLimit := max(1, c.limit*8/10); newLimit != c.limit {
+			log.Printf("S3 error rate %.1f%% exceeds %.1f%%, reducing concurrency from %d to %d",
+				rate*100, c.threshold*100, c.limit, newLimit)
+			c.limit = newLimit
+		}
+		// Judge the new limit on fresh samples only
+		c.resetWindow()
+		return
+	}
+
+	if rate >= adaptiveRecoveryRate {
+		c.healthy = 0
+		return
+	}
+	c.healthy++
+	if c.healthy >= adaptiveRecoveryOps && c.limit < c.max {
+		newLimit := min(c.max, c.limit+max(1, c.limit/10))
+		log.Printf("S3 error rate recovered, increasing concurrency from %d to %d", c.limit, newLimit)
+		c.limit = newLimit
+		c.healthy = 0
+	}
+}
+
+// resetWindow discards all recorded outcomes; c.mu must be held
+func (c *AdaptiveConcurrencyController) resetWindow() {
+	c.window = [adaptiveWindowSize]bool{}
+	c.next, c.samples, c.errors, c.healthy = 0, 0, 0, 0
+}
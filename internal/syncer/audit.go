@@ -0,0 +1,30 @@
+package syncer
+
+import (
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"sava-s3-export/internal/audit"
+)
+
+// recordAudit writes the outcome of a download to AUDIT_LOG_PATH. Failing to
+// write is only logged, so the audit log never fails a sync.
+func (s *Syncer) recordAudit(file types.Object, localPath, status string, downloadErr error) {
+	if s.auditLog == nil {
+		return
+	}
+	entry := audit.Entry{
+		S3Key:     *file.Key,
+		ETag:      *file.ETag,
+		SizeBytes: objectSize(file),
+		LocalPath: localPath,
+		Status:    status,
+	}
+	if downloadErr != nil {
+		entry.Error = downloadErr.Error()
+	}
+	if err := s.auditLog.Record(entry); err != nil {
+		log.Printf("%v", err)
+	}
+}
@@ -0,0 +1,225 @@
+package syncer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ErrNoCheckpoint is returned by a --resume run when there is no checkpoint
+// at CHECKPOINT_PATH to resume from
+var ErrNoCheckpoint = errors.New("no checkpoint to resume from")
+
+// checkpointFile is the JSON layout of a checkpoint
+type checkpointFile struct {
+	Bucket    string            `json:"bucket"`
+	Prefix    string            `json:"prefix"`
+	CreatedAt time.Time         `json:"created_at"`
+	Files     []checkpointEntry `json:"files"`
+}
+
+// checkpointEntry is a file still to be downloaded, with what processing it
+// needs from its listing
+type checkpointEntry struct {
+	Key          string    `json:"key"`
+	ETag         string    `json:"etag"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+	StorageClass string    `json:"storage_class,omitempty"`
+}
+
+// Checkpoint keeps the files of a cycle not yet downloaded in a JSON file at
+// CHECKPOINT_PATH, so a sync interrupted after hours resumes without listing
+// the bucket again. A file leaves the checkpoint once its record has been
+// flushed to the database, and the file on disk is rewritten every
+// CHECKPOINT_INTERVAL such files. It is removed when a cycle completes.
+type Checkpoint struct {
+	path     string
+	interval int
+	bucket   string
+	prefix   string
+
+	mu      sync.Mutex
+	pending map[string]checkpointEntry
+	// done are the keys recorded in the database batch since the last
+	// flush, and removed the number dropped from pending since the last save
+	done    []string
+	removed int
+
+	// saveMu keeps saves in order
+	saveMu sync.Mutex
+}
+
+// newCheckpoint creates the checkpoint of bucket and prefix at path
+func newCheckpoint(path string, interval int, bucket, prefix string) *Checkpoint {
+	return &Checkpoint{path: path, interval: interval, bucket: bucket, prefix: prefix}
+}
+
+// load returns the files of the checkpoint left by an interrupted cycle, or
+// false when there is none. A checkpoint of another bucket or prefix is
+// ignored.
+func (c *Checkpoint) load() ([]types.Object, bool, error) {
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read checkpoint %s: %w", c.path, err)
+	}
+	var f checkpointFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, false, fmt.Errorf("failed to parse checkpoint %s: %w", c.path, err)
+	}
+	if f.Bucket != c.bucket || f.Prefix != c.prefix {
+		log.Printf("Ignoring checkpoint %s of s3://%s/%s", c.path, f.Bucket, f.Prefix)
+		return nil, false, nil
+	}
+
+	files := make([]types.Object, len(f.Files))
+	for i, e := range f.Files {
+		files[i] = types.Object{
+			Key:          &e.Key,
+			ETag:         &e.ETag,
+			Size:         &e.Size,
+			LastModified: &e.LastModified,
+			StorageClass: types.ObjectStorageClass(e.StorageClass),
+		}
+	}
+	log.Printf("Resuming from checkpoint %s of %s: %d files left", c.path, f.CreatedAt.Format(time.RFC3339), len(files))
+	return files, true, nil
+}
+
+// start makes files the pending files of the cycle and saves them
+func (c *Checkpoint) start(files []types.Object) error {
+	c.mu.Lock()
+	c.pending = make(map[string]checkpointEntry, len(files))
+	for _, f := range files {
+		c.pending[*f.Key] = checkpointEntry{
+			Key:          *f.Key,
+			ETag:         *f.ETag,
+			Size:         objectSize(f),
+			LastModified: *f.LastModified,
+			StorageClass: string(f.StorageClass),
+		}
+	}
+	c.done, c.removed = nil, 0
+	c.mu.Unlock()
+	return c.save()
+}
+
+// markDone notes that key has been downloaded, in the database batch, and
+// saves the checkpoint once CHECKPOINT_INTERVAL files have been flushed
+// since the last save. A nil checkpoint does nothing.
+func (c *Checkpoint) markDone(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.done = append(c.done, key)
+	due := c.removed >= c.interval
+	c.mu.Unlock()
+	if !due {
+		return
+	}
+	if err := c.save(); err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+// flushed drops the files marked done from pending now that their records
+// are written. It is registered with OnFlush, so it must not block.
+func (c *Checkpoint) flushed() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range c.done {
+		delete(c.pending, key)
+	}
+	c.removed += len(c.done)
+	c.done = nil
+}
+
+// save replaces the file at CHECKPOINT_PATH with the pending files
+func (c *Checkpoint) save() error {
+	c.saveMu.Lock()
+	defer c.saveMu.Unlock()
+
+	c.mu.Lock()
+	f := checkpointFile{Bucket: c.bucket, Prefix: c.prefix, CreatedAt: time.Now().UTC()}
+	f.Files = make([]checkpointEntry, 0, len(c.pending))
+	for _, e := range c.pending {
+		f.Files = append(f.Files, e)
+	}
+	c.removed = 0
+	c.mu.Unlock()
+
+	data, err := json.Marshal(f)
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".checkpoint-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary checkpoint for %s: %w", c.path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write checkpoint %s: %w", c.path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write checkpoint %s: %w", c.path, err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("failed to move checkpoint to %s: %w", c.path, err)
+	}
+	return nil
+}
+
+// finish removes the checkpoint after a complete cycle, or saves what is
+// left of it after an interrupted one
+func (c *Checkpoint) finish(complete bool) {
+	if !complete {
+		if err := c.save(); err != nil {
+			log.Printf("%v", err)
+		}
+		return
+	}
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Failed to remove checkpoint %s: %v", c.path, err)
+	}
+}
+
+// listOrResume returns the files of the checkpoint of an interrupted cycle,
+// or else lists the bucket. With --resume a missing checkpoint is an error
+// instead, for the first cycle only.
+func (s *Syncer) listOrResume(ctx context.Context) ([]types.Object, error) {
+	resume := s.resume
+	s.resume = false
+	if s.checkpoint != nil {
+		files, ok, err := s.checkpoint.load()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return files, nil
+		}
+	}
+	if resume {
+		return nil, fmt.Errorf("%w at %s", ErrNoCheckpoint, s.cfg.CHECKPOINT_PATH)
+	}
+
+	files, err := s.listFiles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list S3 files: %w", err)
+	}
+	s.costs.addListing(len(files))
+	return files, nil
+}
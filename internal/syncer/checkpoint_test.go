@@ -0,0 +1,162 @@
+package syncer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"sava-s3-export/internal/aws"
+	"sava-s3-export/internal/aws/awstest"
+)
+
+// listCountingClient is an S3 client that counts its ListFiles calls
+type listCountingClient struct {
+	aws.S3ClientInterface
+	lists *atomic.Int32
+}
+
+func (c listCountingClient) ListFiles(ctx context.Context) ([]types.Object, error) {
+	c.lists.Add(1)
+	return c.S3ClientInterface.ListFiles(ctx)
+}
+
+// checkpointKeys returns the sorted keys of the checkpoint at path
+func checkpointKeys(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read checkpoint: %v", err)
+	}
+	var f checkpointFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, e := range f.Files {
+		keys = append(keys, e.Key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func TestCheckpointKeepsUnflushedFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	c := newCheckpoint(path, 2, "bucket", "p/")
+
+	modified := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	var files []types.Object
+	for _, key := range []string{"p/a", "p/b", "p/c"} {
+		files = append(files, types.Object{Key: &key, ETag: &key, LastModified: &modified})
+	}
+	if err := c.start(files); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	// Files downloaded but not yet flushed stay in the checkpoint
+	c.markDone("p/a")
+	c.markDone("p/b")
+	c.finish(false)
+	if got, want := checkpointKeys(t, path), []string{"p/a", "p/b", "p/c"}; !slices.Equal(got, want) {
+		t.Errorf("checkpoint before the flush = %v, want %v", got, want)
+	}
+
+	c.flushed()
+	c.finish(false)
+	if got, want := checkpointKeys(t, path), []string{"p/c"}; !slices.Equal(got, want) {
+		t.Errorf("checkpoint after the flush = %v, want %v", got, want)
+	}
+
+	resumed, ok, err := newCheckpoint(path, 2, "bucket", "p/").load()
+	if err != nil || !ok || len(resumed) != 1 || *resumed[0].Key != "p/c" {
+		t.Errorf("load = %d files, %v, %v, want p/c", len(resumed), ok, err)
+	}
+	// Another prefix does not resume from it
+	if _, ok, err := newCheckpoint(path, 2, "bucket", "q/").load(); err != nil || ok {
+		t.Errorf("load of another prefix = %v, %v, want no checkpoint", ok, err)
+	}
+
+	c.finish(true)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("checkpoint after a complete cycle: %v, want it removed", err)
+	}
+}
+
+func TestRunResumesFromCheckpoint(t *testing.T) {
+	fake := awstest.NewFakeS3Client("p/")
+	modified := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	var keys []string
+	for i := range 6 {
+		key := fmt.Sprintf("p/%d.csv", i)
+		keys = append(keys, key)
+		fake.AddObject(key, []byte(key), modified)
+	}
+	cfg := newTestConfig(t, map[string]string{
+		"CHECKPOINT_PATH":     filepath.Join(t.TempDir(), "checkpoint.json"),
+		"CHECKPOINT_INTERVAL": "1",
+		"BATCH_SIZE":          "1",
+		"MAX_WORKERS":         "1",
+	})
+
+	// Interrupt the first cycle after two downloads
+	var lists atomic.Int32
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var downloads atomic.Int32
+	hook := func(ctx context.Context, key, localPath, etag string) error {
+		if downloads.Add(1) == 2 {
+			cancel()
+		}
+		return nil
+	}
+	s, err := NewSyncerWithClient(cfg, listCountingClient{fake, &lists}, WithPostDownloadHook(hook))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.RunOnce(ctx)
+	s.Close()
+
+	// The checkpoint holds exactly the files without a downloaded record
+	if s, err = NewSyncerWithClient(cfg, listCountingClient{fake, &lists}); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	records, err := s.db.ReadAllRecords(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var left []string
+	for _, key := range keys {
+		if records[key].SyncStatus != "downloaded" {
+			left = append(left, key)
+		}
+	}
+	if len(left) == 0 || len(left) == len(keys) {
+		t.Fatalf("%d of %d files left after the interruption, want some", len(left), len(keys))
+	}
+	if got := checkpointKeys(t, cfg.CHECKPOINT_PATH); !slices.Equal(got, left) {
+		t.Errorf("checkpoint = %v, want the files not downloaded %v", got, left)
+	}
+
+	lists.Store(0)
+	result, err := s.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if n := lists.Load(); n != 0 {
+		t.Errorf("resumed cycle listed the bucket %d times, want the checkpoint used", n)
+	}
+	if result.FilesDownloaded != len(left) {
+		t.Errorf("resumed cycle downloaded %d files, want %d", result.FilesDownloaded, len(left))
+	}
+	if _, err := os.Stat(cfg.CHECKPOINT_PATH); !os.IsNotExist(err) {
+		t.Errorf("checkpoint after the complete cycle: %v, want it removed", err)
+	}
+}
@@ -0,0 +1,149 @@
+package syncer
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"sava-s3-export/internal/aws"
+	"sava-s3-export/internal/cost"
+)
+
+// listCallWarnThreshold is the number of ListObjectsV2 requests in one cycle
+// above which listing the bucket is reported as expensive
+const listCallWarnThreshold = 1000
+
+// runCosts tallies the objects listed and the estimated cost of a sync cycle
+// for MAX_RUN_COST_USD and COST_REPORT_PATH; the requests actually made are
+// counted by the clients, see apiCalls. Targets share their parent's, so the
+// budget covers the whole cycle.
+type runCosts struct {
+	mu            sync.Mutex
+	objectsListed int64
+	estimated     float64
+}
+
+func (c *runCosts) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.objectsListed, c.estimated = 0, 0
+}
+
+// addListing records a listing of objectCount objects
+func (c *runCosts) addListing(objectCount int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.objectsListed += int64(objectCount)
+}
+
+// apiCallCounters returns the request counters of the client of the syncer
+// and those of its targets, once each since targets may share a client
+func (s *Syncer) apiCallCounters() []*aws.APICallCounter {
+	counters := []*aws.APICallCounter{s.s3Client.APICalls()}
+	for _, t := range s.targets {
+		if c := t.s3Client.APICalls(); !slices.Contains(counters, c) {
+			counters = append(counters, c)
+		}
+	}
+	return counters
+}
+
+// resetAPICalls clears the request counts left over from a previous cycle
+func (s *Syncer) resetAPICalls() {
+	for _, c := range s.apiCallCounters() {
+		c.Reset()
+	}
+}
+
+// apiCalls returns the S3 requests made in the current cycle by operation
+func (s *Syncer) apiCalls() map[string]int64 {
+	calls := make(map[string]int64)
+	for _, c := range s.apiCallCounters() {
+		for op, n := range c.Snapshot() {
+			calls[op] += n
+		}
+	}
+	return calls
+}
+
+// requestClasses splits calls into the LIST and GET requests S3 bills for,
+// ListObjectsV2 pages in the first, GetObject, HeadObject and similar in the
+// second
+func requestClasses(calls map[string]int64) (list, get int64) {
+	for op, n := range calls {
+		switch {
+		case strings.HasPrefix(op, "List"):
+			list += n
+		case strings.HasPrefix(op, "Get"), strings.HasPrefix(op, "Head"):
+			get += n
+		}
+	}
+	return list, get
+}
+
+// warnExpensiveListing logs a warning when the cycle needed more than
+// listCallWarnThreshold ListObjectsV2 requests, which USE_INVENTORY avoids
+func warnExpensiveListing(calls map[string]int64) {
+	if n := calls["ListObjectsV2"]; n > listCallWarnThreshold {
+		log.Printf("Warning: listing the bucket took %d ListObjectsV2 requests; consider USE_INVENTORY for buckets this large", n)
+	}
+}
+
+// checkBudget logs the estimated cost of listing listed objects and
+// downloading toDownload. Unless the cost was confirmed with --confirm-cost,
+// it returns cost.ErrBudgetExceeded when the estimate for the cycle so far
+// is over MAX_RUN_COST_USD.
+func (s *Syncer) checkBudget(listed []types.Object, toDownload []types.Object) error {
+	bytes := totalSize(toDownload)
+	estimate := cost.EstimateListCost(int64(len(listed))) + cost.EstimateDownloadCost(bytes, s.cfg.Region())
+
+	s.costs.mu.Lock()
+	s.costs.estimated += estimate
+	total := s.costs.estimated
+	s.costs.mu.Unlock()
+
+	log.Printf("Estimated cost of this run: $%.4f (%d objects listed, %d bytes to download)", estimate, len(listed), bytes)
+	if s.cfg.MAX_RUN_COST_USD <= 0 || total <= s.cfg.MAX_RUN_COST_USD {
+		return nil
+	}
+	if s.costConfirmed {
+		log.Printf("Estimated cost $%.4f exceeds MAX_RUN_COST_USD $%.4f, continuing as confirmed", total, s.cfg.MAX_RUN_COST_USD)
+		return nil
+	}
+	return fmt.Errorf("%w: $%.4f over a budget of $%.4f; rerun with --confirm-cost to proceed anyway",
+		cost.ErrBudgetExceeded, total, s.cfg.MAX_RUN_COST_USD)
+}
+
+// writeCostReport writes the requests and cost of the finished cycle result
+// to COST_REPORT_PATH, priced from the requests actually made
+func (s *Syncer) writeCostReport(result *SyncResult) {
+	if s.cfg.COST_REPORT_PATH == "" {
+		return
+	}
+
+	listRequests, getRequests := requestClasses(result.APICalls)
+	s.costs.mu.Lock()
+	report := cost.Report{
+		RunID:           result.RunID,
+		Region:          s.cfg.Region(),
+		ObjectsListed:   s.costs.objectsListed,
+		ListRequests:    listRequests,
+		GetRequests:     getRequests,
+		APICalls:        result.APICalls,
+		BytesDownloaded: result.BytesDownloaded,
+		GeneratedAt:     time.Now().UTC(),
+	}
+	s.costs.mu.Unlock()
+	report.ListCostUSD = cost.ListRequestCost(report.ListRequests)
+	report.DownloadCostUSD = cost.EstimateDownloadCost(report.BytesDownloaded, report.Region)
+	report.TotalCostUSD = report.ListCostUSD + report.DownloadCostUSD
+
+	if err := cost.WriteReport(s.cfg.COST_REPORT_PATH, report); err != nil {
+		log.Printf("%v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"sava-s3-export/internal/deadletter"
+)
+
+// ErrNoDeadLetterQueue is returned when DEAD_LETTER_PATH is not configured
+var ErrNoDeadLetterQueue = errors.New("DEAD_LETTER_PATH is not configured")
+
+// addDeadLetter records a file that exhausted its retries
+func (s *Syncer) addDeadLetter(file types.Object, err error, attempts int) {
+	entry := deadletter.Entry{
+		S3Key:        *file.Key,
+		ETag:         *file.ETag,
+		LastModified: *file.LastModified,
+		ErrorMessage: err.Error(),
+		Timestamp:    time.Now().UTC(),
+		AttemptCount: attempts,
+	}
+	if err := s.deadLetters.Append(entry); err != nil {
+		log.Printf("Failed to add %s to the dead letter queue: %v", entry.S3Key, err)
+	}
+}
+
+// RequeueDeadLetters resets every file in the dead letter queue to "pending"
+// so the next sync retries it, then empties the queue. It returns the number
+// of records requeued.
+func (s *Syncer) RequeueDeadLetters(ctx context.Context) (int, error) {
+	if s.deadLetters == nil {
+		return 0, ErrNoDeadLetterQueue
+	}
+
+	entries, err := s.deadLetters.ReadAll()
+	if err != nil {
+		return 0, err
+	}
+
+	records, err := s.db.ReadAllRecords(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read local database: %w", err)
+	}
+
+	requeued := make(map[string]struct{}, len(entries))
+	for _, entry := range entries {
+		if _, done := requeued[entry.S3Key]; done {
+			continue
+		}
+		record, exists := records[entry.S3Key]
+		// The entry describes the version that failed; entries written
+		// before it was recorded fall back to the record
+		lastModified := entry.LastModified
+		if lastModified.IsZero() {
+			lastModified = time.Unix(record.LastModified, 0)
+		}
+		if !exists {
+			record.LocalPath = s.localPath(entry.S3Key, lastModified)
+		}
+		if err := s.db.BatchUpdate(entry.S3Key, entry.ETag, record.LocalPath, "pending", lastModified); err != nil {
+			return 0, fmt.Errorf("failed to requeue %s: %w", entry.S3Key, err)
+		}
+		requeued[entry.S3Key] = struct{}{}
+	}
+
+	if err := s.db.FlushBatch(); err != nil {
+		return 0, fmt.Errorf("failed to flush requeued records: %w", err)
+	}
+	if err := s.deadLetters.Truncate(); err != nil {
+		return 0, err
+	}
+
+	log.Printf("Requeued %d files from the dead letter queue", len(requeued))
+	return len(requeued), nil
+}
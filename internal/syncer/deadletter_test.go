@@ -0,0 +1,45 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"sava-s3-export/internal/aws/awstest"
+)
+
+func TestRequeueDeadLettersKeepsLastModified(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	cfg := newTestConfig(t, map[string]string{
+		"DEAD_LETTER_PATH": filepath.Join(t.TempDir(), "dead-letters.ndjson"),
+		"PATH_TEMPLATE":    "{{.Year}}/{{.Month}}/{{.Filename}}",
+	})
+	s := newTestSyncer(t, cfg, awstest.NewFakeS3Client("p/"))
+
+	key, etag := "p/data.csv", `"abc"`
+	s.addDeadLetter(types.Object{Key: &key, ETag: &etag, LastModified: &modified}, errors.New("access denied"), 3)
+
+	ctx := context.Background()
+	if n, err := s.RequeueDeadLetters(ctx); err != nil || n != 1 {
+		t.Fatalf("RequeueDeadLetters = %d, %v, want 1 requeued", n, err)
+	}
+
+	records, err := s.db.ReadAllRecords(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := records[key]
+	if got := time.Unix(record.LastModified, 0).UTC(); !got.Equal(modified) {
+		t.Errorf("requeued record last modified %v, want %v", got, modified)
+	}
+	if want := filepath.Join(cfg.LOCAL_DIR, "2024", "05", "data.csv"); record.LocalPath != want {
+		t.Errorf("requeued record local path %s, want %s", record.LocalPath, want)
+	}
+	if record.SyncStatus != "pending" || record.ETag != etag {
+		t.Errorf("requeued record has status %q and ETag %s, want pending and %s", record.SyncStatus, record.ETag, etag)
+	}
+}
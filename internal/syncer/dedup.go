@@ -0,0 +1,171 @@
+package syncer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"sava-s3-export/internal/database"
+	"sava-s3-export/internal/index"
+)
+
+// dedupIndex maps the content hash of downloaded objects to the local path
+// holding that content, so later keys with the same content are hardlinked
+// to it instead of downloaded again
+type dedupIndex struct {
+	mu    sync.RWMutex
+	paths map[string]string
+	// persistent keeps the index across runs at path, HASH_INDEX_PATH. It
+	// holds an exclusive lock on the file, so it is only opened by the first
+	// sync cycle or event that needs it, and commands that never download
+	// do not wait for a running sync to release it.
+	path       string
+	openOnce   sync.Once
+	openErr    error
+	persistent *index.ContentHashIndex
+
+	// links and bytesSaved count the hardlinks made in the current cycle
+	links      atomic.Int64
+	bytesSaved atomic.Int64
+}
+
+func newDedupIndex(path string) *dedupIndex {
+	return &dedupIndex{paths: make(map[string]string), path: path}
+}
+
+// open opens the persistent index at HASH_INDEX_PATH, once. A nil index or
+// one without a path does nothing.
+func (d *dedupIndex) open() error {
+	if d == nil || d.path == "" {
+		return nil
+	}
+	d.openOnce.Do(func() {
+		d.persistent, d.openErr = index.OpenContentHashIndex(d.path)
+	})
+	return d.openErr
+}
+
+// persistentIndex returns the persistent index, or nil when there is none or
+// it failed to open, which open reports to the sync cycle
+func (d *dedupIndex) persistentIndex() *index.ContentHashIndex {
+	if d.open() != nil {
+		return nil
+	}
+	return d.persistent
+}
+
+// close closes the persistent index if it was opened
+func (d *dedupIndex) close() error {
+	if d == nil || d.path == "" {
+		return nil
+	}
+	// Keep a later open from reopening it
+	d.openOnce.Do(func() {})
+	if d.persistent == nil {
+		return nil
+	}
+	return d.persistent.Close()
+}
+
+// contentHash identifies the content of file by the SHA256 of its ETag and
+// size. ETags are content hashes for single-part uploads, and for multipart
+// uploads as long as the same part size was used.
+func contentHash(file types.Object) string {
+	sum := sha256.Sum256([]byte(*file.ETag + "/" + strconv.FormatInt(objectSize(file), 10)))
+	return hex.EncodeToString(sum[:])
+}
+
+// seed adds the downloaded records of a previous run to the index, keeping
+// paths already indexed in this process
+func (d *dedupIndex) seed(records map[string]database.FileRecord) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, r := range records {
+		if r.SyncStatus != "downloaded" || r.ContentHash == "" {
+			continue
+		}
+		if _, ok := d.paths[r.ContentHash]; !ok {
+			d.paths[r.ContentHash] = r.LocalPath
+		}
+	}
+}
+
+// lookup returns the indexed path holding the content with hash, falling
+// back to the persistent index for content not yet seen by this process
+func (d *dedupIndex) lookup(hash string) (string, bool) {
+	d.mu.RLock()
+	path, ok := d.paths[hash]
+	d.mu.RUnlock()
+	persistent := d.persistentIndex()
+	if ok || persistent == nil {
+		return path, ok
+	}
+	return persistent.Lookup(hash)
+}
+
+// add records localPath as holding the content with hash
+func (d *dedupIndex) add(hash, localPath string) {
+	d.mu.Lock()
+	d.paths[hash] = localPath
+	d.mu.Unlock()
+	if persistent := d.persistentIndex(); persistent != nil {
+		if err := persistent.Store(hash, localPath); err != nil {
+			log.Printf("Failed to add %s to the hash index: %v", localPath, err)
+		}
+	}
+}
+
+// reset clears the counts left over from a previous cycle
+func (d *dedupIndex) reset() {
+	d.links.Store(0)
+	d.bytesSaved.Store(0)
+}
+
+// logSummary logs how many files the current cycle linked instead of downloading
+func (d *dedupIndex) logSummary() {
+	if links := d.links.Load(); links > 0 {
+		log.Printf("Deduplicated %d files with hardlinks, saving %d bytes", links, d.bytesSaved.Load())
+	}
+}
+
+// linkDuplicate hardlinks localPath to an already downloaded file with the
+// same content as file. It reports false when there is none or the link
+// cannot be made, e.g. across devices, in which case file must be downloaded.
+func (s *Syncer) linkDuplicate(file types.Object, hash, localPath string) bool {
+	existing, ok := s.dedup.lookup(hash)
+	if !ok || existing == localPath {
+		return false
+	}
+
+	if err := linkFile(existing, localPath); err != nil {
+		log.Printf("Failed to hardlink %s to %s, downloading instead: %v", localPath, existing, err)
+		return false
+	}
+
+	s.dedup.links.Add(1)
+	s.dedup.bytesSaved.Add(objectSize(file))
+	log.Printf("Linked %s to identical content at %s", *file.Key, existing)
+	return true
+}
+
+// linkFile creates newPath as a hardlink to existingPath, replacing any file already there
+func linkFile(existingPath, newPath string) error {
+	if _, err := os.Stat(existingPath); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", newPath, err)
+	}
+	if err := os.Remove(newPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Link(existingPath, newPath)
+}
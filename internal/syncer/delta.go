@@ -0,0 +1,71 @@
+package syncer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"sava-s3-export/internal/aws"
+	"sava-s3-export/internal/database"
+)
+
+// With DELTA_SYNC_ALGORITHM=sha256 the SHA256 of each downloaded file is
+// stored as the ContentHash of its record, base64 encoded like the
+// x-amz-checksum-sha256 of S3. When the ETag of a downloaded object changes,
+// which happens whenever it is uploaded again in parts even with the same
+// content, its checksum is fetched with GetObjectAttributes and compared with
+// the stored hash before downloading it again.
+
+// hashContent reports whether the SHA256 of downloaded files is recorded for
+// change detection
+func (s *Syncer) hashContent() bool {
+	return s.cfg.DELTA_SYNC_ALGORITHM == "sha256"
+}
+
+// unchangedContent reports whether the object of file, whose ETag differs
+// from that of record, still has the content recorded by its last download.
+// Such a record is refreshed with the new ETag instead of being downloaded
+// again. Objects uploaded without a SHA256 checksum fall back to the ETag.
+func (s *Syncer) unchangedContent(ctx context.Context, file types.Object, record database.FileRecord) bool {
+	if !s.hashContent() || record.SyncStatus != "downloaded" || record.ContentHash == "" {
+		return false
+	}
+
+	attrs, err := s.s3Client.GetAttributes(ctx, *file.Key, []types.ObjectAttributes{types.ObjectAttributesChecksum})
+	if err != nil {
+		log.Printf("Failed to get the checksum of %s, comparing ETags instead: %v", *file.Key, err)
+		return false
+	}
+	if checksum := aws.FullObjectSHA256(attrs); checksum == "" || checksum != record.ContentHash {
+		return false
+	}
+
+	record.ETag = *file.ETag
+	record.LastModified = file.LastModified.Unix()
+	if err := s.db.BatchTouch(record); err != nil {
+		log.Printf("Failed to refresh the record of %s: %v", record.S3Key, err)
+	}
+	log.Printf("Content of %s is unchanged despite its new ETag %s", *file.Key, *file.ETag)
+	return true
+}
+
+// fileSHA256 returns the base64 SHA256 of the file at path
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
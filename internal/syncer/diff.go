@@ -0,0 +1,103 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"sava-s3-export/internal/database"
+)
+
+// DiffResult reconciles the objects in S3 with the sync database. Each list
+// holds S3 keys in order.
+type DiffResult struct {
+	// New are the objects without a record
+	New []string `json:"new"`
+	// Modified are the objects whose ETag differs from their record's
+	Modified []string `json:"modified"`
+	// DeletedFromS3 are the records without an object
+	DeletedFromS3 []string `json:"deleted_from_s3"`
+	// MissingLocally are the downloaded records whose local file is gone
+	MissingLocally []string `json:"missing_locally"`
+}
+
+// newDiffResult returns an empty DiffResult whose lists encode as [] rather
+// than null
+func newDiffResult() DiffResult {
+	return DiffResult{New: []string{}, Modified: []string{}, DeletedFromS3: []string{}, MissingLocally: []string{}}
+}
+
+// Diff compares every object in S3 with the sync database, across every
+// target. Unlike a sync it ignores MODIFIED_AFTER, and it also reports the
+// records whose object or local file no longer exists. Records of specific
+// versions, kept by the download subcommand, are left out.
+func (s *Syncer) Diff(ctx context.Context) (DiffResult, error) {
+	if len(s.targets) > 0 {
+		all := newDiffResult()
+		for _, t := range s.targets {
+			d, err := t.Diff(ctx)
+			if err != nil {
+				return DiffResult{}, fmt.Errorf("target %s: %w", t.cfg.S3_PREFIX, err)
+			}
+			all.New = append(all.New, d.New...)
+			all.Modified = append(all.Modified, d.Modified...)
+			all.DeletedFromS3 = append(all.DeletedFromS3, d.DeletedFromS3...)
+			all.MissingLocally = append(all.MissingLocally, d.MissingLocally...)
+		}
+		for _, keys := range [][]string{all.New, all.Modified, all.DeletedFromS3, all.MissingLocally} {
+			sort.Strings(keys)
+		}
+		return all, nil
+	}
+
+	s3Files, err := s.listFiles(ctx)
+	if err != nil {
+		return DiffResult{}, fmt.Errorf("failed to list S3 files: %w", err)
+	}
+	if s.isTarget {
+		s3Files = filterPrefix(s3Files, s.cfg.S3_PREFIX)
+	}
+	records, err := s.db.ReadAllRecords(ctx)
+	if err != nil {
+		return DiffResult{}, fmt.Errorf("failed to read local database: %w", err)
+	}
+
+	d := newDiffResult()
+	listed := make(map[string]bool, len(s3Files))
+	for _, f := range s3Files {
+		listed[*f.Key] = true
+		record, ok := records[*f.Key]
+		switch {
+		case !ok:
+			d.New = append(d.New, *f.Key)
+		case record.ETag != *f.ETag:
+			d.Modified = append(d.Modified, *f.Key)
+		}
+	}
+	for key, r := range records {
+		if recordOfVersion(r) {
+			continue
+		}
+		if !listed[key] {
+			d.DeletedFromS3 = append(d.DeletedFromS3, key)
+		}
+		if r.SyncStatus != "downloaded" {
+			continue
+		}
+		if _, err := os.Stat(r.LocalPath); os.IsNotExist(err) {
+			d.MissingLocally = append(d.MissingLocally, key)
+		}
+	}
+	for _, keys := range [][]string{d.New, d.Modified, d.DeletedFromS3, d.MissingLocally} {
+		sort.Strings(keys)
+	}
+	return d, nil
+}
+
+// recordOfVersion reports whether r is the record of a specific version,
+// keyed by database.VersionedKey
+func recordOfVersion(r database.FileRecord) bool {
+	return r.VersionID != "" && strings.HasSuffix(r.S3Key, "#"+r.VersionID)
+}
@@ -0,0 +1,91 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"sava-s3-export/internal/database"
+	"sava-s3-export/internal/storage"
+)
+
+const (
+	// diskCheckInterval is how often free space is sampled during a sync
+	diskCheckInterval = 10 * time.Second
+	// diskWaitInterval is how often a paused worker rechecks whether it may continue
+	diskWaitInterval = time.Second
+)
+
+// checkDiskSpace fails if LOCAL_DIR, or the STORAGE_CLASS_DIRS directory
+// files are routed to, cannot hold every file to download there plus a 10%
+// margin. A file that replaces a downloaded one at the same path only needs
+// the difference to the recorded FileSizeBytes.
+func (s *Syncer) checkDiskSpace(files []types.Object, records map[string]database.FileRecord) error {
+	if s.streaming() {
+		return nil
+	}
+	totals := make(map[string]int64)
+	for _, f := range files {
+		dir, _ := s.storageClassDir(f)
+		need := objectSize(f)
+		if r, ok := records[*f.Key]; ok && r.SyncStatus == "downloaded" && r.LocalPath == s.objectPath(f) {
+			need = max(need-r.FileSizeBytes, 0)
+		}
+		totals[dir] += need
+	}
+	for dir, total := range totals {
+		if err := storage.CheckDiskSpace(dir, total+total/10); err != nil {
+			return fmt.Errorf("not starting downloads: %w", err)
+		}
+	}
+	return nil
+}
+
+// monitorDiskSpace samples free space in LOCAL_DIR until ctx is cancelled,
+// flagging the syncer while it is below MIN_FREE_BYTES so workers pause
+func (s *Syncer) monitorDiskSpace(ctx context.Context) {
+	if s.cfg.MIN_FREE_BYTES <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(diskCheckInterval)
+	defer ticker.Stop()
+	for {
+		free, err := storage.FreeBytes(s.cfg.LOCAL_DIR)
+		if err != nil {
+			log.Printf("Failed to check free disk space: %v", err)
+		} else {
+			low := free < s.cfg.MIN_FREE_BYTES
+			if s.diskLow.Swap(low) != low {
+				if low {
+					log.Printf("Free space in %s dropped to %d bytes, below MIN_FREE_BYTES=%d; pausing new downloads",
+						s.cfg.LOCAL_DIR, free, s.cfg.MIN_FREE_BYTES)
+				} else {
+					log.Printf("Free space in %s recovered to %d bytes; resuming downloads", s.cfg.LOCAL_DIR, free)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			s.diskLow.Store(false)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// waitForDiskSpace blocks while free space is below MIN_FREE_BYTES
+func (s *Syncer) waitForDiskSpace(ctx context.Context) error {
+	for s.diskLow.Load() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(diskWaitInterval):
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package syncer
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+// SyncEventHandler receives the events of sync cycles, so a program
+// embedding the syncer can route them to its own logging or metrics instead
+// of the standard logger. The file and progress methods are called from the
+// download workers concurrently and should return quickly.
+type SyncEventHandler interface {
+	// OnFileDownloaded is called once a file is downloaded and recorded;
+	// localPath is empty for a streamed file
+	OnFileDownloaded(key, localPath string, bytes int64)
+	// OnFileFailed is called when a download fails for good, after attempt
+	// attempts
+	OnFileFailed(key string, err error, attempt int)
+	// OnProgress is called after every hundredth download of a cycle, and
+	// the last one, whether it succeeded or failed
+	OnProgress(completed, total int, bytesPerSec float64)
+	// OnRunComplete is called with the outcome of every cycle
+	OnRunComplete(result SyncResult)
+}
+
+// WithEventHandler sends the events of every sync cycle to h instead of the
+// log
+func WithEventHandler(h SyncEventHandler) Option {
+	return func(s *Syncer) {
+		s.eventHandler = h
+	}
+}
+
+// logEventHandler is the default SyncEventHandler, which logs the events.
+// Downloaded files are already logged by the S3 client, so it leaves them out.
+type logEventHandler struct {
+	progress *ProgressTracker
+}
+
+// OnFileDownloaded implements SyncEventHandler
+func (h logEventHandler) OnFileDownloaded(key, localPath string, bytes int64) {}
+
+// OnFileFailed implements SyncEventHandler
+func (h logEventHandler) OnFileFailed(key string, err error, attempt int) {
+	if errors.Is(err, errDownloadTimeout) {
+		log.Printf("Timed out downloading %s after %d attempts: %v", key, attempt, err)
+		return
+	}
+	log.Printf("Failed to download %s after %d attempts: %v", key, attempt, err)
+}
+
+// OnProgress implements SyncEventHandler, logging the counts of the tracker
+func (h logEventHandler) OnProgress(completed, total int, bytesPerSec float64) {
+	snap := h.progress.snapshot()
+	rate := float64(completed) / snap.elapsed.Seconds()
+	log.Printf("Progress: %d/%d files (%.1f%%), Success: %d, Failed: %d, Rate: %.1f files/sec%s",
+		completed, total, float64(completed)*100/float64(total), snap.success, snap.failed, rate, snap.bytesETA())
+}
+
+// OnRunComplete implements SyncEventHandler
+func (h logEventHandler) OnRunComplete(result SyncResult) {
+	log.Printf("Sync run %s finished in %v: %d downloaded, %d failed, %d skipped",
+		result.RunID, result.Duration.Round(time.Millisecond), result.FilesDownloaded, result.FilesFailed, result.FilesSkipped)
+}
@@ -0,0 +1,93 @@
+package syncer
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// EventSource delivers objects to download as soon as they are created,
+// without waiting for the next full scan
+type EventSource interface {
+	// Run sends objects to downloadCh until ctx is cancelled
+	Run(ctx context.Context, downloadCh chan<- types.Object) error
+	// Ack is called once key has been downloaded and persisted to the database
+	Ack(ctx context.Context, key string) error
+	// Nack is called when key was not downloaded, so the source can forget
+	// it and leave the event to be redelivered
+	Nack(key string)
+}
+
+// runEvents downloads objects delivered by the event source alongside the
+// polling loop. Every download is flushed to the database before it is
+// acknowledged; failed downloads are left unacknowledged so they are redelivered.
+func (s *Syncer) runEvents(ctx context.Context) {
+	eventQueue := make(chan types.Object, s.cfg.MAX_WORKERS)
+
+	var wg sync.WaitGroup
+	for i := 0; i < s.cfg.MAX_WORKERS; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-s.stopping:
+					return
+				case file := <-eventQueue:
+					s.processEvent(ctx, file)
+				}
+			}
+		}()
+	}
+
+	if err := s.events.Run(ctx, eventQueue); err != nil {
+		log.Printf("Event source stopped with an error: %v", err)
+	}
+	wg.Wait()
+}
+
+// processEvent downloads a single event-driven object and acknowledges it on
+// success. Every other outcome is reported to the event source with Nack.
+func (s *Syncer) processEvent(ctx context.Context, file types.Object) {
+	key := *file.Key
+	acked := false
+	defer func() {
+		if !acked {
+			s.events.Nack(key)
+		}
+	}()
+
+	if err := s.rateLimiter.limiterFor(key).Wait(ctx); err != nil {
+		return
+	}
+
+	target := s.targetFor(key)
+	if target == nil {
+		log.Printf("Ignoring event for %s: no SYNC_TARGETS prefix matches", key)
+		return
+	}
+	if err := target.acquireSlot(ctx); err != nil {
+		return
+	}
+	defer target.releaseSlot()
+	if !s.inFlight.begin(key) {
+		return
+	}
+	err := target.processFile(ctx, file)
+	s.inFlight.end(key)
+	if err != nil {
+		return
+	}
+	if err := target.db.FlushBatch(); err != nil {
+		log.Printf("Failed to persist event-driven download of %s: %v", key, err)
+		return
+	}
+	acked = true
+	if err := s.events.Ack(ctx, key); err != nil {
+		log.Printf("Failed to acknowledge event for %s: %v", key, err)
+	}
+}
@@ -0,0 +1,83 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"sava-s3-export/internal/storage"
+)
+
+// HealthCheck verifies the prerequisites of a sync before any work starts:
+// that the bucket is reachable with the configured credentials, that
+// LOCAL_DIR and the directory of DB_PATH are writable, and that LOCAL_DIR
+// has at least MIN_FREE_BYTES free. With HEALTH_CHECK_KEY set, that object
+// must also be readable. With SYNC_TARGETS the directories of each target
+// are checked instead. All failures are returned together.
+func (s *Syncer) HealthCheck(ctx context.Context) error {
+	var errs []error
+	if err := s.s3Client.HeadBucket(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("S3 is not reachable: %w", err))
+	} else if s.cfg.HEALTH_CHECK_KEY != "" {
+		if _, err := s.s3Client.StatFile(ctx, s.cfg.HEALTH_CHECK_KEY); err != nil {
+			errs = append(errs, fmt.Errorf("HEALTH_CHECK_KEY is not accessible: %w", err))
+		}
+	}
+	syncers := s.targets
+	if len(syncers) == 0 {
+		syncers = []*Syncer{s}
+	}
+	for _, t := range syncers {
+		errs = append(errs, t.checkLocal()...)
+	}
+	return errors.Join(errs...)
+}
+
+// startupCheck runs the HealthCheck before the first cycle
+func (s *Syncer) startupCheck(ctx context.Context) error {
+	if err := s.HealthCheck(ctx); err != nil {
+		return fmt.Errorf("health check failed: %w", err)
+	}
+	log.Println("Health check passed")
+	return nil
+}
+
+// checkLocal checks the local directories of a single syncer
+func (s *Syncer) checkLocal() []error {
+	var errs []error
+	// Streamed objects are never written under LOCAL_DIR
+	if !s.streaming() {
+		if err := checkWritable(s.cfg.LOCAL_DIR); err != nil {
+			errs = append(errs, fmt.Errorf("LOCAL_DIR is not writable: %w", err))
+		} else if s.cfg.MIN_FREE_BYTES > 0 {
+			free, err := storage.FreeBytes(s.cfg.LOCAL_DIR)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to check free space in %s: %w", s.cfg.LOCAL_DIR, err))
+			} else if free < s.cfg.MIN_FREE_BYTES {
+				errs = append(errs, fmt.Errorf("only %d bytes free in %s, below MIN_FREE_BYTES=%d", free, s.cfg.LOCAL_DIR, s.cfg.MIN_FREE_BYTES))
+			}
+		}
+	}
+	if err := checkWritable(filepath.Dir(s.cfg.DB_PATH)); err != nil {
+		errs = append(errs, fmt.Errorf("the directory of DB_PATH is not writable: %w", err))
+	}
+	return errs
+}
+
+// checkWritable creates dir if needed and proves it writable by creating and
+// removing a temporary file in it
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".healthcheck-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
@@ -0,0 +1,27 @@
+package syncer
+
+import (
+	"log"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// limitFiles returns the MAX_FILES_PER_RUN least recently modified of files,
+// or all of them when it is 0. The rest are left for later runs, which find
+// the files downloaded now in the database, so a bucket is onboarded in
+// chronological batches.
+func (s *Syncer) limitFiles(files []types.Object) []types.Object {
+	limit := s.cfg.MAX_FILES_PER_RUN
+	if limit <= 0 || len(files) <= limit {
+		return files
+	}
+
+	sorted := append([]types.Object(nil), files...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return modifiedUnixNano(sorted[i]) < modifiedUnixNano(sorted[j])
+	})
+	log.Printf("Downloading the %d oldest of %d files, deferring %d to later runs (MAX_FILES_PER_RUN)",
+		limit, len(files), len(files)-limit)
+	return sorted[:limit]
+}
@@ -0,0 +1,82 @@
+package syncer
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// pathTemplateData is the data PATH_TEMPLATE is executed with. Key, Dir and
+// Filename are relative to S3_PREFIX; the date fields come from LastModified
+// in UTC and are zero-padded.
+type pathTemplateData struct {
+	Key      string
+	Prefix   string
+	Dir      string
+	Filename string
+	Year     string
+	Month    string
+	Day      string
+}
+
+// parsePathTemplate parses PATH_TEMPLATE and renders it once with sample data
+// so that references to unknown fields fail at startup rather than per file
+func parsePathTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("PATH_TEMPLATE").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PATH_TEMPLATE: %w", err)
+	}
+	if err := tmpl.Execute(&strings.Builder{}, newPathTemplateData("", "dir/file", time.Now())); err != nil {
+		return nil, fmt.Errorf("invalid PATH_TEMPLATE: %w", err)
+	}
+	return tmpl, nil
+}
+
+func newPathTemplateData(prefix, key string, lastModified time.Time) pathTemplateData {
+	rel := strings.TrimPrefix(key, prefix)
+	dir := path.Dir(rel)
+	if dir == "." {
+		dir = ""
+	}
+	lastModified = lastModified.UTC()
+	return pathTemplateData{
+		Key:      rel,
+		Prefix:   prefix,
+		Dir:      dir,
+		Filename: path.Base(rel),
+		Year:     fmt.Sprintf("%04d", lastModified.Year()),
+		Month:    fmt.Sprintf("%02d", lastModified.Month()),
+		Day:      fmt.Sprintf("%02d", lastModified.Day()),
+	}
+}
+
+// localPath returns the local destination for an S3 key: PATH_TEMPLATE
+// rendered under LOCAL_DIR when set, otherwise the key minus S3_PREFIX.
+// A rendered path that would leave LOCAL_DIR falls back to the default.
+func (s *Syncer) localPath(key string, lastModified time.Time) string {
+	return s.localPathIn(s.cfg.LOCAL_DIR, key, lastModified)
+}
+
+// localPathIn is localPath under dir instead of LOCAL_DIR
+func (s *Syncer) localPathIn(dir, key string, lastModified time.Time) string {
+	rel := strings.TrimPrefix(key, s.cfg.S3_PREFIX)
+	if s.pathTemplate == nil {
+		return filepath.Join(dir, rel)
+	}
+
+	var b strings.Builder
+	if err := s.pathTemplate.Execute(&b, newPathTemplateData(s.cfg.S3_PREFIX, key, lastModified)); err != nil {
+		log.Printf("Failed to apply PATH_TEMPLATE to %s, using the default path: %v", key, err)
+		return filepath.Join(dir, rel)
+	}
+	rendered := filepath.Clean(filepath.FromSlash(b.String()))
+	if rendered == "." || filepath.IsAbs(rendered) || rendered == ".." || strings.HasPrefix(rendered, ".."+string(filepath.Separator)) {
+		log.Printf("PATH_TEMPLATE rendered %q for %s outside %s, using the default path", b.String(), key, dir)
+		return filepath.Join(dir, rel)
+	}
+	return filepath.Join(dir, rendered)
+}
@@ -0,0 +1,53 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"sava-s3-export/internal/metrics"
+)
+
+// pauseWaitInterval is how often a paused worker checks whether it may continue
+const pauseWaitInterval = 500 * time.Millisecond
+
+// errStopping is returned by waitWhilePaused when a shutdown is requested
+var errStopping = errors.New("syncer is shutting down")
+
+// Pause stops workers from starting new downloads until Resume is called,
+// for example to relieve disk or network during an incident. Downloads
+// already in progress finish. With SYNC_TARGETS every target is paused.
+func (s *Syncer) Pause() {
+	if !s.paused.Swap(true) {
+		log.Println("Syncer paused, no new downloads will start until it is resumed")
+		metrics.SyncerPaused.Set(1)
+	}
+}
+
+// Resume lets workers stopped by Pause start downloads again
+func (s *Syncer) Resume() {
+	if s.paused.Swap(false) {
+		log.Println("Syncer resumed")
+		metrics.SyncerPaused.Set(0)
+	}
+}
+
+// Paused reports whether the syncer is paused
+func (s *Syncer) Paused() bool {
+	return s.paused.Load()
+}
+
+// waitWhilePaused blocks while the syncer is paused
+func (s *Syncer) waitWhilePaused(ctx context.Context) error {
+	for s.paused.Load() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.stopping:
+			return errStopping
+		case <-time.After(pauseWaitInterval):
+		}
+	}
+	return nil
+}
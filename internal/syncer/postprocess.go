@@ -0,0 +1,127 @@
+package syncer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"sava-s3-export/internal/storage"
+)
+
+// postProcess applies DECOMPRESS_ON_DOWNLOAD and CONTENT_TYPE_ROUTING to a
+// freshly downloaded file and returns its final path. Failures are logged and
+// leave the file where it is.
+func (s *Syncer) postProcess(localPath string) string {
+	if s.cfg.DECOMPRESS_ON_DOWNLOAD {
+		decompressed, err := storage.Decompress(localPath)
+		if err != nil {
+			log.Printf("Warning: keeping %s compressed: %v", localPath, err)
+		} else if decompressed != localPath {
+			log.Printf("Decompressed %s to %s", localPath, decompressed)
+		}
+		localPath = decompressed
+	}
+
+	if len(s.cfg.CONTENT_TYPE_ROUTING) > 0 {
+		routed, err := s.routeByContentType(localPath)
+		if err != nil {
+			log.Printf("Warning: failed to route %s by content type: %v", localPath, err)
+		} else {
+			localPath = routed
+		}
+	}
+
+	return localPath
+}
+
+// preserveTimestamp sets the access and modification times of the file at
+// localPath to the object's LastModified when PRESERVE_TIMESTAMPS is
+// enabled, so mtime-based tools such as rsync see the S3 time. Failures are
+// only logged.
+func (s *Syncer) preserveTimestamp(localPath string, lastModified time.Time) {
+	if !s.cfg.PRESERVE_TIMESTAMPS {
+		return
+	}
+	if err := os.Chtimes(localPath, lastModified, lastModified); err != nil {
+		log.Printf("Warning: failed to set the modification time of %s: %v", localPath, err)
+	}
+}
+
+// parquetMagic starts every Parquet file, which http.DetectContentType does not know
+var parquetMagic = []byte("PAR1")
+
+// detectContentType sniffs the MIME type of the file at path. Parquet is
+// recognised by its magic bytes; when sniffing only finds generic text or
+// binary the file extension is consulted, so that e.g. CSV maps to text/csv.
+func detectContentType(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	head = head[:n]
+
+	if bytes.HasPrefix(head, parquetMagic) {
+		return "application/x-parquet", nil
+	}
+	detected := http.DetectContentType(head)
+	if strings.HasPrefix(detected, "text/plain") || detected == "application/octet-stream" {
+		if byExt := mime.TypeByExtension(filepath.Ext(path)); byExt != "" {
+			return byExt, nil
+		}
+	}
+	return detected, nil
+}
+
+// routeByContentType moves the file at localPath into the CONTENT_TYPE_ROUTING
+// subdirectory of LOCAL_DIR whose MIME prefix matches best, falling back to
+// the "*" entry. Files of unmatched types stay where they are.
+func (s *Syncer) routeByContentType(localPath string) (string, error) {
+	contentType, err := detectContentType(localPath)
+	if err != nil {
+		return localPath, err
+	}
+
+	subdir, matched := "", ""
+	for prefix, dir := range s.cfg.CONTENT_TYPE_ROUTING {
+		if prefix != "*" && strings.HasPrefix(contentType, prefix) && len(prefix) > len(matched) {
+			subdir, matched = dir, prefix
+		}
+	}
+	if matched == "" {
+		subdir = s.cfg.CONTENT_TYPE_ROUTING["*"]
+	}
+	if subdir == "" {
+		return localPath, nil
+	}
+
+	rel, err := filepath.Rel(s.cfg.LOCAL_DIR, localPath)
+	if err != nil {
+		return localPath, err
+	}
+	dest := filepath.Join(s.cfg.LOCAL_DIR, subdir, rel)
+	if dest == localPath {
+		return localPath, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return localPath, fmt.Errorf("failed to create directory %s: %w", filepath.Dir(dest), err)
+	}
+	if err := os.Rename(localPath, dest); err != nil {
+		return localPath, fmt.Errorf("failed to move %s to %s: %w", localPath, dest, err)
+	}
+	log.Printf("Routed %s (%s) to %s", localPath, contentType, dest)
+	return dest, nil
+}
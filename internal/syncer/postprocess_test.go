@@ -0,0 +1,56 @@
+package syncer
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"sava-s3-export/internal/aws/awstest"
+)
+
+func TestPreserveTimestamps(t *testing.T) {
+	const key = "p/data.csv"
+	modified := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+
+	for _, preserve := range []bool{true, false} {
+		t.Run("PRESERVE_TIMESTAMPS="+strconv.FormatBool(preserve), func(t *testing.T) {
+			fake := awstest.NewFakeS3Client("p/")
+			fake.AddObject(key, []byte("a,1"), modified)
+
+			// The hook runs after the timestamp is set, so it sees it too
+			var hookModTime time.Time
+			hook := func(ctx context.Context, key, localPath, etag string) error {
+				info, err := os.Stat(localPath)
+				if err != nil {
+					return err
+				}
+				hookModTime = info.ModTime()
+				return nil
+			}
+			cfg := newTestConfig(t, map[string]string{"PRESERVE_TIMESTAMPS": strconv.FormatBool(preserve)})
+			s := newTestSyncer(t, cfg, fake, WithPostDownloadHook(hook))
+
+			ctx := context.Background()
+			if _, err := s.RunOnce(ctx); err != nil {
+				t.Fatalf("RunOnce: %v", err)
+			}
+			records, err := s.db.ReadAllRecords(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			info, err := os.Stat(records[key].LocalPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := info.ModTime().Equal(modified); got != preserve {
+				t.Errorf("local file has mtime %v with S3 LastModified %v", info.ModTime(), modified)
+			}
+			if got := hookModTime.Equal(modified); got != preserve {
+				t.Errorf("post-download hook saw mtime %v with S3 LastModified %v", hookModTime, modified)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package syncer
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"sava-s3-export/internal/notification"
+)
+
+// progressCounter counts the OnProgress calls of a ProgressTracker
+type progressCounter struct {
+	SyncEventHandler
+	calls atomic.Int32
+}
+
+func (h *progressCounter) OnProgress(completed, total int, bytesPerSec float64) {
+	h.calls.Add(1)
+}
+
+// TestProgressTrackerConcurrent counts 1000 downloads at once; run it with
+// -race
+func TestProgressTrackerConcurrent(t *testing.T) {
+	const n = 1000
+	const size = 10
+
+	events := &progressCounter{}
+	p := NewProgressTracker()
+	p.events = events
+	p.Start(n)
+
+	stop := make(chan struct{})
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			// Every counted success has its bytes counted with it
+			if snap := p.snapshot(); snap.bytes != snap.success*size {
+				t.Errorf("snapshot has %d successes and %d bytes", snap.success, snap.bytes)
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if i%2 == 0 {
+				p.IncrementSuccess(size)
+			} else {
+				p.IncrementFailed(fmt.Sprintf("key-%d", i), errors.New("failed"))
+			}
+			p.AddSkipped(1)
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	<-readerDone
+
+	success, failed, bytes := p.Totals()
+	if success != n/2 || failed != n/2 || bytes != n/2*size {
+		t.Errorf("Totals() = %d, %d, %d, want %d, %d, %d", success, failed, bytes, n/2, n/2, n/2*size)
+	}
+	if got := p.Skipped(); got != n {
+		t.Errorf("Skipped() = %d, want %d", got, n)
+	}
+	if got := len(p.Errors()); got != notification.MaxResultErrors {
+		t.Errorf("kept %d errors, want %d", got, notification.MaxResultErrors)
+	}
+	// Progress is reported at every hundredth download, the last included
+	if got := events.calls.Load(); got != n/100 {
+		t.Errorf("OnProgress called %d times, want %d", got, n/100)
+	}
+}
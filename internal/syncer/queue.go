@@ -0,0 +1,181 @@
+package syncer
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"sava-s3-export/internal/metrics"
+)
+
+// Download priorities accepted by DOWNLOAD_PRIORITY
+const (
+	PrioritySmallestFirst = "smallest_first"
+	PriorityLargestFirst  = "largest_first"
+	PriorityOldestFirst   = "oldest_first"
+	PriorityNewestFirst   = "newest_first"
+	PriorityFIFO          = "fifo"
+)
+
+// queuedObject is an object waiting in the download queue
+type queuedObject struct {
+	obj types.Object
+	seq int64
+}
+
+// objectHeap implements heap.Interface ordered by less
+type objectHeap struct {
+	items []queuedObject
+	less  func(a, b queuedObject) bool
+}
+
+func (h *objectHeap) Len() int           { return len(h.items) }
+func (h *objectHeap) Less(i, j int) bool { return h.less(h.items[i], h.items[j]) }
+func (h *objectHeap) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *objectHeap) Push(x any)         { h.items = append(h.items, x.(queuedObject)) }
+func (h *objectHeap) Pop() any {
+	n := len(h.items)
+	item := h.items[n-1]
+	h.items[n-1] = queuedObject{}
+	h.items = h.items[:n-1]
+	return item
+}
+
+// downloadQueue is a priority queue of objects to download that is safe for
+// a producer pushing while several workers pop. It holds at most maxDepth
+// objects, so the priority only orders the objects waiting at any one time;
+// a run sorts its files with Sort before pushing them to order them all.
+type downloadQueue struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	notFull  *sync.Cond
+	heap     *objectHeap
+	seq      int64
+	closed   bool
+	maxDepth int
+}
+
+// newDownloadQueue creates a queue ordered according to one of the Priority
+// constants that holds at most maxDepth objects
+func newDownloadQueue(priority string, maxDepth int) (*downloadQueue, error) {
+	less, err := priorityLess(priority)
+	if err != nil {
+		return nil, err
+	}
+	q := &downloadQueue{heap: &objectHeap{less: less}, maxDepth: maxDepth}
+	q.cond = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	return q, nil
+}
+
+// priorityLess returns the ordering for priority. Ties are broken by
+// insertion order so equal objects are downloaded first in, first out.
+func priorityLess(priority string) (func(a, b queuedObject) bool, error) {
+	fifo := func(a, b queuedObject) bool { return a.seq < b.seq }
+	by := func(cmp func(a, b types.Object) int) func(a, b queuedObject) bool {
+		return func(a, b queuedObject) bool {
+			if c := cmp(a.obj, b.obj); c != 0 {
+				return c < 0
+			}
+			return fifo(a, b)
+		}
+	}
+	bySize := func(a, b types.Object) int { return compareInt64(objectSize(a), objectSize(b)) }
+	byModified := func(a, b types.Object) int { return compareInt64(modifiedUnixNano(a), modifiedUnixNano(b)) }
+
+	switch priority {
+	case PrioritySmallestFirst, "":
+		return by(bySize), nil
+	case PriorityLargestFirst:
+		return by(func(a, b types.Object) int { return -bySize(a, b) }), nil
+	case PriorityOldestFirst:
+		return by(byModified), nil
+	case PriorityNewestFirst:
+		return by(func(a, b types.Object) int { return -byModified(a, b) }), nil
+	case PriorityFIFO:
+		return fifo, nil
+	default:
+		return nil, fmt.Errorf("invalid DOWNLOAD_PRIORITY %q", priority)
+	}
+}
+
+// Sort orders files by the priority of the queue, keeping equal files in
+// their order, so that pushing them one by one keeps the priority across the
+// whole run however small maxDepth is
+func (q *downloadQueue) Sort(files []types.Object) {
+	sort.SliceStable(files, func(i, j int) bool {
+		return q.heap.less(queuedObject{obj: files[i]}, queuedObject{obj: files[j]})
+	})
+}
+
+// Push adds an object to the queue, blocking while it is full. It returns
+// false without adding obj once the queue is closed.
+func (q *downloadQueue) Push(obj types.Object) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.heap.Len() >= q.maxDepth && !q.closed {
+		q.notFull.Wait()
+	}
+	if q.closed {
+		return false
+	}
+	heap.Push(q.heap, queuedObject{obj: obj, seq: q.seq})
+	q.seq++
+	metrics.QueueDepth.Set(float64(q.heap.Len()))
+	q.cond.Signal()
+	return true
+}
+
+// Close marks the queue as complete; Pop drains the remaining objects then
+// reports false, and a blocked Push gives up
+func (q *downloadQueue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.notFull.Broadcast()
+}
+
+// Pop blocks until an object is available, returning false once the queue is closed and empty
+func (q *downloadQueue) Pop() (types.Object, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.heap.Len() == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if q.heap.Len() == 0 {
+		return types.Object{}, false
+	}
+	item := heap.Pop(q.heap).(queuedObject)
+	metrics.QueueDepth.Set(float64(q.heap.Len()))
+	q.notFull.Signal()
+	return item.obj, true
+}
+
+// Len returns the number of objects waiting in the queue
+func (q *downloadQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.heap.Len()
+}
+
+// modifiedUnixNano returns the last-modified time of obj, or 0 when unknown
+func modifiedUnixNano(obj types.Object) int64 {
+	if obj.LastModified == nil {
+		return 0
+	}
+	return obj.LastModified.UnixNano()
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,99 @@
+package syncer
+
+import (
+	"container/ring"
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RATE_LIMIT_ALGORITHM values
+const (
+	algorithmTokenBucket   = "token_bucket"
+	algorithmSlidingWindow = "sliding_window"
+)
+
+// limiter paces downloads; Wait blocks until the next one may start
+type limiter interface {
+	Wait(ctx context.Context) error
+}
+
+// newLimiter creates a RATE_LIMIT_ALGORITHM limiter allowing perSec downloads
+// a second. burst only applies to the token bucket; a sliding window never
+// allows more than perSec in any second.
+func newLimiter(algorithm string, perSec, burst int) limiter {
+	if algorithm == algorithmSlidingWindow {
+		return newSlidingWindowLimiter(perSec, time.Second)
+	}
+	return rate.NewLimiter(rate.Limit(perSec), burst)
+}
+
+// slidingWindowLimiter allows at most limit calls in any window. The ring
+// holds the start times of the last limit calls, so the current slot is the
+// oldest of them.
+type slidingWindowLimiter struct {
+	mu     sync.Mutex
+	window time.Duration
+	slots  *ring.Ring
+}
+
+func newSlidingWindowLimiter(limit int, window time.Duration) *slidingWindowLimiter {
+	return &slidingWindowLimiter{window: window, slots: ring.New(max(limit, 1))}
+}
+
+// Wait blocks until fewer than limit calls started within the last window
+func (l *slidingWindowLimiter) Wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		oldest, ok := l.slots.Value.(time.Time)
+		if !ok || now.Sub(oldest) >= l.window {
+			l.slots.Value = now
+			l.slots = l.slots.Next()
+			l.mu.Unlock()
+			return nil
+		}
+		delay := oldest.Add(l.window).Sub(now)
+		l.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// prefixLimiter applies PREFIX_RATE_LIMITS: each configured prefix has its own
+// limiter, and keys under none of them share the global one
+type prefixLimiter struct {
+	global   limiter
+	prefixes map[string]limiter
+}
+
+// newPrefixLimiter builds a limiter per prefix of limits, in downloads per
+// second, using the same algorithm as global
+func newPrefixLimiter(global limiter, algorithm string, limits map[string]int) *prefixLimiter {
+	p := &prefixLimiter{global: global, prefixes: make(map[string]limiter, len(limits))}
+	for prefix, perSec := range limits {
+		p.prefixes[prefix] = newLimiter(algorithm, perSec, perSec)
+	}
+	return p
+}
+
+// limiterFor returns the limiter of the longest prefix matching key, or the
+// global limiter when none does
+func (p *prefixLimiter) limiterFor(key string) limiter {
+	best, bestLen := p.global, -1
+	for prefix, l := range p.prefixes {
+		if strings.HasPrefix(key, prefix) && len(prefix) > bestLen {
+			best, bestLen = l, len(prefix)
+		}
+	}
+	return best
+}
@@ -0,0 +1,155 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"sava-s3-export/internal/aws/awstest"
+)
+
+func TestPrefixLimiterLongestMatch(t *testing.T) {
+	global := newLimiter(algorithmTokenBucket, 1, 1)
+	p := newPrefixLimiter(global, algorithmTokenBucket, map[string]int{
+		"p/archive/":     5,
+		"p/archive/hot/": 50,
+	})
+
+	tests := []struct {
+		key  string
+		want limiter
+	}{
+		{"p/archive/2024/a.csv", p.prefixes["p/archive/"]},
+		{"p/archive/hot/a.csv", p.prefixes["p/archive/hot/"]},
+		{"p/other/a.csv", global},
+	}
+	for _, tt := range tests {
+		if got := p.limiterFor(tt.key); got != tt.want {
+			t.Errorf("limiterFor(%q) is not the limiter of its longest prefix", tt.key)
+		}
+	}
+}
+
+// TestPrefixRateLimits syncs 100 files under two prefixes of
+// PREFIX_RATE_LIMITS and compares the rates at which they are downloaded
+func TestPrefixRateLimits(t *testing.T) {
+	if testing.Short() {
+		t.Skip("takes a second of rate-limited downloads")
+	}
+	const archiveRate, realtimeRate = 10, 40
+
+	fake := awstest.NewFakeS3Client("p/")
+	modified := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	// Twice the rate of each prefix: one second's burst, then one second
+	// at the limit
+	for i := range 2 * archiveRate {
+		fake.AddObject(fmt.Sprintf("p/archive/%03d.csv", i), []byte("a"), modified)
+	}
+	for i := range 2 * realtimeRate {
+		fake.AddObject(fmt.Sprintf("p/realtime/%03d.csv", i), []byte("r"), modified)
+	}
+
+	var (
+		mu   sync.Mutex
+		last = map[string]time.Time{}
+		n    = map[string]int{}
+	)
+	record := func(ctx context.Context, key string, size int64) error {
+		prefix := strings.Split(key, "/")[1]
+		mu.Lock()
+		defer mu.Unlock()
+		n[prefix]++
+		last[prefix] = time.Now()
+		return nil
+	}
+	cfg := newTestConfig(t, map[string]string{
+		"MAX_WORKERS":        "20",
+		"PREFIX_RATE_LIMITS": fmt.Sprintf("p/archive/=%d,p/realtime/=%d", archiveRate, realtimeRate),
+	})
+	s := newTestSyncer(t, cfg, fake, WithPreDownloadHook(record))
+
+	start := time.Now()
+	result, err := s.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if result.FilesDownloaded != 100 {
+		t.Fatalf("downloaded %d files, want 100", result.FilesDownloaded)
+	}
+
+	rate := func(prefix string) float64 {
+		return float64(n[prefix]) / last[prefix].Sub(start).Seconds()
+	}
+	ratio := rate("realtime") / rate("archive")
+	if want := float64(realtimeRate) / archiveRate; ratio < want*0.75 || ratio > want*1.25 {
+		t.Errorf("realtime/ was downloaded %.1f times as fast as archive/, want %.1f (%.1f and %.1f files/s)",
+			ratio, want, rate("realtime"), rate("archive"))
+	}
+}
+
+// BenchmarkLimiterAccuracy compares how closely each RATE_LIMIT_ALGORITHM
+// holds its limit with 8 goroutines calling a fresh limiter as fast as
+// allowed: the most calls let through in any one second, and the mean rate
+// over the run. The token bucket starts with a full burst on top of its
+// rate; the sliding window never exceeds its limit.
+func BenchmarkLimiterAccuracy(b *testing.B) {
+	const perSec = 100
+	const run = 2500 * time.Millisecond
+
+	for _, algorithm := range []string{algorithmTokenBucket, algorithmSlidingWindow} {
+		b.Run(algorithm, func(b *testing.B) {
+			var peak, calls int
+			for range b.N {
+				times := limitedCalls(newLimiter(algorithm, perSec, perSec), 8, run)
+				peak = max(peak, maxInWindow(times, time.Second))
+				calls += len(times)
+			}
+			b.ReportMetric(float64(peak), "max/s")
+			b.ReportMetric(float64(calls)/float64(b.N)/run.Seconds(), "calls/s")
+		})
+	}
+}
+
+// limitedCalls calls l.Wait from workers goroutines for d and returns the
+// times of the calls it allowed, in order
+func limitedCalls(l limiter, workers int, d time.Duration) []time.Time {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		times []time.Time
+	)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for l.Wait(ctx) == nil && ctx.Err() == nil {
+				mu.Lock()
+				times = append(times, time.Now())
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	slices.SortFunc(times, time.Time.Compare)
+	return times
+}
+
+// maxInWindow returns the most of the sorted times within any window
+// [t, t+window)
+func maxInWindow(times []time.Time, window time.Duration) int {
+	best, first := 0, 0
+	for i, t := range times {
+		for t.Sub(times[first]) >= window {
+			first++
+		}
+		best = max(best, i-first+1)
+	}
+	return best
+}
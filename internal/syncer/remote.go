@@ -0,0 +1,71 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// States of a RemoteFile relative to the sync database
+const (
+	RemoteInDB        = "in-db"
+	RemoteNotInDB     = "not-in-db"
+	RemoteETagChanged = "etag-changed"
+)
+
+// RemoteFile is an object in S3 and how it compares with the sync database
+type RemoteFile struct {
+	S3Key        string    `json:"s3_key"`
+	SizeBytes    int64     `json:"size_bytes"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"last_modified"`
+	State        string    `json:"state"`
+	// SyncStatus is the status of the database record, if there is one
+	SyncStatus string `json:"sync_status,omitempty"`
+}
+
+// ListRemote lists the objects a sync would consider, across every target,
+// without downloading anything. MODIFIED_AFTER is applied as in a sync.
+func (s *Syncer) ListRemote(ctx context.Context) ([]RemoteFile, error) {
+	if len(s.targets) > 0 {
+		all := []RemoteFile{}
+		for _, t := range s.targets {
+			files, err := t.ListRemote(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("target %s: %w", t.cfg.S3_PREFIX, err)
+			}
+			all = append(all, files...)
+		}
+		return all, nil
+	}
+
+	s3Files, err := s.listFiles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list S3 files: %w", err)
+	}
+	s3Files = s.modifiedAfter(s3Files)
+	records, err := s.readRecords(ctx, s3Files)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read local database: %w", err)
+	}
+
+	remote := make([]RemoteFile, 0, len(s3Files))
+	for _, f := range s3Files {
+		file := RemoteFile{
+			S3Key:        *f.Key,
+			SizeBytes:    objectSize(f),
+			ETag:         *f.ETag,
+			LastModified: *f.LastModified,
+			State:        RemoteNotInDB,
+		}
+		if record, ok := records[file.S3Key]; ok {
+			file.State = RemoteInDB
+			if record.ETag != file.ETag {
+				file.State = RemoteETagChanged
+			}
+			file.SyncStatus = record.SyncStatus
+		}
+		remote = append(remote, file)
+	}
+	return remote, nil
+}
@@ -0,0 +1,56 @@
+package syncer
+
+import (
+	"context"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"sava-s3-export/internal/database"
+)
+
+// replicated returns the files whose replication to another bucket is not
+// pending, checking each with a HeadObject call when
+// REQUIRE_REPLICATION_COMPLETE is enabled. Files whose replication failed are
+// recorded as "replication_failed" and checked again on the next run, as are
+// pending files and those whose status could not be read. A file already in
+// localRecords keeps the rest of its record, including the local path of the
+// copy downloaded before.
+func (s *Syncer) replicated(ctx context.Context, files []types.Object, localRecords map[string]database.FileRecord) []types.Object {
+	if !s.cfg.REQUIRE_REPLICATION_COMPLETE {
+		return files
+	}
+
+	ready := files[:0]
+	pending := 0
+	for _, file := range files {
+		key := *file.Key
+		status, err := s.s3Client.GetReplicationStatus(ctx, key)
+		if err != nil {
+			log.Printf("Skipping %s until its replication status can be read: %v", key, err)
+			continue
+		}
+		switch types.ReplicationStatus(status) {
+		case types.ReplicationStatusPending:
+			pending++
+		case types.ReplicationStatusFailed:
+			log.Printf("Warning: replication of %s failed, not downloading it", key)
+			var err error
+			if record, ok := localRecords[key]; ok {
+				record.SyncStatus = "replication_failed"
+				err = s.db.BatchTouch(record)
+			} else {
+				err = s.db.BatchUpdate(key, *file.ETag, "", "replication_failed", *file.LastModified)
+			}
+			if err != nil {
+				log.Printf("Failed to record %s: %v", key, err)
+			}
+		default:
+			ready = append(ready, file)
+		}
+	}
+	if pending > 0 {
+		log.Printf("Skipping %d files until their replication completes", pending)
+	}
+	return ready
+}
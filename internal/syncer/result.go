@@ -0,0 +1,81 @@
+package syncer
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"sava-s3-export/internal/notification"
+)
+
+// SyncResult is the outcome of one sync cycle, as reported to the notifiers.
+// It is JSON-serialisable so it can be written out or returned over the API
+// as is.
+type SyncResult = notification.SyncResult
+
+// newSyncResult summarises the cycle started at start from the progress
+// tracker, with err as the error that ended it
+func (s *Syncer) newSyncResult(runID string, start time.Time, err error) *SyncResult {
+	result := &SyncResult{
+		RunID:     runID,
+		StartTime: start,
+		Duration:  time.Since(start),
+		Errors:    []string{},
+	}
+	result.FilesDownloaded, result.FilesFailed, result.BytesDownloaded = s.progress.Totals()
+	result.FilesSkipped = s.progress.Skipped()
+	result.APICalls = s.apiCalls()
+	if err != nil {
+		result.Errors = append(result.Errors, err.Error())
+	}
+	for _, fileErr := range s.progress.Errors() {
+		if len(result.Errors) == notification.MaxResultErrors {
+			break
+		}
+		result.Errors = append(result.Errors, fileErr)
+	}
+	if result.FilesFailed > 0 && s.deadLetters != nil {
+		result.ErrorReport = s.cfg.DEAD_LETTER_PATH
+	}
+	return result
+}
+
+// writeResult writes result as JSON to RESULT_FILE_PATH, replacing the file
+// of the previous cycle atomically so readers never see a partial result.
+// Failures are only logged.
+func (s *Syncer) writeResult(result *SyncResult) {
+	path := s.cfg.RESULT_FILE_PATH
+	if path == "" {
+		return
+	}
+	if err := writeResultFile(path, result); err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+func writeResultFile(path string, result *SyncResult) error {
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode sync result: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".result-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary result file for %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write result file %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write result file %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to move result file to %s: %w", path, err)
+	}
+	return nil
+}
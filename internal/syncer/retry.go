@@ -0,0 +1,145 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"sava-s3-export/internal/aws"
+	"sava-s3-export/internal/database"
+)
+
+// retryBaseDelay is the delay before the first retry; it doubles on each further attempt
+const retryBaseDelay = 500 * time.Millisecond
+
+// errDownloadTimeout marks a download abandoned after DOWNLOAD_TIMEOUT_SECONDS
+var errDownloadTimeout = errors.New("download timed out")
+
+// downloadWithRetry downloads file, retrying up to MAX_RETRIES times with
+// exponential backoff. It returns the number of attempts made. An attempt
+// that exceeds DOWNLOAD_TIMEOUT_SECONDS is not retried, since a hung
+// transfer is likely to hang again.
+func (s *Syncer) downloadWithRetry(ctx context.Context, file types.Object, localPath string) (int, error) {
+	key := *file.Key
+	attempts := 0
+	for {
+		attempts++
+		err := s.downloadOnce(ctx, file, localPath)
+		if err == nil || ctx.Err() != nil || errors.Is(err, errDownloadTimeout) || errors.Is(err, aws.ErrCircuitOpen) || attempts > s.cfg.MAX_RETRIES {
+			return attempts, err
+		}
+
+		delay := retryBaseDelay << (attempts - 1)
+		log.Printf("Download of %s failed (attempt %d of %d), retrying in %v: %v",
+			key, attempts, s.cfg.MAX_RETRIES+1, delay, err)
+		select {
+		case <-ctx.Done():
+			return attempts, err
+		case <-time.After(delay):
+		}
+		// Retries count against S3 like new files, so they wait out a throttle pause too
+		if s.throttle.Wait(ctx) != nil {
+			return attempts, err
+		}
+	}
+}
+
+// downloadOnce makes a single download attempt bounded by DOWNLOAD_TIMEOUT_SECONDS
+func (s *Syncer) downloadOnce(ctx context.Context, file types.Object, localPath string) error {
+	fetch := s.fetch
+	if s.streaming() {
+		fetch = func(ctx context.Context, file types.Object, _ string) error {
+			return s.streamToCommand(ctx, *file.Key)
+		}
+	}
+	if s.cfg.DOWNLOAD_TIMEOUT_SECONDS <= 0 {
+		err := fetch(ctx, file, localPath)
+		s.throttle.Observe(err)
+		return err
+	}
+
+	timeout := s.cfg.DOWNLOAD_TIMEOUT_SECONDS
+	attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := fetch(attemptCtx, file, localPath)
+	s.throttle.Observe(err)
+	if err != nil && ctx.Err() == nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %v: %w", errDownloadTimeout, timeout, err)
+	}
+	return err
+}
+
+// listFiles lists the S3 prefix, or reads it from the S3 Inventory report
+// with USE_INVENTORY, bounded by LIST_TIMEOUT_SECONDS when set
+func (s *Syncer) listFiles(ctx context.Context) ([]types.Object, error) {
+	list := s.s3Client.ListFiles
+	if s.cfg.USE_INVENTORY {
+		list = func(ctx context.Context) ([]types.Object, error) {
+			return s.s3Client.ListFromInventory(ctx, s.cfg.INVENTORY_MANIFEST_KEY)
+		}
+	}
+
+	if s.cfg.LIST_TIMEOUT_SECONDS <= 0 {
+		return list(ctx)
+	}
+
+	timeout := s.cfg.LIST_TIMEOUT_SECONDS
+	listCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	files, err := list(listCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(listCtx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("listing timed out after %v: %w", timeout, err)
+	}
+	return files, err
+}
+
+// RetryAllFailed resets every "failed" record to the empty status, so the
+// next sync downloads it again, and returns how many were reset. Reset
+// records are no longer "failed", so calling it again does nothing.
+func (s *Syncer) RetryAllFailed(ctx context.Context) (int, error) {
+	return s.retryFailed(ctx, func(string) bool { return true })
+}
+
+// RetryByPattern behaves like RetryAllFailed but only resets records whose
+// S3 key matches the glob pattern, with the syntax of path.Match
+func (s *Syncer) RetryByPattern(ctx context.Context, pattern string) (int, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return 0, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	return s.retryFailed(ctx, func(key string) bool {
+		matched, _ := path.Match(pattern, key)
+		return matched
+	})
+}
+
+func (s *Syncer) retryFailed(ctx context.Context, match func(key string) bool) (int, error) {
+	var failed []database.FileRecord
+	err := s.db.ScanRecords(ctx, func(r database.FileRecord) error {
+		if r.SyncStatus == "failed" && match(r.S3Key) {
+			failed = append(failed, r)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read local database: %w", err)
+	}
+
+	for _, r := range failed {
+		if err := s.db.BatchUpdate(r.S3Key, r.ETag, r.LocalPath, "", time.Unix(r.LastModified, 0)); err != nil {
+			return 0, fmt.Errorf("failed to reset %s: %w", r.S3Key, err)
+		}
+	}
+	if err := s.db.FlushBatch(); err != nil {
+		return 0, fmt.Errorf("failed to flush reset records: %w", err)
+	}
+
+	log.Printf("Reset %d failed files for retry", len(failed))
+	return len(failed), nil
+}
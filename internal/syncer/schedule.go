@@ -0,0 +1,43 @@
+package syncer
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"sava-s3-export/internal/config"
+)
+
+// runScheduled runs a sync cycle immediately and then at every time matched
+// by CRON_EXPRESSION until ctx is cancelled. A cycle that overruns one or
+// more trigger times is followed by the next trigger after it finishes.
+func (s *Syncer) runScheduled(ctx context.Context) error {
+	schedule, err := config.ParseCronExpression(s.cfg.CRON_EXPRESSION)
+	if err != nil {
+		return err
+	}
+	log.Printf("Cron schedule enabled: %s", s.cfg.CRON_EXPRESSION)
+
+	for {
+		if err := s.runCycle(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			log.Printf("Sync cycle failed: %v", err)
+		}
+
+		next := schedule.Next(time.Now())
+		log.Printf("Next sync scheduled at %s", next.Format(time.RFC3339))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-s.stopping:
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+	}
+}
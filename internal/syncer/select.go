@@ -0,0 +1,63 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"sava-s3-export/internal/aws"
+)
+
+// fetch writes file to localPath: the S3 Select result of
+// S3_SELECT_EXPRESSION when one is configured, otherwise the whole object
+func (s *Syncer) fetch(ctx context.Context, file types.Object, localPath string) error {
+	if s.cfg.S3_SELECT_EXPRESSION == "" {
+		return s.s3Client.DownloadFile(ctx, file, localPath)
+	}
+	return s.selectToFile(ctx, *file.Key, localPath)
+}
+
+// selectToFile streams the S3 Select result for key into localPath. The
+// result is written to a file in the staging directory and only moved to
+// localPath once complete, so a query that fails midway never leaves a
+// partial result there. The file holds the query result rather than the
+// object, so its checksum never matches the ETag; the ETag is still recorded
+// to detect source changes.
+func (s *Syncer) selectToFile(ctx context.Context, key, localPath string) error {
+	inputFormat := s.cfg.S3_SELECT_INPUT_FORMAT
+	result, err := s.s3Client.SelectQuery(ctx, key, s.cfg.S3_SELECT_EXPRESSION, inputFormat, aws.SelectOutputFormat(inputFormat))
+	if err != nil {
+		return err
+	}
+	defer result.Close()
+
+	dir := s.cfg.StagingDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create staging directory %s: %w", dir, err)
+	}
+	file, err := os.CreateTemp(dir, "."+filepath.Base(localPath)+".select.*")
+	if err != nil {
+		return fmt.Errorf("failed to create staging file for %s: %w", localPath, err)
+	}
+	staged := file.Name()
+
+	n, err := io.Copy(file, result)
+	if cerr := file.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("failed to write %s: %w", staged, cerr)
+	}
+	if err != nil {
+		os.Remove(staged)
+		return err
+	}
+	if err := s.promote(staged, localPath); err != nil {
+		return err
+	}
+
+	log.Printf("Successfully selected %d bytes from %s to %s", n, key, localPath)
+	return nil
+}
@@ -0,0 +1,81 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sava-s3-export/internal/aws"
+	"sava-s3-export/internal/aws/awstest"
+)
+
+// selectClient is an S3 client whose S3 Select results are result,
+// followed by err when set
+type selectClient struct {
+	aws.S3ClientInterface
+	result string
+	err    error
+}
+
+func (c selectClient) SelectQuery(ctx context.Context, key, expression, inputFormat, outputFormat string) (io.ReadCloser, error) {
+	r := io.Reader(strings.NewReader(c.result))
+	if c.err != nil {
+		r = io.MultiReader(r, &failingReader{c.err})
+	}
+	return io.NopCloser(r), nil
+}
+
+// failingReader fails every Read with err
+type failingReader struct{ err error }
+
+func (r *failingReader) Read([]byte) (int, error) { return 0, r.err }
+
+func TestSelectToFile(t *testing.T) {
+	errStream := errors.New("stream reset")
+	tests := []struct {
+		name   string
+		client selectClient
+		want   string
+	}{
+		{"complete result", selectClient{result: "a,b\n1,2\n"}, "a,b\n1,2\n"},
+		// The earlier download is kept rather than replaced by part of the result
+		{"failed midway", selectClient{result: "a,b\n", err: errStream}, "old"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t, map[string]string{
+				"S3_SELECT_EXPRESSION":   "SELECT a, b FROM S3Object",
+				"S3_SELECT_INPUT_FORMAT": "CSV",
+			})
+			tt.client.S3ClientInterface = awstest.NewFakeS3Client("p/")
+			s, err := NewSyncerWithClient(cfg, tt.client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			localPath := filepath.Join(cfg.LOCAL_DIR, "data.csv")
+			if err := os.MkdirAll(cfg.LOCAL_DIR, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(localPath, []byte("old"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			err = s.selectToFile(context.Background(), "p/data.csv", localPath)
+			if !errors.Is(err, tt.client.err) {
+				t.Errorf("selectToFile: %v, want %v", err, tt.client.err)
+			}
+			if got, err := os.ReadFile(localPath); err != nil || string(got) != tt.want {
+				t.Errorf("%s holds %q (%v), want %q", localPath, got, err, tt.want)
+			}
+			if left, _ := os.ReadDir(cfg.StagingDir()); len(left) != 0 {
+				t.Errorf("staging directory holds %d files, want none", len(left))
+			}
+		})
+	}
+}
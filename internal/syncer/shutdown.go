@@ -0,0 +1,119 @@
+package syncer
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// inFlightTracker records the downloads currently in progress and refuses new
+// ones once shutdown has begun
+type inFlightTracker struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	keys     map[string]int
+	count    int
+	stopping bool
+}
+
+func newInFlightTracker() *inFlightTracker {
+	t := &inFlightTracker{keys: make(map[string]int)}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+// begin registers a download of key, returning false if the syncer is shutting down
+func (t *inFlightTracker) begin(key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopping {
+		return false
+	}
+	t.keys[key]++
+	t.count++
+	return true
+}
+
+// end marks a download started with begin as finished
+func (t *inFlightTracker) end(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.keys[key]--; t.keys[key] == 0 {
+		delete(t.keys, key)
+	}
+	t.count--
+	if t.count == 0 {
+		t.cond.Broadcast()
+	}
+}
+
+// stop prevents any further downloads from starting
+func (t *inFlightTracker) stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stopping = true
+}
+
+// isStopping reports whether stop has been called
+func (t *inFlightTracker) isStopping() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stopping
+}
+
+// wait blocks until no downloads are in flight or timeout elapses, reporting
+// whether everything finished
+func (t *inFlightTracker) wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		t.mu.Lock()
+		for t.count > 0 {
+			t.cond.Wait()
+		}
+		t.mu.Unlock()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// inFlightKeys returns the keys currently being downloaded, sorted
+func (t *inFlightTracker) inFlightKeys() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	keys := make([]string, 0, len(t.keys))
+	for key := range t.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Drain stops the syncer from starting new downloads or sync cycles and waits
+// up to SHUTDOWN_DRAIN_TIMEOUT_SECONDS for in-flight downloads to finish. It
+// returns false if the timeout elapsed first, after logging every key still
+// in flight; the caller should then cancel the context passed to Run.
+func (s *Syncer) Drain() bool {
+	s.inFlight.stop()
+	s.stopOnce.Do(func() { close(s.stopping) })
+
+	timeout := s.cfg.SHUTDOWN_DRAIN_TIMEOUT_SECONDS
+	log.Printf("Draining in-flight downloads for up to %v...", timeout)
+	if s.inFlight.wait(timeout) {
+		log.Println("All in-flight downloads completed.")
+		return true
+	}
+
+	keys := s.inFlight.inFlightKeys()
+	log.Printf("Drain timeout reached with %d downloads still in flight", len(keys))
+	for _, key := range keys {
+		log.Printf("Cancelling in-flight download of %s; re-check this file", key)
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package syncer
+
+import (
+	"context"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"sava-s3-export/internal/database"
+)
+
+// modifiedAfter returns the files last modified after MODIFIED_AFTER, or all
+// of them when it is unset
+func (s *Syncer) modifiedAfter(files []types.Object) []types.Object {
+	if s.cfg.MODIFIED_AFTER.IsZero() {
+		return files
+	}
+	var recent []types.Object
+	for _, f := range files {
+		if f.LastModified != nil && f.LastModified.After(s.cfg.MODIFIED_AFTER) {
+			recent = append(recent, f)
+		}
+	}
+	return recent
+}
+
+// readRecords returns the database records needed to decide which of files
+// to download. With MODIFIED_AFTER only the records of those files are kept,
+// so a sync of the last day's changes does not hold the whole database in
+// memory, and a database of LAZY_LOAD_THRESHOLD_RECORDS or more is looked up
+// lazily, see lookupRecords; deduplication still needs every record to find
+// existing content, unless it is kept in HASH_INDEX_PATH.
+func (s *Syncer) readRecords(ctx context.Context, files []types.Object) (map[string]database.FileRecord, error) {
+	if s.dedup != nil && s.dedup.path == "" {
+		return s.db.ReadAllRecords(ctx)
+	}
+	if lazy, err := s.lazyLoad(); err != nil {
+		return nil, err
+	} else if lazy {
+		return s.lookupRecords(ctx, files)
+	}
+	if s.cfg.MODIFIED_AFTER.IsZero() {
+		return s.db.ReadAllRecords(ctx)
+	}
+
+	wanted := make(map[string]bool, len(files))
+	for _, f := range files {
+		wanted[*f.Key] = true
+	}
+	records := make(map[string]database.FileRecord, len(files))
+	err := s.db.ScanRecords(ctx, func(r database.FileRecord) error {
+		if wanted[r.S3Key] {
+			records[r.S3Key] = r
+		}
+		return nil
+	})
+	return records, err
+}
+
+// lazyLoad reports whether the database has LAZY_LOAD_THRESHOLD_RECORDS or
+// more records, too many to copy into memory for the comparison
+func (s *Syncer) lazyLoad() (bool, error) {
+	if s.cfg.PARTITION_BY_DATE {
+		return false, nil
+	}
+	n, err := s.db.CountRecords()
+	if err != nil {
+		return false, err
+	}
+	return n >= int64(s.cfg.LAZY_LOAD_THRESHOLD_RECORDS), nil
+}
+
+// lookupRecords returns the records of files, comparing them first with the
+// ETag and sync status read from the database without the other columns.
+// Only the records of files changeFilter may download are then looked up in
+// full; the others get a record of their key, ETag and status alone, which
+// is all their comparison needs.
+func (s *Syncer) lookupRecords(ctx context.Context, files []types.Object) (map[string]database.FileRecord, error) {
+	summaries, err := s.db.ReadSummaries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make(map[string]database.FileRecord)
+	var changed []string
+	for _, f := range files {
+		summary, ok := summaries[*f.Key]
+		if !ok {
+			continue
+		}
+		if s.isForced(*f.Key) || summary.ETag != *f.ETag || retryStatuses[summary.SyncStatus] || summary.SyncStatus == statusMetadataOnly {
+			changed = append(changed, *f.Key)
+			continue
+		}
+		records[*f.Key] = database.FileRecord{S3Key: *f.Key, ETag: summary.ETag, SyncStatus: summary.SyncStatus}
+	}
+
+	if err := s.db.PrefetchRecords(ctx, changed); err != nil {
+		return nil, err
+	}
+	for _, key := range changed {
+		record, ok, err := s.db.LookupRecord(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			records[key] = record
+		}
+	}
+	log.Printf("Looked up %d of %d records in full", len(changed), len(summaries))
+	return records, nil
+}
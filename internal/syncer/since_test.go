@@ -0,0 +1,113 @@
+package syncer
+
+import (
+	"context"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"sava-s3-export/internal/aws/awstest"
+	"sava-s3-export/internal/database"
+)
+
+// TestLookupRecordsMatchesFullRead checks that a database past
+// LAZY_LOAD_THRESHOLD_RECORDS downloads the same files as a smaller one read
+// into memory in full
+func TestLookupRecordsMatchesFullRead(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	keys := []string{"p/unchanged.csv", "p/changed.csv", "p/pending.csv", "p/forced.csv", "p/new.csv"}
+
+	for _, tt := range []struct {
+		name      string
+		threshold string
+		lazy      bool
+	}{
+		{name: "below threshold", threshold: "100"},
+		{name: "past threshold", threshold: "4", lazy: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := awstest.NewFakeS3Client("p/")
+			for _, key := range keys {
+				fake.AddObject(key, []byte(key), modified)
+			}
+			cfg := newTestConfig(t, map[string]string{
+				"LAZY_LOAD_THRESHOLD_RECORDS": tt.threshold,
+				"FORCE_KEYS":                  "p/forced.csv",
+			})
+			s := newTestSyncer(t, cfg, fake)
+
+			ctx := context.Background()
+			files, err := fake.ListFiles(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			etags := make(map[string]string)
+			for _, f := range files {
+				etags[*f.Key] = *f.ETag
+			}
+			record := func(key, etag, status string) database.FileRecord {
+				return database.FileRecord{S3Key: key, ETag: etag, SyncStatus: status, LocalPath: "/data/" + key, LastModified: modified.Unix()}
+			}
+			err = s.db.WriteRecords([]database.FileRecord{
+				record("p/unchanged.csv", etags["p/unchanged.csv"], "downloaded"),
+				record("p/changed.csv", `"stale"`, "downloaded"),
+				record("p/pending.csv", etags["p/pending.csv"], "pending"),
+				record("p/forced.csv", etags["p/forced.csv"], "downloaded"),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// As in a new process, nothing has been read from the file yet
+			s.db.InvalidateCache()
+
+			download := func() []string {
+				t.Helper()
+				records, err := s.readRecords(ctx, files)
+				if err != nil {
+					t.Fatalf("readRecords: %v", err)
+				}
+				// Only changed records are read in full when looked up lazily
+				if got := records["p/unchanged.csv"].LocalPath == ""; got != tt.lazy {
+					t.Errorf("unchanged record read lazily: %v, want %v", got, tt.lazy)
+				}
+				if got := records["p/changed.csv"].LocalPath; got == "" {
+					t.Error("changed record was not read in full")
+				}
+				var got []string
+				for _, f := range s.getFilesToDownload(ctx, files, records) {
+					got = append(got, *f.Key)
+				}
+				slices.Sort(got)
+				return got
+			}
+
+			want := []string{"p/changed.csv", "p/forced.csv", "p/new.csv", "p/pending.csv"}
+			if got := download(); !slices.Equal(got, want) {
+				t.Errorf("getFilesToDownload = %v, want %v", got, want)
+			}
+
+			// Another process records the pending file as downloaded
+			other, err := database.NewParquetDB(cfg.DB_PATH, cfg.BATCH_SIZE)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := other.BatchUpdate("p/pending.csv", etags["p/pending.csv"], "/data/p/pending.csv", "downloaded", modified); err != nil {
+				t.Fatal(err)
+			}
+			if err := other.FlushBatch(); err != nil {
+				t.Fatal(err)
+			}
+			// Make sure the mtime moves even on filesystems with coarse timestamps
+			later := time.Now().Add(time.Minute)
+			if err := os.Chtimes(cfg.DB_PATH, later, later); err != nil {
+				t.Fatal(err)
+			}
+
+			want = []string{"p/changed.csv", "p/forced.csv", "p/new.csv"}
+			if got := download(); !slices.Equal(got, want) {
+				t.Errorf("getFilesToDownload = %v after the database changed, want %v", got, want)
+			}
+		})
+	}
+}
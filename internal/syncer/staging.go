@@ -0,0 +1,147 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// stagingPath returns where the download of key is written before it is
+// moved into place: the key below the staging directory. Unlike the local
+// path it does not depend on LOCAL_DIR or STORAGE_CLASS_DIRS, so every key
+// has its own staging file inside the staging directory. Rooting the key
+// first keeps ".." segments from leaving it.
+func (s *Syncer) stagingPath(key string) string {
+	rel := filepath.Clean(string(filepath.Separator) + filepath.FromSlash(key))
+	return filepath.Join(s.cfg.StagingDir(), rel)
+}
+
+// downloadStaged downloads file into the staging directory with retries and
+// moves it to localPath once complete. The record is "staging" until then.
+// Objects streamed to POST_PROCESSOR_CMD have no file to stage.
+func (s *Syncer) downloadStaged(ctx context.Context, file types.Object, localPath string) (int, error) {
+	if s.streaming() {
+		return s.downloadWithRetry(ctx, file, localPath)
+	}
+
+	staged := s.stagingPath(*file.Key)
+	s.db.BatchUpdate(*file.Key, *file.ETag, staged, "staging", *file.LastModified)
+	attempts, err := s.downloadWithRetry(ctx, file, staged)
+	if err != nil {
+		os.Remove(staged)
+		return attempts, err
+	}
+	return attempts, s.promote(staged, localPath)
+}
+
+// fetchStaged fetches key into the staging directory and moves it to
+// localPath once complete, so that LOCAL_DIR never holds a partial file.
+// The object may have changed since it was recorded, so only its key is
+// passed on and the rest is looked up again.
+func (s *Syncer) fetchStaged(ctx context.Context, key, localPath string) error {
+	staged := s.stagingPath(key)
+	if err := s.fetch(ctx, types.Object{Key: &key}, staged); err != nil {
+		os.Remove(staged)
+		return err
+	}
+	return s.promote(staged, localPath)
+}
+
+// promote moves a completed download from staging to localPath, copying it
+// when the two are on different filesystems
+func (s *Syncer) promote(staged, localPath string) error {
+	dir := filepath.Dir(localPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		os.Remove(staged)
+		return fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+
+	err := os.Rename(staged, localPath)
+	if errors.Is(err, syscall.EXDEV) {
+		err = moveAcrossDevices(staged, localPath)
+	}
+	if err != nil {
+		os.Remove(staged)
+		return fmt.Errorf("failed to move %s to %s: %w", staged, localPath, err)
+	}
+	return nil
+}
+
+// moveAcrossDevices copies src next to dst and renames it into place, so a
+// reader of dst still never sees a partial file, then removes src
+func moveAcrossDevices(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	in.Close()
+	return os.Remove(src)
+}
+
+// cleanStaging removes files left in the staging directory by a run that
+// crashed, once they are older than STAGING_TTL; younger files may belong to
+// a run still in progress. Failures are only logged.
+func (s *Syncer) cleanStaging() {
+	if s.cfg.STAGING_TTL <= 0 {
+		return
+	}
+	dir := s.cfg.StagingDir()
+	cutoff := time.Now().Add(-s.cfg.STAGING_TTL)
+
+	removed := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			log.Printf("Failed to remove stale staging file %s: %v", path, err)
+			return nil
+		}
+		removed++
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to clean staging directory %s: %v", dir, err)
+	}
+	if removed > 0 {
+		log.Printf("Removed %d stale files from staging directory %s", removed, dir)
+	}
+}
@@ -0,0 +1,79 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"sava-s3-export/internal/database"
+	"sava-s3-export/internal/metrics"
+)
+
+// StatusReport summarises the contents of the sync database
+type StatusReport struct {
+	TotalRecords   int64            `json:"total_records"`
+	ByStatus       map[string]int64 `json:"by_status"`
+	LastSyncTime   time.Time        `json:"last_sync_time"`
+	MissingLocal   int64            `json:"missing_local_files"`
+	OldestSyncedAt time.Time        `json:"oldest_synced_at"`
+	NewestSyncedAt time.Time        `json:"newest_synced_at"`
+	TotalBytes     int64            `json:"total_bytes"`
+	Database       database.DBStats `json:"database"`
+}
+
+// Status computes a StatusReport in a single streaming pass over the database.
+// LastSyncTime is the most recent successful download; MissingLocal and
+// TotalBytes only consider downloaded records, since failed downloads are not
+// expected to have a file on disk.
+func (s *Syncer) Status(ctx context.Context) (StatusReport, error) {
+	report := StatusReport{ByStatus: make(map[string]int64)}
+
+	var oldest, newest, lastSync int64
+	err := s.db.ScanRecords(ctx, func(r database.FileRecord) error {
+		report.TotalRecords++
+		report.ByStatus[r.SyncStatus]++
+		report.Database.TotalTrackedBytes += r.FileSizeBytes
+
+		if oldest == 0 || r.LastSyncedAt < oldest {
+			oldest = r.LastSyncedAt
+		}
+		if r.LastSyncedAt > newest {
+			newest = r.LastSyncedAt
+		}
+
+		if r.SyncStatus != "downloaded" {
+			return nil
+		}
+		if r.LastSyncedAt > lastSync {
+			lastSync = r.LastSyncedAt
+		}
+		if info, err := os.Stat(r.LocalPath); err != nil {
+			report.MissingLocal++
+		} else {
+			report.TotalBytes += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return StatusReport{}, fmt.Errorf("failed to scan database: %w", err)
+	}
+
+	if report.TotalRecords > 0 {
+		report.OldestSyncedAt = time.Unix(oldest, 0)
+		report.NewestSyncedAt = time.Unix(newest, 0)
+	}
+	if lastSync > 0 {
+		report.LastSyncTime = time.Unix(lastSync, 0)
+	}
+
+	report.Database.TotalRecords = report.TotalRecords
+	report.Database.ByStatus = report.ByStatus
+	report.Database.OldestRecord = report.OldestSyncedAt
+	report.Database.NewestRecord = report.NewestSyncedAt
+	if report.Database.FileSizeBytes, err = s.db.DiskUsage(); err != nil {
+		return StatusReport{}, fmt.Errorf("failed to measure database size: %w", err)
+	}
+	metrics.SetRecordsByStatus(report.ByStatus)
+	return report, nil
+}
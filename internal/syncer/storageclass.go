@@ -0,0 +1,74 @@
+package syncer
+
+import (
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"sava-s3-export/internal/database"
+)
+
+// statusMetadataOnly marks a record of an object whose storage class is
+// mapped to no directory by STORAGE_CLASS_DIRS, so it is tracked but never
+// downloaded. It is revisited when the ETag changes or the storage class is
+// mapped to a directory.
+const statusMetadataOnly = "metadata_only"
+
+// storageClassDir returns the directory STORAGE_CLASS_DIRS routes file to,
+// LOCAL_DIR for unmapped storage classes. It reports false for classes
+// mapped to an empty directory, whose objects are not downloaded.
+func (s *Syncer) storageClassDir(file types.Object) (string, bool) {
+	class := file.StorageClass
+	if class == "" {
+		// Listings from an inventory may leave out the storage class
+		class = types.ObjectStorageClassStandard
+	}
+	dir, ok := s.cfg.STORAGE_CLASS_DIRS[string(class)]
+	if !ok {
+		return s.cfg.LOCAL_DIR, true
+	}
+	return dir, dir != ""
+}
+
+// objectPath returns the local destination of file under the directory of
+// its storage class
+func (s *Syncer) objectPath(file types.Object) string {
+	dir, _ := s.storageClassDir(file)
+	return s.localPathIn(dir, *file.Key, *file.LastModified)
+}
+
+// nowDownloaded reports whether file was recorded as metadata-only but its
+// storage class has since been mapped to a directory
+func (s *Syncer) nowDownloaded(file types.Object, record database.FileRecord) bool {
+	if record.SyncStatus != statusMetadataOnly {
+		return false
+	}
+	_, download := s.storageClassDir(file)
+	return download
+}
+
+// recordMetadataOnly records the files of storage classes mapped to an empty
+// directory as "metadata_only" and returns the others, which are downloaded
+func (s *Syncer) recordMetadataOnly(files []types.Object) []types.Object {
+	if len(s.cfg.STORAGE_CLASS_DIRS) == 0 {
+		return files
+	}
+
+	toDownload := files[:0]
+	recorded := 0
+	for _, file := range files {
+		if _, download := s.storageClassDir(file); download {
+			toDownload = append(toDownload, file)
+			continue
+		}
+		if err := s.db.BatchUpdate(*file.Key, *file.ETag, "", statusMetadataOnly, *file.LastModified); err != nil {
+			log.Printf("Failed to record %s: %v", *file.Key, err)
+			continue
+		}
+		recorded++
+	}
+	if recorded > 0 {
+		log.Printf("Recorded %d files of metadata-only storage classes without downloading them", recorded)
+	}
+	return toDownload
+}
@@ -0,0 +1,49 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// streaming reports whether objects are piped to POST_PROCESSOR_CMD instead
+// of being written to LOCAL_DIR
+func (s *Syncer) streaming() bool {
+	return s.cfg.POST_PROCESSOR_CMD != ""
+}
+
+// streamToCommand runs POST_PROCESSOR_CMD with key as its last argument and
+// feeds it the object on stdin. The command is split on whitespace and run
+// without a shell; its output goes to the syncer's stdout and stderr. A
+// command that exits non-zero fails the download.
+func (s *Syncer) streamToCommand(ctx context.Context, key string) error {
+	args := strings.Fields(s.cfg.POST_PROCESSOR_CMD)
+	cmd := exec.CommandContext(ctx, args[0], append(args[1:], key)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to open stdin of post-processor: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start post-processor for %s: %w", key, err)
+	}
+
+	n, copyErr := s.s3Client.StreamFile(ctx, key, stdin)
+	closeErr := stdin.Close()
+	// The exit status explains a broken pipe better than the write error does
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("post-processor failed for %s: %w", key, err)
+	}
+	if err := errors.Join(copyErr, closeErr); err != nil {
+		return err
+	}
+
+	log.Printf("Successfully streamed %d bytes of %s to %s", n, key, args[0])
+	return nil
+}
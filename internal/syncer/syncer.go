@@ -2,169 +2,1217 @@ package syncer
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"path/filepath"
-	"strings"
+	"os"
+	"path"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
-	"golang.org/x/time/rate"
+	"github.com/google/uuid"
 
+	"sava-s3-export/internal/audit"
 	"sava-s3-export/internal/aws"
 	"sava-s3-export/internal/config"
 	"sava-s3-export/internal/database"
+	"sava-s3-export/internal/deadletter"
+	"sava-s3-export/internal/filter"
+	"sava-s3-export/internal/lock"
+	"sava-s3-export/internal/manifest"
+	"sava-s3-export/internal/metrics"
+	"sava-s3-export/internal/notification"
+	"sava-s3-export/internal/trigger"
+	"sava-s3-export/internal/watcher"
 )
 
 // Syncer orchestrates the S3 sync process
 type Syncer struct {
-	s3Client    *aws.S3Client
+	s3Client    aws.S3ClientInterface
 	db          *database.ParquetDB
 	cfg         *config.Config
-	rateLimiter *rate.Limiter
+	rateLimiter *prefixLimiter
 	progress    *ProgressTracker
+	events      EventSource
+	concurrency *AdaptiveConcurrencyController
+	diskLow     atomic.Bool
+	// paused is set by Pause and shared with the targets
+	paused      *atomic.Bool
+	deadLetters *deadletter.Queue
+	breaker     *aws.CircuitBreaker
+	// throttle pauses every worker while S3 keeps answering 503 Slow Down,
+	// nil when THROTTLE_DETECTION_THRESHOLD is 0
+	throttle *ThrottleDetector
+	// cloudwatch sends download statistics to CLOUDWATCH_NAMESPACE after
+	// every database flush, nil when unset
+	cloudwatch *metrics.CloudWatchEmitter
+
+	// notifiers are told about the outcome of every sync cycle
+	notifiers []notification.Notifier
+	// dedup indexes downloaded content for DEDUPLICATE_DOWNLOADS, nil when disabled
+	dedup *dedupIndex
+	// lock keeps other hosts from running against the same prefix, nil
+	// unless DISTRIBUTED_LOCK_ENABLED
+	lock *lock.DynamoLock
+	// pidLock keeps other processes on this host from writing the same
+	// database, nil when PID_LOCK_FILE is empty
+	pidLock *lock.PIDLock
+	// publisher announces every downloaded file on Kafka, nil when KAFKA_BROKERS is unset
+	publisher *notification.KafkaPublisher
+	// localWatcher marks records whose file is changed by hand, nil unless
+	// FILE_WATCHER_ENABLED. With SYNC_TARGETS each target watches its own LOCAL_DIR.
+	localWatcher *watcher.Watcher
+
+	// costs tallies the requests of the current cycle; costConfirmed lets
+	// it run over MAX_RUN_COST_USD
+	costs         *runCosts
+	costConfirmed bool
+	// manifest collects the files downloaded this cycle for MANIFEST_PATH,
+	// nil when unset
+	manifest *manifest.Recorder
+	// auditLog records every download outcome for AUDIT_LOG_PATH, nil when unset
+	auditLog *audit.Logger
+
+	// pathTemplate is the parsed PATH_TEMPLATE, nil when unset
+	pathTemplate *template.Template
+
+	// errorCounts holds the ErrorCount of failing records as of the last
+	// database read, for the error_count label of metrics.FilesFailed
+	errorCounts atomic.Pointer[map[string]int32]
+
+	// inFlight and stopping implement graceful shutdown, see Drain
+	inFlight *inFlightTracker
+	stopping chan struct{}
+	stopOnce sync.Once
+
+	// targets are the per-prefix syncers configured by SYNC_TARGETS; when set,
+	// a run syncs each of them instead of S3_PREFIX. isTarget marks such a child.
+	targets  []*Syncer
+	isTarget bool
+	// slots is the WORKERS_PER_PREFIX pool of a target, so a slow prefix
+	// cannot hold the download capacity of the others; nil when unset
+	slots chan struct{}
+
+	// checkpoint records the files left to download at CHECKPOINT_PATH, nil
+	// when unset; resume makes the first cycle require one, see WithResume
+	checkpoint *Checkpoint
+	resume     bool
+
+	// filters are the WithFileFilter filters, run before changeFilter
+	filters []filter.FileFilter
+
+	// eventHandler receives the events of the cycles, see WithEventHandler
+	eventHandler SyncEventHandler
+
+	// PreDownloadHook runs before each download; an error skips the file and
+	// marks it "hook_rejected"
+	PreDownloadHook func(ctx context.Context, key string, size int64) error
+	// PostDownloadHook runs after a download has been recorded; errors are only logged
+	PostDownloadHook func(ctx context.Context, key, localPath, etag string) error
+
+	// cycleMu serialises sync cycles, so one triggered over the API waits
+	// for a scheduled one in progress
+	cycleMu sync.Mutex
+
+	// stateMu guards the outcome of the most recent sync cycle
+	stateMu       sync.RWMutex
+	completedRuns int
+	lastRunErr    error
+}
+
+// retryStatuses are the record statuses that are downloaded again on the next
+// run even though the ETag is unchanged: interrupted forced downloads, files
+// requeued or skipped while the circuit breaker was open, timeouts, files
+// deleted from LOCAL_DIR by hand, downloads cut off while still in staging,
+// objects whose replication had failed and files that Verify found missing
+// or corrupt. Files edited by hand are left alone. The empty status is set
+// by RetryAllFailed.
+var retryStatuses = map[string]bool{
+	"force_redownload":   true,
+	"pending":            true,
+	"timeout":            true,
+	"local_deleted":      true,
+	"staging":            true,
+	"replication_failed": true,
+	"missing":            true,
+	"checksum_failed":    true,
+	"":                   true,
+}
+
+// lockReleaseTimeout bounds releasing the distributed lock, which happens
+// after the run's context may already be cancelled
+const lockReleaseTimeout = 10 * time.Second
+
+// notifyTimeout bounds each notification so a slow endpoint cannot stall the next cycle
+const notifyTimeout = 30 * time.Second
+
+// errHookRejected marks downloads skipped by the pre-download hook
+var errHookRejected = errors.New("rejected by pre-download hook")
+
+// Option configures optional behaviour of a Syncer
+type Option func(*Syncer)
+
+// WithPreDownloadHook sets the hook called before each file is downloaded
+func WithPreDownloadHook(hook func(ctx context.Context, key string, size int64) error) Option {
+	return func(s *Syncer) {
+		s.PreDownloadHook = hook
+	}
+}
+
+// WithPostDownloadHook sets the hook called after each file is downloaded and recorded
+func WithPostDownloadHook(hook func(ctx context.Context, key, localPath, etag string) error) Option {
+	return func(s *Syncer) {
+		s.PostDownloadHook = hook
+	}
+}
+
+// WithFileFilter adds a filter every listed file must pass to be downloaded,
+// such as a filter.PatternFilter. Filters run in the order they are added,
+// before files unchanged since their last download are excluded.
+func WithFileFilter(f filter.FileFilter) Option {
+	return func(s *Syncer) {
+		s.filters = append(s.filters, f)
+	}
+}
+
+// WithResume makes the first sync cycle resume from the checkpoint at
+// CHECKPOINT_PATH, failing with ErrNoCheckpoint when there is none rather
+// than listing the bucket
+func WithResume() Option {
+	return func(s *Syncer) {
+		s.resume = true
+	}
+}
+
+// WithNotifier adds a notifier told about the outcome of every sync cycle
+func WithNotifier(n notification.Notifier) Option {
+	return func(s *Syncer) {
+		s.notifiers = append(s.notifiers, n)
+	}
+}
+
+// WithCostConfirmed lets sync cycles run even when their estimated cost is
+// over MAX_RUN_COST_USD
+func WithCostConfirmed() Option {
+	return func(s *Syncer) {
+		s.costConfirmed = true
+	}
 }
 
 // NewSyncer creates a new Syncer
-func NewSyncer(cfg *config.Config) (*Syncer, error) {
+func NewSyncer(cfg *config.Config, opts ...Option) (*Syncer, error) {
 	s3Client, err := aws.NewS3Client(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create S3 client: %w", err)
 	}
 
-	db, err := database.NewParquetDB(cfg.DB_PATH, cfg.BATCH_SIZE)
+	return newSyncer(cfg, s3Client, func(targetCfg *config.Config) (aws.S3ClientInterface, error) {
+		return aws.NewS3Client(targetCfg)
+	}, opts...)
+}
+
+// NewSyncerWithClient creates a new Syncer that talks to S3 through s3Client,
+// allowing tests to inject an awstest.FakeS3Client. Every SYNC_TARGETS entry shares
+// s3Client, so it must list the objects of all target prefixes. s3Client is
+// closed if the Syncer cannot be created.
+func NewSyncerWithClient(cfg *config.Config, s3Client aws.S3ClientInterface, opts ...Option) (*Syncer, error) {
+	return newSyncer(cfg, s3Client, func(*config.Config) (aws.S3ClientInterface, error) {
+		return s3Client, nil
+	}, opts...)
+}
+
+// NewInspector creates a Syncer for the commands that only inspect or
+// update the database, such as status, verify and retry. It opens the
+// database and the S3 client but none of the audit log, notifiers, locks,
+// triggers or metrics emitters of a sync, and leaves the staging directory
+// alone.
+func NewInspector(cfg *config.Config) (*Syncer, error) {
+	s3Client, err := aws.NewS3Client(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create database: %w", err)
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
 	}
 
-	rateLimiter := rate.NewLimiter(rate.Limit(cfg.RATE_LIMIT_PER_SEC), cfg.RATE_LIMIT_PER_SEC)
-	progress := NewProgressTracker()
+	s, targets, err := newBaseSyncer(cfg, s3Client)
+	if err != nil {
+		s3Client.Close()
+		return nil, err
+	}
+	if err := s.finish(targets, func(targetCfg *config.Config) (aws.S3ClientInterface, error) {
+		return aws.NewS3Client(targetCfg)
+	}, nil); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
 
+// newSyncer creates a Syncer using s3Client for S3_PREFIX and newClient to
+// create the client of each SYNC_TARGETS entry. When it fails, everything
+// opened by then is closed, s3Client included.
+func newSyncer(cfg *config.Config, s3Client aws.S3ClientInterface, newClient func(*config.Config) (aws.S3ClientInterface, error), opts ...Option) (*Syncer, error) {
+	s, targets, err := newBaseSyncer(cfg, s3Client)
+	if err != nil {
+		s3Client.Close()
+		return nil, err
+	}
+	if err := s.connect(targets, newClient, opts); err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	for _, t := range append([]*Syncer{s}, s.targets...) {
+		t.cleanStaging()
+	}
+
+	if !cfg.MODIFIED_AFTER.IsZero() {
+		log.Printf("Only syncing files modified after %s", cfg.MODIFIED_AFTER.Format(time.RFC3339))
+	}
 	log.Println("Syncer initialized successfully.")
-	return &Syncer{
+	return s, nil
+}
+
+// connect adds to s the triggers, notifiers, locks, watchers and emitters of
+// a sync, then finishes it with targets and opts
+func (s *Syncer) connect(targets []config.SyncTarget, newClient func(*config.Config) (aws.S3ClientInterface, error), opts []Option) error {
+	cfg, db, progress := s.cfg, s.db, s.progress
+
+	if cfg.SQS_QUEUE_URL != "" {
+		if !cfg.WATCH_MODE {
+			log.Println("SQS_QUEUE_URL is ignored unless WATCH_MODE is enabled")
+		} else {
+			// Events are routed to their target by processEvent
+			prefixes := []string{cfg.S3_PREFIX}
+			if len(targets) > 0 {
+				prefixes = prefixes[:0]
+				for _, t := range targets {
+					prefixes = append(prefixes, t.Prefix)
+				}
+			}
+			sqsTrigger, err := trigger.NewSQSTrigger(context.TODO(), cfg, prefixes)
+			if err != nil {
+				return fmt.Errorf("failed to create SQS trigger: %w", err)
+			}
+			s.events = sqsTrigger
+		}
+	}
+	if cfg.AUDIT_LOG_PATH != "" {
+		auditLog, err := audit.Open(cfg.AUDIT_LOG_PATH)
+		if err != nil {
+			return err
+		}
+		s.auditLog = auditLog
+	}
+	if cfg.SNS_TOPIC_ARN != "" && cfg.SNS_NOTIFY_ON != notification.NotifyNever {
+		snsNotifier, err := notification.NewSNSNotifier(context.TODO(), cfg)
+		if err != nil {
+			return fmt.Errorf("failed to create SNS notifier: %w", err)
+		}
+		s.notifiers = append(s.notifiers, snsNotifier)
+	}
+	if cfg.SLACK_WEBHOOK_URL != "" {
+		s.notifiers = append(s.notifiers, notification.NewSlackNotifier(cfg.SLACK_WEBHOOK_URL, cfg.SLACK_NOTIFY_ON))
+	}
+	if cfg.DISTRIBUTED_LOCK_ENABLED {
+		distLock, err := lock.NewDynamoLock(context.TODO(), cfg)
+		if err != nil {
+			return fmt.Errorf("failed to create distributed lock: %w", err)
+		}
+		s.lock = distLock
+	}
+	if cfg.PID_LOCK_FILE != "" {
+		s.pidLock = lock.NewPIDLock(cfg.PID_LOCK_FILE)
+	}
+	if cfg.FILE_WATCHER_ENABLED && len(targets) == 0 {
+		s.localWatcher = watcher.New(cfg.LOCAL_DIR, db, cfg.StagingDir())
+	}
+	if cfg.KAFKA_BROKERS != "" {
+		publisher, err := notification.NewKafkaPublisher(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to create Kafka publisher: %w", err)
+		}
+		s.publisher = publisher
+	}
+	if cfg.CLOUDWATCH_NAMESPACE != "" {
+		awsCfg, err := aws.LoadAWSConfig(context.TODO(), cfg)
+		if err != nil {
+			return fmt.Errorf("failed to create CloudWatch emitter: %w", err)
+		}
+		s.cloudwatch = metrics.NewCloudWatchEmitter(awsCfg, cfg.CLOUDWATCH_NAMESPACE, cfg.CLOUDWATCH_DIMENSION_NAME, cfg.CLOUDWATCH_DIMENSION_VALUE)
+		progress.cloudwatch = s.cloudwatch
+		db.OnFlush(s.cloudwatch.EmitInBackground)
+	}
+	if cfg.CHECKPOINT_PATH != "" {
+		s.checkpoint = newCheckpoint(cfg.CHECKPOINT_PATH, cfg.CHECKPOINT_INTERVAL, cfg.S3_BUCKET, cfg.S3_PREFIX)
+		db.OnFlush(s.checkpoint.flushed)
+	}
+	return s.finish(targets, newClient, opts)
+}
+
+// newBaseSyncer validates cfg and creates a Syncer with its database and
+// the parts that need no outside services, returning the SYNC_TARGETS
+// entries still to be added by finish
+func newBaseSyncer(cfg *config.Config, s3Client aws.S3ClientInterface) (*Syncer, []config.SyncTarget, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	var pathTemplate *template.Template
+	if cfg.PATH_TEMPLATE != "" {
+		tmpl, err := parsePathTemplate(cfg.PATH_TEMPLATE)
+		if err != nil {
+			return nil, nil, err
+		}
+		pathTemplate = tmpl
+	}
+
+	targets, err := config.ParseSyncTargets(cfg.SYNC_TARGETS)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	db, err := database.OpenParquetDB(cfg.DB_PATH, cfg.BATCH_SIZE, cfg.PARTITION_BY_DATE)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create database: %w", err)
+	}
+	db.EnableBloomFilter(cfg.BLOOM_FALSE_POSITIVE_RATE)
+	db.SetReadWorkers(cfg.PARQUET_READ_WORKERS)
+
+	// Stop hitting S3 after a run of consecutive failures
+	var breaker *aws.CircuitBreaker
+	if cfg.CIRCUIT_BREAKER_THRESHOLD > 0 {
+		breaker = aws.NewCircuitBreaker(cfg.CIRCUIT_BREAKER_THRESHOLD, cfg.CIRCUIT_BREAKER_RESET_TIMEOUT)
+		s3Client = aws.NewCircuitBreakerClient(s3Client, breaker)
+	}
+
+	globalLimiter := newLimiter(cfg.RATE_LIMIT_ALGORITHM, cfg.RATE_LIMIT_PER_SEC, cfg.RATE_LIMIT_BURST)
+	rateLimiter := newPrefixLimiter(globalLimiter, cfg.RATE_LIMIT_ALGORITHM, cfg.PREFIX_RATE_LIMITS)
+	progress := NewProgressTracker()
+
+	s := &Syncer{
 		s3Client:    s3Client,
 		db:          db,
 		cfg:         cfg,
 		rateLimiter: rateLimiter,
 		progress:    progress,
+		breaker:     breaker,
+		inFlight:    newInFlightTracker(),
+		stopping:    make(chan struct{}),
+		paused:      new(atomic.Bool),
+	}
+	s.pathTemplate = pathTemplate
+	s.costs = &runCosts{}
+	if cfg.MANIFEST_PATH != "" {
+		s.manifest = &manifest.Recorder{}
+	}
+	if cfg.DEDUPLICATE_DOWNLOADS {
+		s.dedup = newDedupIndex(cfg.HASH_INDEX_PATH)
+	}
+	if cfg.DEAD_LETTER_PATH != "" {
+		s.deadLetters = deadletter.NewQueue(cfg.DEAD_LETTER_PATH, int64(cfg.MAX_DLQ_SIZE_MB)*1024*1024)
+	}
+	if cfg.ADAPTIVE_CONCURRENCY {
+		maxWorkers := cfg.MAX_WORKERS
+		if cfg.WORKERS_PER_PREFIX > 0 && len(targets) > 0 {
+			// The shared limit is the union of the per-prefix pools
+			maxWorkers = cfg.WORKERS_PER_PREFIX * len(targets)
+		}
+		s.concurrency = NewAdaptiveConcurrencyController(maxWorkers, cfg.ERROR_RATE_THRESHOLD)
+	}
+	if cfg.THROTTLE_DETECTION_THRESHOLD > 0 && cfg.THROTTLE_BACKOFF_DURATION > 0 {
+		s.throttle = NewThrottleDetector(cfg.THROTTLE_DETECTION_THRESHOLD, cfg.THROTTLE_BACKOFF_DURATION)
+	}
+	return s, targets, nil
+}
+
+// finish applies opts and creates the Syncer of each SYNC_TARGETS entry,
+// which shares the parts of s set up by then
+func (s *Syncer) finish(targets []config.SyncTarget, newClient func(*config.Config) (aws.S3ClientInterface, error), opts []Option) error {
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.eventHandler == nil {
+		s.eventHandler = logEventHandler{progress: s.progress}
+	}
+	s.progress.events = s.eventHandler
+
+	for _, target := range targets {
+		child, err := s.newTarget(target, newClient)
+		if err != nil {
+			return err
+		}
+		s.targets = append(s.targets, child)
+	}
+	return nil
+}
+
+// RunOnce performs exactly one sync cycle and returns its outcome. It holds
+// the PID_LOCK_FILE lock, and with DISTRIBUTED_LOCK_ENABLED the DynamoDB
+// lock, for the cycle. The result is returned even when the cycle fails, but
+// is nil if a lock could not be taken or the HealthCheck failed.
+func (s *Syncer) RunOnce(ctx context.Context) (*SyncResult, error) {
+	ctx, release, err := s.acquireLocks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if err := s.startupCheck(ctx); err != nil {
+		return nil, lockLost(ctx, err)
+	}
+
+	result, err := s.SyncNow(ctx, uuid.NewString())
+	return result, lockLost(ctx, err)
+}
+
+// RunContinuously syncs until ctx is cancelled or a shutdown is requested:
+// at every time matched by CRON_EXPRESSION when set, otherwise every
+// POLL_INTERVAL_SECONDS, consuming S3 events in between when configured.
+// Failed cycles are logged and retried, but a failed HealthCheck at the
+// start is returned. It holds the locks, and runs the FILE_WATCHER_ENABLED
+// watchers, for the whole time.
+func (s *Syncer) RunContinuously(ctx context.Context) error {
+	if s.cfg.CRON_EXPRESSION == "" && s.cfg.POLL_INTERVAL_SECONDS <= 0 {
+		return errors.New("POLL_INTERVAL_SECONDS or CRON_EXPRESSION must be set to run continuously")
+	}
+
+	ctx, release, err := s.acquireLocks(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err := s.startupCheck(ctx); err != nil {
+		return lockLost(ctx, err)
+	}
+
+	stopWatchers := s.startWatchers(ctx)
+	defer stopWatchers()
+
+	if s.cfg.CRON_EXPRESSION != "" {
+		return lockLost(ctx, s.runScheduled(ctx))
+	}
+	return lockLost(ctx, s.watch(ctx))
+}
+
+// lockLost returns lock.ErrLockLost when ctx was cancelled because the
+// DynamoDB lock was lost, and err otherwise
+func lockLost(ctx context.Context, err error) error {
+	if cause := context.Cause(ctx); errors.Is(cause, lock.ErrLockLost) {
+		return cause
+	}
+	return err
+}
+
+// acquireLocks takes the PID_LOCK_FILE lock and, with
+// DISTRIBUTED_LOCK_ENABLED, the DynamoDB lock, and returns the context to
+// run under, cancelled if the DynamoDB lock is lost, and a function that
+// releases both
+func (s *Syncer) acquireLocks(ctx context.Context) (context.Context, func(), error) {
+	if s.pidLock != nil {
+		if err := s.pidLock.Acquire(); err != nil {
+			return nil, nil, err
+		}
+	}
+	releasePID := func() {
+		if s.pidLock == nil {
+			return
+		}
+		if err := s.pidLock.Release(); err != nil {
+			log.Printf("%v", err)
+		}
+	}
+
+	if s.lock == nil {
+		return ctx, releasePID, nil
+	}
+	runCtx, err := s.lock.Acquire(ctx)
+	if err != nil {
+		releasePID()
+		return nil, nil, err
+	}
+	return runCtx, func() {
+		releaseCtx, cancel := context.WithTimeout(context.Background(), lockReleaseTimeout)
+		defer cancel()
+		if err := s.lock.Release(releaseCtx); err != nil {
+			log.Printf("%v", err)
+		}
+		releasePID()
 	}, nil
 }
 
-// Run starts the sync process
-func (s *Syncer) Run(ctx context.Context) error {
+// startWatchers runs the FILE_WATCHER_ENABLED watchers of s and its targets
+// in the background and returns a function that stops them
+func (s *Syncer) startWatchers(ctx context.Context) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	for _, t := range append([]*Syncer{s}, s.targets...) {
+		if t.localWatcher == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(w *watcher.Watcher) {
+			defer wg.Done()
+			if err := w.Run(ctx); err != nil {
+				log.Printf("File watcher stopped: %v", err)
+			}
+		}(t.localWatcher)
+	}
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+// runCycle performs one sync cycle under a fresh run ID
+func (s *Syncer) runCycle(ctx context.Context) error {
+	_, err := s.SyncNow(ctx, uuid.NewString())
+	return err
+}
+
+// SyncNow performs one sync cycle under runID, waiting for any cycle already
+// in progress. It records the outcome for the health probes, writes it to
+// RESULT_FILE_PATH, reports it to the notifiers and returns it.
+func (s *Syncer) SyncNow(ctx context.Context, runID string) (*SyncResult, error) {
+	s.cycleMu.Lock()
+	defer s.cycleMu.Unlock()
+
+	start := time.Now()
+	s.progress.reset()
+	s.costs.reset()
+	s.resetAPICalls()
+	s.auditLog.SetRunID(runID)
+	if s.dedup != nil {
+		s.dedup.reset()
+	}
+
+	runCtx, cancel := s.withGlobalTimeout(ctx)
+	err := s.dedup.open()
+	if err == nil {
+		err = s.run(runCtx)
+	}
+	err = s.checkAborted(runCtx, err)
+	cancel()
+	if s.dedup != nil {
+		s.dedup.logSummary()
+	}
+	s.recordRun(err)
+
+	result := s.newSyncResult(runID, start, err)
+	warnExpensiveListing(result.APICalls)
+	s.writeCostReport(result)
+	s.writeManifest(result)
+	s.writeResult(result)
+	s.notify(result)
+	s.eventHandler.OnRunComplete(*result)
+	return result, err
+}
+
+// Store returns the sync state database
+func (s *Syncer) Store() database.StateStore {
+	return s.db
+}
+
+// notify sends result to every notifier. Failures are only logged so that a
+// broken notification channel never fails a sync.
+func (s *Syncer) notify(result *SyncResult) {
+	for _, n := range s.notifiers {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		if err := n.Notify(ctx, *result); err != nil {
+			log.Printf("Failed to send notification for run %s: %v", result.RunID, err)
+		}
+		cancel()
+	}
+}
+
+// Healthy returns the error of the most recent sync cycle, or nil if it succeeded
+func (s *Syncer) Healthy() error {
+	s.stateMu.RLock()
+	defer s.stateMu.RUnlock()
+	return s.lastRunErr
+}
+
+// Ready reports whether at least one sync cycle has completed
+func (s *Syncer) Ready() bool {
+	s.stateMu.RLock()
+	defer s.stateMu.RUnlock()
+	return s.completedRuns > 0
+}
+
+// ProbeDetails reports component state for the /healthz endpoint
+func (s *Syncer) ProbeDetails() map[string]string {
+	details := make(map[string]string)
+	if s.breaker != nil {
+		details["circuit_breaker"] = s.breaker.State().String()
+	}
+	details["paused"] = strconv.FormatBool(s.Paused())
+	return details
+}
+
+// recordRun stores the outcome of a sync cycle for Healthy and Ready
+func (s *Syncer) recordRun(err error) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	s.completedRuns++
+	s.lastRunErr = err
+}
+
+// run performs a single sync cycle
+func (s *Syncer) run(ctx context.Context) error {
+	if len(s.targets) > 0 {
+		return s.runTargets(ctx)
+	}
+
 	log.Println("Starting S3 sync process...")
 
-	// 1. List all files from S3
-	s3Files, err := s.s3Client.ListFiles(ctx)
+	// 1. List all files from S3, unless resuming an interrupted cycle
+	s3Files, err := s.listOrResume(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to list S3 files: %w", err)
+		return err
+	}
+	if s.isTarget {
+		s3Files = filterPrefix(s3Files, s.cfg.S3_PREFIX)
 	}
 	log.Printf("Found %d files in S3", len(s3Files))
 
+	// Only files modified after MODIFIED_AFTER are candidates
+	candidates := s.modifiedAfter(s3Files)
+
 	// 2. Get the current state from the local database
-	localRecords, err := s.db.ReadAllRecords(ctx)
+	localRecords, err := s.readRecords(ctx, candidates)
 	if err != nil {
 		return fmt.Errorf("failed to read local database: %w", err)
 	}
 	log.Printf("Found %d records in the local database", len(localRecords))
+	s.storeErrorCounts(localRecords)
+	if s.dedup != nil {
+		s.dedup.seed(localRecords)
+	}
 
 	// 3. Determine which files to download
-	filesToDownload := s.getFilesToDownload(s3Files, localRecords)
+	filesToDownload := s.recordMetadataOnly(s.getFilesToDownload(ctx, candidates, localRecords))
+	// Files deferred by MAX_FILES_PER_RUN are skipped in this run too
+	filesToDownload = s.limitFiles(filesToDownload)
+	s.progress.AddSkipped(len(s3Files) - len(filesToDownload))
+	if err := s.checkBudget(s3Files, filesToDownload); err != nil {
+		return err
+	}
 	if len(filesToDownload) == 0 {
 		log.Println("All files are up to date. Nothing to download.")
-		return nil
+		if s.checkpoint != nil {
+			s.checkpoint.finish(true)
+		}
+		// Write the records refreshed for SKIP_EXISTING and DELTA_SYNC_ALGORITHM,
+		// and those of metadata-only storage classes
+		return s.db.FlushBatch()
 	}
 	log.Printf("Found %d files to download", len(filesToDownload))
 
+	// Refuse to start if the downloads cannot fit on disk
+	if err := s.checkDiskSpace(filesToDownload, localRecords); err != nil {
+		return err
+	}
+
+	// Mark forced files first so an interrupted force run picks them up again
+	if err := s.markForced(filesToDownload); err != nil {
+		return fmt.Errorf("failed to mark forced downloads: %w", err)
+	}
+	if s.checkpoint != nil {
+		if err := s.checkpoint.start(filesToDownload); err != nil {
+			log.Printf("%v", err)
+		}
+	}
+
 	// 4. Download files concurrently
-	s.progress.Start(len(filesToDownload))
-	defer s.progress.Finish()
+	if s.isTarget {
+		// Targets share the parent's tracker, which starts and finishes the run
+		s.progress.Add(len(filesToDownload))
+	} else {
+		s.progress.Start(len(filesToDownload))
+		defer s.progress.Finish()
+	}
+	s.progress.AddBytes(totalSize(filesToDownload))
 
 	var wg sync.WaitGroup
-	downloadQueue := make(chan types.Object, len(filesToDownload))
+	downloadQueue, err := newDownloadQueue(s.cfg.DOWNLOAD_PRIORITY, min(len(filesToDownload), s.cfg.MAX_QUEUE_DEPTH))
+	if err != nil {
+		return err
+	}
+
+	// Pause downloads while free space is below MIN_FREE_BYTES
+	monitorCtx, stopMonitor := context.WithCancel(ctx)
+	defer stopMonitor()
+	go s.monitorDiskSpace(monitorCtx)
 
 	// Start worker goroutines with configurable concurrency
 	numWorkers := s.cfg.MAX_WORKERS
+	if s.slots != nil {
+		numWorkers = cap(s.slots)
+	}
 	for i := 0; i < numWorkers; i++ {
 		wg.Add(1)
 		go s.downloadWorker(ctx, &wg, downloadQueue)
 	}
+	// Workers stop early when the run is cancelled or drained, and must not
+	// leave the loop below waiting on a full queue
+	go func() {
+		wg.Wait()
+		downloadQueue.Close()
+	}()
 
-	// Add files to the download queue
+	// Add files to the download queue in priority order, waiting while
+	// MAX_QUEUE_DEPTH are queued
+	downloadQueue.Sort(filesToDownload)
 	for _, file := range filesToDownload {
-		downloadQueue <- file
+		if !downloadQueue.Push(file) {
+			break
+		}
 	}
-	close(downloadQueue)
+	downloadQueue.Close()
 
 	// Wait for all downloads to complete
 	wg.Wait()
 
 	// Flush any remaining batch updates
-	if err := s.db.FlushBatch(); err != nil {
-		log.Printf("Failed to flush final batch: %v", err)
+	flushErr := s.db.FlushBatch()
+	if flushErr != nil {
+		log.Printf("Failed to flush final batch: %v", flushErr)
+	}
+	if s.checkpoint != nil {
+		// A file marked done after its batch was flushed is in the database
+		// even when the final batch was empty and flushed nothing
+		if flushErr == nil {
+			s.checkpoint.flushed()
+		}
+		s.checkpoint.finish(flushErr == nil && ctx.Err() == nil && !s.inFlight.isStopping())
+	}
+	if !s.isTarget {
+		s.updateRecordMetrics()
 	}
 
 	log.Println("S3 sync process completed successfully.")
 	return nil
 }
 
-// getFilesToDownload compares S3 files with local records to find what needs downloading
-func (s *Syncer) getFilesToDownload(s3Files []types.Object, localRecords map[string]database.FileRecord) []types.Object {
-	var toDownload []types.Object
-	for _, s3File := range s3Files {
-		key := *s3File.Key
-		if record, exists := localRecords[key]; exists {
-			// File exists locally, check if it has been modified
-			if record.ETag != *s3File.ETag {
-				toDownload = append(toDownload, s3File)
-			}
-		} else {
-			// File does not exist locally
-			toDownload = append(toDownload, s3File)
+// getFilesToDownload compares S3 files with local records to find what needs
+// downloading, running them through the chain of fileFilters. With
+// REQUIRE_REPLICATION_COMPLETE, objects still being replicated are left for a
+// later run.
+func (s *Syncer) getFilesToDownload(ctx context.Context, s3Files []types.Object, localRecords map[string]database.FileRecord) []types.Object {
+	return s.replicated(ctx, s.fileFilters(ctx).Apply(s3Files, localRecords), localRecords)
+}
+
+// fileFilters returns the filters deciding which listed files are downloaded:
+// objects larger than MAX_FILE_SIZE_BYTES are left out, then those added
+// with WithFileFilter and changeFilter decide
+func (s *Syncer) fileFilters(ctx context.Context) *filter.FilterChain {
+	chain := filter.NewChain().WithMembership(s.db.MayContain)
+	if s.cfg.MAX_FILE_SIZE_BYTES > 0 {
+		chain.Add(filter.SizeFilter{Max: s.cfg.MAX_FILE_SIZE_BYTES})
+	}
+	for _, f := range s.filters {
+		chain.Add(f)
+	}
+	return chain.Add(s.changeFilter(ctx))
+}
+
+// changeFilter includes forced files, files without a record, and those
+// whose ETag changed or whose record is waiting for a retry. With
+// DELTA_SYNC_ALGORITHM=sha256, a downloaded object whose ETag changed is
+// compared by its checksum before it is downloaded again.
+func (s *Syncer) changeFilter(ctx context.Context) filter.FileFilter {
+	etag := filter.ETagFilter{Retry: retryStatuses}
+	return filter.FilterFunc(func(obj types.Object, record *database.FileRecord, exists bool) (bool, string) {
+		if s.isForced(*obj.Key) || !exists {
+			return true, ""
+		}
+		if include, reason := etag.Filter(obj, record, exists); !include && !s.nowDownloaded(obj, *record) {
+			return false, reason
+		}
+		if s.keepExisting(*record) {
+			return false, "kept existing local file"
+		}
+		if s.unchangedContent(ctx, obj, *record) {
+			return false, "content unchanged"
+		}
+		return true, ""
+	})
+}
+
+// keepExisting reports whether SKIP_EXISTING keeps the local file of record
+// rather than downloading the object again. A kept record only has its
+// LastSyncedAt refreshed.
+func (s *Syncer) keepExisting(record database.FileRecord) bool {
+	if !s.cfg.SKIP_EXISTING || record.LocalPath == "" {
+		return false
+	}
+	info, err := os.Stat(record.LocalPath)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	if err := s.db.BatchTouch(record); err != nil {
+		log.Printf("Failed to refresh the record of %s: %v", record.S3Key, err)
+	}
+	return true
+}
+
+// isForced reports whether key must be re-downloaded regardless of its ETag
+func (s *Syncer) isForced(key string) bool {
+	if s.cfg.FORCE_REDOWNLOAD {
+		return true
+	}
+	if s.cfg.FORCE_KEYS == "" {
+		return false
+	}
+	matched, _ := path.Match(s.cfg.FORCE_KEYS, key)
+	return matched
+}
+
+// markForced records a "force_redownload" status for every forced file before
+// any download starts, so the next run retries them if this one is interrupted
+func (s *Syncer) markForced(files []types.Object) error {
+	if !s.cfg.FORCE_REDOWNLOAD && s.cfg.FORCE_KEYS == "" {
+		return nil
+	}
+
+	forced := 0
+	for _, file := range files {
+		key := *file.Key
+		if !s.isForced(key) {
+			continue
 		}
+		if err := s.db.BatchUpdate(key, *file.ETag, s.objectPath(file), "force_redownload", *file.LastModified); err != nil {
+			return err
+		}
+		forced++
 	}
-	return toDownload
+	log.Printf("Forcing re-download of %d files", forced)
+	return s.db.FlushBatch()
 }
 
-// downloadWorker is a worker goroutine that downloads files from a channel
-func (s *Syncer) downloadWorker(ctx context.Context, wg *sync.WaitGroup, queue <-chan types.Object) {
+// totalSize returns the summed size of files
+func totalSize(files []types.Object) int64 {
+	var total int64
+	for _, f := range files {
+		total += objectSize(f)
+	}
+	return total
+}
+
+// objectSize returns the size of an S3 object, or 0 when S3 did not report one
+func objectSize(obj types.Object) int64 {
+	if obj.Size == nil {
+		return 0
+	}
+	return *obj.Size
+}
+
+// downloadWorker is a worker goroutine that downloads files from the queue
+func (s *Syncer) downloadWorker(ctx context.Context, wg *sync.WaitGroup, queue *downloadQueue) {
 	defer wg.Done()
-	for file := range queue {
-		// Rate limiting
-		if err := s.rateLimiter.Wait(ctx); err != nil {
+	for {
+		file, ok := queue.Pop()
+		if !ok || s.inFlight.isStopping() {
+			return
+		}
+
+		// Hold off the whole pool while S3 is throttling
+		if err := s.throttle.Wait(ctx); err != nil {
+			return
+		}
+
+		// Rate limiting, by the longest matching PREFIX_RATE_LIMITS entry
+		if err := s.rateLimiter.limiterFor(*file.Key).Wait(ctx); err != nil {
 			log.Printf("Rate limiter context cancelled: %v", err)
 			return
 		}
 
-		key := *file.Key
-		localPath := filepath.Join(s.cfg.LOCAL_DIR, strings.TrimPrefix(key, s.cfg.S3_PREFIX))
+		if err := s.waitWhilePaused(ctx); err != nil {
+			return
+		}
+		if err := s.waitForDiskSpace(ctx); err != nil {
+			return
+		}
 
-		err := s.s3Client.DownloadFile(ctx, key, localPath)
+		if err := s.acquireSlot(ctx); err != nil {
+			return
+		}
+		if err := s.concurrency.Acquire(ctx); err != nil {
+			s.releaseSlot()
+			return
+		}
+		if !s.inFlight.begin(*file.Key) {
+			s.concurrency.Release(false)
+			s.releaseSlot()
+			return
+		}
+		start := time.Now()
+		err := s.processFile(ctx, file)
+		// Failed files stay in the checkpoint to be retried on resume
+		if err == nil || errors.Is(err, errHookRejected) {
+			s.checkpoint.markDone(*file.Key)
+		}
+		s.inFlight.end(*file.Key)
+		s.concurrency.Release(err != nil && !errors.Is(err, errHookRejected))
+		s.releaseSlot()
 		if err != nil {
-			log.Printf("Failed to download %s: %v", key, err)
-			// Use batch update for failed status
-			s.db.BatchUpdate(key, *file.ETag, localPath, "failed", *file.LastModified)
-			s.progress.IncrementFailed()
+			s.cloudwatch.RecordFailure()
+			s.progress.IncrementFailed(*file.Key, err)
 			continue
 		}
+		s.cloudwatch.RecordDownload(objectSize(file), time.Since(start))
+		s.progress.IncrementSuccess(objectSize(file))
+	}
+}
+
+// processFile downloads a single file and records the outcome in the database batch
+func (s *Syncer) processFile(ctx context.Context, file types.Object) error {
+	key := *file.Key
+	localPath := s.objectPath(file)
+	defer s.localWatcher.Suppress(localPath)()
+
+	if s.PreDownloadHook != nil {
+		if err := s.PreDownloadHook(ctx, key, objectSize(file)); err != nil {
+			log.Printf("Pre-download hook rejected %s: %v", key, err)
+			s.db.BatchUpdate(key, *file.ETag, localPath, "hook_rejected", *file.LastModified)
+			s.recordAudit(file, localPath, "hook_rejected", err)
+			return fmt.Errorf("%w: %w", errHookRejected, err)
+		}
+	}
+
+	// With DEDUPLICATE_DOWNLOADS, content already on disk is hardlinked instead
+	var hash string
+	linked := false
+	if s.dedup != nil {
+		hash = contentHash(file)
+		linked = s.linkDuplicate(file, hash, localPath)
+		if !linked {
+			// Downloading over a hardlink would rewrite every key sharing it
+			if err := os.Remove(localPath); err != nil && !os.IsNotExist(err) {
+				log.Printf("Failed to remove %s before downloading: %v", localPath, err)
+			}
+		}
+	}
+
+	var attempts int
+	var err error
+	if !linked {
+		attempts, err = s.downloadStaged(ctx, file, localPath)
+	}
+	if errors.Is(err, aws.ErrCircuitOpen) {
+		// Not the file's fault; leave it pending so the next run retries it
+		log.Printf("Skipping %s while the S3 circuit breaker is open", key)
+		s.db.BatchUpdate(key, *file.ETag, localPath, "pending", *file.LastModified)
+		return err
+	}
+	if err != nil && ctx.Err() != nil && (s.inFlight.isStopping() || errors.Is(context.Cause(ctx), errGlobalTimeout)) {
+		// Cancelled after the shutdown drain timeout or GLOBAL_TIMEOUT_SECONDS;
+		// retry on the next run
+		log.Printf("Download of %s cancelled: %v", key, context.Cause(ctx))
+		s.db.BatchUpdate(key, *file.ETag, localPath, "pending", *file.LastModified)
+		return err
+	}
+	if errors.Is(err, errDownloadTimeout) {
+		s.eventHandler.OnFileFailed(key, err, attempts)
+		s.db.BatchUpdateFailure(key, *file.ETag, localPath, "timeout", *file.LastModified, err)
+		s.recordAudit(file, localPath, "timeout", err)
+		s.recordFailure(key)
+		return err
+	}
+	if err != nil {
+		s.eventHandler.OnFileFailed(key, err, attempts)
+		if s.deadLetters != nil && ctx.Err() == nil {
+			s.addDeadLetter(file, err, attempts)
+		}
+		// Use batch update for failed status
+		s.db.BatchUpdateFailure(key, *file.ETag, localPath, "failed", *file.LastModified, err)
+		s.recordAudit(file, localPath, "failed", err)
+		s.recordFailure(key)
+		return err
+	}
+
+	// Hash the file as downloaded, before any decompression or routing
+	if s.hashContent() && !linked {
+		if hash, err = fileSHA256(localPath); err != nil {
+			log.Printf("Failed to hash %s, its next change will be detected by ETag: %v", localPath, err)
+			hash = ""
+		}
+	}
+
+	status := "downloaded"
+	if s.streaming() {
+		// Nothing was written to LOCAL_DIR
+		status, localPath = "streamed", ""
+		err = s.db.BatchUpdate(key, *file.ETag, localPath, status, *file.LastModified)
+	} else {
+		localPath = s.postProcess(localPath)
+		defer s.localWatcher.Suppress(localPath)()
+		s.preserveTimestamp(localPath, *file.LastModified)
 
 		// Use batch update for downloaded status
-		err = s.db.BatchUpdate(key, *file.ETag, localPath, "downloaded", *file.LastModified)
-		if err != nil {
-			log.Printf("Failed to update database for %s: %v", key, err)
+		err = s.db.BatchUpdateDownloaded(key, *file.ETag, localPath, hash, objectSize(file), *file.LastModified)
+	}
+	s.recordAudit(file, localPath, status, nil)
+	if err != nil {
+		log.Printf("Failed to update database for %s: %v", key, err)
+	} else if s.dedup != nil && !linked {
+		s.dedup.add(hash, localPath)
+	}
+	if err == nil && s.PostDownloadHook != nil && localPath != "" {
+		if err := s.PostDownloadHook(ctx, key, localPath, *file.ETag); err != nil {
+			log.Printf("Post-download hook failed for %s: %v", key, err)
+		}
+	}
+	s.publish(ctx, file, localPath, status)
+	if s.manifest != nil {
+		s.manifest.Add(manifest.Entry{
+			S3Key:        key,
+			LocalPath:    localPath,
+			ETag:         *file.ETag,
+			SizeBytes:    objectSize(file),
+			LastModified: *file.LastModified,
+			DownloadedAt: time.Now(),
+		})
+	}
+	metrics.FilesDownloaded.Inc()
+	s.eventHandler.OnFileDownloaded(key, localPath, objectSize(file))
+	return nil
+}
+
+// publish announces a downloaded or streamed file on Kafka. Failures are only
+// logged and never change the file's download status.
+func (s *Syncer) publish(ctx context.Context, file types.Object, localPath, status string) {
+	if s.publisher == nil {
+		return
+	}
+	record := database.FileRecord{
+		S3Key:         *file.Key,
+		ETag:          *file.ETag,
+		LastModified:  file.LastModified.Unix(),
+		SyncStatus:    status,
+		LocalPath:     localPath,
+		LastSyncedAt:  time.Now().Unix(),
+		FileSizeBytes: objectSize(file),
+	}
+	if err := s.publisher.Publish(ctx, record); err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+// writeManifest writes the files downloaded in the cycle of result to
+// MANIFEST_PATH. Files downloaded from events between cycles are included in
+// the next cycle's manifest.
+func (s *Syncer) writeManifest(result *SyncResult) {
+	if s.manifest == nil {
+		return
+	}
+	m := manifest.Manifest{
+		RunID:     result.RunID,
+		StartTime: result.StartTime,
+		EndTime:   result.StartTime.Add(result.Duration),
+		Summary: manifest.Summary{
+			FilesDownloaded: result.FilesDownloaded,
+			FilesFailed:     result.FilesFailed,
+			BytesDownloaded: result.BytesDownloaded,
+		},
+		Files: s.manifest.Take(),
+	}
+	if err := manifest.Write(s.cfg.MANIFEST_PATH, s.cfg.MANIFEST_FORMAT, m); err != nil {
+		log.Printf("%v", err)
+		return
+	}
+	log.Printf("Wrote manifest of %d files to %s", len(m.Files), s.cfg.MANIFEST_PATH)
+}
+
+// Close releases resources held beyond a run, flushing any Kafka messages
+// still buffered in KAFKA_ASYNC mode and closing the S3 clients, audit log
+// and hash index
+func (s *Syncer) Close() error {
+	var errs []error
+	for _, t := range append([]*Syncer{s}, s.targets...) {
+		if err := t.s3Client.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close S3 client: %w", err))
+		}
+	}
+	if s.dedup != nil {
+		if err := s.dedup.close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close hash index: %w", err))
+		}
+	}
+	if s.publisher != nil {
+		if err := s.publisher.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close Kafka publisher: %w", err))
+		}
+	}
+	if s.auditLog != nil {
+		if err := s.auditLog.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close audit log: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// updateRecordMetrics refreshes metrics.RecordsByStatus from the records
+// held in memory. Without them, as with LAZY_LOAD_THRESHOLD_RECORDS, the
+// gauges keep their value until the next Status rather than costing a scan
+// of the database after every cycle.
+func (s *Syncer) updateRecordMetrics() {
+	if counts, ok := s.db.CachedStatusCounts(); ok {
+		metrics.SetRecordsByStatus(counts)
+	}
+}
+
+// storeErrorCounts remembers the ErrorCount of every failing record
+func (s *Syncer) storeErrorCounts(records map[string]database.FileRecord) {
+	counts := make(map[string]int32)
+	for key, r := range records {
+		if r.ErrorCount > 0 {
+			counts[key] = r.ErrorCount
 		}
-		s.progress.IncrementSuccess()
 	}
+	s.errorCounts.Store(&counts)
 }
 
-// ProgressTracker tracks download progress
+// recordFailure counts a failed download of key in metrics.FilesFailed
+func (s *Syncer) recordFailure(key string) {
+	count := int32(1)
+	if counts := s.errorCounts.Load(); counts != nil {
+		count += (*counts)[key]
+	}
+	metrics.FilesFailed.WithLabelValues(metrics.ErrorCountLabel(count)).Inc()
+}
+
+// ProgressTracker tracks download progress. Its counters are updated
+// atomically with mu held for reading, so downloads never wait on each other,
+// or on the log, to count a file. Readers of several counters, such as
+// snapshot and Totals, hold mu exclusively so they see the counters of a
+// whole number of downloads. mu also guards the start time and kept errors,
+// and makes Start and reset clear the counters together.
 type ProgressTracker struct {
-	total     int
-	success   int
-	failed    int
+	total      atomic.Int64
+	success    atomic.Int64
+	failed     atomic.Int64
+	bytes      atomic.Int64
+	bytesTotal atomic.Int64
+	// completed counts finished downloads, so that exactly one of them logs
+	// each hundredth
+	completed atomic.Int64
 	startTime time.Time
-	mu        sync.Mutex
+	// skipped and errors cover the whole cycle, across targets, so only
+	// reset clears them
+	skipped atomic.Int64
+	errors  []string
+	mu      sync.RWMutex
+
+	// cloudwatch is sent the statistics left over at Finish, nil unless
+	// CLOUDWATCH_NAMESPACE is set
+	cloudwatch *metrics.CloudWatchEmitter
+
+	// events is told the progress, and logs it by default
+	events SyncEventHandler
 }
 
 // NewProgressTracker creates a new progress tracker
@@ -175,47 +1223,155 @@ func NewProgressTracker() *ProgressTracker {
 // Start initializes the progress tracker
 func (p *ProgressTracker) Start(total int) {
 	p.mu.Lock()
-	defer p.mu.Unlock()
-	p.total = total
-	p.success = 0
-	p.failed = 0
+	p.total.Store(int64(total))
+	p.success.Store(0)
+	p.failed.Store(0)
+	p.completed.Store(0)
+	p.bytes.Store(0)
+	p.bytesTotal.Store(0)
 	p.startTime = time.Now()
+	p.mu.Unlock()
 	log.Printf("Starting download of %d files", total)
 }
 
-// IncrementSuccess increments successful downloads
-func (p *ProgressTracker) IncrementSuccess() {
+// reset clears the counts left over from a previous cycle
+func (p *ProgressTracker) reset() {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.success++
-	p.logProgress()
+	for _, c := range []*atomic.Int64{&p.total, &p.success, &p.failed, &p.completed, &p.bytes, &p.bytesTotal, &p.skipped} {
+		c.Store(0)
+	}
+	p.errors = nil
 }
 
-// IncrementFailed increments failed downloads
-func (p *ProgressTracker) IncrementFailed() {
+// Totals returns the number of successful and failed downloads and the bytes downloaded
+func (p *ProgressTracker) Totals() (success, failed int, bytes int64) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.failed++
-	p.logProgress()
+	return int(p.success.Load()), int(p.failed.Load()), p.bytes.Load()
+}
+
+// Skipped returns the number of listed files that did not need downloading
+func (p *ProgressTracker) Skipped() int {
+	return int(p.skipped.Load())
+}
+
+// Errors returns the errors of the failed downloads, at most
+// notification.MaxResultErrors of them
+func (p *ProgressTracker) Errors() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return append([]string(nil), p.errors...)
+}
+
+// AddSkipped counts n listed files that did not need downloading
+func (p *ProgressTracker) AddSkipped(n int) {
+	p.skipped.Add(int64(n))
+}
+
+// Add raises the total by n files, for runs that queue downloads in several batches
+func (p *ProgressTracker) Add(n int) {
+	p.mu.RLock()
+	total := p.total.Add(int64(n))
+	p.mu.RUnlock()
+	log.Printf("Queued %d more files, %d in total", n, total)
+}
+
+// AddBytes raises the number of bytes expected to be downloaded by n
+func (p *ProgressTracker) AddBytes(n int64) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	p.bytesTotal.Add(n)
+}
+
+// IncrementSuccess increments successful downloads and adds their size in bytes
+func (p *ProgressTracker) IncrementSuccess(bytes int64) {
+	p.mu.RLock()
+	p.success.Add(1)
+	p.bytes.Add(bytes)
+	completed := p.completed.Add(1)
+	p.mu.RUnlock()
+	p.logProgress(completed)
 }
 
-// logProgress logs current progress
-func (p *ProgressTracker) logProgress() {
-	completed := p.success + p.failed
-	if completed%100 == 0 || completed == p.total {
-		elapsed := time.Since(p.startTime)
-		rate := float64(completed) / elapsed.Seconds()
-		log.Printf("Progress: %d/%d files (%.1f%%), Success: %d, Failed: %d, Rate: %.1f files/sec", 
-			completed, p.total, float64(completed)*100/float64(p.total), p.success, p.failed, rate)
+// IncrementFailed increments failed downloads and keeps the error of key,
+// until notification.MaxResultErrors errors are kept
+func (p *ProgressTracker) IncrementFailed(key string, err error) {
+	p.mu.Lock()
+	p.failed.Add(1)
+	if len(p.errors) < notification.MaxResultErrors {
+		p.errors = append(p.errors, fmt.Sprintf("%s: %v", key, err))
 	}
+	completed := p.completed.Add(1)
+	p.mu.Unlock()
+	p.logProgress(completed)
 }
 
-// Finish logs final statistics
-func (p *ProgressTracker) Finish() {
+// progressSnapshot holds the counters of a ProgressTracker read at one time
+type progressSnapshot struct {
+	total, success, failed int64
+	bytes, bytesTotal      int64
+	elapsed                time.Duration
+}
+
+// snapshot reads the counters for logging, so the log is written without
+// holding any lock
+func (p *ProgressTracker) snapshot() progressSnapshot {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	elapsed := time.Since(p.startTime)
-	rate := float64(p.success+p.failed) / elapsed.Seconds()
-	log.Printf("Download completed in %v: %d successful, %d failed, %.1f files/sec", 
-		elapsed, p.success, p.failed, rate)
-}
\ No newline at end of file
+	return progressSnapshot{
+		total:      p.total.Load(),
+		success:    p.success.Load(),
+		failed:     p.failed.Load(),
+		bytes:      p.bytes.Load(),
+		bytesTotal: p.bytesTotal.Load(),
+		elapsed:    time.Since(p.startTime),
+	}
+}
+
+// logProgress reports current progress to the event handler when completed,
+// the count of finished downloads including the one just counted, is a
+// hundredth or the last one
+func (p *ProgressTracker) logProgress(completed int64) {
+	total := p.total.Load()
+	if completed%100 != 0 && completed != total {
+		return
+	}
+	// A tracker not created by a Syncer logs its progress
+	var events SyncEventHandler = logEventHandler{progress: p}
+	if p.events != nil {
+		events = p.events
+	}
+	snap := p.snapshot()
+	events.OnProgress(int(completed), int(snap.total), float64(snap.bytes)/snap.elapsed.Seconds())
+}
+
+// bytesETA describes the downloaded share of bytesTotal and the time left at
+// the current byte rate, or returns "" when no sizes are known
+func (s progressSnapshot) bytesETA() string {
+	if s.bytesTotal <= 0 || s.bytes <= 0 {
+		return ""
+	}
+	remaining := max(s.bytesTotal-s.bytes, 0)
+	eta := time.Duration(float64(s.elapsed) * float64(remaining) / float64(s.bytes))
+	return fmt.Sprintf(", Bytes: %d/%d (%.1f%%), ETA: %v",
+		s.bytes, s.bytesTotal, float64(s.bytes)*100/float64(s.bytesTotal), eta.Round(time.Second))
+}
+
+// Finish logs final statistics and sends those not yet emitted to CloudWatch
+func (p *ProgressTracker) Finish() {
+	snap := p.snapshot()
+	rate := float64(snap.success+snap.failed) / snap.elapsed.Seconds()
+	log.Printf("Download completed in %v: %d successful, %d failed, %.1f files/sec",
+		snap.elapsed, snap.success, snap.failed, rate)
+
+	if p.cloudwatch == nil {
+		return
+	}
+	p.cloudwatch.Wait()
+	ctx, cancel := context.WithTimeout(context.Background(), finalFlushTimeout)
+	defer cancel()
+	if err := p.cloudwatch.Emit(ctx); err != nil {
+		log.Printf("Failed to emit CloudWatch metrics: %v", err)
+	}
+}
@@ -0,0 +1,452 @@
+package syncer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"sava-s3-export/internal/aws"
+	"sava-s3-export/internal/aws/awstest"
+	"sava-s3-export/internal/config"
+	"sava-s3-export/internal/database"
+)
+
+// newTestConfig returns the configuration of a syncer of prefix p/ whose
+// local directory and database are in a temporary directory, with env set
+// on top
+func newTestConfig(t testing.TB, env map[string]string) *config.Config {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("S3_BUCKET", "bucket")
+	t.Setenv("S3_PREFIX", "p/")
+	t.Setenv("LOCAL_DIR", filepath.Join(dir, "data"))
+	t.Setenv("DB_PATH", filepath.Join(dir, "db.parquet"))
+	t.Setenv("AWS_REGION", "us-east-1")
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+	return config.Load()
+}
+
+// newTestSyncer creates a syncer of cfg on fake, closed when the test ends
+func newTestSyncer(t testing.TB, cfg *config.Config, fake *awstest.FakeS3Client, opts ...Option) *Syncer {
+	t.Helper()
+	s, err := NewSyncerWithClient(cfg, fake, opts...)
+	if err != nil {
+		t.Fatalf("NewSyncerWithClient: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestGetFilesToDownload(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		// record is the stored record of the object, none when nil
+		record *database.FileRecord
+		want   bool
+	}{
+		{
+			name: "new object",
+			want: true,
+		},
+		{
+			name:   "unchanged object",
+			record: &database.FileRecord{SyncStatus: "downloaded"},
+			want:   false,
+		},
+		{
+			name:   "changed ETag",
+			record: &database.FileRecord{ETag: `"stale"`, SyncStatus: "downloaded"},
+			want:   true,
+		},
+		{
+			name:   "failed download with changed ETag",
+			record: &database.FileRecord{ETag: `"stale"`, SyncStatus: "failed"},
+			want:   true,
+		},
+		{
+			name:   "failed download of the same object",
+			record: &database.FileRecord{SyncStatus: "failed"},
+			want:   false,
+		},
+		{
+			name:   "pending retry",
+			record: &database.FileRecord{SyncStatus: "pending"},
+			want:   true,
+		},
+		{
+			name:   "timed out",
+			record: &database.FileRecord{SyncStatus: "timeout"},
+			want:   true,
+		},
+		{
+			name:   "interrupted staging",
+			record: &database.FileRecord{SyncStatus: "staging"},
+			want:   true,
+		},
+		{
+			name:   "missing at verification",
+			record: &database.FileRecord{SyncStatus: "missing"},
+			want:   true,
+		},
+		{
+			name:   "corrupt at verification",
+			record: &database.FileRecord{SyncStatus: "checksum_failed"},
+			want:   true,
+		},
+		{
+			name: "larger than MAX_FILE_SIZE_BYTES",
+			env:  map[string]string{"MAX_FILE_SIZE_BYTES": "4"},
+			want: false,
+		},
+		{
+			name: "within MAX_FILE_SIZE_BYTES",
+			env:  map[string]string{"MAX_FILE_SIZE_BYTES": "8"},
+			want: true,
+		},
+		{
+			name:   "forced by FORCE_REDOWNLOAD",
+			env:    map[string]string{"FORCE_REDOWNLOAD": "true"},
+			record: &database.FileRecord{SyncStatus: "downloaded"},
+			want:   true,
+		},
+		{
+			name:   "forced by FORCE_KEYS",
+			env:    map[string]string{"FORCE_KEYS": "p/*.csv"},
+			record: &database.FileRecord{SyncStatus: "downloaded"},
+			want:   true,
+		},
+		{
+			name:   "not matched by FORCE_KEYS",
+			env:    map[string]string{"FORCE_KEYS": "p/*.json"},
+			record: &database.FileRecord{SyncStatus: "downloaded"},
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const key = "p/data.csv"
+			fake := awstest.NewFakeS3Client("p/")
+			fake.AddObject(key, []byte("contents"), modified)
+			s := newTestSyncer(t, newTestConfig(t, tt.env), fake)
+
+			ctx := context.Background()
+			files, err := fake.ListFiles(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.record != nil {
+				record := *tt.record
+				record.S3Key = key
+				if record.ETag == "" {
+					record.ETag = *files[0].ETag
+				}
+				record.LastModified = modified.Unix()
+				if err := s.db.WriteRecords([]database.FileRecord{record}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			records, err := s.db.ReadAllRecords(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := s.getFilesToDownload(ctx, files, records)
+			if included := len(got) == 1; included != tt.want {
+				t.Errorf("getFilesToDownload included %s = %v, want %v", key, included, tt.want)
+			}
+		})
+	}
+}
+
+func TestChangeFilterKeepsOrder(t *testing.T) {
+	fake := awstest.NewFakeS3Client("p/")
+	modified := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	for _, key := range []string{"p/a", "p/b", "p/c", "p/d"} {
+		fake.AddObject(key, []byte(key), modified)
+	}
+	s := newTestSyncer(t, newTestConfig(t, nil), fake)
+
+	ctx := context.Background()
+	files, err := fake.ListFiles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// p/b is up to date and p/d changed
+	records := map[string]database.FileRecord{
+		"p/b": {S3Key: "p/b", ETag: *files[1].ETag, SyncStatus: "downloaded"},
+		"p/d": {S3Key: "p/d", ETag: `"stale"`, SyncStatus: "downloaded"},
+	}
+
+	got := objectKeys(s.getFilesToDownload(ctx, files, records))
+	if want := []string{"p/a", "p/c", "p/d"}; !slices.Equal(got, want) {
+		t.Errorf("getFilesToDownload = %v, want %v", got, want)
+	}
+}
+
+// objectKeys returns the keys of files
+func objectKeys(files []types.Object) []string {
+	keys := make([]string, len(files))
+	for i, f := range files {
+		keys[i] = *f.Key
+	}
+	return keys
+}
+
+// BenchmarkGetFilesToDownload compares 1M listed files with 1M records, of
+// which one in ten changed
+func BenchmarkGetFilesToDownload(b *testing.B) {
+	const n = 1_000_000
+	s := newTestSyncer(b, newTestConfig(b, nil), awstest.NewFakeS3Client("p/"))
+
+	modified := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	files := make([]types.Object, n)
+	records := make([]database.FileRecord, n)
+	for i := range files {
+		key := fmt.Sprintf("p/%04d/part-%08d.csv.gz", i%1000, i)
+		etag := fmt.Sprintf(`"%032x"`, i)
+		size := int64(i)
+		files[i] = types.Object{Key: &key, ETag: &etag, Size: &size, LastModified: &modified}
+		records[i] = database.FileRecord{S3Key: key, ETag: etag, LastModified: modified.Unix(), SyncStatus: "downloaded", FileSizeBytes: size}
+		if i%10 == 0 {
+			records[i].ETag = `"stale"`
+		}
+	}
+	if err := s.db.WriteRecords(records); err != nil {
+		b.Fatal(err)
+	}
+	ctx := context.Background()
+	localRecords, err := s.db.ReadAllRecords(ctx)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for range b.N {
+		if got := s.getFilesToDownload(ctx, files, localRecords); len(got) != n/10 {
+			b.Fatalf("getFilesToDownload returned %d files, want %d", len(got), n/10)
+		}
+	}
+}
+
+func TestNewInspectorLeavesSyncStateAlone(t *testing.T) {
+	dir := t.TempDir()
+	auditPath := filepath.Join(dir, "audit.log")
+	cfg := newTestConfig(t, map[string]string{
+		"AWS_ACCESS_KEY_ID":     "test",
+		"AWS_SECRET_ACCESS_KEY": "test",
+		"AUDIT_LOG_PATH":        auditPath,
+		"STAGING_TTL":           "1s",
+	})
+
+	// A staged file old enough for a sync to clean up
+	staged := filepath.Join(cfg.StagingDir(), "old.csv")
+	if err := os.MkdirAll(filepath.Dir(staged), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(staged, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(staged, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewInspector(cfg)
+	if err != nil {
+		t.Fatalf("NewInspector: %v", err)
+	}
+	defer s.Close()
+
+	if _, err := s.Status(context.Background()); err != nil {
+		t.Errorf("Status: %v", err)
+	}
+	if _, err := os.Stat(staged); err != nil {
+		t.Errorf("staged file: %v, want it left in place", err)
+	}
+	if _, err := os.Stat(auditPath); !os.IsNotExist(err) {
+		t.Errorf("audit log opened (stat: %v), want no audit log", err)
+	}
+}
+
+func TestStatusDatabaseStats(t *testing.T) {
+	cfg := newTestConfig(t, nil)
+	s := newTestSyncer(t, cfg, awstest.NewFakeS3Client("p/"))
+
+	synced := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	records := []database.FileRecord{
+		{S3Key: "p/a.csv", SyncStatus: "downloaded", FileSizeBytes: 10, LastSyncedAt: synced.Unix()},
+		{S3Key: "p/b.csv", SyncStatus: "failed", FileSizeBytes: 5, LastSyncedAt: synced.Add(time.Hour).Unix()},
+	}
+	if err := s.db.WriteRecords(records); err != nil {
+		t.Fatal(err)
+	}
+	// The PID lock beside the database is not part of it
+	if err := os.WriteFile(cfg.DB_PATH+".lock", make([]byte, 1<<20), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(cfg.DB_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := s.Status(context.Background())
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	got := report.Database
+	if got.TotalRecords != 2 || got.ByStatus["downloaded"] != 1 || got.ByStatus["failed"] != 1 {
+		t.Errorf("Database = %d records by status %v, want 1 downloaded and 1 failed", got.TotalRecords, got.ByStatus)
+	}
+	if got.TotalTrackedBytes != 15 {
+		t.Errorf("TotalTrackedBytes = %d, want 15", got.TotalTrackedBytes)
+	}
+	if !got.OldestRecord.Equal(synced) || !got.NewestRecord.Equal(synced.Add(time.Hour)) {
+		t.Errorf("records span %v to %v, want %v to %v", got.OldestRecord, got.NewestRecord, synced, synced.Add(time.Hour))
+	}
+	if got.FileSizeBytes != info.Size() {
+		t.Errorf("FileSizeBytes = %d, want %d, the size of the database file", got.FileSizeBytes, info.Size())
+	}
+}
+
+func TestSyncRedownloadsCorruptFile(t *testing.T) {
+	const key = "p/data.csv"
+	contents := []byte("a,1\nb,2\n")
+	fake := awstest.NewFakeS3Client("p/")
+	fake.AddObject(key, contents, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC))
+	s := newTestSyncer(t, newTestConfig(t, nil), fake)
+
+	ctx := context.Background()
+	if _, err := s.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	records, err := s.db.ReadAllRecords(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	localPath := records[key].LocalPath
+	if err := os.WriteFile(localPath, []byte("a,1\nb,X\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Verify without --repair leaves the record for the next sync
+	if err := s.Verify(ctx, io.Discard); !errors.Is(err, ErrVerifyFailed) {
+		t.Fatalf("Verify: %v, want ErrVerifyFailed", err)
+	}
+	if records, err = s.db.ReadAllRecords(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := records[key].SyncStatus; got != "checksum_failed" {
+		t.Fatalf("status after Verify = %q, want checksum_failed", got)
+	}
+
+	if _, err := s.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	got, err := os.ReadFile(localPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, contents) {
+		t.Errorf("local file = %q, want it downloaded again as %q", got, contents)
+	}
+	if records, err = s.db.ReadAllRecords(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := records[key].SyncStatus; got != "downloaded" {
+		t.Errorf("status after sync = %q, want downloaded", got)
+	}
+}
+
+func TestMaxFilesPerRun(t *testing.T) {
+	fake := awstest.NewFakeS3Client("p/")
+	oldest := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 5 {
+		key := fmt.Sprintf("p/%d.csv", i)
+		fake.AddObject(key, []byte(key), oldest.Add(time.Duration(4-i)*time.Hour))
+	}
+	s := newTestSyncer(t, newTestConfig(t, map[string]string{"MAX_FILES_PER_RUN": "2"}), fake)
+
+	ctx := context.Background()
+	result, err := s.RunOnce(ctx)
+	if err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	// The deferred files count as skipped, so every listed file is reported
+	if result.FilesDownloaded != 2 || result.FilesSkipped != 3 {
+		t.Errorf("downloaded %d and skipped %d files, want 2 and 3", result.FilesDownloaded, result.FilesSkipped)
+	}
+	records, err := s.db.ReadAllRecords(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for key := range records {
+		got = append(got, key)
+	}
+	slices.Sort(got)
+	if want := []string{"p/3.csv", "p/4.csv"}; !slices.Equal(got, want) {
+		t.Errorf("downloaded %v, want the least recently modified %v", got, want)
+	}
+}
+
+// closeCountingClient is an S3 client that counts its Close calls
+type closeCountingClient struct {
+	aws.S3ClientInterface
+	closes *atomic.Int32
+}
+
+func (c closeCountingClient) Close() error {
+	c.closes.Add(1)
+	return c.S3ClientInterface.Close()
+}
+
+func TestNewSyncerClosesOnError(t *testing.T) {
+	errClient := errors.New("no credentials")
+	tests := []struct {
+		name string
+		env  map[string]string
+	}{
+		{
+			name: "invalid configuration",
+			env:  map[string]string{"FORCE_KEYS": "p/[a"},
+		},
+		{
+			name: "target client fails",
+			env: map[string]string{
+				"AUDIT_LOG_PATH": filepath.Join(t.TempDir(), "audit.log"),
+				"SYNC_TARGETS":   "[{prefix: p/a/, local_dir: " + t.TempDir() + ", db_path_suffix: a}]",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var closes atomic.Int32
+			client := closeCountingClient{awstest.NewFakeS3Client("p/"), &closes}
+			_, err := newSyncer(newTestConfig(t, tt.env), client, func(*config.Config) (aws.S3ClientInterface, error) {
+				return nil, errClient
+			})
+			if err == nil {
+				t.Fatal("newSyncer succeeded, want an error")
+			}
+			if n := closes.Load(); n != 1 {
+				t.Errorf("S3 client closed %d times, want once", n)
+			}
+		})
+	}
+}
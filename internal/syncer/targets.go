@@ -0,0 +1,177 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"sava-s3-export/internal/aws"
+	"sava-s3-export/internal/config"
+	"sava-s3-export/internal/database"
+	"sava-s3-export/internal/watcher"
+)
+
+// newTarget creates the child Syncer of a SYNC_TARGETS entry. It has its own
+// prefix, local directory, S3 client and database, but shares rate limiting,
+// progress, the circuit breaker and shutdown state with s.
+func (s *Syncer) newTarget(target config.SyncTarget, newClient func(*config.Config) (aws.S3ClientInterface, error)) (*Syncer, error) {
+	cfg := *s.cfg
+	cfg.S3_PREFIX = target.Prefix
+	cfg.LOCAL_DIR = target.LocalDir
+	cfg.DB_PATH = target.DBPath(s.cfg.DB_PATH)
+	cfg.SYNC_TARGETS = ""
+	if cfg.STAGING_DIR != "" {
+		// Keep the staged files of targets with the same relative paths apart
+		cfg.STAGING_DIR = filepath.Join(cfg.STAGING_DIR, strings.ReplaceAll(strings.Trim(target.Prefix, "/"), "/", "_"))
+	}
+
+	client, err := newClient(&cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client for target %s: %w", target.Prefix, err)
+	}
+	if s.breaker != nil {
+		client = aws.NewCircuitBreakerClient(client, s.breaker)
+	}
+
+	db, err := database.OpenParquetDB(cfg.DB_PATH, cfg.BATCH_SIZE, cfg.PARTITION_BY_DATE)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to create database for target %s: %w", target.Prefix, err)
+	}
+	db.EnableBloomFilter(cfg.BLOOM_FALSE_POSITIVE_RATE)
+	db.SetReadWorkers(cfg.PARQUET_READ_WORKERS)
+	if s.cloudwatch != nil {
+		db.OnFlush(s.cloudwatch.EmitInBackground)
+	}
+
+	var localWatcher *watcher.Watcher
+	if cfg.FILE_WATCHER_ENABLED {
+		localWatcher = watcher.New(cfg.LOCAL_DIR, db, cfg.StagingDir())
+	}
+
+	var slots chan struct{}
+	if cfg.WORKERS_PER_PREFIX > 0 {
+		slots = make(chan struct{}, cfg.WORKERS_PER_PREFIX)
+	}
+
+	return &Syncer{
+		s3Client:         client,
+		db:               db,
+		cfg:              &cfg,
+		rateLimiter:      s.rateLimiter,
+		progress:         s.progress,
+		concurrency:      s.concurrency,
+		deadLetters:      s.deadLetters,
+		publisher:        s.publisher,
+		dedup:            s.dedup,
+		breaker:          s.breaker,
+		throttle:         s.throttle,
+		cloudwatch:       s.cloudwatch,
+		costs:            s.costs,
+		costConfirmed:    s.costConfirmed,
+		manifest:         s.manifest,
+		auditLog:         s.auditLog,
+		localWatcher:     localWatcher,
+		pathTemplate:     s.pathTemplate,
+		inFlight:         s.inFlight,
+		stopping:         s.stopping,
+		paused:           s.paused,
+		isTarget:         true,
+		slots:            slots,
+		filters:          s.filters,
+		eventHandler:     s.eventHandler,
+		PreDownloadHook:  s.PreDownloadHook,
+		PostDownloadHook: s.PostDownloadHook,
+	}, nil
+}
+
+// runTargets syncs every target, running up to PARALLEL_TARGET_COUNT of them
+// at once. A failing target does not stop the others; all errors are returned.
+func (s *Syncer) runTargets(ctx context.Context) error {
+	log.Printf("Syncing %d targets, %d at a time", len(s.targets), s.cfg.PARALLEL_TARGET_COUNT)
+	s.progress.Start(0)
+	defer s.progress.Finish()
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	sem := make(chan struct{}, s.cfg.PARALLEL_TARGET_COUNT)
+	for _, target := range s.targets {
+		if s.inFlight.isStopping() || ctx.Err() != nil {
+			break
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(t *Syncer) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			log.Printf("Syncing target %s into %s", t.cfg.S3_PREFIX, t.cfg.LOCAL_DIR)
+			if err := t.run(ctx); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("target %s: %w", t.cfg.S3_PREFIX, err))
+				mu.Unlock()
+			}
+		}(target)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// acquireSlot blocks until the target's WORKERS_PER_PREFIX pool has room for
+// another download or ctx is cancelled. Without a pool it returns at once.
+func (s *Syncer) acquireSlot(ctx context.Context) error {
+	if s.slots == nil {
+		return nil
+	}
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// releaseSlot returns a slot taken with acquireSlot
+func (s *Syncer) releaseSlot() {
+	if s.slots != nil {
+		<-s.slots
+	}
+}
+
+// targetFor returns the syncer responsible for key: s itself when no
+// SYNC_TARGETS are configured, otherwise the target with the longest matching
+// prefix, or nil if none matches
+func (s *Syncer) targetFor(key string) *Syncer {
+	if len(s.targets) == 0 {
+		return s
+	}
+	var best *Syncer
+	for _, t := range s.targets {
+		if strings.HasPrefix(key, t.cfg.S3_PREFIX) && (best == nil || len(t.cfg.S3_PREFIX) > len(best.cfg.S3_PREFIX)) {
+			best = t
+		}
+	}
+	return best
+}
+
+// filterPrefix drops the objects outside prefix, which a client shared between
+// targets may return
+func filterPrefix(files []types.Object, prefix string) []types.Object {
+	filtered := files[:0]
+	for _, f := range files {
+		if strings.HasPrefix(*f.Key, prefix) {
+			filtered = append(filtered, f)
+		}
+	}
+	return filtered
+}
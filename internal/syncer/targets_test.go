@@ -0,0 +1,105 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"sava-s3-export/internal/aws"
+	"sava-s3-export/internal/aws/awstest"
+	"sava-s3-export/internal/config"
+)
+
+// slowClient is an S3 client whose downloads each take delay
+type slowClient struct {
+	aws.S3ClientInterface
+	delay time.Duration
+}
+
+func (c slowClient) DownloadFile(ctx context.Context, obj types.Object, localPath string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(c.delay):
+	}
+	return c.S3ClientInterface.DownloadFile(ctx, obj, localPath)
+}
+
+// BenchmarkWorkersPerPrefixFairness syncs a fast and a slow SYNC_TARGETS
+// prefix at once through an 8-worker ADAPTIVE_CONCURRENCY limit, shared as
+// a whole or split by WORKERS_PER_PREFIX, and reports the download rate of
+// each prefix. Without per-prefix pools the slow prefix holds most of the
+// workers and the fast one is held back.
+func BenchmarkWorkersPerPrefixFairness(b *testing.B) {
+	const files = 40
+	delays := map[string]time.Duration{"p/fast/": 2 * time.Millisecond, "p/slow/": 50 * time.Millisecond}
+
+	for _, perPrefix := range []int{0, 4} {
+		b.Run(fmt.Sprintf("WORKERS_PER_PREFIX=%d", perPrefix), func(b *testing.B) {
+			dir := b.TempDir()
+			clients := map[string]aws.S3ClientInterface{}
+			var targets []string
+			for prefix, delay := range delays {
+				fake := awstest.NewFakeS3Client(prefix)
+				for i := range files {
+					fake.AddObject(fmt.Sprintf("%s%03d.csv", prefix, i), []byte("x"), time.Now())
+				}
+				clients[prefix] = slowClient{fake, delay}
+				name := strings.Trim(strings.TrimPrefix(prefix, "p/"), "/")
+				targets = append(targets, fmt.Sprintf("{prefix: %s, local_dir: %s, db_path_suffix: %s}",
+					prefix, filepath.Join(dir, name), name))
+			}
+
+			var (
+				mu    sync.Mutex
+				start time.Time
+				last  = map[string]time.Time{}
+			)
+			record := func(ctx context.Context, key, localPath, etag string) error {
+				mu.Lock()
+				defer mu.Unlock()
+				last[key[:strings.LastIndex(key, "/")+1]] = time.Now()
+				return nil
+			}
+
+			cfg := newTestConfig(b, map[string]string{
+				"SYNC_TARGETS":          "[" + strings.Join(targets, ", ") + "]",
+				"PARALLEL_TARGET_COUNT": "2",
+				"MAX_WORKERS":           "8",
+				"ADAPTIVE_CONCURRENCY":  "true",
+				"WORKERS_PER_PREFIX":    fmt.Sprint(perPrefix),
+				"FORCE_REDOWNLOAD":      "true",
+			})
+			newClient := func(cfg *config.Config) (aws.S3ClientInterface, error) {
+				return clients[cfg.S3_PREFIX], nil
+			}
+			s, err := newSyncer(cfg, awstest.NewFakeS3Client("p/"), newClient, WithPostDownloadHook(record))
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.Cleanup(func() { s.Close() })
+
+			elapsed := map[string]time.Duration{}
+			b.ResetTimer()
+			for range b.N {
+				start = time.Now()
+				if _, err := s.RunOnce(context.Background()); err != nil {
+					b.Fatal(err)
+				}
+				for prefix := range delays {
+					elapsed[prefix] += last[prefix].Sub(start)
+				}
+			}
+			for prefix := range delays {
+				name := strings.Trim(strings.TrimPrefix(prefix, "p/"), "/")
+				b.ReportMetric(float64(files*b.N)/elapsed[prefix].Seconds(), name+"-files/s")
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/smithy-go"
+
+	"sava-s3-export/internal/metrics"
+)
+
+// throttleWindow is how far back 503 responses are counted
+const throttleWindow = 10 * time.Second
+
+// ThrottleDetector pauses the whole worker pool when S3 keeps answering 503
+// Slow Down. The SDK already retries single requests; when more than
+// threshold throttled responses arrive within 10 seconds across all workers,
+// every worker instead waits for backoff before starting its next file.
+//
+// A nil detector never pauses.
+type ThrottleDetector struct {
+	threshold int
+	backoff   time.Duration
+
+	mu   sync.Mutex
+	hits []time.Time
+	// pause is non-nil while the workers are paused and closed on resume
+	pause chan struct{}
+}
+
+// NewThrottleDetector creates a detector that pauses for backoff once more
+// than threshold 503 responses arrive within the window
+func NewThrottleDetector(threshold int, backoff time.Duration) *ThrottleDetector {
+	return &ThrottleDetector{threshold: threshold, backoff: backoff}
+}
+
+// Observe records err from an S3 call, counting it if S3 throttled the request
+func (d *ThrottleDetector) Observe(err error) {
+	if d == nil || !isThrottled(err) {
+		return
+	}
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.pause != nil {
+		// Responses to requests sent before the pause do not extend it
+		return
+	}
+
+	recent := d.hits[:0]
+	for _, t := range d.hits {
+		if now.Sub(t) < throttleWindow {
+			recent = append(recent, t)
+		}
+	}
+	d.hits = append(recent, now)
+	if len(d.hits) <= d.threshold {
+		return
+	}
+
+	log.Printf("Warning: S3 returned %d Slow Down responses in %v, pausing all downloads for %v", len(d.hits), throttleWindow, d.backoff)
+	metrics.ThrottleActivations.Inc()
+	pause := make(chan struct{})
+	d.pause = pause
+	d.hits = d.hits[:0]
+	time.AfterFunc(d.backoff, func() {
+		d.mu.Lock()
+		d.pause = nil
+		d.mu.Unlock()
+		close(pause)
+		log.Println("Resuming downloads after S3 throttling")
+	})
+}
+
+// Wait blocks while the workers are paused or until ctx is cancelled
+func (d *ThrottleDetector) Wait(ctx context.Context) error {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	pause := d.pause
+	d.mu.Unlock()
+	if pause == nil {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-pause:
+		return nil
+	}
+}
+
+// isThrottled reports whether err is an HTTP 503 or SlowDown response from S3
+func isThrottled(err error) bool {
+	if err == nil {
+		return false
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "SlowDown" {
+		return true
+	}
+	var respErr interface{ HTTPStatusCode() int }
+	return errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusServiceUnavailable
+}
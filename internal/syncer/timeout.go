@@ -0,0 +1,44 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// finalFlushTimeout bounds the database work done after a cycle's context has
+// been cancelled, so partial progress is kept without hanging the exit
+const finalFlushTimeout = 5 * time.Second
+
+// errGlobalTimeout is the cancellation cause of a cycle that ran longer than
+// GLOBAL_TIMEOUT_SECONDS
+var errGlobalTimeout = errors.New("global timeout reached")
+
+// withGlobalTimeout bounds a sync cycle by GLOBAL_TIMEOUT_SECONDS when set.
+// Cancelling the returned context stops every in-flight listing and download.
+func (s *Syncer) withGlobalTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.cfg.GLOBAL_TIMEOUT_SECONDS <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, s.cfg.GLOBAL_TIMEOUT_SECONDS, errGlobalTimeout)
+}
+
+// checkAborted logs why a cycle ended early and makes sure a cycle stopped
+// by GLOBAL_TIMEOUT_SECONDS fails even when every worker gave up quietly
+func (s *Syncer) checkAborted(ctx context.Context, err error) error {
+	if ctx.Err() == nil {
+		return err
+	}
+	cause := context.Cause(ctx)
+	if errors.Is(cause, errGlobalTimeout) {
+		log.Printf("Global timeout of %v reached, aborting sync; unfinished files will be retried on the next run", s.cfg.GLOBAL_TIMEOUT_SECONDS)
+		if err == nil {
+			return fmt.Errorf("sync aborted: %w after %v", errGlobalTimeout, s.cfg.GLOBAL_TIMEOUT_SECONDS)
+		}
+		return fmt.Errorf("sync aborted: %w after %v: %w", errGlobalTimeout, s.cfg.GLOBAL_TIMEOUT_SECONDS, err)
+	}
+	log.Printf("Sync cancelled by user: %v", cause)
+	return err
+}
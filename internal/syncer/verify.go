@@ -0,0 +1,288 @@
+package syncer
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"sava-s3-export/internal/aws"
+	"sava-s3-export/internal/database"
+)
+
+// ErrVerifyFailed is returned by Verify when at least one file is corrupt or missing
+var ErrVerifyFailed = errors.New("verification failed")
+
+// VerifyMismatch describes a downloaded file that failed verification
+type VerifyMismatch struct {
+	S3Key     string `json:"s3_key"`
+	LocalPath string `json:"local_path"`
+	Status    string `json:"status"`
+	Expected  string `json:"expected,omitempty"`
+	Actual    string `json:"actual,omitempty"`
+	Repaired  bool   `json:"repaired"`
+}
+
+// Verify re-hashes every downloaded file and compares it against the ETag
+// currently in S3, after checking its size. Each mismatch is written to w as
+// a JSON line and the record is marked "checksum_failed", or "missing" when
+// the file is gone from disk. Multipart ETags are not a content hash, so
+// those files are only checked for presence and size.
+func (s *Syncer) Verify(ctx context.Context, w io.Writer) error {
+	return s.verify(ctx, w, nil, false)
+}
+
+// VerifyAndRepair behaves like Verify but re-downloads every corrupt or missing file
+func (s *Syncer) VerifyAndRepair(ctx context.Context, w io.Writer) error {
+	return s.verify(ctx, w, nil, true)
+}
+
+// VerifyKeys behaves like Verify, or VerifyAndRepair with repair set, for
+// the given keys only. Their ETag, size and checksum are fetched with one
+// GetObjectAttributes call each instead of listing the whole prefix, so a
+// file uploaded in parts with a SHA256 checksum is checked against it.
+func (s *Syncer) VerifyKeys(ctx context.Context, w io.Writer, keys []string, repair bool) error {
+	return s.verify(ctx, w, keys, repair)
+}
+
+func (s *Syncer) verify(ctx context.Context, w io.Writer, keys []string, repair bool) error {
+	records, err := s.db.ReadAllRecords(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read local database: %w", err)
+	}
+
+	var remotes map[string]remoteObject
+	if keys != nil {
+		selected := make(map[string]database.FileRecord, len(keys))
+		for _, key := range keys {
+			record, ok := records[key]
+			if !ok {
+				return fmt.Errorf("%w: %s", database.ErrRecordNotFound, key)
+			}
+			selected[key] = record
+		}
+		records = selected
+		if remotes, err = s.statObjects(ctx, keys); err != nil {
+			return err
+		}
+	} else if remotes, err = s.listObjects(ctx); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	checked, failed := 0, 0
+	for _, record := range records {
+		if record.SyncStatus != "downloaded" {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		checked++
+
+		remote, ok := remotes[record.S3Key]
+		if !ok {
+			remote = remoteObject{etag: record.ETag, size: -1}
+		}
+		etag := remote.etag
+
+		// A decompressed file or S3 Select result does not match the
+		// object, so only check that it is present
+		expected := remote
+		if s.cfg.DECOMPRESS_ON_DOWNLOAD || s.cfg.S3_SELECT_EXPRESSION != "" {
+			expected = remoteObject{size: -1}
+		}
+
+		mismatch, err := verifyFile(record, expected)
+		if err != nil {
+			log.Printf("Failed to verify %s: %v", record.S3Key, err)
+			continue
+		}
+		if mismatch == nil {
+			continue
+		}
+
+		status := mismatch.Status
+		if repair {
+			if localPath, err := s.repairFile(ctx, record); err != nil {
+				log.Printf("Failed to repair %s: %v", record.S3Key, err)
+			} else {
+				mismatch.Repaired = true
+				status = "downloaded"
+				record.ETag = etag
+				record.LocalPath = localPath
+			}
+		}
+		if !mismatch.Repaired {
+			failed++
+		}
+
+		if err := s.db.BatchUpdate(record.S3Key, record.ETag, record.LocalPath, status, time.Unix(record.LastModified, 0)); err != nil {
+			log.Printf("Failed to update database for %s: %v", record.S3Key, err)
+		}
+		if err := enc.Encode(mismatch); err != nil {
+			return fmt.Errorf("failed to write verify result: %w", err)
+		}
+	}
+
+	if err := s.db.FlushBatch(); err != nil {
+		return fmt.Errorf("failed to flush verify results: %w", err)
+	}
+
+	log.Printf("Verified %d files, %d failed", checked, failed)
+	if failed > 0 {
+		return fmt.Errorf("%w: %d of %d files", ErrVerifyFailed, failed, checked)
+	}
+	return nil
+}
+
+// remoteObject is what verify compares a downloaded file with: the ETag of
+// its object, its size, or -1 when unknown, and its full-object SHA256
+// checksum when S3 has one
+type remoteObject struct {
+	etag     string
+	size     int64
+	checksum string
+}
+
+// listObjects returns the current ETag and size of every object under the prefix
+func (s *Syncer) listObjects(ctx context.Context) (map[string]remoteObject, error) {
+	s3Files, err := s.listFiles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list S3 files: %w", err)
+	}
+	remotes := make(map[string]remoteObject, len(s3Files))
+	for _, f := range s3Files {
+		size := int64(-1)
+		if f.Size != nil {
+			size = *f.Size
+		}
+		remotes[*f.Key] = remoteObject{etag: *f.ETag, size: size}
+	}
+	return remotes, nil
+}
+
+// verifyAttributes are the attributes statObjects fetches for each key
+var verifyAttributes = []types.ObjectAttributes{
+	types.ObjectAttributesEtag,
+	types.ObjectAttributesChecksum,
+	types.ObjectAttributesObjectSize,
+}
+
+// statObjects returns the current ETag, size and checksum of each of keys
+// that still exists
+func (s *Syncer) statObjects(ctx context.Context, keys []string) (map[string]remoteObject, error) {
+	remotes := make(map[string]remoteObject, len(keys))
+	for _, key := range keys {
+		attrs, err := s.s3Client.GetAttributes(ctx, key, verifyAttributes)
+		if errors.Is(err, aws.ErrObjectNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		remote := remoteObject{size: -1, checksum: aws.FullObjectSHA256(attrs)}
+		if attrs.ETag != nil {
+			// Unlike listings, GetObjectAttributes leaves out the quotes
+			remote.etag = `"` + strings.Trim(*attrs.ETag, `"`) + `"`
+		}
+		if attrs.ObjectSize != nil {
+			remote.size = *attrs.ObjectSize
+		}
+		remotes[key] = remote
+	}
+	return remotes, nil
+}
+
+// repairFile downloads record again and returns its new local path, which
+// differs from the recorded one only for decompressed or routed files
+func (s *Syncer) repairFile(ctx context.Context, record database.FileRecord) (string, error) {
+	defer s.localWatcher.Suppress(record.LocalPath)()
+	lastModified := time.Unix(record.LastModified, 0)
+	if !s.cfg.DECOMPRESS_ON_DOWNLOAD && len(s.cfg.CONTENT_TYPE_ROUTING) == 0 {
+		if err := s.fetchStaged(ctx, record.S3Key, record.LocalPath); err != nil {
+			return "", err
+		}
+		s.preserveTimestamp(record.LocalPath, lastModified)
+		return record.LocalPath, nil
+	}
+
+	localPath := s.localPath(record.S3Key, lastModified)
+	defer s.localWatcher.Suppress(localPath)()
+	if err := s.fetchStaged(ctx, record.S3Key, localPath); err != nil {
+		return "", err
+	}
+	finalPath := s.postProcess(localPath)
+	defer s.localWatcher.Suppress(finalPath)()
+	s.preserveTimestamp(finalPath, lastModified)
+	return finalPath, nil
+}
+
+// verifyFile checks the local file of record against want: its size, then
+// its MD5 against a single-part ETag, or else its SHA256 against the
+// checksum. It returns nil when the file is intact; a zero want with an
+// unknown size only checks presence.
+func verifyFile(record database.FileRecord, want remoteObject) (*VerifyMismatch, error) {
+	f, err := os.Open(record.LocalPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &VerifyMismatch{S3Key: record.S3Key, LocalPath: record.LocalPath, Status: "missing"}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	mismatch := func(expected, actual string) *VerifyMismatch {
+		return &VerifyMismatch{
+			S3Key:     record.S3Key,
+			LocalPath: record.LocalPath,
+			Status:    "checksum_failed",
+			Expected:  expected,
+			Actual:    actual,
+		}
+	}
+
+	if want.size >= 0 {
+		info, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		if info.Size() != want.size {
+			return mismatch(fmt.Sprintf("%d bytes", want.size), fmt.Sprintf("%d bytes", info.Size())), nil
+		}
+	}
+
+	// ETags are hex MD5s, checksums base64 SHA256s
+	var h hash.Hash
+	var expected string
+	encode := hex.EncodeToString
+	if etag := strings.Trim(want.etag, `"`); etag != "" && !strings.Contains(etag, "-") {
+		h, expected = md5.New(), etag
+	} else if want.checksum != "" {
+		h, expected, encode = sha256.New(), want.checksum, base64.StdEncoding.EncodeToString
+	} else {
+		return nil, nil
+	}
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, fmt.Errorf("failed to hash %s: %w", record.LocalPath, err)
+	}
+
+	actual := encode(h.Sum(nil))
+	if actual == expected {
+		return nil, nil
+	}
+	return mismatch(expected, actual), nil
+}
@@ -0,0 +1,92 @@
+package syncer
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// maxPollBackoff caps the delay between cycles after repeated failures
+const maxPollBackoff = time.Hour
+
+// watch runs sync cycles on a wall-clock ticker until ctx is cancelled. After
+// consecutive failed cycles the interval is doubled each time, up to maxPollBackoff.
+func (s *Syncer) watch(ctx context.Context) error {
+	interval := s.cfg.POLL_INTERVAL_SECONDS
+	log.Printf("Watch mode enabled, polling S3 every %v", interval)
+
+	if s.events != nil {
+		var eventsDone sync.WaitGroup
+		eventsDone.Add(1)
+		go func() {
+			defer eventsDone.Done()
+			s.runEvents(ctx)
+		}()
+		defer eventsDone.Wait()
+	}
+
+	// Spread the first cycle of instances that start at the same time
+	if s.cfg.POLL_JITTER_SECONDS > 0 {
+		delay := rand.N(s.cfg.POLL_JITTER_SECONDS)
+		log.Printf("Delaying first sync by %v of jitter", delay.Round(time.Millisecond))
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.stopping:
+			return nil
+		case <-time.After(delay):
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	period := interval
+	cycleStart := time.Now()
+	failures := 0
+	for {
+		if err := s.runCycle(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			failures++
+			log.Printf("Sync cycle failed (%d consecutive failures): %v", failures, err)
+		} else {
+			failures = 0
+		}
+
+		next := cycleStart.Add(period)
+		if wait := pollBackoff(interval, failures); wait != period {
+			period = wait
+			ticker.Reset(period)
+			next = time.Now().Add(period)
+		}
+		if next.Before(time.Now()) {
+			next = time.Now()
+		}
+		log.Printf("Next sync scheduled at %s", next.Format(time.RFC3339))
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.stopping:
+			return nil
+		case cycleStart = <-ticker.C:
+		}
+	}
+}
+
+// pollBackoff returns the delay before the next cycle after the given number
+// of consecutive failures
+func pollBackoff(interval time.Duration, failures int) time.Duration {
+	if failures == 0 {
+		return interval
+	}
+	wait := interval
+	for i := 1; i < failures && wait < maxPollBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, max(interval, maxPollBackoff))
+}
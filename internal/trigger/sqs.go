@@ -0,0 +1,239 @@
+package trigger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+
+	appAws "sava-s3-export/internal/aws"
+	"sava-s3-export/internal/config"
+)
+
+// receiveErrorDelay is how long Run waits after a failed ReceiveMessage call
+const receiveErrorDelay = 5 * time.Second
+
+// SQSTrigger long-polls an SQS queue for S3 event notifications and turns
+// ObjectCreated events into objects for the syncer to download
+type SQSTrigger struct {
+	client   *sqs.Client
+	queueURL string
+	bucket   string
+	// prefixes are the prefixes events are accepted for: S3_PREFIX, or
+	// every SYNC_TARGETS prefix
+	prefixes []string
+
+	// mu guards pending, which maps an S3 key to the messages waiting on its download
+	mu      sync.Mutex
+	pending map[string][]*pendingMessage
+}
+
+// pendingMessage is a received message whose keys have not all been
+// resolved yet. A message with a failed key is never deleted, so it is
+// redelivered after the visibility timeout, or moved to the queue's
+// dead-letter queue.
+type pendingMessage struct {
+	receiptHandle string
+	outstanding   int
+	failed        bool
+}
+
+// s3Event is the standard S3 event notification format
+type s3Event struct {
+	Records []struct {
+		EventName string    `json:"eventName"`
+		EventTime time.Time `json:"eventTime"`
+		S3        struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key  string `json:"key"`
+				Size int64  `json:"size"`
+				ETag string `json:"eTag"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+}
+
+// snsEnvelope wraps S3 events that are fanned out to SQS through an SNS topic
+type snsEnvelope struct {
+	Type    string `json:"Type"`
+	Message string `json:"Message"`
+}
+
+// NewSQSTrigger creates a trigger for cfg.SQS_QUEUE_URL that only accepts
+// events for the configured bucket and keys under one of prefixes
+func NewSQSTrigger(ctx context.Context, cfg *config.Config, prefixes []string) (*SQSTrigger, error) {
+	awsCfg, err := appAws.LoadAWSConfig(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SQSTrigger{
+		client:   sqs.NewFromConfig(awsCfg),
+		queueURL: cfg.SQS_QUEUE_URL,
+		bucket:   cfg.S3_BUCKET,
+		prefixes: prefixes,
+		pending:  make(map[string][]*pendingMessage),
+	}, nil
+}
+
+// Run receives messages until ctx is cancelled, sending every created object
+// to downloadCh. Messages are only deleted once Ack has been called for all
+// of their keys, so failed downloads are redelivered after the visibility timeout.
+func (t *SQSTrigger) Run(ctx context.Context, downloadCh chan<- types.Object) error {
+	log.Printf("Listening for S3 events on %s", t.queueURL)
+	for {
+		out, err := t.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(t.queueURL),
+			MaxNumberOfMessages: 10,
+			WaitTimeSeconds:     20,
+		})
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			log.Printf("Failed to receive SQS messages: %v", err)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(receiveErrorDelay):
+			}
+			continue
+		}
+
+		for _, msg := range out.Messages {
+			objects, err := t.parseMessage(aws.ToString(msg.Body))
+			if err != nil {
+				log.Printf("Discarding unparseable SQS message %s: %v", aws.ToString(msg.MessageId), err)
+			}
+			if len(objects) == 0 {
+				t.deleteMessage(ctx, aws.ToString(msg.ReceiptHandle))
+				continue
+			}
+
+			t.track(aws.ToString(msg.ReceiptHandle), objects)
+			for _, obj := range objects {
+				select {
+				case <-ctx.Done():
+					return nil
+				case downloadCh <- obj:
+				}
+			}
+		}
+	}
+}
+
+// Ack reports that key has been downloaded and recorded in the database,
+// deleting every message that has no other keys outstanding
+func (t *SQSTrigger) Ack(ctx context.Context, key string) error {
+	t.mu.Lock()
+	messages := t.pending[key]
+	delete(t.pending, key)
+	var done []string
+	for _, m := range messages {
+		m.outstanding--
+		if m.outstanding == 0 && !m.failed {
+			done = append(done, m.receiptHandle)
+		}
+	}
+	t.mu.Unlock()
+
+	for _, handle := range done {
+		if err := t.deleteMessage(ctx, handle); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Nack reports that key was not downloaded. Its messages are kept in the
+// queue and key is forgotten, so pending does not grow with failed keys.
+func (t *SQSTrigger) Nack(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, m := range t.pending[key] {
+		m.outstanding--
+		m.failed = true
+	}
+	delete(t.pending, key)
+}
+
+// track registers a message as waiting on the download of objects
+func (t *SQSTrigger) track(receiptHandle string, objects []types.Object) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	m := &pendingMessage{receiptHandle: receiptHandle, outstanding: len(objects)}
+	for _, obj := range objects {
+		key := aws.ToString(obj.Key)
+		t.pending[key] = append(t.pending[key], m)
+	}
+}
+
+// deleteMessage removes a message from the queue, logging any failure
+func (t *SQSTrigger) deleteMessage(ctx context.Context, receiptHandle string) error {
+	_, err := t.client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(t.queueURL),
+		ReceiptHandle: aws.String(receiptHandle),
+	})
+	if err != nil {
+		log.Printf("Failed to delete SQS message: %v", err)
+		return fmt.Errorf("failed to delete SQS message: %w", err)
+	}
+	return nil
+}
+
+// parseMessage extracts the created objects for our bucket and prefixes from a
+// message body. Test events and other event types yield no objects.
+func (t *SQSTrigger) parseMessage(body string) ([]types.Object, error) {
+	var envelope snsEnvelope
+	if err := json.Unmarshal([]byte(body), &envelope); err == nil && envelope.Type == "Notification" {
+		body = envelope.Message
+	}
+
+	var event s3Event
+	if err := json.Unmarshal([]byte(body), &event); err != nil {
+		return nil, fmt.Errorf("failed to decode S3 event: %w", err)
+	}
+
+	var objects []types.Object
+	for _, r := range event.Records {
+		if !strings.HasPrefix(r.EventName, "ObjectCreated:") || r.S3.Bucket.Name != t.bucket {
+			continue
+		}
+		// Keys in event notifications are URL-encoded with '+' for spaces
+		key, err := url.QueryUnescape(r.S3.Object.Key)
+		if err != nil {
+			return objects, fmt.Errorf("failed to decode key %q: %w", r.S3.Object.Key, err)
+		}
+		if !t.accepts(key) {
+			continue
+		}
+		objects = append(objects, types.Object{
+			Key:          aws.String(key),
+			ETag:         aws.String(`"` + strings.Trim(r.S3.Object.ETag, `"`) + `"`),
+			Size:         aws.Int64(r.S3.Object.Size),
+			LastModified: aws.Time(r.EventTime),
+		})
+	}
+	return objects, nil
+}
+
+// accepts reports whether key is under one of the trigger's prefixes
+func (t *SQSTrigger) accepts(key string) bool {
+	for _, prefix := range t.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
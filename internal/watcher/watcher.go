@@ -0,0 +1,263 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"sava-s3-export/internal/database"
+)
+
+// Statuses given to downloaded records whose local file was changed by hand
+const (
+	StatusModified = "local_modified"
+	StatusDeleted  = "local_deleted"
+)
+
+// debounceWindow is how long a path must be quiet before its changes are
+// recorded, so a burst of writes by an editor becomes a single update
+const debounceWindow = 2 * time.Second
+
+// Store is the part of the sync database the watcher reads and updates
+type Store interface {
+	ScanRecords(ctx context.Context, fn func(database.FileRecord) error) error
+	BatchUpdate(s3Key, etag, localPath, status string, lastModified time.Time) error
+	FlushBatch() error
+}
+
+// Watcher watches LOCAL_DIR recursively for files changed outside the
+// syncer. When the file of a downloaded record is modified or deleted, the
+// record is marked StatusModified or StatusDeleted.
+type Watcher struct {
+	root    string
+	store   Store
+	ignored []string
+
+	mu sync.Mutex
+	// pending holds the time of the last event of each changed path
+	pending map[string]time.Time
+	// active counts the syncer's own writes in progress per path, and ended
+	// holds when the last of them finished; see Suppress
+	active map[string]int
+	ended  map[string]time.Time
+}
+
+// New creates a Watcher of root that records changes in store. Changes in
+// the ignored directories, such as the staging directory, are not watched.
+func New(root string, store Store, ignored ...string) *Watcher {
+	w := &Watcher{
+		root:    filepath.Clean(root),
+		store:   store,
+		pending: make(map[string]time.Time),
+		active:  make(map[string]int),
+		ended:   make(map[string]time.Time),
+	}
+	for _, dir := range ignored {
+		w.ignored = append(w.ignored, filepath.Clean(dir))
+	}
+	return w
+}
+
+// isIgnored reports whether path is, or lies below, an ignored directory
+func (w *Watcher) isIgnored(path string) bool {
+	path = filepath.Clean(path)
+	for _, dir := range w.ignored {
+		if path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Suppress ignores changes to path until the returned function is called and
+// for one debounce window after, so the syncer's own downloads, renames and
+// removals are not mistaken for manual changes. It is safe on a nil Watcher.
+func (w *Watcher) Suppress(path string) func() {
+	if w == nil {
+		return func() {}
+	}
+	path = filepath.Clean(path)
+
+	w.mu.Lock()
+	w.active[path]++
+	w.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			if w.active[path]--; w.active[path] <= 0 {
+				delete(w.active, path)
+			}
+			w.ended[path] = time.Now()
+		})
+	}
+}
+
+// Run watches until ctx is cancelled. Failing to start watching is returned;
+// later errors are only logged.
+func (w *Watcher) Run(ctx context.Context) error {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	defer fw.Close()
+
+	if err := os.MkdirAll(w.root, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", w.root, err)
+	}
+	if err := w.addTree(fw, w.root); err != nil {
+		return err
+	}
+	log.Printf("Watching %s for local modifications", w.root)
+
+	ticker := time.NewTicker(debounceWindow / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-fw.Events:
+			if !ok {
+				return nil
+			}
+			w.handle(fw, event)
+		case err, ok := <-fw.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("File watcher error: %v", err)
+		case <-ticker.C:
+			w.flush(ctx)
+		}
+	}
+}
+
+// addTree watches dir and every directory below it, since fsnotify only
+// reports changes to the direct children of a watched directory
+func (w *Watcher) addTree(fw *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if w.isIgnored(path) {
+			return filepath.SkipDir
+		}
+		if err := fw.Add(path); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// handle queues the path of event, and starts watching new directories
+func (w *Watcher) handle(fw *fsnotify.Watcher, event fsnotify.Event) {
+	if w.isIgnored(event.Name) {
+		return
+	}
+	if event.Has(fsnotify.Create) {
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			if err := w.addTree(fw, event.Name); err != nil {
+				log.Printf("%v", err)
+			}
+		}
+	}
+	if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) && !event.Has(fsnotify.Remove) && !event.Has(fsnotify.Rename) {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending[filepath.Clean(event.Name)] = time.Now()
+}
+
+// flush records the paths that have been quiet for a debounce window
+func (w *Watcher) flush(ctx context.Context) {
+	now := time.Now()
+	changed := make(map[string]bool)
+
+	w.mu.Lock()
+	for path, last := range w.pending {
+		if now.Sub(last) < debounceWindow {
+			continue
+		}
+		delete(w.pending, path)
+		if w.active[path] > 0 || !w.ended[path].Before(last.Add(-debounceWindow)) {
+			continue
+		}
+		changed[path] = true
+	}
+	for path, ended := range w.ended {
+		if w.active[path] == 0 && now.Sub(ended) > 2*debounceWindow {
+			delete(w.ended, path)
+		}
+	}
+	w.mu.Unlock()
+
+	if len(changed) > 0 {
+		if err := w.record(ctx, changed); err != nil {
+			log.Printf("Failed to record local modifications: %v", err)
+		}
+	}
+}
+
+// record marks the downloaded records whose file is, or lies below, one of
+// the changed paths. The local path is not indexed, so the database is
+// scanned once for the whole batch.
+func (w *Watcher) record(ctx context.Context, changed map[string]bool) error {
+	var matched []database.FileRecord
+	err := w.store.ScanRecords(ctx, func(r database.FileRecord) error {
+		if r.SyncStatus == "downloaded" && r.LocalPath != "" && isChanged(filepath.Clean(r.LocalPath), changed) {
+			matched = append(matched, r)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, r := range matched {
+		status := StatusModified
+		if _, err := os.Stat(r.LocalPath); errors.Is(err, fs.ErrNotExist) {
+			status = StatusDeleted
+		}
+		log.Printf("Local file %s of %s was changed outside the syncer, marking it %s", r.LocalPath, r.S3Key, status)
+		if err := w.store.BatchUpdate(r.S3Key, r.ETag, r.LocalPath, status, time.Unix(r.LastModified, 0)); err != nil {
+			return err
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+	return w.store.FlushBatch()
+}
+
+// isChanged reports whether path or one of its parent directories is in changed
+func isChanged(path string, changed map[string]bool) bool {
+	for p := path; ; {
+		if changed[p] {
+			return true
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return false
+		}
+		p = parent
+	}
+}